@@ -2,4 +2,8 @@ package main
 
 type contextKey string
 
-const isAuthenticatedContextKey = contextKey("isAuthenticated")
+const (
+	authenticatedUserContextKey = contextKey("authenticatedUser")
+	requestIDContextKey         = contextKey("requestID")
+	clientIPContextKey          = contextKey("clientIP")
+)
@@ -3,56 +3,315 @@ package main
 import (
 	"errors"
 	"fmt"
+	"html/template"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"snippetbox.prajjmon.net/internal/models"
+	"snippetbox.prajjmon.net/internal/totp"
 	"snippetbox.prajjmon.net/internal/validator"
 )
 
+// How many of the week's most starred snippets are listed on the home page.
+const mostStarredLimit = 5
+
+// A snippet along with the number of stars it has been given.
+type starredSnippet struct {
+	models.Snippet
+	Stars int
+}
+
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
-	snippets, err := app.snippets.Latest()
+	snippets, err := app.snippets.Latest(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	starred, err := app.stars.MostStarred(r.Context(), time.Now().Add(-7*24*time.Hour), mostStarredLimit)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
+	// The home page is the same for everyone, so only public snippets are listed. Private
+	// and organization snippets can be starred by the people they're shared with, in which
+	// case the list is just a little shorter.
+	var mostStarred []starredSnippet
+	for _, s := range starred {
+		snippet, err := app.snippets.Get(r.Context(), s.SnippetID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				continue
+			}
+			app.serverError(w, r, err)
+			return
+		}
+
+		if snippet.Hidden || snippet.Visibility != models.VisibilityPublic {
+			continue
+		}
+
+		mostStarred = append(mostStarred, starredSnippet{Snippet: snippet, Stars: s.Stars})
+	}
+
 	data := app.newTemplateData(r)
 	data.Snippets = snippets
+	data.MostStarred = mostStarred
 
 	app.render(w, r, http.StatusOK, "home.html", data)
 }
 
-func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
+// Returns the snippet in the {id} path segment and what the logged in user is allowed to do
+// with it, provided that they have at least the access that's needed. If they don't, or
+// there's no such snippet, an error response has already been sent and ok is false.
+func (app *application) accessibleSnippet(w http.ResponseWriter, r *http.Request, need accessLevel) (snippet models.Snippet, access accessLevel, ok bool) {
 	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil || id < 1 {
 		http.NotFound(w, r)
-		return
+		return models.Snippet{}, accessNone, false
 	}
 
-	snippet, err := app.snippets.Get(id)
+	return app.snippetWithAccess(w, r, id, need)
+}
+
+// Like accessibleSnippet, but for the snippet with the given ID.
+func (app *application) snippetWithAccess(w http.ResponseWriter, r *http.Request, id int, need accessLevel) (snippet models.Snippet, access accessLevel, ok bool) {
+	snippet, err := app.snippets.Get(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
 			http.NotFound(w, r)
 		} else {
 			app.serverError(w, r, err)
 		}
-		return
+		return models.Snippet{}, accessNone, false
+	}
+
+	// The snippet has been taken down, at least until a moderator has reviewed it.
+	if snippet.Hidden {
+		app.clientError(w, http.StatusGone)
+		return models.Snippet{}, accessNone, false
+	}
+
+	access, err = app.snippetAccess(r, snippet)
+	if err != nil {
+		app.serverError(w, r, err)
+		return models.Snippet{}, accessNone, false
+	}
+
+	switch {
+	case access == accessNone:
+		// Don't give away that the snippet exists to people who aren't allowed to see it.
+		http.NotFound(w, r)
+		return models.Snippet{}, accessNone, false
+	case access < need:
+		app.clientError(w, http.StatusForbidden)
+		return models.Snippet{}, accessNone, false
 	}
 
+	return snippet, access, true
+}
+
+// A user that a snippet has been shared with, along with their name and email address.
+type snippetShare struct {
+	models.Share
+	Name  string
+	Email string
+}
+
+// Returns the template data for a snippet's page. Its owners also get the list of people
+// that it has been shared with.
+func (app *application) newSnippetViewData(r *http.Request, snippet models.Snippet, access accessLevel) (templateData, error) {
 	data := app.newTemplateData(r)
 	data.Snippet = snippet
+	data.CanEdit = access >= accessEdit
+	data.OwnsSnippet = access == accessOwner
+	data.Form = snippetReportForm{}
+	data.ShareForm = snippetShareForm{Permission: models.ShareView}
+
+	if snippet.OrgID != 0 {
+		org, err := app.orgs.Get(r.Context(), snippet.OrgID)
+		if err != nil {
+			return templateData{}, err
+		}
+		data.Org = org
+	}
+
+	collections, err := app.collections.PublicForSnippet(r.Context(), snippet.ID)
+	if err != nil {
+		return templateData{}, err
+	}
+	data.SnippetCollections = collections
+
+	data.StarCount, err = app.stars.Count(r.Context(), snippet.ID)
+	if err != nil {
+		return templateData{}, err
+	}
+
+	// Logged in users can star the snippet and add it to one of their own collections.
+	if user, ok := app.authenticatedUser(r); ok {
+		data.Starred, err = app.stars.Exists(r.Context(), user.Id, snippet.ID)
+		if err != nil {
+			return templateData{}, err
+		}
+
+		collections, err := app.collections.ListForUser(r.Context(), user.Id)
+		if err != nil {
+			return templateData{}, err
+		}
+		data.Collections = collections
+	}
+
+	if access == accessOwner {
+		shares, err := app.shares.ListForSnippet(r.Context(), snippet.ID)
+		if err != nil {
+			return templateData{}, err
+		}
+
+		for _, s := range shares {
+			user, err := app.users.Get(r.Context(), s.UserID)
+			if err != nil {
+				return templateData{}, err
+			}
+
+			data.Shares = append(data.Shares, snippetShare{Share: s, Name: user.Name, Email: user.Email})
+		}
+	}
+
+	return data, nil
+}
+
+func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
+	snippet, access, ok := app.accessibleSnippet(w, r, accessView)
+	if !ok {
+		return
+	}
+
+	data, err := app.newSnippetViewData(r, snippet, access)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 
 	app.render(w, r, http.StatusOK, "view.html", data)
 }
 
+type snippetReportForm struct {
+	Reason              string `form:"reason"`
+	validator.Validator `form:"-"`
+}
+
+// Reports the snippet in the {id} path segment to the moderators. Anyone can do this, whether
+// or not they're logged in. Once the snippet has enough open reports it's hidden until a
+// moderator has looked at it.
+func (app *application) snippetReportPost(w http.ResponseWriter, r *http.Request) {
+	snippet, access, ok := app.accessibleSnippet(w, r, accessView)
+	if !ok {
+		return
+	}
+
+	id := snippet.ID
+
+	var form snippetReportForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Reason), "reason", "Please tell us what's wrong with this snippet")
+	form.CheckField(validator.MaxChars(form.Reason, 500), "reason", "Reason can't be more than 500 chars long")
+
+	if !form.Valid() {
+		data, err := app.newSnippetViewData(r, snippet, access)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "view.html", data)
+		return
+	}
+
+	// Anonymous reports are told apart by IP address instead.
+	user, _ := app.authenticatedUser(r)
+
+	// Reporting a snippet twice doesn't count twice, but there's no need to tell the reporter
+	// that.
+	_, err = app.reports.Insert(r.Context(), id, user.Id, clientIP(r), form.Reason)
+	if err != nil && !errors.Is(err, models.ErrDuplicateReport) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Thanks for your report. A moderator will take a look at this snippet.")
+
+	if app.reportThreshold > 0 {
+		count, err := app.reports.CountOpen(r.Context(), id)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if count >= app.reportThreshold {
+			err = app.snippets.SetHidden(r.Context(), id, true)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
+			err = app.audit(r, models.AuditEntry{
+				Action:     models.AuditSnippetHide,
+				TargetType: models.AuditTargetSnippet,
+				TargetID:   id,
+				Details:    map[string]string{"reason": "report threshold"},
+			})
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
+			// The snippet page would only say that it's gone.
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
 func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-	data.Form = snippetCreateForm{}
+	data, err := app.newSnippetCreateData(r, snippetCreateForm{Visibility: models.VisibilityPublic})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 
 	app.render(w, r, http.StatusOK, "create.html", data)
 }
 
+// Returns the template data for the create page, which needs the organizations that the
+// logged in user can create snippets under.
+func (app *application) newSnippetCreateData(r *http.Request, form snippetCreateForm) (templateData, error) {
+	user, _ := app.authenticatedUser(r)
+
+	orgs, err := app.orgs.ListForUser(r.Context(), user.Id)
+	if err != nil {
+		return templateData{}, err
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.Orgs = orgs
+
+	return data, nil
+}
+
 // Represents the form data and validation errors for the form fields.
 // Note that most of the struct fields are deliberately exported (i.e. start with a
 // capital letter). This is because struct fields must be exported in order to be read
@@ -63,8 +322,10 @@ func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
 // form input with the name "title" in the Title field. The struct tag `form:"-"` tells the
 // decoder to completely ignore a field during decoding.
 type snippetCreateForm struct {
-	Title               string `form:"title"`
-	Content             string `form:"content"`
+	Title               string            `form:"title"`
+	Content             string            `form:"content"`
+	OrgID               int               `form:"org"`
+	Visibility          models.Visibility `form:"visibility"`
 	validator.Validator `form:"-"`
 }
 
@@ -81,14 +342,49 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 	form.CheckField(validator.MaxChars(form.Title, 100), "title", "Title can't be more than 100 chars long")
 	form.CheckField(validator.NotBlank(form.Content), "content", "Content field can't be blank")
 
+	// Snippets are public unless the form says otherwise.
+	if form.Visibility == "" {
+		form.Visibility = models.VisibilityPublic
+	}
+
+	form.CheckField(form.Visibility.Valid(), "visibility", "Please choose who can see this snippet")
+	form.CheckField(form.OrgID != 0 || form.Visibility != models.VisibilityOrg, "visibility", "Only organization snippets can be limited to its members")
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	// Snippets can only be created under organizations which the user belongs to.
+	if form.OrgID != 0 {
+		_, err = app.orgs.MemberRole(r.Context(), form.OrgID, userID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+		form.CheckField(err == nil, "org", "You aren't a member of that organization")
+	}
+
 	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
+		data, err := app.newSnippetCreateData(r, form)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
 		app.render(w, r, http.StatusUnprocessableEntity, "create.html", data)
 		return
 	}
 
-	id, err := app.snippets.Insert(form.Title, form.Content)
+	id, err := app.snippets.Insert(r.Context(), userID, form.OrgID, form.Title, form.Content, form.Visibility)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.audit(r, models.AuditEntry{
+		Action:     models.AuditSnippetCreate,
+		TargetType: models.AuditTargetSnippet,
+		TargetID:   id,
+		Details:    map[string]string{"title": form.Title},
+	})
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -100,21 +396,38 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
 }
 
-type userSignupForm struct {
-	Name                string `form:"name"`
-	Email               string `form:"email"`
-	Password            string `form:"password"`
+type snippetEditForm struct {
+	Title               string            `form:"title"`
+	Content             string            `form:"content"`
+	Visibility          models.Visibility `form:"visibility"`
 	validator.Validator `form:"-"`
 }
 
-func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
+func (app *application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+	snippet, access, ok := app.accessibleSnippet(w, r, accessEdit)
+	if !ok {
+		return
+	}
+
 	data := app.newTemplateData(r)
-	data.Form = userSignupForm{}
-	app.render(w, r, http.StatusOK, "signup.html", data)
+	data.Snippet = snippet
+	data.OwnsSnippet = access == accessOwner
+	data.Form = snippetEditForm{
+		Title:      snippet.Title,
+		Content:    snippet.Content,
+		Visibility: snippet.Visibility,
+	}
+
+	app.render(w, r, http.StatusOK, "edit.html", data)
 }
 
-func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
-	var form userSignupForm
+func (app *application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	snippet, access, ok := app.accessibleSnippet(w, r, accessEdit)
+	if !ok {
+		return
+	}
+
+	var form snippetEditForm
 
 	err := app.decodePostForm(r, &form)
 	if err != nil {
@@ -122,53 +435,68 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Name), "name", "Name can't be blank")
-	form.CheckField(validator.NotBlank(form.Email), "email", "Email can't be blank")
-	form.CheckField(validator.IsValidEmail(form.Email), "email", "Email needs to be a valid email address")
-	form.CheckField(validator.NotBlank(form.Password), "password", "Password can't be blank")
-	form.CheckField(validator.MinChars(form.Password, 8), "password", "Password must be at least 8 characters long")
+	// Only the owners can change who can see the snippet. The people it has been shared with
+	// can still edit everything else.
+	if access < accessOwner {
+		form.Visibility = snippet.Visibility
+	}
+
+	form.CheckField(validator.NotBlank(form.Title), "title", "Title can't be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "Title can't be more than 100 chars long")
+	form.CheckField(validator.NotBlank(form.Content), "content", "Content field can't be blank")
+	form.CheckField(form.Visibility.Valid(), "visibility", "Please choose who can see this snippet")
+	form.CheckField(snippet.OrgID != 0 || form.Visibility != models.VisibilityOrg, "visibility", "Only organization snippets can be limited to its members")
 
 	if !form.Valid() {
 		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.OwnsSnippet = access == accessOwner
 		data.Form = form
-		app.render(w, r, http.StatusUnprocessableEntity, "signup.html", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "edit.html", data)
 		return
 	}
 
-	err = app.users.Insert(form.Name, form.Email, form.Password)
+	err = app.snippets.Update(r.Context(), snippet.ID, form.Title, form.Content, form.Visibility)
 	if err != nil {
-		if errors.Is(err, models.ErrDuplicateEmail) {
-			form.AddFieldError("email", "Email address is already in use")
-
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.render(w, r, http.StatusUnprocessableEntity, "signup.html", data)
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
 		} else {
 			app.serverError(w, r, err)
 		}
+		return
+	}
 
+	err = app.audit(r, models.AuditEntry{
+		Action:     models.AuditSnippetEdit,
+		TargetType: models.AuditTargetSnippet,
+		TargetID:   snippet.ID,
+		Details:    map[string]string{"title": form.Title},
+	})
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful! Please log in")
+	app.sessionManager.Put(r.Context(), "flash", "Snippet updated successfully!")
 
-	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
 }
 
-type userLoginForm struct {
-	Email               string `form:"email"`
-	Password            string `form:"password"`
+type snippetShareForm struct {
+	Email               string                 `form:"email"`
+	Permission          models.SharePermission `form:"permission"`
 	validator.Validator `form:"-"`
 }
 
-func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-	data.Form = userLoginForm{}
-	app.render(w, r, http.StatusOK, "login.html", data)
-}
+// Shares the snippet in the {id} path segment with the user who has the given email address,
+// or changes what they're allowed to do with it. Only the snippet's owners can share it.
+func (app *application) snippetSharePost(w http.ResponseWriter, r *http.Request) {
+	snippet, access, ok := app.accessibleSnippet(w, r, accessOwner)
+	if !ok {
+		return
+	}
 
-func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
-	var form userLoginForm
+	var form snippetShareForm
 
 	err := app.decodePostForm(r, &form)
 	if err != nil {
@@ -176,59 +504,2943 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	form.Email = strings.TrimSpace(form.Email)
+
 	form.CheckField(validator.NotBlank(form.Email), "email", "Email can't be blank")
-	form.CheckField(validator.IsValidEmail(form.Email), "email", "Email needs to be a valid email address")
-	form.CheckField(validator.NotBlank(form.Password), "password", "Password can't be blank")
+	form.CheckField(validator.IsValidEmail(form.Email), "email", "This field must be a valid email address")
+	form.CheckField(form.Permission.Valid(), "permission", "Please choose what they can do")
+
+	var user models.User
+	if form.Valid() {
+		user, err = app.users.GetByEmail(r.Context(), form.Email)
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			form.AddFieldError("email", "There's no account with that email address")
+		case err != nil:
+			app.serverError(w, r, err)
+			return
+		case user.Id == snippet.UserID:
+			form.AddFieldError("email", "That's the snippet's owner")
+		}
+	}
 
 	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
-		app.render(w, r, http.StatusUnprocessableEntity, "login.html", data)
+		data, err := app.newSnippetViewData(r, snippet, access)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		data.ShareForm = form
+		app.render(w, r, http.StatusUnprocessableEntity, "view.html", data)
 		return
 	}
 
-	id, err := app.users.Authenticate(form.Email, form.Password)
+	err = app.shares.Set(r.Context(), snippet.ID, user.Id, form.Permission)
 	if err != nil {
-		if errors.Is(err, models.ErrInvalidCredentials) {
-			form.AddNonFieldError("Email or password is incorrect")
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.render(w, r, http.StatusUnprocessableEntity, "login.html", data)
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.audit(r, models.AuditEntry{
+		Action:     models.AuditSnippetShare,
+		TargetType: models.AuditTargetSnippet,
+		TargetID:   snippet.ID,
+		Details:    map[string]string{"email": user.Email, "permission": string(form.Permission)},
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet shared with "+user.Email)
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+type snippetUnshareForm struct {
+	UserID int `form:"user"`
+}
+
+// Stops sharing the snippet in the {id} path segment with a user. Only the snippet's owners
+// can do this.
+func (app *application) snippetUnsharePost(w http.ResponseWriter, r *http.Request) {
+	snippet, _, ok := app.accessibleSnippet(w, r, accessOwner)
+	if !ok {
+		return
+	}
+
+	var form snippetUnshareForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.users.Get(r.Context(), form.UserID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
 		} else {
 			app.serverError(w, r, err)
 		}
+		return
+	}
 
+	err = app.shares.Delete(r.Context(), snippet.ID, user.Id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
 		return
 	}
 
-	// Use the RenewToken() method on the current session to change the session ID. It's good practice to generate a new session ID when the authentication state or privilege levels  changes for the user (e.g. login and logout operations)
-	err = app.sessionManager.RenewToken(r.Context())
+	err = app.audit(r, models.AuditEntry{
+		Action:     models.AuditSnippetUnshare,
+		TargetType: models.AuditTargetSnippet,
+		TargetID:   snippet.ID,
+		Details:    map[string]string{"email": user.Email},
+	})
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
-	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+	app.sessionManager.Put(r.Context(), "flash", "Snippet no longer shared with "+user.Email)
 
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
 }
 
-func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
+// A snippet which has been shared with the logged in user, and what they're allowed to do
+// with it.
+type sharedSnippet struct {
+	models.Snippet
+	Permission models.SharePermission
+}
 
-	// Good practice to renew the session ID again
-	err := app.sessionManager.RenewToken(r.Context())
+// Lists the snippets which other people have shared with the logged in user.
+func (app *application) snippetsShared(w http.ResponseWriter, r *http.Request) {
+	user, _ := app.authenticatedUser(r)
+
+	shares, err := app.shares.ListForUser(r.Context(), user.Id)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+	var snippets []sharedSnippet
+	for _, share := range shares {
+		snippet, err := app.snippets.Get(r.Context(), share.SnippetID)
+		if err != nil {
+			// Expired snippets stay shared until they're deleted, but there's nothing to see.
+			if errors.Is(err, models.ErrNoRecord) {
+				continue
+			}
+			app.serverError(w, r, err)
+			return
+		}
 
-	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully")
+		if snippet.Hidden {
+			continue
+		}
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+		snippets = append(snippets, sharedSnippet{Snippet: snippet, Permission: share.Permission})
+	}
+
+	data := app.newTemplateData(r)
+	data.SharedSnippets = snippets
+
+	app.render(w, r, http.StatusOK, "shared.html", data)
+}
+
+// Stars the snippet in the {id} path segment for the logged in user, who needs to be able to
+// see it. Starring a snippet twice does nothing.
+func (app *application) snippetStarPost(w http.ResponseWriter, r *http.Request) {
+	snippet, _, ok := app.accessibleSnippet(w, r, accessView)
+	if !ok {
+		return
+	}
+
+	user, _ := app.authenticatedUser(r)
+
+	err := app.stars.Insert(r.Context(), user.Id, snippet.ID)
+	if err != nil && !errors.Is(err, models.ErrDuplicateStar) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet starred")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// Removes the logged in user's star from the snippet in the {id} path segment.
+func (app *application) snippetUnstarPost(w http.ResponseWriter, r *http.Request) {
+	snippet, _, ok := app.accessibleSnippet(w, r, accessView)
+	if !ok {
+		return
+	}
+
+	user, _ := app.authenticatedUser(r)
+
+	err := app.stars.Delete(r.Context(), user.Id, snippet.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet unstarred")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// Lists the snippets which the logged in user has starred, most recently starred first.
+// Snippets which they can no longer see are left out, but keep their stars in case they
+// become visible again.
+func (app *application) snippetsStarred(w http.ResponseWriter, r *http.Request) {
+	user, _ := app.authenticatedUser(r)
+
+	stars, err := app.stars.ListForUser(r.Context(), user.Id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var snippets []models.Snippet
+	for _, star := range stars {
+		snippet, err := app.snippets.Get(r.Context(), star.SnippetID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				continue
+			}
+			app.serverError(w, r, err)
+			return
+		}
+
+		if snippet.Hidden {
+			continue
+		}
+
+		access, err := app.snippetAccess(r, snippet)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if access == accessNone {
+			continue
+		}
+
+		snippets = append(snippets, snippet)
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+
+	app.render(w, r, http.StatusOK, "stars.html", data)
+}
+
+type shareLinkForm struct {
+	Expires             int `form:"expires"`
+	MaxViews            int `form:"max_views"`
+	validator.Validator `form:"-"`
+}
+
+// Renders the settings page for the snippet, where its owners can manage its share links.
+func (app *application) renderSnippetSettings(w http.ResponseWriter, r *http.Request, status int, snippet models.Snippet, form shareLinkForm) {
+	links, err := app.links.ListForSnippet(r.Context(), snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.ShareLinks = links
+	data.Form = form
+
+	app.render(w, r, status, "settings.html", data)
+}
+
+func (app *application) snippetSettings(w http.ResponseWriter, r *http.Request) {
+	snippet, _, ok := app.accessibleSnippet(w, r, accessOwner)
+	if !ok {
+		return
+	}
+
+	app.renderSnippetSettings(w, r, http.StatusOK, snippet, shareLinkForm{Expires: 7})
+}
+
+// Creates a link which lets anyone who has it see the snippet in the {id} path segment,
+// without an account. The link's token is only shown once, in the flash message, since only
+// its hash is stored.
+func (app *application) shareLinkCreatePost(w http.ResponseWriter, r *http.Request) {
+	snippet, _, ok := app.accessibleSnippet(w, r, accessOwner)
+	if !ok {
+		return
+	}
+
+	var form shareLinkForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if snippet.Visibility == models.VisibilityPublic {
+		form.AddNonFieldError("Public snippets can already be seen by anyone with their address")
+	}
+
+	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 30), "expires", "This field must equal 1, 7 or 30")
+	form.CheckField(form.MaxViews >= 0 && form.MaxViews <= 1000, "max_views", "This field must be between 0 and 1000")
+
+	if !form.Valid() {
+		app.renderSnippetSettings(w, r, http.StatusUnprocessableEntity, snippet, form)
+		return
+	}
+
+	token, err := app.links.Insert(r.Context(), snippet.ID, time.Duration(form.Expires)*24*time.Hour, form.MaxViews)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	linkID, _, _ := models.ParseShareLinkToken(token)
+
+	err = app.audit(r, models.AuditEntry{
+		Action:     models.AuditShareLinkCreate,
+		TargetType: models.AuditTargetSnippet,
+		TargetID:   snippet.ID,
+		Details: map[string]string{
+			"link":      strconv.Itoa(linkID),
+			"expires":   strconv.Itoa(form.Expires) + "d",
+			"max_views": strconv.Itoa(form.MaxViews),
+		},
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Share link created. Copy it now, because it won't be shown again: "+app.baseURL+"/snippet/link/"+token)
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/settings/%d", snippet.ID), http.StatusSeeOther)
+}
+
+type shareLinkRevokeForm struct {
+	LinkID int `form:"link"`
+}
+
+// Revokes one of the share links for the snippet in the {id} path segment.
+func (app *application) shareLinkRevokePost(w http.ResponseWriter, r *http.Request) {
+	snippet, _, ok := app.accessibleSnippet(w, r, accessOwner)
+	if !ok {
+		return
+	}
+
+	var form shareLinkRevokeForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.links.Delete(r.Context(), snippet.ID, form.LinkID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.audit(r, models.AuditEntry{
+		Action:     models.AuditShareLinkRevoke,
+		TargetType: models.AuditTargetSnippet,
+		TargetID:   snippet.ID,
+		Details:    map[string]string{"link": strconv.Itoa(form.LinkID)},
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The share link has been revoked")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/settings/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// Shows the snippet that the share link in the {token} path segment is for, whoever is (or
+// isn't) logged in. Each request counts as one of the link's views.
+func (app *application) shareLinkView(w http.ResponseWriter, r *http.Request) {
+	token := r.PathValue("token")
+
+	// Make sure the snippet can still be shown before counting a view, so that a link to a
+	// snippet which has expired or been hidden doesn't use up its views.
+	snippetID, err := app.links.Check(r.Context(), token)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), snippetID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if snippet.Hidden {
+		app.clientError(w, http.StatusGone)
+		return
+	}
+
+	// The link may have been used up by someone else since we checked it.
+	_, err = app.links.Use(r.Context(), token)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.ViaShareLink = true
+
+	app.render(w, r, http.StatusOK, "view.html", data)
+}
+
+type userSignupForm struct {
+	Name                string `form:"name"`
+	Email               string `form:"email"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userSignupForm{}
+	app.render(w, r, http.StatusOK, "signup.html", data)
+}
+
+func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
+	var form userSignupForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "Name can't be blank")
+	form.CheckField(validator.NotBlank(form.Email), "email", "Email can't be blank")
+	form.CheckField(validator.IsValidEmail(form.Email), "email", "Email needs to be a valid email address")
+	form.CheckField(validator.NotBlank(form.Password), "password", "Password can't be blank")
+
+	err = app.checkPasswordPolicy(&form.Validator, "password", form.Password, form.Name, form.Email)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "signup.html", data)
+		return
+	}
+
+	id, err := app.users.Insert(r.Context(), form.Name, form.Email, form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			form.AddFieldError("email", "Email address is already in use")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "signup.html", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.audit(r, models.AuditEntry{
+		ActorID:    id,
+		Action:     models.AuditSignup,
+		TargetType: models.AuditTargetUser,
+		TargetID:   id,
+		Details:    map[string]string{"email": form.Email},
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.sendVerificationEmail(r, models.User{Id: id, Name: form.Name, Email: form.Email})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful! We've sent you an email to confirm your address. Please log in")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+type userLoginForm struct {
+	Email               string `form:"email"`
+	Password            string `form:"password"`
+	RememberMe          bool   `form:"remember_me"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userLoginForm{}
+	app.render(w, r, http.StatusOK, "login.html", data)
+}
+
+func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
+	var form userLoginForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "Email can't be blank")
+	form.CheckField(validator.IsValidEmail(form.Email), "email", "Email needs to be a valid email address")
+	form.CheckField(validator.NotBlank(form.Password), "password", "Password can't be blank")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "login.html", data)
+		return
+	}
+
+	// Count the attempt before Authenticate, so that throttled attempts don't cost us a
+	// password hash comparison.
+	attempt, wait, locked, err := app.startLoginAttempt(r.Context(),
+		throttleKey{emailThrottle, strings.ToLower(form.Email)},
+		throttleKey{ipThrottle, clientIP(r)},
+	)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if wait > 0 {
+		app.metrics.logins.WithLabelValues("throttled").Inc()
+
+		form.AddNonFieldError(throttleMessage(wait, locked))
+		data := app.newTemplateData(r)
+		data.Form = form
+		setRetryAfter(w, wait)
+		app.render(w, r, http.StatusTooManyRequests, "login.html", data)
+		return
+	}
+
+	id, err := app.users.Authenticate(r.Context(), form.Email, form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.metrics.logins.WithLabelValues("failure").Inc()
+			app.failLoginAttempt(r, attempt)
+
+			err = app.auditLoginFailure(r, form.Email, "wrong password")
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
+			form.AddNonFieldError("Email or password is incorrect")
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "login.html", data)
+		} else if errors.Is(err, models.ErrAccountDisabled) {
+			app.metrics.logins.WithLabelValues("disabled").Inc()
+
+			// The password was right, so this isn't a guess.
+			err = app.cancelLoginAttempt(r.Context(), attempt)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
+			err = app.auditLoginFailure(r, form.Email, "account disabled")
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
+			form.AddNonFieldError("Your account has been disabled")
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusForbidden, "login.html", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.succeedLoginAttempt(r.Context(), attempt)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// If the user has turned on two-factor authentication, their password alone isn't
+	// enough. Remember who they are (but without logging them in) and ask for a code.
+	_, err = app.mfa.GetSecret(r.Context(), id)
+	if err == nil {
+		err = app.sessionManager.RenewToken(r.Context())
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.sessionManager.Put(r.Context(), "pendingMFAUserID", id)
+		app.sessionManager.Put(r.Context(), "pendingMFAExpiry", time.Now().Add(pendingMFATTL).Unix())
+		app.sessionManager.Put(r.Context(), "pendingMFARememberMe", form.RememberMe)
+
+		http.Redirect(w, r, "/user/login/mfa", http.StatusSeeOther)
+		return
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.completeLogin(w, r, id, form.RememberMe)
+}
+
+// Logs the user in, once they have given us everything we need to be sure who they are. If
+// rememberMe is true the login survives the browser being closed, and lasts for the session
+// manager's full lifetime.
+func (app *application) completeLogin(w http.ResponseWriter, r *http.Request, id int, rememberMe bool) {
+	// Use the RenewToken() method on the current session to change the session ID. It's good practice to generate a new session ID when the authentication state or privilege levels  changes for the user (e.g. login and logout operations)
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Record where the user has logged in from, so that they can see the session on their
+	// account page and revoke it if they don't recognise it.
+	lifetime := app.sessionLifetime
+	if rememberMe {
+		lifetime = app.sessionManager.Lifetime
+	}
+
+	expires := time.Now().Add(lifetime)
+
+	sessionID, err := app.userSessions.Insert(r.Context(), id, clientIP(r), userAgent(r), expires)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.audit(r, models.AuditEntry{ActorID: id, Action: models.AuditLogin, TargetType: models.AuditTargetUser, TargetID: id})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
+	app.sessionManager.Put(r.Context(), "sessionID", sessionID)
+	app.sessionManager.Put(r.Context(), "rememberMe", rememberMe)
+	app.sessionManager.RememberMe(r.Context(), rememberMe)
+	app.metrics.logins.WithLabelValues("success").Inc()
+
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+// How long a user has to enter their two-factor authentication code after entering their
+// password.
+const pendingMFATTL = 5 * time.Minute
+
+// Returns the ID of the user who is part-way through logging in with two-factor
+// authentication, provided that they haven't taken too long about it.
+func (app *application) pendingMFAUserID(r *http.Request) (int, bool) {
+	id := app.sessionManager.GetInt(r.Context(), "pendingMFAUserID")
+	expiry := app.sessionManager.GetInt64(r.Context(), "pendingMFAExpiry")
+
+	if id == 0 || time.Now().Unix() > expiry {
+		return 0, false
+	}
+
+	return id, true
+}
+
+type userLoginMFAForm struct {
+	Code                string `form:"code"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) userLoginMFA(w http.ResponseWriter, r *http.Request) {
+	if _, ok := app.pendingMFAUserID(r); !ok {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = userLoginMFAForm{}
+	app.render(w, r, http.StatusOK, "login_mfa.html", data)
+}
+
+func (app *application) userLoginMFAPost(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.pendingMFAUserID(r)
+	if !ok {
+		app.sessionManager.Put(r.Context(), "flash", "Your login has expired. Please enter your password again")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	var form userLoginMFAForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Code), "code", "Code can't be blank")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "login_mfa.html", data)
+		return
+	}
+
+	attempt, wait, locked, err := app.startLoginAttempt(r.Context(), throttleKey{mfaThrottle, strconv.Itoa(id)})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if wait > 0 {
+		app.metrics.logins.WithLabelValues("throttled").Inc()
+
+		form.AddFieldError("code", throttleMessage(wait, locked))
+		data := app.newTemplateData(r)
+		data.Form = form
+		setRetryAfter(w, wait)
+		app.render(w, r, http.StatusTooManyRequests, "login_mfa.html", data)
+		return
+	}
+
+	secret, err := app.mfa.GetSecret(r.Context(), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Accept either a code from the user's authenticator app or one of their recovery
+	// codes. Both can only be used once.
+	code := strings.ReplaceAll(form.Code, " ", "")
+	if step, ok := totp.Validate(secret, code, time.Now()); ok {
+		err = app.mfa.RecordStep(r.Context(), id, step)
+	} else {
+		err = app.mfa.UseRecoveryCode(r.Context(), id, code)
+	}
+
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.metrics.logins.WithLabelValues("failure").Inc()
+			app.failLoginAttempt(r, attempt)
+
+			err = app.audit(r, models.AuditEntry{
+				Action:     models.AuditLoginFailed,
+				TargetType: models.AuditTargetUser,
+				TargetID:   id,
+				Details:    map[string]string{"reason": "wrong code"},
+			})
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
+			form.AddFieldError("code", "Code is incorrect")
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "login_mfa.html", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.succeedLoginAttempt(r.Context(), attempt)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), "pendingMFAUserID")
+	app.sessionManager.Remove(r.Context(), "pendingMFAExpiry")
+
+	rememberMe := app.sessionManager.PopBool(r.Context(), "pendingMFARememberMe")
+
+	app.completeLogin(w, r, id, rememberMe)
+}
+
+func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err := app.userSessions.Delete(r.Context(), userID, app.sessionManager.GetString(r.Context(), "sessionID"))
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.audit(r, models.AuditEntry{Action: models.AuditLogout, TargetType: models.AuditTargetUser, TargetID: userID})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Good practice to renew the session ID again
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+	app.sessionManager.Remove(r.Context(), "sessionID")
+
+	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// How long a password reset link remains valid for.
+const passwordResetTTL = time.Hour
+
+type passwordForgotForm struct {
+	Email               string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) passwordForgot(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = passwordForgotForm{}
+	app.render(w, r, http.StatusOK, "password_forgot.html", data)
+}
+
+func (app *application) passwordForgotPost(w http.ResponseWriter, r *http.Request) {
+	var form passwordForgotForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "Email can't be blank")
+	form.CheckField(validator.IsValidEmail(form.Email), "email", "Email needs to be a valid email address")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "password_forgot.html", data)
+		return
+	}
+
+	// We send the same response whether or not there is an account with this email address,
+	// so that the form can't be used to find out who has an account.
+	user, err := app.users.GetByEmail(r.Context(), form.Email)
+	if err == nil {
+		// Only the most recently requested link should work.
+		err = app.tokens.DeleteAllForUser(r.Context(), user.Id, models.ScopePasswordReset)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		token, err := app.tokens.New(r.Context(), user.Id, passwordResetTTL, models.ScopePasswordReset)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		emailData := map[string]any{
+			"Name":     user.Name,
+			"ResetURL": app.baseURL + "/user/password/reset/" + token,
+			"TTL":      "1 hour",
+		}
+
+		// Send the email in the background, so that the response time doesn't give away
+		// whether the address belongs to an account.
+		logger := app.requestLogger(r)
+		app.background(func() {
+			err := app.mailer.Send(user.Email, "password_reset.tmpl", emailData)
+			if err != nil {
+				logger.Error(err.Error())
+			}
+		})
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "If there is an account with that email address, we've sent it a link to reset your password")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+type passwordResetForm struct {
+	Token               string `form:"-"`
+	Password            string `form:"password"`
+	ConfirmPassword     string `form:"confirm_password"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) passwordReset(w http.ResponseWriter, r *http.Request) {
+	form := passwordResetForm{Token: r.PathValue("token")}
+	status := http.StatusOK
+
+	// Check the token up front so that we can tell the user straight away if the link is no
+	// good, rather than after they've chosen a new password. An empty Token tells the
+	// template to show the "invalid link" message instead of the form.
+	_, err := app.tokens.GetUserID(r.Context(), form.Token, models.ScopePasswordReset)
+	if err != nil {
+		if !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+		form.Token = ""
+		status = http.StatusNotFound
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	app.render(w, r, status, "password_reset.html", data)
+}
+
+func (app *application) passwordResetPost(w http.ResponseWriter, r *http.Request) {
+	form := passwordResetForm{Token: r.PathValue("token")}
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Look up who the token belongs to (without using it up yet), so that we can check that
+	// their new password doesn't contain their name or email address.
+	userID, err := app.tokens.GetUserID(r.Context(), form.Token, models.ScopePasswordReset)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			data := app.newTemplateData(r)
+			data.Form = passwordResetForm{}
+			app.render(w, r, http.StatusNotFound, "password_reset.html", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.users.Get(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "Password can't be blank")
+	form.CheckField(form.Password == form.ConfirmPassword, "confirmPassword", "Passwords don't match")
+
+	err = app.checkPasswordPolicy(&form.Validator, "password", form.Password, user.Name, user.Email)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "password_reset.html", data)
+		return
+	}
+
+	// Only use up the token once we know that the new password is acceptable.
+	userID, err = app.tokens.Consume(r.Context(), form.Token, models.ScopePasswordReset)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			data := app.newTemplateData(r)
+			data.Form = passwordResetForm{}
+			app.render(w, r, http.StatusNotFound, "password_reset.html", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.users.UpdatePassword(r.Context(), userID, form.Password)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.audit(r, models.AuditEntry{
+		ActorID:    userID,
+		Action:     models.AuditPasswordChange,
+		TargetType: models.AuditTargetUser,
+		TargetID:   userID,
+		Details:    map[string]string{"method": "reset"},
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Invalidate any other outstanding reset links, and sign the user out everywhere else in
+	// case someone else had got into their account.
+	err = app.tokens.DeleteAllForUser(r.Context(), userID, models.ScopePasswordReset)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.destroyUserSessions(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your password has been reset. Please log in")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// How long an email verification link remains valid for.
+const emailVerificationTTL = 72 * time.Hour
+
+// Creates a new email verification token for the user (replacing any existing ones) and sends
+// them a link containing it.
+func (app *application) sendVerificationEmail(r *http.Request, user models.User) error {
+	err := app.tokens.DeleteAllForUser(r.Context(), user.Id, models.ScopeEmailVerification)
+	if err != nil {
+		return err
+	}
+
+	token, err := app.tokens.New(r.Context(), user.Id, emailVerificationTTL, models.ScopeEmailVerification)
+	if err != nil {
+		return err
+	}
+
+	emailData := map[string]any{
+		"Name":      user.Name,
+		"VerifyURL": app.baseURL + "/user/verify/" + token,
+		"TTL":       "3 days",
+	}
+
+	logger := app.requestLogger(r)
+	app.background(func() {
+		err := app.mailer.Send(user.Email, "email_verification.tmpl", emailData)
+		if err != nil {
+			logger.Error(err.Error())
+		}
+	})
+
+	return nil
+}
+
+func (app *application) userVerify(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.tokens.Consume(r.Context(), r.PathValue("token"), models.ScopeEmailVerification)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.render(w, r, http.StatusNotFound, "verify.html", app.newTemplateData(r))
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.users.SetVerified(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.tokens.DeleteAllForUser(r.Context(), userID, models.ScopeEmailVerification)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Thanks, your email address has been verified")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *application) userVerifyResendPost(w http.ResponseWriter, r *http.Request) {
+	user, err := app.users.Get(r.Context(), app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if user.Verified {
+		app.sessionManager.Put(r.Context(), "flash", "Your email address has already been verified")
+	} else {
+		err = app.sendVerificationEmail(r, user)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.sessionManager.Put(r.Context(), "flash", "We've sent a new verification link to "+user.Email)
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *application) accountView(w http.ResponseWriter, r *http.Request) {
+	user, err := app.users.Get(r.Context(), app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	_, err = app.mfa.GetSecret(r.Context(), user.Id)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+	mfaEnabled := err == nil
+
+	remaining, err := app.mfa.RecoveryCodesRemaining(r.Context(), user.Id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	orgs, err := app.orgs.ListForUser(r.Context(), user.Id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	collections, err := app.collections.ListForUser(r.Context(), user.Id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.User = user
+	data.MFAEnabled = mfaEnabled
+	data.Orgs = orgs
+	data.Collections = collections
+	data.RecoveryCodesRemaining = remaining
+
+	app.render(w, r, http.StatusOK, "account.html", data)
+}
+
+type accountNameUpdateForm struct {
+	Name                string `form:"name"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) accountNameUpdate(w http.ResponseWriter, r *http.Request) {
+	user, err := app.users.Get(r.Context(), app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = accountNameUpdateForm{Name: user.Name}
+	app.render(w, r, http.StatusOK, "account_name.html", data)
+}
+
+func (app *application) accountNameUpdatePost(w http.ResponseWriter, r *http.Request) {
+	var form accountNameUpdateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "Name can't be blank")
+	form.CheckField(validator.MaxChars(form.Name, 255), "name", "Name can't be more than 255 chars long")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "account_name.html", data)
+		return
+	}
+
+	err = app.users.UpdateName(r.Context(), app.sessionManager.GetInt(r.Context(), "authenticatedUserID"), form.Name)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your name has been updated")
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+type accountEmailUpdateForm struct {
+	Email               string `form:"email"`
+	CurrentPassword     string `form:"current_password"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) accountEmailUpdate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = accountEmailUpdateForm{}
+	app.render(w, r, http.StatusOK, "account_email.html", data)
+}
+
+func (app *application) accountEmailUpdatePost(w http.ResponseWriter, r *http.Request) {
+	var form accountEmailUpdateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "Email can't be blank")
+	form.CheckField(validator.IsValidEmail(form.Email), "email", "Email needs to be a valid email address")
+	form.CheckField(validator.NotBlank(form.CurrentPassword), "currentPassword", "Current password can't be blank")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "account_email.html", data)
+		return
+	}
+
+	user, err := app.users.Get(r.Context(), app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	attempt, wait, locked, err := app.startPasswordCheck(r, user)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if wait > 0 {
+		form.AddFieldError("currentPassword", throttleMessage(wait, locked))
+		data := app.newTemplateData(r)
+		data.Form = form
+		setRetryAfter(w, wait)
+		app.render(w, r, http.StatusTooManyRequests, "account_email.html", data)
+		return
+	}
+
+	// Ask for the password before changing the address, as whoever controls the email address
+	// can reset the password and so take over the account.
+	_, err = app.users.Authenticate(r.Context(), user.Email, form.CurrentPassword)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.failLoginAttempt(r, attempt)
+			form.AddFieldError("currentPassword", "Current password is incorrect")
+		} else {
+			app.serverError(w, r, err)
+			return
+		}
+	} else {
+		err = app.succeedLoginAttempt(r.Context(), attempt)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if form.Valid() && form.Email != user.Email {
+		err = app.users.UpdateEmail(r.Context(), user.Id, form.Email)
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			form.AddFieldError("email", "Email address is already in use")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "account_email.html", data)
+		return
+	}
+
+	if form.Email == user.Email {
+		http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+		return
+	}
+
+	// Let the old address know about the change, in case it wasn't the account owner who
+	// made it.
+	oldEmail := user.Email
+	emailData := map[string]any{
+		"Name":     user.Name,
+		"NewEmail": form.Email,
+	}
+
+	logger := app.requestLogger(r)
+	app.background(func() {
+		err := app.mailer.Send(oldEmail, "email_changed.tmpl", emailData)
+		if err != nil {
+			logger.Error(err.Error())
+		}
+	})
+
+	user.Email = form.Email
+
+	err = app.sendVerificationEmail(r, user)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your email address has been changed. We've sent a verification link to "+user.Email)
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+type accountPasswordUpdateForm struct {
+	CurrentPassword     string `form:"current_password"`
+	NewPassword         string `form:"new_password"`
+	ConfirmPassword     string `form:"confirm_password"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) accountPasswordUpdate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = accountPasswordUpdateForm{}
+	app.render(w, r, http.StatusOK, "account_password.html", data)
+}
+
+func (app *application) accountPasswordUpdatePost(w http.ResponseWriter, r *http.Request) {
+	var form accountPasswordUpdateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.CurrentPassword), "currentPassword", "Current password can't be blank")
+	form.CheckField(validator.NotBlank(form.NewPassword), "newPassword", "New password can't be blank")
+	form.CheckField(form.NewPassword == form.ConfirmPassword, "confirmPassword", "Passwords don't match")
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	user, err := app.users.Get(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.checkPasswordPolicy(&form.Validator, "newPassword", form.NewPassword, user.Name, user.Email)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "account_password.html", data)
+		return
+	}
+
+	attempt, wait, locked, err := app.startPasswordCheck(r, user)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if wait > 0 {
+		form.AddFieldError("currentPassword", throttleMessage(wait, locked))
+		data := app.newTemplateData(r)
+		data.Form = form
+		setRetryAfter(w, wait)
+		app.render(w, r, http.StatusTooManyRequests, "account_password.html", data)
+		return
+	}
+
+	err = app.users.ChangePassword(r.Context(), userID, form.CurrentPassword, form.NewPassword)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.failLoginAttempt(r, attempt)
+			form.AddFieldError("currentPassword", "Current password is incorrect")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "account_password.html", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.succeedLoginAttempt(r.Context(), attempt)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.audit(r, models.AuditEntry{
+		Action:     models.AuditPasswordChange,
+		TargetType: models.AuditTargetUser,
+		TargetID:   userID,
+		Details:    map[string]string{"method": "change"},
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Sign the user out of their other sessions, which may belong to whoever prompted them
+	// to change their password.
+	err = app.destroyUserSessions(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your password has been updated")
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+// The issuer name which authenticator apps show next to the user's account.
+const totpIssuer = "Snippetbox"
+
+type accountMFASetupForm struct {
+	Code                string       `form:"code"`
+	Secret              string       `form:"-"`
+	URI                 template.URL `form:"-"`
+	QRCode              template.URL `form:"-"`
+	validator.Validator `form:"-"`
+}
+
+// Fills in the details that the user needs to add the secret to their authenticator app.
+func (app *application) newAccountMFASetupForm(r *http.Request, secret string) (accountMFASetupForm, error) {
+	user, err := app.users.Get(r.Context(), app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	if err != nil {
+		return accountMFASetupForm{}, err
+	}
+
+	uri := totp.ProvisioningURI(secret, totpIssuer, user.Email)
+
+	qrCode, err := qrCodeDataURI(uri)
+	if err != nil {
+		return accountMFASetupForm{}, err
+	}
+
+	// The provisioning URI uses the otpauth scheme, which html/template doesn't trust by
+	// default. It's built from our own values, so it's safe to link to.
+	return accountMFASetupForm{Secret: secret, URI: template.URL(uri), QRCode: qrCode}, nil
+}
+
+func (app *application) accountMFASetup(w http.ResponseWriter, r *http.Request) {
+	_, err := app.mfa.GetSecret(r.Context(), app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	if err == nil {
+		app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication is already turned on")
+		http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+		return
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The new secret is kept in the session until the user has proved that they've set up
+	// their app by entering a code, so that reloading the page doesn't change it.
+	secret := app.sessionManager.GetString(r.Context(), "mfaSetupSecret")
+	if secret == "" {
+		secret, err = totp.GenerateSecret()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.sessionManager.Put(r.Context(), "mfaSetupSecret", secret)
+	}
+
+	form, err := app.newAccountMFASetupForm(r, secret)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	app.render(w, r, http.StatusOK, "mfa_setup.html", data)
+}
+
+func (app *application) accountMFASetupPost(w http.ResponseWriter, r *http.Request) {
+	secret := app.sessionManager.GetString(r.Context(), "mfaSetupSecret")
+	if secret == "" {
+		http.Redirect(w, r, "/account/mfa/setup", http.StatusSeeOther)
+		return
+	}
+
+	form, err := app.newAccountMFASetupForm(r, secret)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Code), "code", "Code can't be blank")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "mfa_setup.html", data)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	// Codes are checked against the same throttle as the second step of logging in.
+	attempt, wait, locked, err := app.startLoginAttempt(r.Context(), throttleKey{mfaThrottle, strconv.Itoa(userID)})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if wait > 0 {
+		form.AddFieldError("code", throttleMessage(wait, locked))
+		data := app.newTemplateData(r)
+		data.Form = form
+		setRetryAfter(w, wait)
+		app.render(w, r, http.StatusTooManyRequests, "mfa_setup.html", data)
+		return
+	}
+
+	step, ok := totp.Validate(secret, strings.ReplaceAll(form.Code, " ", ""), time.Now())
+	if !ok {
+		app.failLoginAttempt(r, attempt)
+
+		form.AddFieldError("code", "Code is incorrect. Check that the time on your device is correct")
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "mfa_setup.html", data)
+		return
+	}
+
+	err = app.succeedLoginAttempt(r.Context(), attempt)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	recoveryCodes, err := models.GenerateRecoveryCodes(models.RecoveryCodeCount)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.mfa.Enable(r.Context(), userID, secret, recoveryCodes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Don't let the code which the user just entered be used to log in.
+	err = app.mfa.RecordStep(r.Context(), userID, step)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.audit(r, models.AuditEntry{Action: models.AuditMFAEnable, TargetType: models.AuditTargetUser, TargetID: userID})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), "mfaSetupSecret")
+
+	// The recovery codes are rendered directly rather than after a redirect, as this is the
+	// only time we'll ever have them in plaintext.
+	data := app.newTemplateData(r)
+	data.RecoveryCodes = recoveryCodes
+	app.render(w, r, http.StatusOK, "mfa_recovery.html", data)
+}
+
+type accountMFADisableForm struct {
+	CurrentPassword     string `form:"current_password"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) accountMFADisable(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = accountMFADisableForm{}
+	app.render(w, r, http.StatusOK, "mfa_disable.html", data)
+}
+
+func (app *application) accountMFADisablePost(w http.ResponseWriter, r *http.Request) {
+	var form accountMFADisableForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.users.Get(r.Context(), app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	attempt, wait, locked, err := app.startPasswordCheck(r, user)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if wait > 0 {
+		form.AddFieldError("currentPassword", throttleMessage(wait, locked))
+		data := app.newTemplateData(r)
+		data.Form = form
+		setRetryAfter(w, wait)
+		app.render(w, r, http.StatusTooManyRequests, "mfa_disable.html", data)
+		return
+	}
+
+	_, err = app.users.Authenticate(r.Context(), user.Email, form.CurrentPassword)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.failLoginAttempt(r, attempt)
+
+			form.AddFieldError("currentPassword", "Current password is incorrect")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "mfa_disable.html", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.succeedLoginAttempt(r.Context(), attempt)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.mfa.Disable(r.Context(), user.Id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.audit(r, models.AuditEntry{Action: models.AuditMFADisable, TargetType: models.AuditTargetUser, TargetID: user.Id})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication has been turned off")
+
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+func ping(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("OK"))
+}
+
+func (app *application) accountSessions(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	sessions, err := app.userSessions.ListForUser(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Sessions = sessions
+	data.CurrentSessionID = app.sessionManager.GetString(r.Context(), "sessionID")
+
+	app.render(w, r, http.StatusOK, "sessions.html", data)
+}
+
+func (app *application) accountSessionRevokePost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	// The current session is revoked by logging out instead, and there's no button for it.
+	if id == app.sessionManager.GetString(r.Context(), "sessionID") {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err := app.userSessions.Delete(r.Context(), app.sessionManager.GetInt(r.Context(), "authenticatedUserID"), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "That session has been signed out")
+
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+func (app *application) accountSessionRevokeOthersPost(w http.ResponseWriter, r *http.Request) {
+	err := app.destroyUserSessions(r.Context(), app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "You've been signed out everywhere else")
+
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+// How many users and creators are listed on the admin pages.
+const (
+	adminListLimit   = 10
+	adminSearchLimit = 50
+)
+
+// A user, and how many snippets they have created.
+type topCreator struct {
+	User     models.User
+	Snippets int
+}
+
+func (app *application) adminDashboard(w http.ResponseWriter, r *http.Request) {
+	userCount, err := app.users.Count(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	snippetCounts, err := app.snippets.Counts(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	recent, err := app.users.Latest(r.Context(), adminListLimit)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	reports, err := app.reports.ListOpen(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	creators, err := app.snippets.TopCreators(r.Context(), adminListLimit)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// There are only ever a handful of creators, so looking each of them up is cheap enough.
+	topCreators := make([]topCreator, 0, len(creators))
+	for _, c := range creators {
+		user, err := app.users.Get(r.Context(), c.UserID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		topCreators = append(topCreators, topCreator{User: user, Snippets: c.Snippets})
+	}
+
+	data := app.newTemplateData(r)
+	data.UserCount = userCount
+	data.SnippetCounts = snippetCounts
+	data.OpenReportCount = len(reports)
+	data.Users = recent
+	data.TopCreators = topCreators
+
+	app.render(w, r, http.StatusOK, "admin.html", data)
+}
+
+// Lists the users whose name or email address contains the "q" query parameter, or the
+// newest users if it's empty.
+func (app *application) adminUsers(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	var users []models.User
+	var err error
+
+	if query == "" {
+		users, err = app.users.Latest(r.Context(), adminSearchLimit)
+	} else {
+		users, err = app.users.Search(r.Context(), query, adminSearchLimit)
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Users = users
+	data.Query = query
+	data.Roles = models.Roles
+
+	app.render(w, r, http.StatusOK, "admin_users.html", data)
+}
+
+func (app *application) adminUserDisablePost(w http.ResponseWriter, r *http.Request) {
+	app.setUserDisabled(w, r, true)
+}
+
+func (app *application) adminUserEnablePost(w http.ResponseWriter, r *http.Request) {
+	app.setUserDisabled(w, r, false)
+}
+
+// Disables or re-enables the account of the user in the {id} path segment, then goes back to
+// the user search that the form was submitted from.
+func (app *application) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	redirectURL := "/admin/users"
+	if query := r.PostFormValue("q"); query != "" {
+		redirectURL += "?q=" + url.QueryEscape(query)
+	}
+
+	// Admins would otherwise be able to lock themselves (and possibly everyone) out.
+	if disabled && id == app.sessionManager.GetInt(r.Context(), "authenticatedUserID") {
+		app.sessionManager.Put(r.Context(), "flash", "You can't disable your own account.")
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		return
+	}
+
+	user, err := app.users.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.users.SetDisabled(r.Context(), id, disabled)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	action := models.AuditUserEnable
+	if disabled {
+		action = models.AuditUserDisable
+	}
+
+	err = app.audit(r, models.AuditEntry{
+		Action:     action,
+		TargetType: models.AuditTargetUser,
+		TargetID:   id,
+		Details:    map[string]string{"email": user.Email},
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if disabled {
+		// Log them out everywhere. The authenticate middleware would turn them away anyway,
+		// but this way their sessions don't linger.
+		err = app.userSessions.DeleteAllForUser(r.Context(), id, "")
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("%s's account has been disabled.", user.Name))
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("%s's account has been enabled.", user.Name))
+	}
+
+	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+}
+
+type adminUserRoleForm struct {
+	Role  models.Role `form:"role"`
+	Query string      `form:"q"`
+}
+
+// Changes the role of the user in the {id} path segment, then goes back to the user search
+// that the form was submitted from.
+func (app *application) adminUserRolePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	var form adminUserRoleForm
+
+	err = app.decodePostForm(r, &form)
+	if err != nil || !form.Role.Valid() {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	redirectURL := "/admin/users"
+	if form.Query != "" {
+		redirectURL += "?q=" + url.QueryEscape(form.Query)
+	}
+
+	// Otherwise the last admin could demote themselves, leaving nobody to run the site.
+	if id == app.sessionManager.GetInt(r.Context(), "authenticatedUserID") {
+		app.sessionManager.Put(r.Context(), "flash", "You can't change your own role.")
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		return
+	}
+
+	user, err := app.users.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.users.SetRole(r.Context(), id, form.Role)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.audit(r, models.AuditEntry{
+		Action:     models.AuditUserRoleChange,
+		TargetType: models.AuditTargetUser,
+		TargetID:   id,
+		Details:    map[string]string{"email": user.Email, "from": string(user.Role), "to": string(form.Role)},
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("%s's role has been changed to %s.", user.Name, form.Role))
+
+	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+}
+
+// Makes the snippet in the {id} path segment expire straight away.
+func (app *application) adminSnippetExpirePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.snippets.Expire(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.audit(r, models.AuditEntry{Action: models.AuditSnippetExpire, TargetType: models.AuditTargetSnippet, TargetID: id})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet #%d has been expired.", id))
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (app *application) adminSnippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.deleteSnippet(r, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet #%d has been deleted.", id))
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// Deletes a snippet, along with any reports against it, and records who did it. The databases would delete the
+// reports anyway, but the in-memory store doesn't know that they belong to the snippet.
+func (app *application) deleteSnippet(r *http.Request, id int) error {
+	err := app.reports.Resolve(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	err = app.snippets.Delete(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return app.audit(r, models.AuditEntry{Action: models.AuditSnippetDelete, TargetType: models.AuditTargetSnippet, TargetID: id})
+}
+
+// A snippet with open reports against it, as shown in the moderation queue.
+type reportedSnippet struct {
+	Snippet models.Snippet
+
+	// False if the snippet has expired or been deleted since it was reported.
+	Live bool
+
+	Reports []reportWithReporter
+}
+
+// A report, and the name of the user who made it (or an empty string if they were
+// anonymous).
+type reportWithReporter struct {
+	models.Report
+	Reporter string
+}
+
+// Lists the open reports, grouped by the snippet that they're about. Snippets appear in the
+// order that they were first reported, so the ones which have been waiting longest are first.
+func (app *application) moderation(w http.ResponseWriter, r *http.Request) {
+	reports, err := app.reports.ListOpen(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var queue []reportedSnippet
+	index := make(map[int]int)
+
+	for _, report := range reports {
+		i, ok := index[report.SnippetID]
+		if !ok {
+			item := reportedSnippet{Snippet: models.Snippet{ID: report.SnippetID}}
+
+			snippet, err := app.snippets.Get(r.Context(), report.SnippetID)
+			if err == nil {
+				item.Snippet = snippet
+				item.Live = true
+			} else if !errors.Is(err, models.ErrNoRecord) {
+				app.serverError(w, r, err)
+				return
+			}
+
+			i = len(queue)
+			index[report.SnippetID] = i
+			queue = append(queue, item)
+		}
+
+		entry := reportWithReporter{Report: report}
+
+		if report.ReporterID != 0 {
+			user, err := app.users.Get(r.Context(), report.ReporterID)
+			if err == nil {
+				entry.Reporter = user.Name
+			} else if !errors.Is(err, models.ErrNoRecord) {
+				app.serverError(w, r, err)
+				return
+			}
+		}
+
+		queue[i].Reports = append(queue[i].Reports, entry)
+	}
+
+	data := app.newTemplateData(r)
+	data.ReportedSnippets = queue
+
+	app.render(w, r, http.StatusOK, "moderation.html", data)
+}
+
+// Closes the reports against the snippet in the {id} path segment without taking any
+// action, and puts the snippet back if it was hidden automatically.
+func (app *application) moderationDismissPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.reports.Resolve(r.Context(), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The snippet may have been deleted since it was reported, in which case there's
+	// nothing to put back.
+	err = app.snippets.SetHidden(r.Context(), id, false)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.audit(r, models.AuditEntry{Action: models.AuditReportsDismiss, TargetType: models.AuditTargetSnippet, TargetID: id})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("The reports against snippet #%d have been dismissed.", id))
+
+	http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+}
+
+// Hides the snippet in the {id} path segment for good, and closes the reports against it.
+func (app *application) moderationHidePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.snippets.SetHidden(r.Context(), id, true)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.reports.Resolve(r.Context(), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.audit(r, models.AuditEntry{Action: models.AuditSnippetHide, TargetType: models.AuditTargetSnippet, TargetID: id})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet #%d has been hidden.", id))
+
+	http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+}
+
+func (app *application) moderationDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.deleteSnippet(r, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet #%d has been deleted.", id))
+
+	http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+}
+
+// How many entries are shown on the audit log pages.
+const (
+	auditListLimit    = 100
+	activityListLimit = 50
+)
+
+// An audit log entry, along with the name of the user who did it. Actor is empty if nobody
+// was logged in, or the user no longer exists.
+type auditEntry struct {
+	models.AuditEntry
+	Actor string
+}
+
+// Lists the newest audit log entries, optionally only those for the user with the email
+// address in the "user" query parameter and the action in the "action" parameter.
+func (app *application) adminAudit(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("user"))
+	action := models.AuditAction(r.URL.Query().Get("action"))
+
+	if action != "" && !action.Valid() {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	filter := models.AuditFilter{Action: action, Limit: auditListLimit}
+
+	var entries []models.AuditEntry
+
+	// An unknown user can't have any entries, so there's nothing to look up.
+	user, err := app.findAuditUser(r, query)
+	if err == nil {
+		filter.UserID = user.Id
+
+		entries, err = app.auditLog.List(r.Context(), filter)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Entries are mostly made by a handful of people, so the lookups are cached.
+	names := make(map[int]string)
+	list := make([]auditEntry, 0, len(entries))
+
+	for _, e := range entries {
+		name, ok := names[e.ActorID]
+		if !ok && e.ActorID != 0 {
+			actor, err := app.users.Get(r.Context(), e.ActorID)
+			if err == nil {
+				name = actor.Name
+			} else if !errors.Is(err, models.ErrNoRecord) {
+				app.serverError(w, r, err)
+				return
+			}
+			names[e.ActorID] = name
+		}
+
+		list = append(list, auditEntry{AuditEntry: e, Actor: name})
+	}
+
+	data := app.newTemplateData(r)
+	data.AuditEntries = list
+	data.AuditActions = models.AuditActions
+	data.AuditAction = action
+	data.Query = query
+
+	app.render(w, r, http.StatusOK, "admin_audit.html", data)
+}
+
+// Returns the user with the given email address, or the zero User if the address is empty.
+func (app *application) findAuditUser(r *http.Request, email string) (models.User, error) {
+	if email == "" {
+		return models.User{}, nil
+	}
+
+	return app.users.GetByEmail(r.Context(), email)
+}
+
+// Shows the logged in user the recent security-relevant events for their account, including
+// failed attempts to log into it and anything the admins have done to it.
+func (app *application) accountActivity(w http.ResponseWriter, r *http.Request) {
+	user, _ := app.authenticatedUser(r)
+
+	entries, err := app.auditLog.List(r.Context(), models.AuditFilter{UserID: user.Id, Limit: activityListLimit})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	list := make([]auditEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, auditEntry{AuditEntry: e})
+	}
+
+	data := app.newTemplateData(r)
+	data.User = user
+	data.AuditEntries = list
+
+	app.render(w, r, http.StatusOK, "activity.html", data)
+}
+
+type orgCreateForm struct {
+	Name                string `form:"name"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) orgCreate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = orgCreateForm{}
+
+	app.render(w, r, http.StatusOK, "org_create.html", data)
+}
+
+func (app *application) orgCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form orgCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Name = strings.TrimSpace(form.Name)
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "Name can't be blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "Name can't be more than 100 chars long")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "org_create.html", data)
+		return
+	}
+
+	user, _ := app.authenticatedUser(r)
+
+	id, err := app.orgs.Insert(r.Context(), form.Name, user.Id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your organization has been created")
+
+	http.Redirect(w, r, fmt.Sprintf("/org/view/%d", id), http.StatusSeeOther)
+}
+
+// A member of an organization, along with their name and email address.
+type orgMember struct {
+	models.OrgMember
+	Name  string
+	Email string
+}
+
+// Returns the organization in the {id} path segment and the logged in user's role in it. If
+// there's no such organization, or the user isn't a member of it, an error response has
+// already been sent and ok is false.
+func (app *application) memberOrg(w http.ResponseWriter, r *http.Request) (org models.Org, role models.OrgRole, ok bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return models.Org{}, "", false
+	}
+
+	org, err = app.orgs.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Org{}, "", false
+	}
+
+	user, _ := app.authenticatedUser(r)
+
+	// Organizations are private to their members.
+	role, err = app.orgs.MemberRole(r.Context(), org.ID, user.Id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Org{}, "", false
+	}
+
+	return org, role, true
+}
+
+// Returns the template data for an organization's page, which lists its members and
+// snippets.
+func (app *application) newOrgData(r *http.Request, org models.Org, role models.OrgRole, form orgInviteForm) (templateData, error) {
+	members, err := app.orgs.Members(r.Context(), org.ID)
+	if err != nil {
+		return templateData{}, err
+	}
+
+	list := make([]orgMember, 0, len(members))
+	for _, m := range members {
+		user, err := app.users.Get(r.Context(), m.UserID)
+		if err != nil {
+			return templateData{}, err
+		}
+
+		list = append(list, orgMember{OrgMember: m, Name: user.Name, Email: user.Email})
+	}
+
+	snippets, err := app.snippets.ListForOrg(r.Context(), org.ID)
+	if err != nil {
+		return templateData{}, err
+	}
+
+	data := app.newTemplateData(r)
+	data.Org = org
+	data.OrgRole = role
+	data.OrgMembers = list
+	data.Snippets = snippets
+	data.Form = form
+
+	return data, nil
+}
+
+func (app *application) orgView(w http.ResponseWriter, r *http.Request) {
+	org, role, ok := app.memberOrg(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := app.newOrgData(r, org, role, orgInviteForm{Role: models.OrgRoleMember})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, http.StatusOK, "org.html", data)
+}
+
+type orgInviteForm struct {
+	Email               string         `form:"email"`
+	Role                models.OrgRole `form:"role"`
+	validator.Validator `form:"-"`
+}
+
+// How long an invitation to join an organization remains valid for.
+const orgInvitationTTL = 7 * 24 * time.Hour
+
+// Emails an invitation to join the organization in the {id} path segment. Only the
+// organization's owners can invite people.
+func (app *application) orgInvitePost(w http.ResponseWriter, r *http.Request) {
+	org, role, ok := app.memberOrg(w, r)
+	if !ok {
+		return
+	}
+
+	if role != models.OrgRoleOwner {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	var form orgInviteForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Email = strings.TrimSpace(form.Email)
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "Email can't be blank")
+	form.CheckField(validator.IsValidEmail(form.Email), "email", "This field must be a valid email address")
+	form.CheckField(form.Role.Valid(), "role", "Please choose a role")
+
+	if !form.Valid() {
+		data, err := app.newOrgData(r, org, role, form)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.render(w, r, http.StatusUnprocessableEntity, "org.html", data)
+		return
+	}
+
+	token, err := app.orgs.Invite(r.Context(), org.ID, form.Email, form.Role, orgInvitationTTL)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.audit(r, models.AuditEntry{
+		Action:     models.AuditOrgInvite,
+		TargetType: models.AuditTargetOrg,
+		TargetID:   org.ID,
+		Details:    map[string]string{"email": form.Email, "role": string(form.Role)},
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	user, _ := app.authenticatedUser(r)
+
+	emailData := map[string]any{
+		"InviterName": user.Name,
+		"OrgName":     org.Name,
+		"Role":        string(form.Role),
+		"JoinURL":     app.baseURL + "/org/join/" + token,
+		"TTL":         "7 days",
+	}
+
+	logger := app.requestLogger(r)
+	app.background(func() {
+		err := app.mailer.Send(form.Email, "org_invitation.tmpl", emailData)
+		if err != nil {
+			logger.Error(err.Error())
+		}
+	})
+
+	app.sessionManager.Put(r.Context(), "flash", "We've sent an invitation to "+form.Email)
+
+	http.Redirect(w, r, fmt.Sprintf("/org/view/%d", org.ID), http.StatusSeeOther)
 }
 
-func ping(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("OK"))
+// Returns the invitation in the {token} path segment and the organization it's for. If the
+// invitation doesn't exist, has expired or was sent to somebody else, the join page has
+// already been rendered explaining why and ok is false.
+func (app *application) orgInvitation(w http.ResponseWriter, r *http.Request) (inv models.OrgInvitation, org models.Org, ok bool) {
+	inv, err := app.orgs.GetInvitation(r.Context(), r.PathValue("token"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.render(w, r, http.StatusNotFound, "org_join.html", app.newTemplateData(r))
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.OrgInvitation{}, models.Org{}, false
+	}
+
+	org, err = app.orgs.Get(r.Context(), inv.OrgID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return models.OrgInvitation{}, models.Org{}, false
+	}
+
+	// Anyone who gets hold of the link shouldn't be able to use it, only the person it was
+	// sent to.
+	user, _ := app.authenticatedUser(r)
+	if !strings.EqualFold(user.Email, inv.Email) {
+		data := app.newTemplateData(r)
+		data.Org = org
+		app.render(w, r, http.StatusForbidden, "org_join.html", data)
+		return models.OrgInvitation{}, models.Org{}, false
+	}
+
+	return inv, org, true
+}
+
+type orgJoinForm struct {
+	Token string `form:"-"`
+}
+
+func (app *application) orgJoin(w http.ResponseWriter, r *http.Request) {
+	inv, org, ok := app.orgInvitation(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Org = org
+	data.Invitation = inv
+	data.Form = orgJoinForm{Token: r.PathValue("token")}
+
+	app.render(w, r, http.StatusOK, "org_join.html", data)
+}
+
+func (app *application) orgJoinPost(w http.ResponseWriter, r *http.Request) {
+	_, org, ok := app.orgInvitation(w, r)
+	if !ok {
+		return
+	}
+
+	user, _ := app.authenticatedUser(r)
+
+	_, err := app.orgs.AcceptInvitation(r.Context(), r.PathValue("token"), user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDuplicateMember):
+			app.sessionManager.Put(r.Context(), "flash", "You're already a member of "+org.Name)
+			http.Redirect(w, r, fmt.Sprintf("/org/view/%d", org.ID), http.StatusSeeOther)
+		case errors.Is(err, models.ErrNoRecord):
+			app.render(w, r, http.StatusNotFound, "org_join.html", app.newTemplateData(r))
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.audit(r, models.AuditEntry{
+		Action:     models.AuditOrgJoin,
+		TargetType: models.AuditTargetOrg,
+		TargetID:   org.ID,
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Welcome to "+org.Name+"!")
+
+	http.Redirect(w, r, fmt.Sprintf("/org/view/%d", org.ID), http.StatusSeeOther)
+}
+
+type collectionForm struct {
+	Name                string            `form:"name"`
+	Visibility          models.Visibility `form:"visibility"`
+	validator.Validator `form:"-"`
+}
+
+// Trims and validates the name and visibility of a new or renamed collection.
+func (form *collectionForm) check() {
+	form.Name = strings.TrimSpace(form.Name)
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "Name can't be blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "Name can't be more than 100 chars long")
+	form.CheckField(models.ValidCollectionVisibility(form.Visibility), "visibility", "Please choose who can see this collection")
+}
+
+func (app *application) collectionCreate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = collectionForm{Visibility: models.VisibilityPublic}
+
+	app.render(w, r, http.StatusOK, "collection_create.html", data)
+}
+
+func (app *application) collectionCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form collectionForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.check()
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "collection_create.html", data)
+		return
+	}
+
+	user, _ := app.authenticatedUser(r)
+
+	id, err := app.collections.Insert(r.Context(), user.Id, form.Name, form.Visibility)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your collection has been created")
+
+	http.Redirect(w, r, fmt.Sprintf("/collection/view/%d", id), http.StatusSeeOther)
+}
+
+// Returns the collection in the {id} path segment, and whether the logged in user owns it.
+// Private collections can only be seen by their owner, and everyone else gets a 404. If
+// the collection can't be seen, an error response has already been sent and ok is false.
+func (app *application) visibleCollection(w http.ResponseWriter, r *http.Request) (collection models.Collection, owner, ok bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return models.Collection{}, false, false
+	}
+
+	collection, err = app.collections.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Collection{}, false, false
+	}
+
+	user, _ := app.authenticatedUser(r)
+	owner = user.Id != 0 && user.Id == collection.UserID
+
+	if !owner && collection.Visibility != models.VisibilityPublic {
+		http.NotFound(w, r)
+		return models.Collection{}, false, false
+	}
+
+	return collection, owner, true
+}
+
+// Like visibleCollection, but only succeeds for the collection's owner. Everyone else gets a
+// 403 (or a 404 if they can't see the collection at all).
+func (app *application) ownCollection(w http.ResponseWriter, r *http.Request) (models.Collection, bool) {
+	collection, owner, ok := app.visibleCollection(w, r)
+	if !ok {
+		return models.Collection{}, false
+	}
+
+	if !owner {
+		app.clientError(w, http.StatusForbidden)
+		return models.Collection{}, false
+	}
+
+	return collection, true
+}
+
+// Returns the template data for a collection's page. The snippets which the logged in user
+// can't see (along with hidden and expired ones) are left out.
+func (app *application) newCollectionData(r *http.Request, collection models.Collection, owner bool, form collectionForm) (templateData, error) {
+	ids, err := app.collections.SnippetIDs(r.Context(), collection.ID)
+	if err != nil {
+		return templateData{}, err
+	}
+
+	var snippets []models.Snippet
+	for _, id := range ids {
+		snippet, err := app.snippets.Get(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				continue
+			}
+			return templateData{}, err
+		}
+
+		if snippet.Hidden {
+			continue
+		}
+
+		access, err := app.snippetAccess(r, snippet)
+		if err != nil {
+			return templateData{}, err
+		}
+
+		if access >= accessView {
+			snippets = append(snippets, snippet)
+		}
+	}
+
+	data := app.newTemplateData(r)
+	data.Collection = collection
+	data.OwnsCollection = owner
+	data.Snippets = snippets
+	data.Form = form
+
+	return data, nil
+}
+
+func (app *application) collectionView(w http.ResponseWriter, r *http.Request) {
+	collection, owner, ok := app.visibleCollection(w, r)
+	if !ok {
+		return
+	}
+
+	form := collectionForm{Name: collection.Name, Visibility: collection.Visibility}
+
+	data, err := app.newCollectionData(r, collection, owner, form)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, http.StatusOK, "collection.html", data)
+}
+
+// Renames the collection in the {id} path segment, and changes who can see it.
+func (app *application) collectionRenamePost(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownCollection(w, r)
+	if !ok {
+		return
+	}
+
+	var form collectionForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.check()
+
+	if !form.Valid() {
+		data, err := app.newCollectionData(r, collection, true, form)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.render(w, r, http.StatusUnprocessableEntity, "collection.html", data)
+		return
+	}
+
+	err = app.collections.Update(r.Context(), collection.ID, form.Name, form.Visibility)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Collection updated successfully!")
+
+	http.Redirect(w, r, fmt.Sprintf("/collection/view/%d", collection.ID), http.StatusSeeOther)
+}
+
+type collectionSnippetForm struct {
+	SnippetID int    `form:"snippet"`
+	Direction string `form:"direction"`
+}
+
+// Adds a snippet to the end of the collection in the {id} path segment. Only snippets which
+// the logged in user can see can be added.
+func (app *application) collectionAddPost(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownCollection(w, r)
+	if !ok {
+		return
+	}
+
+	var form collectionSnippetForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	snippet, _, ok := app.snippetWithAccess(w, r, form.SnippetID, accessView)
+	if !ok {
+		return
+	}
+
+	err = app.collections.AddSnippet(r.Context(), collection.ID, snippet.ID)
+	switch {
+	case errors.Is(err, models.ErrDuplicateSnippet):
+		app.sessionManager.Put(r.Context(), "flash", "This snippet is already in "+collection.Name)
+	case err != nil:
+		app.serverError(w, r, err)
+		return
+	default:
+		app.sessionManager.Put(r.Context(), "flash", "Added to "+collection.Name)
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// Removes a snippet from the collection in the {id} path segment.
+func (app *application) collectionRemovePost(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownCollection(w, r)
+	if !ok {
+		return
+	}
+
+	var form collectionSnippetForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.collections.RemoveSnippet(r.Context(), collection.ID, form.SnippetID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Removed from "+collection.Name)
+
+	http.Redirect(w, r, fmt.Sprintf("/collection/view/%d", collection.ID), http.StatusSeeOther)
+}
+
+// Moves a snippet one place up or down the collection in the {id} path segment.
+func (app *application) collectionMovePost(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownCollection(w, r)
+	if !ok {
+		return
+	}
+
+	var form collectionSnippetForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var delta int
+	switch form.Direction {
+	case "up":
+		delta = -1
+	case "down":
+		delta = 1
+	default:
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.collections.MoveSnippet(r.Context(), collection.ID, form.SnippetID, delta)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/collection/view/%d", collection.ID), http.StatusSeeOther)
 }
@@ -1,11 +1,22 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"golang.org/x/crypto/bcrypt"
 	"snippetbox.prajjmon.net/internal/assert"
+	"snippetbox.prajjmon.net/internal/models"
+	"snippetbox.prajjmon.net/internal/models/memory"
+	"snippetbox.prajjmon.net/internal/models/mocks"
+	"snippetbox.prajjmon.net/internal/passhash"
+	"snippetbox.prajjmon.net/internal/totp"
 )
 
 func TestPing(t *testing.T) {
@@ -46,6 +57,16 @@ func TestSnippetView(t *testing.T) {
 			urlPath:  "/snippet/view/2",
 			wantCode: http.StatusNotFound,
 		},
+		{
+			name:     "Query timeout",
+			urlPath:  "/snippet/view/3",
+			wantCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:     "Query canceled",
+			urlPath:  "/snippet/view/4",
+			wantCode: statusClientClosedRequest,
+		},
 		{
 			name:     "Negative ID",
 			urlPath:  "/snippet/view/-1",
@@ -104,6 +125,7 @@ func TestUserSignup(t *testing.T) {
 		csrfToken    string
 		wantCode     int
 		wantFormTag  string
+		wantError    string
 	}{
 		{
 			name:         "Valid submission",
@@ -166,6 +188,36 @@ func TestUserSignup(t *testing.T) {
 			wantCode:     http.StatusUnprocessableEntity,
 			wantFormTag:  formTag,
 		},
+		{
+			name:         "Breached password",
+			userName:     validName,
+			userEmail:    validEmail,
+			userPassword: "password1",
+			csrfToken:    validCSRFToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantFormTag:  formTag,
+			wantError:    "This password has appeared in a data breach",
+		},
+		{
+			name:         "Password contains name",
+			userName:     validName,
+			userEmail:    validEmail,
+			userPassword: "i-am-prajjwol!",
+			csrfToken:    validCSRFToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantFormTag:  formTag,
+			wantError:    "Password can&#39;t contain your name or email address",
+		},
+		{
+			name:         "Predictable password",
+			userName:     validName,
+			userEmail:    validEmail,
+			userPassword: "aaaaaaaaaaaa",
+			csrfToken:    validCSRFToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantFormTag:  formTag,
+			wantError:    "Password is too easy to guess",
+		},
 		{
 			name:         "Duplicate email",
 			userName:     validName,
@@ -179,6 +231,9 @@ func TestUserSignup(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			mailer := &testMailer{}
+			app.mailer = mailer
+
 			form := url.Values{}
 			form.Add("name", tt.userName)
 			form.Add("email", tt.userEmail)
@@ -186,12 +241,2557 @@ func TestUserSignup(t *testing.T) {
 			form.Add("csrf_token", tt.csrfToken)
 
 			code, _, body := ts.postForm(t, "/user/signup", form)
+			app.wg.Wait()
 
 			assert.Equal(t, code, tt.wantCode)
 
 			if tt.wantFormTag != "" {
 				assert.StringContains(t, body, tt.wantFormTag)
 			}
+
+			if tt.wantError != "" {
+				assert.StringContains(t, body, tt.wantError)
+			}
+
+			// A successful signup should send a verification email.
+			if code == http.StatusSeeOther {
+				emails := mailer.emails()
+				assert.Equal(t, len(emails), 1)
+				assert.Equal(t, emails[0].recipient, tt.userEmail)
+				assert.Equal(t, emails[0].templateFile, "email_verification.tmpl")
+			}
+		})
+	}
+}
+
+func TestUserSignupPasswordTooLong(t *testing.T) {
+	// Use real users with bcrypt, which can't hash passwords longer than 72 bytes.
+	params := passhash.Params{Algorithm: passhash.Bcrypt, BcryptCost: bcrypt.MinCost}
+
+	app := newTestApplication(t)
+	app.users = &memory.UserModel{PasswordParams: params}
+	app.passwordPolicy.MaxLength = params.MaxPasswordLength()
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/signup")
+	csrfToken := extractCsrfToken(t, body)
+
+	tests := []struct {
+		name      string
+		email     string
+		password  string
+		wantCode  int
+		wantError string
+	}{
+		{"Too long", "long@example.com", strings.Repeat("validP@ssword", 6)[:73], http.StatusUnprocessableEntity, "Password can&#39;t be longer than 72 bytes"},
+		{"Longest allowed", "longest@example.com", strings.Repeat("validP@ssword", 6)[:72], http.StatusSeeOther, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("name", "Prajjwol")
+			form.Add("email", tt.email)
+			form.Add("password", tt.password)
+			form.Add("csrf_token", csrfToken)
+
+			code, _, body := ts.postForm(t, "/user/signup", form)
+			app.wg.Wait()
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantError != "" {
+				assert.StringContains(t, body, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestPasswordForgot(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/password/forgot")
+	validCSRFToken := extractCsrfToken(t, body)
+
+	tests := []struct {
+		name       string
+		email      string
+		wantCode   int
+		wantEmails int
+	}{
+		{
+			name:       "Existing account",
+			email:      "alice@example.com",
+			wantCode:   http.StatusSeeOther,
+			wantEmails: 1,
+		},
+		{
+			name:       "Unknown account",
+			email:      "nobody@example.com",
+			wantCode:   http.StatusSeeOther,
+			wantEmails: 0,
+		},
+		{
+			name:       "Invalid email",
+			email:      "alice@",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantEmails: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mailer := &testMailer{}
+			app.mailer = mailer
+
+			form := url.Values{}
+			form.Add("email", tt.email)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, headers, _ := ts.postForm(t, "/user/password/forgot", form)
+			app.wg.Wait()
+
+			assert.Equal(t, code, tt.wantCode)
+			if code == http.StatusSeeOther {
+				assert.Equal(t, headers.Get("Location"), "/user/login")
+			}
+
+			emails := mailer.emails()
+			assert.Equal(t, len(emails), tt.wantEmails)
+
+			if len(emails) > 0 {
+				assert.Equal(t, emails[0].recipient, tt.email)
+				assert.Equal(t, emails[0].templateFile, "password_reset.tmpl")
+
+				data := emails[0].data.(map[string]any)
+				assert.Equal(t, data["ResetURL"].(string), "https://snippetbox.example.com/user/password/reset/"+mocks.ValidToken)
+			}
+		})
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	validPath := "/user/password/reset/" + mocks.ValidToken
+
+	t.Run("Invalid token", func(t *testing.T) {
+		code, _, body := ts.get(t, "/user/password/reset/not-a-token")
+
+		assert.Equal(t, code, http.StatusNotFound)
+		assert.StringContains(t, body, "invalid or has expired")
+	})
+
+	code, _, body := ts.get(t, validPath)
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, `<form action='`+validPath+`' method='POST' novalidate>`)
+	validCSRFToken := extractCsrfToken(t, body)
+
+	tests := []struct {
+		name            string
+		urlPath         string
+		password        string
+		confirmPassword string
+		wantCode        int
+	}{
+		{
+			name:            "Passwords don&#39;t match",
+			urlPath:         validPath,
+			password:        "n3w pa$$word",
+			confirmPassword: "something else",
+			wantCode:        http.StatusUnprocessableEntity,
+		},
+		{
+			name:            "Short password",
+			urlPath:         validPath,
+			password:        "pa$$",
+			confirmPassword: "pa$$",
+			wantCode:        http.StatusUnprocessableEntity,
+		},
+		{
+			name:            "Breached password",
+			urlPath:         validPath,
+			password:        "password123",
+			confirmPassword: "password123",
+			wantCode:        http.StatusUnprocessableEntity,
+		},
+		{
+			name:            "Invalid token",
+			urlPath:         "/user/password/reset/not-a-token",
+			password:        "n3w pa$$word",
+			confirmPassword: "n3w pa$$word",
+			wantCode:        http.StatusNotFound,
+		},
+		{
+			name:            "Valid submission",
+			urlPath:         validPath,
+			password:        "n3w pa$$word",
+			confirmPassword: "n3w pa$$word",
+			wantCode:        http.StatusSeeOther,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("password", tt.password)
+			form.Add("confirm_password", tt.confirmPassword)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestPasswordResetDestroysSessions(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Log in as alice using a second client, with its own cookie jar.
+	other := ts.newClient(t)
+	other.login(t, "alice@example.com", "pa$$word")
+
+	code, _, _ := other.get(t, "/snippet/create")
+	assert.Equal(t, code, http.StatusOK)
+
+	// Then reset alice's password using the main client.
+	_, _, body := ts.get(t, "/user/password/reset/"+mocks.ValidToken)
+
+	form := url.Values{}
+	form.Add("password", "n3w pa$$word")
+	form.Add("confirm_password", "n3w pa$$word")
+	form.Add("csrf_token", extractCsrfToken(t, body))
+
+	code, _, _ = ts.postForm(t, "/user/password/reset/"+mocks.ValidToken, form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	// The other session should have been logged out.
+	code, headers, _ := other.get(t, "/snippet/create")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+}
+
+func TestSnippetCreate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		code, headers, _ := ts.get(t, "/snippet/create")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login")
+	})
+
+	t.Run("Unverified", func(t *testing.T) {
+		client := ts.newClient(t)
+		client.login(t, "bob@example.com", "pa$$word")
+
+		code, _, body := client.get(t, "/snippet/create")
+
+		assert.Equal(t, code, http.StatusForbidden)
+		assert.StringContains(t, body, `<form action='/user/verify/resend' method='POST'>`)
+	})
+
+	t.Run("Verified", func(t *testing.T) {
+		client := ts.newClient(t)
+		client.login(t, "alice@example.com", "pa$$word")
+
+		code, _, body := client.get(t, "/snippet/create")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<form action='/snippet/create' method='POST'>")
+	})
+}
+
+func TestUserVerify(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{
+			name:     "Valid token",
+			urlPath:  "/user/verify/" + mocks.ValidToken,
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Invalid token",
+			urlPath:  "/user/verify/not-a-token",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, _ := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestUserVerifyResend(t *testing.T) {
+	app := newTestApplication(t)
+	mailer := &testMailer{}
+	app.mailer = mailer
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "bob@example.com", "pa$$word")
+
+	_, _, body := ts.get(t, "/snippet/create")
+
+	form := url.Values{}
+	form.Add("csrf_token", extractCsrfToken(t, body))
+
+	code, _, _ := ts.postForm(t, "/user/verify/resend", form)
+	app.wg.Wait()
+
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	emails := mailer.emails()
+	assert.Equal(t, len(emails), 1)
+	assert.Equal(t, emails[0].recipient, "bob@example.com")
+	assert.Equal(t, emails[0].templateFile, "email_verification.tmpl")
+}
+
+func TestAccountView(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		code, headers, _ := ts.get(t, "/account/view")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login")
+	})
+
+	t.Run("Authenticated", func(t *testing.T) {
+		client := ts.newClient(t)
+		client.login(t, "alice@example.com", "pa$$word")
+
+		code, _, body := client.get(t, "/account/view")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<td>Alice</td>")
+		assert.StringContains(t, body, "<td>alice@example.com</td>")
+	})
+}
+
+func TestAccountPasswordUpdate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	_, _, body := ts.get(t, "/account/password/update")
+	validCSRFToken := extractCsrfToken(t, body)
+
+	tests := []struct {
+		name            string
+		currentPassword string
+		newPassword     string
+		confirmPassword string
+		wantCode        int
+		wantError       string
+	}{
+		{
+			name:            "Wrong current password",
+			currentPassword: "wrong password",
+			newPassword:     "n3w pa$$word",
+			confirmPassword: "n3w pa$$word",
+			wantCode:        http.StatusUnprocessableEntity,
+			wantError:       "Current password is incorrect",
+		},
+		{
+			name:            "Short password",
+			currentPassword: "pa$$word",
+			newPassword:     "pa$$",
+			confirmPassword: "pa$$",
+			wantCode:        http.StatusUnprocessableEntity,
+			wantError:       "Password must be at least 8 characters long",
+		},
+		{
+			name:            "Breached password",
+			currentPassword: "pa$$word",
+			newPassword:     "qwerty123",
+			confirmPassword: "qwerty123",
+			wantCode:        http.StatusUnprocessableEntity,
+			wantError:       "This password has appeared in a data breach",
+		},
+		{
+			name:            "Password contains email",
+			currentPassword: "pa$$word",
+			newPassword:     "Alice-2024-Rocks",
+			confirmPassword: "Alice-2024-Rocks",
+			wantCode:        http.StatusUnprocessableEntity,
+			wantError:       "Password can&#39;t contain your name or email address",
+		},
+		{
+			name:            "Passwords don&#39;t match",
+			currentPassword: "pa$$word",
+			newPassword:     "n3w pa$$word",
+			confirmPassword: "something else",
+			wantCode:        http.StatusUnprocessableEntity,
+			wantError:       "Passwords don&#39;t match",
+		},
+		{
+			name:            "Valid submission",
+			currentPassword: "pa$$word",
+			newPassword:     "n3w pa$$word",
+			confirmPassword: "n3w pa$$word",
+			wantCode:        http.StatusSeeOther,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("current_password", tt.currentPassword)
+			form.Add("new_password", tt.newPassword)
+			form.Add("confirm_password", tt.confirmPassword)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, headers, body := ts.postForm(t, "/account/password/update", form)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantError != "" {
+				assert.StringContains(t, body, tt.wantError)
+			} else {
+				assert.Equal(t, headers.Get("Location"), "/account/view")
+			}
 		})
 	}
 }
+
+func TestAccountEmailUpdate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	_, _, body := ts.get(t, "/account/email/update")
+	validCSRFToken := extractCsrfToken(t, body)
+
+	tests := []struct {
+		name            string
+		email           string
+		currentPassword string
+		wantCode        int
+		wantEmails      int
+	}{
+		{
+			name:            "Invalid email",
+			email:           "alice@example.",
+			currentPassword: "pa$$word",
+			wantCode:        http.StatusUnprocessableEntity,
+		},
+		{
+			name:            "Wrong current password",
+			email:           "alice@example.org",
+			currentPassword: "wrong password",
+			wantCode:        http.StatusUnprocessableEntity,
+		},
+		{
+			name:            "Duplicate email",
+			email:           "dupe@example.com",
+			currentPassword: "pa$$word",
+			wantCode:        http.StatusUnprocessableEntity,
+		},
+		{
+			name:            "Unchanged email",
+			email:           "alice@example.com",
+			currentPassword: "pa$$word",
+			wantCode:        http.StatusSeeOther,
+		},
+		{
+			name:            "Valid submission",
+			email:           "alice@example.org",
+			currentPassword: "pa$$word",
+			wantCode:        http.StatusSeeOther,
+			wantEmails:      2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mailer := &testMailer{}
+			app.mailer = mailer
+
+			form := url.Values{}
+			form.Add("email", tt.email)
+			form.Add("current_password", tt.currentPassword)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := ts.postForm(t, "/account/email/update", form)
+			app.wg.Wait()
+
+			assert.Equal(t, code, tt.wantCode)
+
+			emails := mailer.emails()
+			assert.Equal(t, len(emails), tt.wantEmails)
+
+			// The old address gets a notification and the new one a verification link. They are
+			// sent in the background, so may arrive in either order.
+			if tt.wantEmails == 2 {
+				sent := map[string]string{}
+				for _, e := range emails {
+					sent[e.templateFile] = e.recipient
+				}
+				assert.Equal(t, sent["email_changed.tmpl"], "alice@example.com")
+				assert.Equal(t, sent["email_verification.tmpl"], "alice@example.org")
+			}
+		})
+	}
+}
+
+func TestUserLoginMFA(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("No pending login", func(t *testing.T) {
+		code, headers, _ := ts.get(t, "/user/login/mfa")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login")
+	})
+
+	validCode, err := totp.Code(mocks.MFASecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		code         string
+		wantCode     int
+		wantLoggedIn bool
+	}{
+		{
+			name:     "Blank code",
+			code:     "",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Wrong code",
+			code:     "000000",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Valid TOTP code",
+			code:         validCode,
+			wantCode:     http.StatusSeeOther,
+			wantLoggedIn: true,
+		},
+		{
+			name:         "Valid recovery code",
+			code:         mocks.ValidRecoveryCode,
+			wantCode:     http.StatusSeeOther,
+			wantLoggedIn: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := ts.newClient(t)
+			client.login(t, "carol@example.com", "pa$$word")
+
+			// The password on its own shouldn't be enough to log in.
+			code, headers, _ := client.get(t, "/snippet/create")
+			assert.Equal(t, code, http.StatusSeeOther)
+			assert.Equal(t, headers.Get("Location"), "/user/login")
+
+			code, _, body := client.get(t, "/user/login/mfa")
+			assert.Equal(t, code, http.StatusOK)
+
+			form := url.Values{}
+			form.Add("code", tt.code)
+			form.Add("csrf_token", extractCsrfToken(t, body))
+
+			code, _, _ = client.postForm(t, "/user/login/mfa", form)
+			assert.Equal(t, code, tt.wantCode)
+
+			code, _, _ = client.get(t, "/snippet/create")
+			assert.Equal(t, code == http.StatusOK, tt.wantLoggedIn)
+		})
+	}
+}
+
+func TestAccountMFASetup(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := ts.get(t, "/account/mfa/setup")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "otpauth://totp/Snippetbox:alice@example.com?")
+	assert.StringContains(t, body, "<img src='data:image/png;base64,")
+
+	// The secret shouldn't change when the page is reloaded.
+	secret := regexp.MustCompile(`<code>([A-Z2-7]+)</code>`).FindStringSubmatch(body)
+	if secret == nil {
+		t.Fatal("no secret found in body")
+	}
+
+	_, _, reloaded := ts.get(t, "/account/mfa/setup")
+	assert.StringContains(t, reloaded, secret[0])
+
+	csrfToken := extractCsrfToken(t, body)
+
+	form := url.Values{}
+	form.Add("code", "000000")
+	form.Add("csrf_token", csrfToken)
+
+	code, _, _ = ts.postForm(t, "/account/mfa/setup", form)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+
+	validCode, err := totp.Code(secret[1], time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form.Set("code", validCode)
+
+	code, _, body = ts.postForm(t, "/account/mfa/setup", form)
+	assert.Equal(t, code, http.StatusOK)
+
+	recoveryCodes := regexp.MustCompile(`<code>[a-z2-7]{4}-[a-z2-7]{4}</code>`).FindAllString(body, -1)
+	assert.Equal(t, len(recoveryCodes), models.RecoveryCodeCount)
+
+	// The wrong code counts against the throttle until the right one is entered.
+	failures, _, err := app.loginAttempts.Failures(context.Background(), "mfa:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, failures, 0)
+
+	entries, err := app.auditLog.List(context.Background(), models.AuditFilter{Action: models.AuditMFAEnable})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].ActorID, 1)
+	assert.Equal(t, entries[0].TargetID, 1)
+}
+
+func TestAccountMFADisable(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	_, _, body := ts.get(t, "/account/mfa/disable")
+	csrfToken := extractCsrfToken(t, body)
+
+	disable := func(password string) (int, http.Header, string) {
+		form := url.Values{}
+		form.Add("current_password", password)
+		form.Add("csrf_token", csrfToken)
+
+		return ts.postForm(t, "/account/mfa/disable", form)
+	}
+
+	// The password check shares the login throttle for the account.
+	for i := 0; i <= emailThrottle.freeAttempts; i++ {
+		code, _, body := disable("wrong password")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "Current password is incorrect")
+	}
+
+	code, headers, body := disable("pa$$word")
+	assert.Equal(t, code, http.StatusTooManyRequests)
+	assert.Equal(t, headers.Get("Retry-After"), "1")
+	assert.StringContains(t, body, "Please wait 1 second before trying again")
+
+	entries, err := app.auditLog.List(context.Background(), models.AuditFilter{Action: models.AuditMFADisable})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(entries), 0)
+
+	time.Sleep(time.Second)
+
+	code, headers, _ = disable("pa$$word")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/account/view")
+
+	failures, _, err := app.loginAttempts.Failures(context.Background(), "email:alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, failures, 0)
+
+	entries, err = app.auditLog.List(context.Background(), models.AuditFilter{Action: models.AuditMFADisable})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].ActorID, 1)
+	assert.Equal(t, entries[0].TargetID, 1)
+}
+
+func TestAccountSessions(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ctx := context.Background()
+
+	// Returns the IDs of alice's sessions.
+	sessionIDs := func() []string {
+		sessions, err := app.userSessions.ListForUser(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []string
+		for _, s := range sessions {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+
+	ts.login(t, "alice@example.com", "pa$$word")
+	currentID := sessionIDs()[0]
+
+	// Log in twice more as alice, each time with a different client.
+	second := ts.newClient(t)
+	second.login(t, "alice@example.com", "pa$$word")
+
+	var secondID string
+	for _, id := range sessionIDs() {
+		if id != currentID {
+			secondID = id
+		}
+	}
+
+	third := ts.newClient(t)
+	third.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := ts.get(t, "/account/sessions")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "This device")
+	assert.StringContains(t, body, "/account/sessions/revoke/"+secondID)
+	assert.Equal(t, len(sessionIDs()), 3)
+
+	form := url.Values{}
+	form.Add("csrf_token", extractCsrfToken(t, body))
+
+	t.Run("Revoke current session", func(t *testing.T) {
+		code, _, _ := ts.postForm(t, "/account/sessions/revoke/"+currentID, form)
+		assert.Equal(t, code, http.StatusBadRequest)
+	})
+
+	t.Run("Revoke missing session", func(t *testing.T) {
+		code, _, _ := ts.postForm(t, "/account/sessions/revoke/missing", form)
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		code, headers, _ := ts.postForm(t, "/account/sessions/revoke/"+secondID, form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/account/sessions")
+
+		// The revoked session is logged out, but the others are unaffected.
+		code, headers, _ = second.get(t, "/account/view")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login")
+
+		code, _, _ = third.get(t, "/account/view")
+		assert.Equal(t, code, http.StatusOK)
+	})
+
+	t.Run("Sign out everywhere else", func(t *testing.T) {
+		code, _, _ := ts.postForm(t, "/account/sessions/revoke-others", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		code, _, _ = third.get(t, "/account/view")
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		code, _, _ = ts.get(t, "/account/view")
+		assert.Equal(t, code, http.StatusOK)
+
+		assert.Equal(t, len(sessionIDs()), 1)
+	})
+
+	t.Run("Logout", func(t *testing.T) {
+		code, _, _ := ts.postForm(t, "/user/logout", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		assert.Equal(t, len(sessionIDs()), 0)
+	})
+}
+
+func TestAccountSessionsEscaping(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	// Whoever logs in chooses their own user agent, which is then shown on the page.
+	other := ts.newClient(t)
+	other.setUserAgent("<script>alert(1)</script>")
+	other.login(t, "alice@example.com", "pa$$word")
+
+	_, _, body := ts.get(t, "/account/sessions")
+	assert.StringContains(t, body, "&lt;script&gt;alert(1)&lt;/script&gt;")
+	assert.Equal(t, strings.Contains(body, "<script>alert(1)</script>"), false)
+}
+
+func TestUserLoginRememberMe(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Every session is idle by the time of its next request, so only remembered sessions
+	// should stay logged in.
+	app.sessionIdleTimeout = time.Nanosecond
+
+	tests := []struct {
+		name           string
+		rememberMe     string
+		wantPersistent bool
+		wantLifetime   time.Duration
+		wantCode       int
+	}{
+		{
+			name:           "Browser session",
+			wantPersistent: false,
+			wantLifetime:   12 * time.Hour,
+			wantCode:       http.StatusSeeOther,
+		},
+		{
+			name:           "Remember me",
+			rememberMe:     "true",
+			wantPersistent: true,
+			wantLifetime:   30 * 24 * time.Hour,
+			wantCode:       http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := ts.newClient(t)
+
+			_, _, body := client.get(t, "/user/login")
+
+			form := url.Values{}
+			form.Add("email", "alice@example.com")
+			form.Add("password", "pa$$word")
+			form.Add("remember_me", tt.rememberMe)
+			form.Add("csrf_token", extractCsrfToken(t, body))
+
+			code, headers, _ := client.postForm(t, "/user/login", form)
+			assert.Equal(t, code, http.StatusSeeOther)
+
+			var cookie *http.Cookie
+			for _, c := range (&http.Response{Header: headers}).Cookies() {
+				if c.Name == app.sessionManager.Cookie.Name {
+					cookie = c
+				}
+			}
+			if cookie == nil {
+				t.Fatal("no session cookie set")
+			}
+
+			// Browser-session cookies don't have an expiry time.
+			assert.Equal(t, !cookie.Expires.IsZero(), tt.wantPersistent)
+
+			sessions, err := app.userSessions.ListForUser(context.Background(), 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lifetime := time.Until(sessions[0].Expires)
+			assert.Equal(t, lifetime > tt.wantLifetime-time.Minute && lifetime <= tt.wantLifetime, true)
+
+			// The session cookie is sent from the client's cookie jar.
+			code, _, _ = client.get(t, "/account/view")
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestAdminDashboard(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Anonymous", func(t *testing.T) {
+		code, headers, _ := ts.get(t, "/admin")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login")
+	})
+
+	t.Run("Ordinary user", func(t *testing.T) {
+		client := ts.newClient(t)
+		client.login(t, "alice@example.com", "pa$$word")
+
+		code, _, _ := client.get(t, "/admin")
+		assert.Equal(t, code, http.StatusForbidden)
+
+		_, _, body := client.get(t, "/")
+		assert.Equal(t, strings.Contains(body, "href='/admin'"), false)
+	})
+
+	t.Run("Admin", func(t *testing.T) {
+		client := ts.newClient(t)
+		client.login(t, "dave@example.com", "pa$$word")
+
+		code, _, body := client.get(t, "/admin")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<h2>Admin</h2>")
+		assert.StringContains(t, body, "href='/admin'")
+
+		// The mock models have six users, one live and two expired snippets, and Alice
+		// is the top creator.
+		assert.StringContains(t, body, "<th>Users</th>\n            <td>6</td>")
+		assert.StringContains(t, body, "<th>Expired snippets</th>\n            <td>2</td>")
+		assert.StringContains(t, body, "<td>alice@example.com</td>\n                    <td>3</td>")
+	})
+}
+
+func TestAdminUsers(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "dave@example.com", "pa$$word")
+
+	code, _, body := ts.get(t, "/admin/users?q=ALI")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "alice@example.com")
+	assert.Equal(t, strings.Contains(body, "bob@example.com"), false)
+
+	// Without a query, everyone is listed. Eve's account can be enabled again.
+	code, _, body = ts.get(t, "/admin/users")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "bob@example.com")
+	assert.StringContains(t, body, "action='/admin/users/enable/6'")
+
+	csrfToken := extractCsrfToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		q            string
+		wantCode     int
+		wantLocation string
+		wantFlash    string
+	}{
+		{
+			name:         "Disable",
+			urlPath:      "/admin/users/disable/1",
+			q:            "ali",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/admin/users?q=ali",
+			wantFlash:    "Alice&#39;s account has been disabled.",
+		},
+		{
+			name:         "Enable",
+			urlPath:      "/admin/users/enable/6",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/admin/users",
+			wantFlash:    "Eve&#39;s account has been enabled.",
+		},
+		{
+			name:         "Disable yourself",
+			urlPath:      "/admin/users/disable/5",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/admin/users",
+			wantFlash:    "You can&#39;t disable your own account.",
+		},
+		{
+			name:     "Missing user",
+			urlPath:  "/admin/users/disable/99",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Invalid ID",
+			urlPath:  "/admin/users/disable/abc",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			form.Add("q", tt.q)
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+
+			if tt.wantFlash != "" {
+				_, _, body := ts.get(t, tt.wantLocation)
+				assert.StringContains(t, body, tt.wantFlash)
+			}
+		})
+	}
+
+	t.Run("Not an admin", func(t *testing.T) {
+		client := ts.newClient(t)
+		client.login(t, "alice@example.com", "pa$$word")
+
+		_, _, body := client.get(t, "/account/view")
+
+		form := url.Values{}
+		form.Add("csrf_token", extractCsrfToken(t, body))
+
+		code, _, _ := client.postForm(t, "/admin/users/disable/4", form)
+		assert.Equal(t, code, http.StatusForbidden)
+	})
+}
+
+func TestAdminUserRole(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "dave@example.com", "pa$$word")
+
+	code, _, body := ts.get(t, "/admin/users")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "action='/admin/users/role/1'")
+	assert.StringContains(t, body, "<option value='moderator' selected>moderator</option>")
+
+	csrfToken := extractCsrfToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		role         string
+		wantCode     int
+		wantLocation string
+		wantFlash    string
+	}{
+		{
+			name:         "Make moderator",
+			urlPath:      "/admin/users/role/1",
+			role:         "moderator",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/admin/users",
+			wantFlash:    "Alice&#39;s role has been changed to moderator.",
+		},
+		{
+			name:         "Demote yourself",
+			urlPath:      "/admin/users/role/5",
+			role:         "user",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/admin/users",
+			wantFlash:    "You can&#39;t change your own role.",
+		},
+		{
+			name:     "Invalid role",
+			urlPath:  "/admin/users/role/1",
+			role:     "superuser",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Missing user",
+			urlPath:  "/admin/users/role/99",
+			role:     "admin",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			form.Add("role", tt.role)
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+
+			if tt.wantFlash != "" {
+				_, _, body := ts.get(t, tt.wantLocation)
+				assert.StringContains(t, body, tt.wantFlash)
+			}
+		})
+	}
+
+	// Only the successful change is audited.
+	entries, err := app.auditLog.List(context.Background(), models.AuditFilter{Action: models.AuditUserRoleChange})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].ActorID, 5)
+	assert.Equal(t, entries[0].TargetID, 1)
+	assert.Equal(t, entries[0].Details["to"], "moderator")
+
+	t.Run("Not an admin", func(t *testing.T) {
+		client := ts.newClient(t)
+		client.login(t, "frank@example.com", "pa$$word")
+
+		_, _, body := client.get(t, "/")
+
+		form := url.Values{}
+		form.Add("csrf_token", extractCsrfToken(t, body))
+		form.Add("role", "admin")
+
+		code, _, _ := client.postForm(t, "/admin/users/role/7", form)
+		assert.Equal(t, code, http.StatusForbidden)
+	})
+}
+func TestAdminSnippets(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Only admins get the buttons.
+	code, _, body := ts.get(t, "/snippet/view/1")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, "/admin/snippets/"), false)
+
+	ts.login(t, "dave@example.com", "pa$$word")
+
+	code, _, body = ts.get(t, "/snippet/view/1")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "action='/admin/snippets/expire/1'")
+	assert.StringContains(t, body, "action='/admin/snippets/delete/1'")
+
+	csrfToken := extractCsrfToken(t, body)
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantCode  int
+		wantFlash string
+	}{
+		{"Expire", "/admin/snippets/expire/1", http.StatusSeeOther, "Snippet #1 has been expired."},
+		{"Delete", "/admin/snippets/delete/1", http.StatusSeeOther, "Snippet #1 has been deleted."},
+		{"Expire missing", "/admin/snippets/expire/2", http.StatusNotFound, ""},
+		{"Delete missing", "/admin/snippets/delete/2", http.StatusNotFound, ""},
+		{"Invalid ID", "/admin/snippets/delete/-1", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantFlash != "" {
+				assert.Equal(t, headers.Get("Location"), "/admin")
+
+				_, _, body := ts.get(t, "/admin")
+				assert.StringContains(t, body, tt.wantFlash)
+			}
+		})
+	}
+}
+
+func TestUserLoginDisabled(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", "eve@example.com")
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", extractCsrfToken(t, body))
+
+	code, _, body := ts.postForm(t, "/user/login", form)
+	assert.Equal(t, code, http.StatusForbidden)
+	assert.StringContains(t, body, "Your account has been disabled")
+
+	// With the wrong password, Eve gets the usual message.
+	form.Set("password", "wrong")
+
+	code, _, body = ts.postForm(t, "/user/login", form)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.StringContains(t, body, "Email or password is incorrect")
+}
+
+func TestSnippetReport(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Anonymous users can report snippets too.
+	code, _, body := ts.get(t, "/snippet/view/1")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "action='/snippet/report/1'")
+
+	csrfToken := extractCsrfToken(t, body)
+
+	report := func(t *testing.T, ts *testServer, csrfToken, urlPath, reason string) (int, http.Header, string) {
+		t.Helper()
+
+		form := url.Values{}
+		form.Add("reason", reason)
+		form.Add("csrf_token", csrfToken)
+
+		return ts.postForm(t, urlPath, form)
+	}
+
+	t.Run("Blank reason", func(t *testing.T) {
+		code, _, body := report(t, ts, csrfToken, "/snippet/report/1", " ")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "Please tell us what&#39;s wrong with this snippet")
+	})
+
+	t.Run("Anonymous", func(t *testing.T) {
+		code, headers, _ := report(t, ts, csrfToken, "/snippet/report/1", "Spam")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/snippet/view/1")
+
+		_, _, body := ts.get(t, "/snippet/view/1")
+		assert.StringContains(t, body, "Thanks for your report.")
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		code, headers, _ := report(t, ts, csrfToken, "/snippet/report/1", "Still spam")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/snippet/view/1")
+
+		count, err := app.reports.CountOpen(context.Background(), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, count, 1)
+	})
+
+	// The test application hides snippets once they have two reports.
+	t.Run("Threshold", func(t *testing.T) {
+		client := ts.newClient(t)
+		client.login(t, "alice@example.com", "pa$$word")
+
+		_, _, body := client.get(t, "/snippet/view/1")
+
+		code, headers, _ := report(t, client, extractCsrfToken(t, body), "/snippet/report/1", "Spam")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/")
+
+		reports, err := app.reports.ListOpen(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(reports), 2)
+		assert.Equal(t, reports[1].ReporterID, 1)
+	})
+
+	t.Run("Hidden", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/snippet/view/5")
+		assert.Equal(t, code, http.StatusGone)
+
+		code, _, _ = report(t, ts, csrfToken, "/snippet/report/5", "Spam")
+		assert.Equal(t, code, http.StatusGone)
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		code, _, _ := report(t, ts, csrfToken, "/snippet/report/2", "Spam")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+}
+
+func TestModeration(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Ordinary user", func(t *testing.T) {
+		client := ts.newClient(t)
+		client.login(t, "alice@example.com", "pa$$word")
+
+		code, _, _ := client.get(t, "/moderation")
+		assert.Equal(t, code, http.StatusForbidden)
+	})
+
+	t.Run("Admin", func(t *testing.T) {
+		client := ts.newClient(t)
+		client.login(t, "dave@example.com", "pa$$word")
+
+		code, _, body := client.get(t, "/moderation")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "There are no open reports.")
+	})
+
+	ts.login(t, "frank@example.com", "pa$$word")
+
+	// Moderators can't use the admin pages.
+	code, _, _ := ts.get(t, "/admin")
+	assert.Equal(t, code, http.StatusForbidden)
+
+	ctx := context.Background()
+	for _, r := range []models.Report{
+		{SnippetID: 1, ReporterIP: "192.0.2.1", Reason: "Spam"},
+		{SnippetID: 5, ReporterID: 1, ReporterIP: "192.0.2.2", Reason: "Offensive"},
+		{SnippetID: 2, ReporterIP: "192.0.2.3", Reason: "Gone now"},
+	} {
+		_, err := app.reports.Insert(ctx, r.SnippetID, r.ReporterID, r.ReporterIP, r.Reason)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	code, _, body := ts.get(t, "/moderation")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "href='/moderation'")
+	assert.StringContains(t, body, "<strong>An old silent pond</strong>")
+	assert.StringContains(t, body, "<td>Anonymous (192.0.2.1)</td>")
+	assert.StringContains(t, body, "<span>#5 (hidden)</span>")
+	assert.StringContains(t, body, "<td>Alice (192.0.2.2)</td>")
+	assert.StringContains(t, body, "<strong>Expired or deleted</strong>")
+	assert.Equal(t, strings.Contains(body, "action='/moderation/hide/2'"), false)
+
+	csrfToken := extractCsrfToken(t, body)
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantCode  int
+		wantFlash string
+	}{
+		{"Dismiss", "/moderation/dismiss/2", http.StatusSeeOther, "The reports against snippet #2 have been dismissed."},
+		{"Hide", "/moderation/hide/5", http.StatusSeeOther, "Snippet #5 has been hidden."},
+		{"Delete", "/moderation/delete/1", http.StatusSeeOther, "Snippet #1 has been deleted."},
+		{"Hide missing", "/moderation/hide/2", http.StatusNotFound, ""},
+		{"Delete missing", "/moderation/delete/2", http.StatusNotFound, ""},
+		{"Invalid ID", "/moderation/dismiss/abc", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantFlash != "" {
+				assert.Equal(t, headers.Get("Location"), "/moderation")
+
+				_, _, body := ts.get(t, "/moderation")
+				assert.StringContains(t, body, tt.wantFlash)
+			}
+		})
+	}
+
+	_, _, body = ts.get(t, "/moderation")
+	assert.StringContains(t, body, "There are no open reports.")
+}
+
+func TestModerationEscaping(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Anyone can report a snippet, so the reason has to be escaped when moderators see it.
+	reporter := ts.newClient(t)
+
+	_, _, body := reporter.get(t, "/snippet/view/1")
+
+	form := url.Values{}
+	form.Add("reason", "<b>x</b>")
+	form.Add("csrf_token", extractCsrfToken(t, body))
+
+	code, _, _ := reporter.postForm(t, "/snippet/report/1", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	ts.login(t, "frank@example.com", "pa$$word")
+
+	_, _, body = ts.get(t, "/moderation")
+	assert.StringContains(t, body, "&lt;b&gt;x&lt;/b&gt;")
+	assert.Equal(t, strings.Contains(body, "<b>x</b>"), false)
+}
+
+func TestAuditLog(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ctx := context.Background()
+
+	// A failed login against Alice's account, then a successful one.
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", "alice@example.com")
+	form.Add("password", "wrong")
+	form.Add("csrf_token", extractCsrfToken(t, body))
+
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+
+	ts.login(t, "alice@example.com", "pa$$word")
+
+	entries, err := app.auditLog.List(ctx, models.AuditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(entries), 2)
+	assert.Equal(t, entries[0].Action, models.AuditLogin)
+	assert.Equal(t, entries[0].ActorID, 1)
+	assert.Equal(t, entries[0].IP, "127.0.0.1")
+	assert.Equal(t, entries[1].Action, models.AuditLoginFailed)
+	assert.Equal(t, entries[1].ActorID, 0)
+	assert.Equal(t, entries[1].TargetID, 1)
+	assert.Equal(t, entries[1].Details["reason"], "wrong password")
+
+	t.Run("Security activity", func(t *testing.T) {
+		code, _, body := ts.get(t, "/account/activity")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<td>Logged in</td>\n                    <td>You</td>")
+		assert.StringContains(t, body, "<td>Failed login (wrong password)</td>\n                    <td>Unknown</td>")
+	})
+
+	t.Run("Not an admin", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/admin/audit")
+		assert.Equal(t, code, http.StatusForbidden)
+	})
+
+	admin := ts.newClient(t)
+	admin.login(t, "dave@example.com", "pa$$word")
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		want     []string
+		wantNot  []string
+	}{
+		{
+			name:     "Everything",
+			urlPath:  "/admin/audit",
+			wantCode: http.StatusOK,
+			want:     []string{"<td>Dave (#5)</td>", "<td>Alice (#1)</td>", "<td>Anonymous</td>", "<td>user #1</td>"},
+		},
+		{
+			name:     "By user and action",
+			urlPath:  "/admin/audit?user=alice@example.com&action=login_failed",
+			wantCode: http.StatusOK,
+			want:     []string{"<td>Failed login</td>", "email: alice@example.com<br>reason: wrong password<br>", "value='login_failed' selected"},
+			wantNot:  []string{"<td>Logged in</td>"},
+		},
+		{
+			name:     "Unknown user",
+			urlPath:  "/admin/audit?user=nobody@example.com",
+			wantCode: http.StatusOK,
+			want:     []string{"No entries matched."},
+		},
+		{
+			name:     "Invalid action",
+			urlPath:  "/admin/audit?action=bogus",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := admin.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+
+			for _, want := range tt.want {
+				assert.StringContains(t, body, want)
+			}
+			for _, notWant := range tt.wantNot {
+				assert.Equal(t, strings.Contains(body, notWant), false)
+			}
+		})
+	}
+
+	t.Run("Admin actions", func(t *testing.T) {
+		_, _, body := admin.get(t, "/admin/users")
+
+		form := url.Values{}
+		form.Add("csrf_token", extractCsrfToken(t, body))
+
+		code, _, _ := admin.postForm(t, "/admin/users/disable/2", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		code, _, _ = admin.postForm(t, "/admin/snippets/delete/1", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		entries, err := app.auditLog.List(ctx, models.AuditFilter{UserID: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(entries), 3)
+		assert.Equal(t, entries[0].Action, models.AuditSnippetDelete)
+		assert.Equal(t, entries[0].TargetType, models.AuditTargetSnippet)
+		assert.Equal(t, entries[0].TargetID, 1)
+		assert.Equal(t, entries[1].Action, models.AuditUserDisable)
+		assert.Equal(t, entries[1].Details["email"], "bob@example.com")
+	})
+
+	t.Run("Logout", func(t *testing.T) {
+		_, _, body := ts.get(t, "/account/view")
+
+		form := url.Values{}
+		form.Add("csrf_token", extractCsrfToken(t, body))
+
+		code, _, _ := ts.postForm(t, "/user/logout", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		entries, err := app.auditLog.List(ctx, models.AuditFilter{Action: models.AuditLogout})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(entries), 1)
+		assert.Equal(t, entries[0].ActorID, 1)
+	})
+}
+
+func TestAuditLogEscaping(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// A failed login records the attacker's user agent against Alice's account, where both
+	// she and the admins will see it.
+	const userAgent = "<script>alert(1)</script>"
+
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", "alice@example.com")
+	form.Add("password", "wrong")
+	form.Add("csrf_token", extractCsrfToken(t, body))
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/user/login", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", userAgent)
+
+	rs, err := ts.client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+	assert.Equal(t, rs.StatusCode, http.StatusUnprocessableEntity)
+
+	alice := ts.newClient(t)
+	alice.login(t, "alice@example.com", "pa$$word")
+
+	dave := ts.newClient(t)
+	dave.login(t, "dave@example.com", "pa$$word")
+
+	for _, page := range []struct {
+		client  *testServer
+		urlPath string
+	}{
+		{alice, "/account/activity"},
+		{dave, "/admin/audit"},
+	} {
+		_, _, body := page.client.get(t, page.urlPath)
+		assert.StringContains(t, body, "&lt;script&gt;alert(1)&lt;/script&gt;")
+		assert.Equal(t, strings.Contains(body, userAgent), false)
+	}
+}
+
+func TestOrgs(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	alice := ts.newClient(t)
+	alice.login(t, "alice@example.com", "pa$$word")
+
+	_, _, body := alice.get(t, "/org/create")
+	csrfToken := extractCsrfToken(t, body)
+
+	t.Run("Create", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("name", " ")
+		form.Add("csrf_token", csrfToken)
+
+		code, _, body := alice.postForm(t, "/org/create", form)
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "Name can&#39;t be blank")
+
+		form.Set("name", "Acme")
+
+		code, headers, _ := alice.postForm(t, "/org/create", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/org/view/1")
+
+		code, _, body = alice.get(t, "/org/view/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<h2>Acme</h2>")
+		assert.StringContains(t, body, "<a href='/snippet/view/6'>Team notes</a>")
+		assert.StringContains(t, body, "<td>alice@example.com</td>")
+		assert.StringContains(t, body, "action='/org/invite/1'")
+
+		_, _, body = alice.get(t, "/account/view")
+		assert.StringContains(t, body, "<a href='/org/view/1'>Acme</a>")
+	})
+
+	t.Run("Not a member", func(t *testing.T) {
+		client := ts.newClient(t)
+		client.login(t, "dave@example.com", "pa$$word")
+
+		code, _, _ := client.get(t, "/org/view/1")
+		assert.Equal(t, code, http.StatusNotFound)
+
+		code, _, _ = client.get(t, "/org/view/2")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	var joinPath string
+
+	t.Run("Invite", func(t *testing.T) {
+		mailer := &testMailer{}
+		app.mailer = mailer
+
+		form := url.Values{}
+		form.Add("email", "frank@")
+		form.Add("role", "member")
+		form.Add("csrf_token", csrfToken)
+
+		code, _, body := alice.postForm(t, "/org/invite/1", form)
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "This field must be a valid email address")
+
+		form.Set("email", "frank@example.com")
+
+		code, headers, _ := alice.postForm(t, "/org/invite/1", form)
+		app.wg.Wait()
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/org/view/1")
+
+		emails := mailer.emails()
+		assert.Equal(t, len(emails), 1)
+		assert.Equal(t, emails[0].recipient, "frank@example.com")
+		assert.Equal(t, emails[0].templateFile, "org_invitation.tmpl")
+
+		joinURL := emails[0].data.(map[string]any)["JoinURL"].(string)
+		joinPath = strings.TrimPrefix(joinURL, "https://snippetbox.example.com")
+		assert.StringContains(t, joinPath, "/org/join/")
+
+		entries, err := app.auditLog.List(context.Background(), models.AuditFilter{Action: models.AuditOrgInvite})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(entries), 1)
+		assert.Equal(t, entries[0].Details["email"], "frank@example.com")
+	})
+
+	t.Run("Join", func(t *testing.T) {
+		// The link only works for the person it was sent to.
+		dave := ts.newClient(t)
+		dave.login(t, "dave@example.com", "pa$$word")
+
+		code, _, body := dave.get(t, joinPath)
+		assert.Equal(t, code, http.StatusForbidden)
+		assert.StringContains(t, body, "was sent to a different email address")
+
+		frank := ts.newClient(t)
+		frank.login(t, "frank@example.com", "pa$$word")
+
+		code, _, body = frank.get(t, joinPath)
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "You've been invited to join Acme as a member.")
+
+		form := url.Values{}
+		form.Add("csrf_token", extractCsrfToken(t, body))
+
+		code, headers, _ := frank.postForm(t, joinPath, form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/org/view/1")
+
+		// Members can see the organization, but only owners can invite people.
+		code, _, body = frank.get(t, "/org/view/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "Welcome to Acme!")
+		assert.StringContains(t, body, "<td>frank@example.com</td>")
+		assert.Equal(t, strings.Contains(body, "action='/org/invite/1'"), false)
+
+		form = url.Values{}
+		form.Add("email", "dave@example.com")
+		form.Add("role", "owner")
+		form.Add("csrf_token", extractCsrfToken(t, body))
+
+		code, _, _ = frank.postForm(t, "/org/invite/1", form)
+		assert.Equal(t, code, http.StatusForbidden)
+
+		// Invitations can only be used once.
+		code, _, body = frank.get(t, joinPath)
+		assert.Equal(t, code, http.StatusNotFound)
+		assert.StringContains(t, body, "This invitation is invalid or has expired.")
+	})
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		code, headers, _ := ts.get(t, "/org/view/1")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login")
+	})
+}
+
+func TestOrgSnippets(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Alice owns the organization which mock snippet 6 belongs to, although Bob created it.
+	// Frank is an ordinary member.
+	orgID, err := app.orgs.Insert(context.Background(), "Acme", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := app.orgs.Invite(context.Background(), orgID, "frank@example.com", models.OrgRoleMember, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = app.orgs.AcceptInvitation(context.Background(), token, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := ts.newClient(t)
+	alice.login(t, "alice@example.com", "pa$$word")
+
+	frank := ts.newClient(t)
+	frank.login(t, "frank@example.com", "pa$$word")
+
+	dave := ts.newClient(t)
+	dave.login(t, "dave@example.com", "pa$$word")
+
+	t.Run("View", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/snippet/view/6")
+		assert.Equal(t, code, http.StatusNotFound)
+
+		code, _, _ = dave.get(t, "/snippet/view/6")
+		assert.Equal(t, code, http.StatusNotFound)
+
+		code, _, body := alice.get(t, "/snippet/view/6")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "Owned by <a href='/org/view/1'>Acme</a> (members only)")
+		assert.StringContains(t, body, "<a href='/snippet/edit/6'>Edit</a>")
+
+		// Only people who can edit a snippet get the link.
+		code, _, body = dave.get(t, "/snippet/view/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, strings.Contains(body, "/snippet/edit/1"), false)
+		assert.Equal(t, strings.Contains(body, "Owned by"), false)
+	})
+
+	t.Run("Edit access", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			client   *testServer
+			urlPath  string
+			wantCode int
+		}{
+			{"Creator", alice, "/snippet/edit/1", http.StatusOK},
+			{"Org owner", alice, "/snippet/edit/6", http.StatusOK},
+			{"Org member", frank, "/snippet/edit/6", http.StatusOK},
+			{"Someone else's snippet", dave, "/snippet/edit/1", http.StatusForbidden},
+			{"Org-only snippet", dave, "/snippet/edit/6", http.StatusNotFound},
+			{"Hidden", alice, "/snippet/edit/5", http.StatusGone},
+			{"Missing", alice, "/snippet/edit/2", http.StatusNotFound},
+			{"Invalid ID", alice, "/snippet/edit/foo", http.StatusNotFound},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				code, _, _ := tt.client.get(t, tt.urlPath)
+				assert.Equal(t, code, tt.wantCode)
+			})
+		}
+
+		code, headers, _ := ts.get(t, "/snippet/edit/1")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login")
+	})
+
+	t.Run("Edit", func(t *testing.T) {
+		_, _, body := alice.get(t, "/snippet/edit/6")
+		assert.StringContains(t, body, "value='org' checked")
+
+		csrfToken := extractCsrfToken(t, body)
+
+		tests := []struct {
+			name       string
+			urlPath    string
+			title      string
+			visibility string
+			wantCode   int
+			wantBody   string
+		}{
+			{"Valid", "/snippet/edit/6", "New title", "public", http.StatusSeeOther, ""},
+			{"Blank title", "/snippet/edit/6", "", "org", http.StatusUnprocessableEntity, "Title can&#39;t be blank"},
+			{"Invalid visibility", "/snippet/edit/6", "Title", "secret", http.StatusUnprocessableEntity, "Please choose who can see this snippet"},
+			{"Org-only without an org", "/snippet/edit/1", "Title", "org", http.StatusUnprocessableEntity, "Only organization snippets can be limited to its members"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				form := url.Values{}
+				form.Add("title", tt.title)
+				form.Add("content", "Content")
+				form.Add("visibility", tt.visibility)
+				form.Add("csrf_token", csrfToken)
+
+				code, headers, body := alice.postForm(t, tt.urlPath, form)
+				assert.Equal(t, code, tt.wantCode)
+
+				if code == http.StatusSeeOther {
+					assert.Equal(t, headers.Get("Location"), "/snippet/view/6")
+				} else {
+					assert.StringContains(t, body, tt.wantBody)
+				}
+			})
+		}
+
+		entries, err := app.auditLog.List(context.Background(), models.AuditFilter{Action: models.AuditSnippetEdit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(entries), 1)
+		assert.Equal(t, entries[0].ActorID, 1)
+		assert.Equal(t, entries[0].TargetID, 6)
+	})
+
+	t.Run("Owner access", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			client   *testServer
+			method   string
+			urlPath  string
+			form     url.Values
+			wantCode int
+		}{
+			{"Settings as org owner", alice, http.MethodGet, "/snippet/settings/6", nil, http.StatusOK},
+			{"Settings as org member", frank, http.MethodGet, "/snippet/settings/6", nil, http.StatusForbidden},
+			{"Settings as non-member", dave, http.MethodGet, "/snippet/settings/6", nil, http.StatusNotFound},
+			{"Share as non-member", dave, http.MethodPost, "/snippet/share/6", url.Values{"email": {"dave@example.com"}, "permission": {"edit"}}, http.StatusNotFound},
+			{"Share as org owner", alice, http.MethodPost, "/snippet/share/6", url.Values{"email": {"dave@example.com"}, "permission": {"view"}}, http.StatusSeeOther},
+			{"Share as org member", frank, http.MethodPost, "/snippet/share/6", url.Values{"email": {"dave@example.com"}, "permission": {"edit"}}, http.StatusForbidden},
+			{"Unshare as org member", frank, http.MethodPost, "/snippet/unshare/6", url.Values{"user": {"5"}}, http.StatusForbidden},
+			{"Share link as org member", frank, http.MethodPost, "/snippet/links/create/6", url.Values{"expires": {"7"}}, http.StatusForbidden},
+			{"Share link as org owner", alice, http.MethodPost, "/snippet/links/create/6", url.Values{"expires": {"7"}}, http.StatusSeeOther},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if tt.method == http.MethodGet {
+					code, _, _ := tt.client.get(t, tt.urlPath)
+					assert.Equal(t, code, tt.wantCode)
+					return
+				}
+
+				_, _, body := tt.client.get(t, "/snippet/create")
+				tt.form.Add("csrf_token", extractCsrfToken(t, body))
+
+				code, _, _ := tt.client.postForm(t, tt.urlPath, tt.form)
+				assert.Equal(t, code, tt.wantCode)
+			})
+		}
+
+		// Only the org owner's changes went through.
+		for _, action := range []models.AuditAction{models.AuditSnippetShare, models.AuditShareLinkCreate} {
+			entries, err := app.auditLog.List(context.Background(), models.AuditFilter{Action: action})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, len(entries), 1)
+			assert.Equal(t, entries[0].ActorID, 1)
+		}
+	})
+
+	t.Run("Visibility", func(t *testing.T) {
+		// Members can edit the snippet, but not change who can see it.
+		_, _, body := frank.get(t, "/snippet/edit/6")
+		assert.Equal(t, strings.Contains(body, "name='visibility'"), false)
+
+		_, _, body = alice.get(t, "/snippet/edit/6")
+		assert.StringContains(t, body, "name='visibility'")
+
+		// An invalid visibility shows that the member's choice is ignored rather than checked.
+		form := url.Values{}
+		form.Add("title", "Title")
+		form.Add("content", "Content")
+		form.Add("visibility", "secret")
+		form.Add("csrf_token", extractCsrfToken(t, body))
+
+		code, _, _ := alice.postForm(t, "/snippet/edit/6", form)
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+
+		_, _, body = frank.get(t, "/snippet/edit/6")
+		form.Set("csrf_token", extractCsrfToken(t, body))
+
+		code, _, _ = frank.postForm(t, "/snippet/edit/6", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+	})
+
+	t.Run("Create", func(t *testing.T) {
+		_, _, body := alice.get(t, "/snippet/create")
+		assert.StringContains(t, body, "<option value='1'>Acme</option>")
+
+		csrfToken := extractCsrfToken(t, body)
+
+		tests := []struct {
+			name       string
+			org        string
+			visibility string
+			wantCode   int
+			wantBody   string
+		}{
+			{"Org-only", "1", "org", http.StatusSeeOther, ""},
+			{"Not a member", "2", "public", http.StatusUnprocessableEntity, "You aren&#39;t a member of that organization"},
+			{"Org-only without an org", "0", "org", http.StatusUnprocessableEntity, "Only organization snippets can be limited to its members"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				form := url.Values{}
+				form.Add("title", "Title")
+				form.Add("content", "Content")
+				form.Add("org", tt.org)
+				form.Add("visibility", tt.visibility)
+				form.Add("csrf_token", csrfToken)
+
+				code, headers, body := alice.postForm(t, "/snippet/create", form)
+				assert.Equal(t, code, tt.wantCode)
+
+				if code == http.StatusSeeOther {
+					assert.Equal(t, headers.Get("Location"), "/snippet/view/2")
+				} else {
+					assert.StringContains(t, body, tt.wantBody)
+				}
+			})
+		}
+	})
+}
+
+func TestSnippetSharing(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Mock snippet 7 is Bob's, and nobody else can see it until he shares it.
+	bob := ts.newClient(t)
+	bob.login(t, "bob@example.com", "pa$$word")
+
+	alice := ts.newClient(t)
+	alice.login(t, "alice@example.com", "pa$$word")
+
+	code, _, _ := ts.get(t, "/snippet/view/7")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	code, _, _ = alice.get(t, "/snippet/view/7")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	code, _, body := bob.get(t, "/snippet/view/7")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "This snippet hasn't been shared with anyone.")
+
+	bobToken := extractCsrfToken(t, body)
+
+	_, _, body = alice.get(t, "/user/shared")
+	aliceToken := extractCsrfToken(t, body)
+
+	share := func(t *testing.T, client *testServer, csrfToken, email, permission string) (int, http.Header, string) {
+		form := url.Values{}
+		form.Add("email", email)
+		form.Add("permission", permission)
+		form.Add("csrf_token", csrfToken)
+
+		return client.postForm(t, "/snippet/share/7", form)
+	}
+
+	t.Run("Share", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			email      string
+			permission string
+			wantCode   int
+			wantBody   string
+		}{
+			{"Unknown email", "nobody@example.com", "view", http.StatusUnprocessableEntity, "There&#39;s no account with that email address"},
+			{"Owner", "bob@example.com", "view", http.StatusUnprocessableEntity, "That&#39;s the snippet&#39;s owner"},
+			{"Invalid permission", "alice@example.com", "delete", http.StatusUnprocessableEntity, "Please choose what they can do"},
+			{"Valid", "alice@example.com", "view", http.StatusSeeOther, ""},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				code, headers, body := share(t, bob, bobToken, tt.email, tt.permission)
+				assert.Equal(t, code, tt.wantCode)
+
+				if code == http.StatusSeeOther {
+					assert.Equal(t, headers.Get("Location"), "/snippet/view/7")
+				} else {
+					assert.StringContains(t, body, tt.wantBody)
+				}
+			})
+		}
+
+		_, _, body := bob.get(t, "/snippet/view/7")
+		assert.StringContains(t, body, "Snippet shared with alice@example.com")
+		assert.StringContains(t, body, "<td>alice@example.com</td>")
+	})
+
+	t.Run("View permission", func(t *testing.T) {
+		code, _, body := alice.get(t, "/snippet/view/7")
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, strings.Contains(body, "/snippet/edit/7"), false)
+		assert.Equal(t, strings.Contains(body, "<summary>Share</summary>"), false)
+
+		code, _, _ = alice.get(t, "/snippet/edit/7")
+		assert.Equal(t, code, http.StatusForbidden)
+
+		// Only the owner can share the snippet with anyone else.
+		code, _, _ = share(t, alice, aliceToken, "dave@example.com", "view")
+		assert.Equal(t, code, http.StatusForbidden)
+
+		code, _, body = alice.get(t, "/user/shared")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<a href='/snippet/view/7'>Draft</a>")
+	})
+
+	t.Run("Edit permission", func(t *testing.T) {
+		code, _, _ := share(t, bob, bobToken, "alice@example.com", "edit")
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		code, _, body := alice.get(t, "/snippet/edit/7")
+		assert.Equal(t, code, http.StatusOK)
+
+		// People the snippet has been shared with can't change who can see it.
+		assert.Equal(t, strings.Contains(body, "name='visibility'"), false)
+
+		form := url.Values{}
+		form.Add("title", "Draft")
+		form.Add("content", "Ready now")
+		form.Add("csrf_token", aliceToken)
+
+		code, headers, _ := alice.postForm(t, "/snippet/edit/7", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/snippet/view/7")
+	})
+
+	t.Run("Unshare", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("user", "1")
+		form.Add("csrf_token", bobToken)
+
+		code, headers, _ := bob.postForm(t, "/snippet/unshare/7", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/snippet/view/7")
+
+		code, _, _ = alice.get(t, "/snippet/view/7")
+		assert.Equal(t, code, http.StatusNotFound)
+
+		code, _, body := alice.get(t, "/user/shared")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "Nobody has shared a snippet with you yet.")
+
+		code, _, _ = bob.postForm(t, "/snippet/unshare/7", form)
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	for action, want := range map[models.AuditAction]int{
+		models.AuditSnippetShare:   2,
+		models.AuditSnippetUnshare: 1,
+	} {
+		entries, err := app.auditLog.List(context.Background(), models.AuditFilter{Action: action})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(entries), want)
+	}
+}
+
+func TestShareLinks(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Mock snippet 7 is Bob's, and nobody else can see it.
+	bob := ts.newClient(t)
+	bob.login(t, "bob@example.com", "pa$$word")
+
+	alice := ts.newClient(t)
+	alice.login(t, "alice@example.com", "pa$$word")
+
+	code, _, body := bob.get(t, "/snippet/settings/7")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "This snippet doesn't have any share links.")
+
+	bobToken := extractCsrfToken(t, body)
+
+	// Only the snippet's owners can manage its links.
+	code, _, _ = alice.get(t, "/snippet/settings/7")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	code, _, body = alice.get(t, "/snippet/settings/1")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "This snippet is public")
+
+	aliceToken := extractCsrfToken(t, body)
+
+	linkRegex := regexp.MustCompile(`https://snippetbox\.example\.com/snippet/link/([\w.-]+)`)
+
+	createLink := func(t *testing.T, maxViews string) string {
+		form := url.Values{}
+		form.Add("expires", "7")
+		form.Add("max_views", maxViews)
+		form.Add("csrf_token", bobToken)
+
+		code, headers, _ := bob.postForm(t, "/snippet/links/create/7", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/snippet/settings/7")
+
+		_, _, body := bob.get(t, "/snippet/settings/7")
+
+		matches := linkRegex.FindStringSubmatch(body)
+		if matches == nil {
+			t.Fatal("no share link in the flash message")
+		}
+
+		return matches[1]
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			client   *testServer
+			urlPath  string
+			token    string
+			expires  string
+			maxViews string
+			wantCode int
+			wantBody string
+		}{
+			{"Invalid expiry", bob, "/snippet/links/create/7", bobToken, "3", "0", http.StatusUnprocessableEntity, "This field must equal 1, 7 or 30"},
+			{"Negative max views", bob, "/snippet/links/create/7", bobToken, "7", "-1", http.StatusUnprocessableEntity, "This field must be between 0 and 1000"},
+			{"Public snippet", alice, "/snippet/links/create/1", aliceToken, "7", "0", http.StatusUnprocessableEntity, "Public snippets can already be seen by anyone with their address"},
+			{"Not the owner", alice, "/snippet/links/create/7", aliceToken, "7", "0", http.StatusNotFound, ""},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				form := url.Values{}
+				form.Add("expires", tt.expires)
+				form.Add("max_views", tt.maxViews)
+				form.Add("csrf_token", tt.token)
+
+				code, _, body := tt.client.postForm(t, tt.urlPath, form)
+				assert.Equal(t, code, tt.wantCode)
+				assert.StringContains(t, body, tt.wantBody)
+			})
+		}
+	})
+
+	t.Run("View", func(t *testing.T) {
+		token := createLink(t, "2")
+
+		// Anyone with the link can see the snippet, until its views have been used up.
+		for i := 0; i < 2; i++ {
+			code, _, body := ts.get(t, "/snippet/link/"+token)
+			assert.Equal(t, code, http.StatusOK)
+			assert.StringContains(t, body, "Not ready yet")
+			assert.Equal(t, strings.Contains(body, "/snippet/report/7"), false)
+		}
+
+		code, _, _ := ts.get(t, "/snippet/link/"+token)
+		assert.Equal(t, code, http.StatusNotFound)
+
+		_, _, body := bob.get(t, "/snippet/settings/7")
+		assert.StringContains(t, body, "2 of 2 (no longer works)")
+
+		id, _, _ := models.ParseShareLinkToken(token)
+
+		for _, token := range []string{"nonsense", models.FormatShareLinkToken(id, "wrong"), token + "x"} {
+			code, _, _ := ts.get(t, "/snippet/link/"+token)
+			assert.Equal(t, code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		token := createLink(t, "0")
+
+		code, _, _ := ts.get(t, "/snippet/link/"+token)
+		assert.Equal(t, code, http.StatusOK)
+
+		id, _, _ := models.ParseShareLinkToken(token)
+
+		form := url.Values{}
+		form.Add("link", strconv.Itoa(id))
+		form.Add("csrf_token", bobToken)
+
+		code, headers, _ := bob.postForm(t, "/snippet/links/revoke/7", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/snippet/settings/7")
+
+		code, _, _ = ts.get(t, "/snippet/link/"+token)
+		assert.Equal(t, code, http.StatusNotFound)
+
+		code, _, _ = bob.postForm(t, "/snippet/links/revoke/7", form)
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Snippet can't be shown", func(t *testing.T) {
+		ctx := context.Background()
+
+		// Mock snippet 5 has been hidden by a moderator, and there's no snippet 99.
+		for snippetID, wantCode := range map[int]int{5: http.StatusGone, 99: http.StatusNotFound} {
+			token, err := app.links.Insert(ctx, snippetID, time.Hour, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			code, _, _ := ts.get(t, "/snippet/link/"+token)
+			assert.Equal(t, code, wantCode)
+
+			// The link's only view hasn't been used up.
+			links, err := app.links.ListForSnippet(ctx, snippetID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, links[0].Views, 0)
+		}
+	})
+
+	for action, want := range map[models.AuditAction]int{
+		models.AuditShareLinkCreate: 2,
+		models.AuditShareLinkRevoke: 1,
+	} {
+		entries, err := app.auditLog.List(context.Background(), models.AuditFilter{Action: action})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(entries), want)
+	}
+}
+
+func TestCollections(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Alice can see mock snippet 6 (which only the organization's members can see) as well
+	// as her own public snippet 1.
+	_, err := app.orgs.Insert(context.Background(), "Acme", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := ts.newClient(t)
+	alice.login(t, "alice@example.com", "pa$$word")
+
+	dave := ts.newClient(t)
+	dave.login(t, "dave@example.com", "pa$$word")
+
+	_, _, body := alice.get(t, "/collection/create")
+	csrfToken := extractCsrfToken(t, body)
+
+	_, _, body = dave.get(t, "/snippet/view/1")
+	daveToken := extractCsrfToken(t, body)
+
+	t.Run("Create", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			collection string
+			visibility string
+			wantCode   int
+			wantBody   string
+		}{
+			{"Blank name", " ", "public", http.StatusUnprocessableEntity, "Name can&#39;t be blank"},
+			{"Org-only", "Onboarding", "org", http.StatusUnprocessableEntity, "Please choose who can see this collection"},
+			{"Valid", "Onboarding", "public", http.StatusSeeOther, ""},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				form := url.Values{}
+				form.Add("name", tt.collection)
+				form.Add("visibility", tt.visibility)
+				form.Add("csrf_token", csrfToken)
+
+				code, headers, body := alice.postForm(t, "/collection/create", form)
+				assert.Equal(t, code, tt.wantCode)
+
+				if code == http.StatusSeeOther {
+					assert.Equal(t, headers.Get("Location"), "/collection/view/1")
+				} else {
+					assert.StringContains(t, body, tt.wantBody)
+				}
+			})
+		}
+
+		_, _, body := alice.get(t, "/account/view")
+		assert.StringContains(t, body, "<a href='/collection/view/1'>Onboarding</a>")
+	})
+
+	snippetForm := func(token string, snippetID int) url.Values {
+		form := url.Values{}
+		form.Add("snippet", strconv.Itoa(snippetID))
+		form.Add("csrf_token", token)
+		return form
+	}
+
+	t.Run("Add", func(t *testing.T) {
+		_, _, body := alice.get(t, "/snippet/view/1")
+		assert.StringContains(t, body, "<form action='/collection/add/1' method='POST'>")
+
+		tests := []struct {
+			name      string
+			client    *testServer
+			token     string
+			snippetID int
+			wantCode  int
+			wantFlash string
+		}{
+			{"Valid", alice, csrfToken, 1, http.StatusSeeOther, "Added to Onboarding"},
+			{"Duplicate", alice, csrfToken, 1, http.StatusSeeOther, "This snippet is already in Onboarding"},
+			{"Org snippet", alice, csrfToken, 6, http.StatusSeeOther, "Added to Onboarding"},
+			{"Can't see snippet", alice, csrfToken, 7, http.StatusNotFound, ""},
+			{"Missing snippet", alice, csrfToken, 2, http.StatusNotFound, ""},
+			{"Someone else's collection", dave, daveToken, 1, http.StatusForbidden, ""},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				code, headers, _ := tt.client.postForm(t, "/collection/add/1", snippetForm(tt.token, tt.snippetID))
+				assert.Equal(t, code, tt.wantCode)
+
+				if code == http.StatusSeeOther {
+					location := "/snippet/view/" + strconv.Itoa(tt.snippetID)
+					assert.Equal(t, headers.Get("Location"), location)
+
+					_, _, body := tt.client.get(t, location)
+					assert.StringContains(t, body, tt.wantFlash)
+				}
+			})
+		}
+
+		// Public collections are listed on the pages of the snippets they include.
+		_, _, body = ts.get(t, "/snippet/view/1")
+		assert.StringContains(t, body, "In collections:")
+		assert.StringContains(t, body, "<a href='/collection/view/1'>Onboarding</a>")
+	})
+
+	t.Run("View", func(t *testing.T) {
+		code, _, body := alice.get(t, "/collection/view/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<h2>Onboarding</h2>")
+		assert.Equal(t, strings.Index(body, "An old silent pond") < strings.Index(body, "Team notes"), true)
+		assert.StringContains(t, body, "/collection/move/1")
+
+		// Snippets are left out for people who can't see them.
+		code, _, body = ts.get(t, "/collection/view/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "An old silent pond")
+		assert.Equal(t, strings.Contains(body, "Team notes"), false)
+		assert.Equal(t, strings.Contains(body, "/collection/move/1"), false)
+
+		code, _, _ = ts.get(t, "/collection/view/2")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Move", func(t *testing.T) {
+		form := snippetForm(csrfToken, 6)
+		form.Add("direction", "up")
+
+		code, headers, _ := alice.postForm(t, "/collection/move/1", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/collection/view/1")
+
+		_, _, body := alice.get(t, "/collection/view/1")
+		assert.Equal(t, strings.Index(body, "Team notes") < strings.Index(body, "An old silent pond"), true)
+
+		form.Set("direction", "sideways")
+		code, _, _ = alice.postForm(t, "/collection/move/1", form)
+		assert.Equal(t, code, http.StatusBadRequest)
+
+		// Snippets can only be moved within the collection they're in.
+		form = snippetForm(csrfToken, 5)
+		form.Add("direction", "down")
+
+		code, _, _ = alice.postForm(t, "/collection/move/1", form)
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("name", "Secrets")
+		form.Add("visibility", "private")
+		form.Add("csrf_token", daveToken)
+
+		code, _, _ := dave.postForm(t, "/collection/rename/1", form)
+		assert.Equal(t, code, http.StatusForbidden)
+
+		form.Set("csrf_token", csrfToken)
+
+		code, headers, _ := alice.postForm(t, "/collection/rename/1", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/collection/view/1")
+
+		_, _, body := alice.get(t, "/collection/view/1")
+		assert.StringContains(t, body, "<h2>Secrets</h2>")
+
+		// Private collections can only be seen by their owner, and aren't listed on the
+		// snippets' pages.
+		code, _, _ = ts.get(t, "/collection/view/1")
+		assert.Equal(t, code, http.StatusNotFound)
+
+		_, _, body = ts.get(t, "/snippet/view/1")
+		assert.Equal(t, strings.Contains(body, "In collections:"), false)
+
+		form.Set("name", "")
+		code, _, body = alice.postForm(t, "/collection/rename/1", form)
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "Name can&#39;t be blank")
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		code, headers, _ := alice.postForm(t, "/collection/remove/1", snippetForm(csrfToken, 1))
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/collection/view/1")
+
+		_, _, body := alice.get(t, "/collection/view/1")
+		assert.Equal(t, strings.Contains(body, "An old silent pond"), false)
+
+		code, _, _ = alice.postForm(t, "/collection/remove/1", snippetForm(csrfToken, 1))
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+}
+
+func TestStars(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	alice := ts.newClient(t)
+	alice.login(t, "alice@example.com", "pa$$word")
+
+	bob := ts.newClient(t)
+	bob.login(t, "bob@example.com", "pa$$word")
+
+	dave := ts.newClient(t)
+	dave.login(t, "dave@example.com", "pa$$word")
+
+	_, _, body := alice.get(t, "/snippet/view/1")
+	aliceToken := extractCsrfToken(t, body)
+	assert.StringContains(t, body, "0 stars")
+	assert.StringContains(t, body, "<form action='/snippet/star/1' method='POST'>")
+
+	_, _, body = bob.get(t, "/user/stars")
+	bobToken := extractCsrfToken(t, body)
+	assert.StringContains(t, body, "You haven't starred any snippets yet.")
+
+	_, _, body = dave.get(t, "/snippet/view/1")
+	daveToken := extractCsrfToken(t, body)
+
+	tokenForm := func(token string) url.Values {
+		form := url.Values{}
+		form.Add("csrf_token", token)
+		return form
+	}
+
+	t.Run("Star", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			client   *testServer
+			token    string
+			urlPath  string
+			wantCode int
+		}{
+			{"Valid", alice, aliceToken, "/snippet/star/1", http.StatusSeeOther},
+			{"Already starred", alice, aliceToken, "/snippet/star/1", http.StatusSeeOther},
+			{"Someone else", dave, daveToken, "/snippet/star/1", http.StatusSeeOther},
+			{"Own private snippet", bob, bobToken, "/snippet/star/7", http.StatusSeeOther},
+			{"Can't see snippet", alice, aliceToken, "/snippet/star/7", http.StatusNotFound},
+			{"Hidden snippet", alice, aliceToken, "/snippet/star/5", http.StatusGone},
+			{"Missing snippet", alice, aliceToken, "/snippet/star/2", http.StatusNotFound},
+			{"Invalid ID", alice, aliceToken, "/snippet/star/foo", http.StatusNotFound},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				code, headers, _ := tt.client.postForm(t, tt.urlPath, tokenForm(tt.token))
+				assert.Equal(t, code, tt.wantCode)
+
+				if code == http.StatusSeeOther {
+					assert.Equal(t, headers.Get("Location"), strings.Replace(tt.urlPath, "star", "view", 1))
+				}
+			})
+		}
+
+		// Starring a snippet twice only counts once.
+		_, _, body := alice.get(t, "/snippet/view/1")
+		assert.StringContains(t, body, "Snippet starred")
+		assert.StringContains(t, body, "2 stars")
+		assert.StringContains(t, body, "<form action='/snippet/unstar/1' method='POST'>")
+
+		// Anyone can see how many stars a snippet has, but only logged in users can star it.
+		_, _, body = ts.get(t, "/snippet/view/1")
+		assert.StringContains(t, body, "2 stars")
+		assert.Equal(t, strings.Contains(body, "/snippet/star/1"), false)
+	})
+
+	t.Run("My stars", func(t *testing.T) {
+		code, _, body := alice.get(t, "/user/stars")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<a href='/snippet/view/1'>An old silent pond</a>")
+
+		_, _, body = bob.get(t, "/user/stars")
+		assert.StringContains(t, body, "<a href='/snippet/view/7'>Draft</a>")
+
+		code, headers, _ := ts.get(t, "/user/stars")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login")
+	})
+
+	t.Run("Most starred", func(t *testing.T) {
+		_, _, body := ts.get(t, "/")
+		assert.StringContains(t, body, "Most Starred This Week")
+		assert.StringContains(t, body, "<td>2</td>")
+
+		// Private snippets aren't listed, even though they've been starred.
+		assert.Equal(t, strings.Contains(body, "Draft"), false)
+	})
+
+	t.Run("Unstar", func(t *testing.T) {
+		code, headers, _ := alice.postForm(t, "/snippet/unstar/1", tokenForm(aliceToken))
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/snippet/view/1")
+
+		_, _, body := alice.get(t, "/snippet/view/1")
+		assert.StringContains(t, body, "Snippet unstarred")
+		assert.StringContains(t, body, "1 star")
+		assert.StringContains(t, body, "<form action='/snippet/star/1' method='POST'>")
+
+		code, _, _ = alice.postForm(t, "/snippet/unstar/1", tokenForm(aliceToken))
+		assert.Equal(t, code, http.StatusNotFound)
+
+		_, _, body = alice.get(t, "/user/stars")
+		assert.StringContains(t, body, "You haven't starred any snippets yet.")
+	})
+}
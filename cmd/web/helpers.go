@@ -2,19 +2,36 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"html/template"
 	"log/slog"
 	"net/http"
 	"runtime/debug"
+	"strings"
 	"time"
 
 	"github.com/go-playground/form/v4"
 	"github.com/justinas/nosurf"
+	"rsc.io/qr"
+	"snippetbox.prajjmon.net/internal/models"
+	"snippetbox.prajjmon.net/internal/validator"
 )
 
+// A non-standard status code (borrowed from nginx) which we use when the client went away
+// before we could finish handling its request. The client will never see it, but it shows
+// up in our access logs and metrics.
+const statusClientClosedRequest = 499
+
 // Writes a log entry at Error level (including the request method and URI as attributes),
 // then sends a generic 500 Internal Server Error response to the user.
+//
+// Database queries which timed out or were cancelled aren't bugs in our application, so they
+// are logged at a lower level and get a 503 Service Unavailable or 499 response instead.
 func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
 	var (
 		method = r.Method
@@ -22,7 +39,19 @@ func (app *application) serverError(w http.ResponseWriter, r *http.Request, err
 		trace  = string(debug.Stack())
 	)
 
-	app.logger.Error(err.Error(), slog.String("method", method), slog.String("uri", uri), slog.String("trace", trace))
+	switch {
+	case errors.Is(err, models.ErrQueryTimeout):
+		app.requestLogger(r).Warn(err.Error(), slog.String("method", method), slog.String("uri", uri))
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	case errors.Is(err, models.ErrQueryCanceled):
+		app.requestLogger(r).Info(err.Error(), slog.String("method", method), slog.String("uri", uri))
+		w.WriteHeader(statusClientClosedRequest)
+		return
+	}
+
+	app.requestLogger(r).Error(err.Error(), slog.String("method", method), slog.String("uri", uri), slog.String("trace", trace))
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
 
@@ -42,7 +71,11 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, status in
 
 	buf := new(bytes.Buffer)
 
+	_, span := app.tracer.Start(r.Context(), "render "+page)
+	start := time.Now()
 	err := ts.ExecuteTemplate(buf, "base", data)
+	app.metrics.renderDuration.WithLabelValues(page).Observe(time.Since(start).Seconds())
+	span.End()
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -55,10 +88,13 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, status in
 }
 
 func (app *application) newTemplateData(r *http.Request) templateData {
+	user, isAuthenticated := app.authenticatedUser(r)
+
 	return templateData{
 		CurrentYear:     time.Now().Year(),
 		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
-		IsAuthenticated: app.isAuthenticated(r),
+		IsAuthenticated: isAuthenticated,
+		Role:            user.Role,
 		CsrfToken:       nosurf.Token(r),
 	}
 }
@@ -90,14 +126,266 @@ func (app *application) decodePostForm(r *http.Request, targetDst any) error {
 }
 
 func (app *application) isAuthenticated(r *http.Request) bool {
-	isAuthenticated, ok := r.Context().Value(isAuthenticatedContextKey).(bool)
+	_, ok := app.authenticatedUser(r)
+	return ok
+}
 
-	// If there isn’t a value in the request context with the isAuthenticatedContextKey key,
-	// or the underlying value isn’t a bool, then this type assertion will fail, and we take
-	// a "safe" fall back and return false
-	if !ok {
+// Returns the user that the authenticate middleware stored in the request context. If there
+// isn't one (or the value isn't a models.User) then the type assertion fails, and we take a
+// "safe" fall back and report that the request isn't authenticated.
+func (app *application) authenticatedUser(r *http.Request) (models.User, bool) {
+	user, ok := r.Context().Value(authenticatedUserContextKey).(models.User)
+	return user, ok
+}
+
+// Returns the ID that the requestID middleware stored in the request context, or an empty
+// string if there isn't one.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// Generates a new random request ID, encoded as 32 hex characters.
+func newRequestID() string {
+	b := make([]byte, 16)
+
+	// crypto/rand.Read never returns an error on the platforms that Go supports.
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// Reports whether an X-Request-ID value supplied by the client is safe to reuse. We only
+// accept short values made of a conservative set of characters, so that a client can't use
+// the header to inject arbitrary content into our logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
 		return false
 	}
 
-	return isAuthenticated
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns a logger which includes the request ID in every log entry, so that everything we
+// log while handling a request can be correlated with its access log entry.
+func (app *application) requestLogger(r *http.Request) *slog.Logger {
+	return app.logger.With(slog.String("request_id", requestID(r)))
+}
+
+// Wraps a http.ResponseWriter so that we can find out which status code the handler sent and
+// how many bytes of response body it wrote.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	n, err := rr.ResponseWriter.Write(b)
+	rr.size += n
+	return n, err
+}
+
+// Allows http.ResponseController to reach the underlying http.ResponseWriter.
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// Runs fn in a background goroutine. Panics in fn are recovered and logged (our
+// recoverFromPanic middleware can't see them, as they happen in a different goroutine), and
+// app.wg lets us wait for background tasks to finish.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error(fmt.Sprintf("%v", err), slog.String("trace", string(debug.Stack())))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// Destroys every session in the store which is authenticated as the given user, apart from
+// the session in ctx (if it belongs to the user).
+func (app *application) destroyUserSessions(ctx context.Context, userID int) error {
+	currentToken := app.sessionManager.Token(ctx)
+
+	// Revoking the session records is enough on its own to stop the other sessions from
+	// being used, but we destroy the session data too so that it doesn't hang around.
+	err := app.userSessions.DeleteAllForUser(ctx, userID, app.sessionManager.GetString(ctx, "sessionID"))
+	if err != nil {
+		return err
+	}
+
+	return app.sessionManager.Iterate(ctx, func(ctx context.Context) error {
+		if app.sessionManager.GetInt(ctx, "authenticatedUserID") != userID {
+			return nil
+		}
+
+		if app.sessionManager.Token(ctx) == currentToken {
+			return nil
+		}
+
+		return app.sessionManager.Destroy(ctx)
+	})
+}
+
+// Checks a new password against the password policy, adding an error for the form field
+// with the given key if it isn't acceptable. The personal values (such as the user's name
+// and email address) are things which the password mustn't contain.
+func (app *application) checkPasswordPolicy(v *validator.Validator, key, password string, personal ...string) error {
+	message, err := app.passwordPolicy.Check(password, personal...)
+	if err != nil {
+		return err
+	}
+
+	v.CheckField(message == "", key, message)
+
+	return nil
+}
+
+// The longest user agent we'll record for a session. Browsers send far less than this, so
+// anything longer is junk which isn't worth storing in full.
+const maxUserAgentLength = 256
+
+// Returns the request's User-Agent header, truncated to maxUserAgentLength bytes.
+func userAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLength {
+		ua = strings.ToValidUTF8(ua[:maxUserAgentLength], "")
+	}
+	return ua
+}
+
+// Encodes text as a QR code and returns it as a PNG data URI, ready to use as the src of an
+// img element. Rendering the image ourselves means that secrets (like the TOTP provisioning
+// URI) never have to be sent to a third-party QR code service. The result is marked as a safe
+// URL, as html/template would otherwise refuse to render a data URI.
+func qrCodeDataURI(text string) (template.URL, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return "", err
+	}
+
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(code.PNG())), nil
+}
+
+// Records a security-relevant event in the audit log, along with the IP address and user
+// agent of the request. If the entry doesn't say who did it, the actor is the logged in user
+// (if there is one).
+func (app *application) audit(r *http.Request, entry models.AuditEntry) error {
+	if entry.ActorID == 0 {
+		if user, ok := app.authenticatedUser(r); ok {
+			entry.ActorID = user.Id
+		}
+	}
+
+	entry.IP = clientIP(r)
+	entry.UserAgent = userAgent(r)
+
+	return app.auditLog.Log(r.Context(), entry)
+}
+
+// Records a failed login with the given email address in the audit log. If the address
+// belongs to an account, the attempt shows up in that user's security activity.
+func (app *application) auditLoginFailure(r *http.Request, email, reason string) error {
+	entry := models.AuditEntry{
+		Action:  models.AuditLoginFailed,
+		Details: map[string]string{"email": email, "reason": reason},
+	}
+
+	user, err := app.users.GetByEmail(r.Context(), email)
+	if err == nil {
+		entry.TargetType = models.AuditTargetUser
+		entry.TargetID = user.Id
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		return err
+	}
+
+	return app.audit(r, entry)
+}
+
+// How much a user is allowed to do with a snippet. Each level includes everything that the
+// levels below it allow.
+type accessLevel int
+
+const (
+	accessNone accessLevel = iota
+	accessView
+	accessEdit
+
+	// Owners can also change who can see the snippet, and share it with other people.
+	accessOwner
+)
+
+// Returns what the logged in user (if there is one) is allowed to do with the snippet. It's
+// owned by the user who created it and, if it belongs to an organization, by the
+// organization's owners. The organization's other members can edit it. Anyone can see public
+// snippets, and the snippet's access-control list can let other users see or edit it whatever
+// its visibility.
+func (app *application) snippetAccess(r *http.Request, snippet models.Snippet) (accessLevel, error) {
+	access := accessNone
+	if snippet.Visibility == models.VisibilityPublic {
+		access = accessView
+	}
+
+	user, ok := app.authenticatedUser(r)
+	if !ok {
+		return access, nil
+	}
+
+	if snippet.UserID == user.Id {
+		return accessOwner, nil
+	}
+
+	if snippet.OrgID != 0 {
+		role, err := app.orgs.MemberRole(r.Context(), snippet.OrgID, user.Id)
+		if err == nil {
+			if role == models.OrgRoleOwner {
+				return accessOwner, nil
+			}
+			// Sharing can't give a member any more than this.
+			return accessEdit, nil
+		} else if !errors.Is(err, models.ErrNoRecord) {
+			return accessNone, err
+		}
+	}
+
+	permission, err := app.shares.Get(r.Context(), snippet.ID, user.Id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return access, nil
+		}
+		return accessNone, err
+	}
+
+	if permission == models.ShareEdit {
+		return accessEdit, nil
+	}
+
+	return max(access, accessView), nil
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Holds the Prometheus collectors for the application. We use our own registry (rather than
+// the global prometheus.DefaultRegisterer) so that tests can create as many independent
+// application instances as they like without running into duplicate registration panics.
+type metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	panics          prometheus.Counter
+	renderDuration  *prometheus.HistogramVec
+	logins          *prometheus.CounterVec
+	loginLockouts   *prometheus.CounterVec
+	rateLimited     *prometheus.CounterVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "snippetbox_http_requests_total",
+			Help: "Total number of HTTP requests, by route pattern, method and status class.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "snippetbox_http_request_duration_seconds",
+			Help:    "Time taken to serve HTTP requests, by route pattern.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route"}),
+		panics: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "snippetbox_http_panics_recovered_total",
+			Help: "Total number of panics recovered by the recoverFromPanic middleware.",
+		}),
+		renderDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "snippetbox_template_render_duration_seconds",
+			Help:    "Time taken to execute page templates, by page.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1},
+		}, []string{"page"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "snippetbox_logins_total",
+			Help: "Total number of login attempts, by result.",
+		}, []string{"result"}),
+		loginLockouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "snippetbox_login_lockouts_total",
+			Help: "Total number of times login throttling keys have been locked out, by key scope.",
+		}, []string{"scope"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "snippetbox_http_rate_limited_total",
+			Help: "Total number of requests rejected by the rate limiter, by route pattern.",
+		}, []string{"route"}),
+	}
+
+	m.registry.MustRegister(m.requests, m.requestDuration, m.panics, m.renderDuration, m.logins, m.loginLockouts, m.rateLimited)
+
+	return m
+}
+
+// Registers gauges which report the pgxpool connection statistics every time the metrics
+// endpoint is scraped.
+func (m *metrics) registerDBPool(dbpool *pgxpool.Pool) {
+	gauge := func(name, help string, value func(*pgxpool.Stat) int32) prometheus.GaugeFunc {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, func() float64 {
+			return float64(value(dbpool.Stat()))
+		})
+	}
+
+	m.registry.MustRegister(
+		gauge("snippetbox_db_pool_acquired_conns", "Number of currently acquired connections in the pool.", (*pgxpool.Stat).AcquiredConns),
+		gauge("snippetbox_db_pool_idle_conns", "Number of currently idle connections in the pool.", (*pgxpool.Stat).IdleConns),
+		gauge("snippetbox_db_pool_total_conns", "Total number of connections currently in the pool.", (*pgxpool.Stat).TotalConns),
+	)
+}
+
+// Returns a handler which serves the collected metrics in the Prometheus text format.
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Returns the status class (e.g. "2xx") for the given status code.
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"snippetbox.prajjmon.net/internal/assert"
+)
+
+// Scrapes the application's metrics handler and returns the response body.
+func scrapeMetrics(t *testing.T, app *application) string {
+	rr := httptest.NewRecorder()
+
+	r, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.metrics.handler().ServeHTTP(rr, r)
+
+	body, err := io.ReadAll(rr.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body)
+}
+
+func TestRequestMetrics(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.get(t, "/snippet/view/1")
+	ts.get(t, "/snippet/view/2")
+	ts.get(t, "/does/not/exist")
+
+	body := scrapeMetrics(t, app)
+
+	// Requests should be keyed by the servemux pattern, not the raw URI.
+	assert.StringContains(t, body, `snippetbox_http_requests_total{method="GET",route="GET /snippet/view/{id}",status="2xx"} 1`)
+	assert.StringContains(t, body, `snippetbox_http_requests_total{method="GET",route="GET /snippet/view/{id}",status="4xx"} 1`)
+	assert.StringContains(t, body, `snippetbox_http_requests_total{method="GET",route="unmatched",status="4xx"} 1`)
+	assert.StringContains(t, body, `snippetbox_template_render_duration_seconds_count{page="view.html"} 1`)
+}
+
+func TestPanicMetrics(t *testing.T) {
+	app := newTestApplication(t)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+
+	rr := httptest.NewRecorder()
+	r, err := http.NewRequest(http.MethodGet, "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.recoverFromPanic(app.instrumentRequest(next)).ServeHTTP(rr, r)
+
+	assert.Equal(t, rr.Code, http.StatusInternalServerError)
+
+	body := scrapeMetrics(t, app)
+	assert.StringContains(t, body, "snippetbox_http_panics_recovered_total 1")
+	assert.StringContains(t, body, `snippetbox_http_requests_total{method="GET",route="unmatched",status="5xx"} 1`)
+}
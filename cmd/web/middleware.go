@@ -2,10 +2,20 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/justinas/alice"
 	"github.com/justinas/nosurf"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"snippetbox.prajjmon.net/internal/models"
 )
 
 func commonHeaders(next http.Handler) http.Handler {
@@ -27,15 +37,73 @@ func commonHeaders(next http.Handler) http.Handler {
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var (
-			ip     = r.RemoteAddr
+			ip     = clientIP(r)
 			proto  = r.Proto
 			method = r.Method
-			uri    = r.URL.RequestURI()
+			uri    = redactTokens(r.URL.EscapedPath())
+			start  = time.Now()
 		)
 
-		app.logger.Info("received request", "ip", ip, "proto", proto, "method", method, "uri", uri)
+		if r.URL.RawQuery != "" {
+			uri += "?" + r.URL.RawQuery
+		}
 
-		next.ServeHTTP(w, r)
+		rr := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rr, r)
+
+		// The access log entry is written once the response has been sent, so that it can
+		// include the status code, the size of the response body and how long it took.
+		// A handler which never writes anything gets an implicit 200 OK from net/http.
+		status := rr.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		app.requestLogger(r).Info("handled request", "ip", ip, "proto", proto, "method", method, "uri", uri,
+			"status", status, "size", rr.size, "duration", time.Since(start))
+	})
+}
+
+// The path prefixes of the routes which end in a secret token, such as a share link or a
+// password reset link. Anyone who has one of these URLs can use it, so the token is replaced
+// with a placeholder before the path is logged or added to a trace. Routes like this need to
+// be listed here as well as in routes().
+var tokenPathPrefixes = []string{
+	"/snippet/link/",
+	"/user/password/reset/",
+	"/user/verify/",
+	"/org/join/",
+}
+
+// Returns the path with any secret token in it replaced by "{token}".
+func redactTokens(path string) string {
+	for _, prefix := range tokenPathPrefixes {
+		if token, ok := strings.CutPrefix(path, prefix); ok && token != "" {
+			return prefix + "{token}"
+		}
+	}
+
+	return path
+}
+
+// The maximum length of an incoming X-Request-ID header that we're willing to reuse.
+const maxRequestIDLength = 128
+
+// Stores a request ID in the request context and echoes it back in the X-Request-ID response
+// header. If the client (or a proxy in front of us) already sent an X-Request-ID header with a
+// sensible value we reuse it, otherwise we generate a new random ID.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
@@ -60,6 +128,8 @@ func (app *application) recoverFromPanic(next http.Handler) http.Handler {
 				// user that the connection will be closed
 				w.Header().Set("Connection", "close")
 
+				app.metrics.panics.Inc()
+
 				// Since the recover() function has the type "any", and its underlying type
 				// could be string, error, or something else — we normalize this into an error
 				// by using the fmt.Errorf() function to create a new error object containing
@@ -72,6 +142,87 @@ func (app *application) recoverFromPanic(next http.Handler) http.Handler {
 	})
 }
 
+// Starts a server span for every request, continuing the trace from any incoming W3C
+// traceparent header. The span is stored in the request context, so spans started further
+// down the chain (e.g. for database queries and template rendering) become its children.
+func (app *application) traceRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := app.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		ctx, span := app.tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(redactTokens(r.URL.Path)),
+			),
+		)
+
+		rr := &responseRecorder{ResponseWriter: w}
+		r = r.WithContext(ctx)
+		completed := false
+
+		defer func() {
+			status := rr.status
+			if !completed {
+				status = http.StatusInternalServerError
+			} else if status == 0 {
+				status = http.StatusOK
+			}
+
+			// The servemux sets r.Pattern on the request we passed down, so by now we know
+			// which route was matched and can use it to give the span a better name.
+			if r.Pattern != "" {
+				span.SetName(r.Pattern)
+				span.SetAttributes(semconv.HTTPRoute(r.Pattern))
+			}
+
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if status >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+
+			span.End()
+		}()
+
+		next.ServeHTTP(rr, r)
+		completed = true
+	})
+}
+
+// Records the request count and latency for every request. This needs to be the last
+// middleware before the servemux, because the servemux sets r.Pattern on the *http.Request
+// that it is given, and we use the matched pattern (rather than the raw URI) as the route
+// label to keep the number of distinct time series bounded.
+func (app *application) instrumentRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rr := &responseRecorder{ResponseWriter: w}
+		completed := false
+
+		// If the handler panics we never get past next.ServeHTTP(), but the deferred function
+		// still runs. In that case recoverFromPanic will send a 500, so we record that here.
+		defer func() {
+			status := rr.status
+			if !completed {
+				status = http.StatusInternalServerError
+			} else if status == 0 {
+				status = http.StatusOK
+			}
+
+			route := r.Pattern
+			if route == "" {
+				route = "unmatched"
+			}
+
+			app.metrics.requests.WithLabelValues(route, r.Method, statusClass(status)).Inc()
+			app.metrics.requestDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+		}()
+
+		next.ServeHTTP(rr, r)
+		completed = true
+	})
+}
+
 func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !app.isAuthenticated(r) {
@@ -88,6 +239,40 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
+// Stops users who haven't verified their email address yet from going any further. This must
+// come after requireAuthentication in the middleware chain.
+func (app *application) requireVerified(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := app.authenticatedUser(r)
+
+		if !user.Verified {
+			app.render(w, r, http.StatusForbidden, "unverified.html", app.newTemplateData(r))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Returns middleware which only lets through users who have one of the given roles, and
+// responds with 403 Forbidden to everyone else. Roles don't imply each other, so a route for
+// moderators which admins can also use needs to list both. This must come after
+// requireAuthentication in the middleware chain.
+func (app *application) requireRole(roles ...models.Role) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := app.authenticatedUser(r)
+
+			if !slices.Contains(roles, user.Role) {
+				app.clientError(w, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // Creates a NoSurf middleware function which uses a customized CSRF cookie with
 // the Secure, Path and HttpOnly attributes set.
 func noSurf(next http.Handler) http.Handler {
@@ -101,6 +286,9 @@ func noSurf(next http.Handler) http.Handler {
 	return csrfHandler
 }
 
+// How often the last seen time of a session is updated.
+const sessionTouchInterval = time.Minute
+
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
@@ -109,14 +297,64 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		exists, err := app.users.Exists(id)
-		if err != nil {
+		// Sessions which have been revoked (or which were created before we started keeping
+		// session records) are logged out.
+		session, err := app.userSessions.Get(r.Context(), app.sessionManager.GetString(r.Context(), "sessionID"))
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+
+		revoked := err != nil || session.UserID != id
+
+		// So are sessions which haven't been used for a while, unless the user asked us to
+		// remember them. The last seen time is only updated every sessionTouchInterval, so
+		// the timeout is only accurate to within that.
+		idle := !revoked && app.sessionIdleTimeout > 0 && !app.sessionManager.GetBool(r.Context(), "rememberMe") &&
+			time.Since(session.LastSeen) > app.sessionIdleTimeout
+
+		if revoked || idle {
+			if idle {
+				err = app.userSessions.Delete(r.Context(), id, session.ID)
+				if err != nil && !errors.Is(err, models.ErrNoRecord) {
+					app.serverError(w, r, err)
+					return
+				}
+			}
+
+			err = app.sessionManager.Destroy(r.Context())
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Only record activity every so often, so that we aren't writing to the database
+		// on every request.
+		ip, ua := clientIP(r), userAgent(r)
+		if time.Since(session.LastSeen) > sessionTouchInterval || session.IP != ip || session.UserAgent != ua {
+			err = app.userSessions.Touch(r.Context(), session.ID, ip, ua)
+			if err != nil && !errors.Is(err, models.ErrNoRecord) {
+				app.serverError(w, r, err)
+				return
+			}
+		}
+
+		// Load the whole user, so that later middleware and handlers can check their role
+		// and verification status without going back to the database.
+		user, err := app.users.Get(r.Context(), id)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
 			app.serverError(w, r, err)
 			return
 		}
 
-		if exists {
-			cntxt := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+		// Disabled users have already had their sessions revoked, but we check here as well
+		// in case they were disabled some other way (e.g. directly in the database).
+		if err == nil && !user.Disabled {
+			cntxt := context.WithValue(r.Context(), authenticatedUserContextKey, user)
 			r = r.WithContext(cntxt)
 		}
 
@@ -2,11 +2,17 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"snippetbox.prajjmon.net/internal/assert"
 )
 
@@ -78,3 +84,163 @@ func TestCommonHeaders(t *testing.T) {
 	body = bytes.TrimSpace(body)
 	assert.Equal(t, string(body), "OK")
 }
+
+func TestRequestID(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name     string
+		header   string
+		wantSame bool
+	}{
+		{
+			name:     "Valid incoming ID",
+			header:   "abc-123_DEF.456:7",
+			wantSame: true,
+		},
+		{
+			name:     "No incoming ID",
+			header:   "",
+			wantSame: false,
+		},
+		{
+			name:     "Invalid characters",
+			header:   "abc\n123",
+			wantSame: false,
+		},
+		{
+			name:     "Too long",
+			header:   strings.Repeat("a", maxRequestIDLength+1),
+			wantSame: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+
+			r, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.header != "" {
+				r.Header.Set("X-Request-ID", tt.header)
+			}
+
+			// The mock handler records the ID it finds in the request context.
+			var contextID string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contextID = requestID(r)
+			})
+
+			app.requestID(next).ServeHTTP(rr, r)
+
+			headerID := rr.Result().Header.Get("X-Request-ID")
+			assert.Equal(t, headerID, contextID)
+			assert.Equal(t, headerID == tt.header, tt.wantSame)
+			assert.Equal(t, validRequestID(headerID), true)
+		})
+	}
+}
+
+func TestLogRequest(t *testing.T) {
+	var buf bytes.Buffer
+
+	app := newTestApplication(t)
+	app.logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+	rr := httptest.NewRecorder()
+
+	r, err := http.NewRequest(http.MethodGet, "/snippet/view/1?foo=bar", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("X-Request-ID", "test-request-id")
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("I'm a teapot"))
+	})
+
+	app.requestID(app.logRequest(next)).ServeHTTP(rr, r)
+
+	var entry struct {
+		Msg       string `json:"msg"`
+		RequestID string `json:"request_id"`
+		Method    string `json:"method"`
+		URI       string `json:"uri"`
+		Status    int    `json:"status"`
+		Size      int    `json:"size"`
+	}
+
+	err = json.Unmarshal(buf.Bytes(), &entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, entry.Msg, "handled request")
+	assert.Equal(t, entry.RequestID, "test-request-id")
+	assert.Equal(t, entry.Method, http.MethodGet)
+	assert.Equal(t, entry.URI, "/snippet/view/1?foo=bar")
+	assert.Equal(t, entry.Status, http.StatusTeapot)
+	assert.Equal(t, entry.Size, len("I'm a teapot"))
+}
+
+func TestLogRequestRedactsTokens(t *testing.T) {
+	var buf bytes.Buffer
+
+	exporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tracerProvider.Shutdown(context.Background())
+
+	app := newTestApplication(t)
+	app.logger = slog.New(slog.NewTextHandler(&buf, nil))
+	app.tracer = tracerProvider.Tracer(tracerName)
+
+	ts := newTestServer(t, app.routes())
+
+	const token = "s3cr3t-t0k3n"
+
+	urlPaths := []string{
+		"/snippet/link/" + token,
+		"/user/password/reset/" + token,
+		"/user/verify/" + token,
+		"/org/join/" + token,
+	}
+
+	for _, urlPath := range urlPaths {
+		ts.get(t, urlPath+"?foo=bar")
+	}
+
+	ts.Close()
+
+	// Neither the access log nor the traces should include the token.
+	assert.Equal(t, strings.Contains(buf.String(), token), false)
+	assert.StringContains(t, buf.String(), `uri="/snippet/link/{token}?foo=bar"`)
+
+	for _, span := range exporter.GetSpans() {
+		for _, attr := range span.Attributes {
+			assert.Equal(t, strings.Contains(attr.Value.Emit(), token), false)
+		}
+	}
+}
+
+func TestRedactTokens(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/snippet/link/abc123", "/snippet/link/{token}"},
+		{"/user/password/reset/abc123", "/user/password/reset/{token}"},
+		{"/user/verify/abc123", "/user/verify/{token}"},
+		{"/org/join/abc123", "/org/join/{token}"},
+		{"/snippet/view/1", "/snippet/view/1"},
+		{"/snippet/link/", "/snippet/link/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, redactTokens(tt.path), tt.want)
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Parses a comma-separated list of trusted proxies, each of which is either a CIDR (e.g.
+// "10.0.0.0/8") or a single IP address.
+func parseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		if strings.Contains(field, "/") {
+			prefix, err := netip.ParsePrefix(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", field, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", field, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return prefixes, nil
+}
+
+// Reports whether addr belongs to one of the trusted proxies.
+func (app *application) isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range app.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Works out the real client IP address and scheme for requests which reach us through a
+// reverse proxy (e.g. our load balancer). The X-Forwarded-For, Forwarded and
+// X-Forwarded-Proto headers are only believed when the request comes directly from one of
+// the trusted proxies, as anyone else can set them to whatever they like.
+//
+// The client IP is stored in the request context (see clientIP) rather than overwriting
+// r.RemoteAddr, and the scheme is stored in r.URL.Scheme, which is where nosurf looks for it.
+func (app *application) proxyHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, err := netip.ParseAddrPort(r.RemoteAddr)
+		if err != nil || !app.isTrustedProxy(peer.Addr().Unmap()) {
+			if err == nil {
+				r = r.WithContext(context.WithValue(r.Context(), clientIPContextKey, peer.Addr().Unmap().String()))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		hops, proto := forwardedHops(r.Header)
+
+		// Each proxy appends the address it received the request from, so we work backwards
+		// from the proxy nearest to us. The first address which isn't one of our proxies is
+		// the client; everything to the left of it could have been made up by the client. If
+		// we reach a hop that isn't an IP address, the last proxy is the best we can do.
+		client := peer.Addr().Unmap()
+		for i := len(hops) - 1; i >= 0; i-- {
+			if !app.isTrustedProxy(client) {
+				break
+			}
+
+			addr, ok := parseForwardedAddr(hops[i])
+			if !ok {
+				break
+			}
+			client = addr
+		}
+
+		ctx := context.WithValue(r.Context(), clientIPContextKey, client.String())
+		r = r.WithContext(ctx)
+
+		if proto == "http" || proto == "https" {
+			r.URL.Scheme = proto
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Returns the list of client addresses from the Forwarded header (RFC 7239), or from
+// X-Forwarded-For if there isn't one, in the order they were added. Also returns the scheme
+// that the nearest proxy received the request over, if it told us.
+func forwardedHops(h http.Header) ([]string, string) {
+	var hops []string
+	var proto string
+
+	if forwarded := h.Values("Forwarded"); len(forwarded) > 0 {
+		for _, element := range strings.Split(strings.Join(forwarded, ","), ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+
+				value = strings.Trim(value, `"`)
+
+				switch strings.ToLower(key) {
+				case "for":
+					hops = append(hops, value)
+				case "proto":
+					proto = strings.ToLower(value)
+				}
+			}
+		}
+
+		return hops, proto
+	}
+
+	for _, hop := range strings.Split(strings.Join(h.Values("X-Forwarded-For"), ","), ",") {
+		if hop = strings.TrimSpace(hop); hop != "" {
+			hops = append(hops, hop)
+		}
+	}
+
+	// If there are several proxies, the last value was set by the nearest one.
+	if values := strings.Split(h.Get("X-Forwarded-Proto"), ","); len(values) > 0 {
+		proto = strings.ToLower(strings.TrimSpace(values[len(values)-1]))
+	}
+
+	return hops, proto
+}
+
+// Parses a client address from a forwarding header, which may include a port and (for IPv6)
+// square brackets. Obfuscated identifiers and "unknown" aren't valid addresses.
+func parseForwardedAddr(s string) (netip.Addr, bool) {
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return addr.Unmap(), true
+}
+
+// Returns the IP address of the client which made the request, as worked out by the
+// proxyHeaders middleware. If the middleware hasn't run, it falls back to r.RemoteAddr.
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPContextKey).(string); ok {
+		return ip
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
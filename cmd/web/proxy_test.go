@@ -0,0 +1,164 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"snippetbox.prajjmon.net/internal/assert"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	prefixes, err := parseTrustedProxies("10.0.0.0/8, 192.0.2.1,2001:db8::/32,,::ffff:198.51.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+		netip.MustParsePrefix("198.51.100.1/32"),
+	}
+
+	assert.Equal(t, len(prefixes), len(want))
+	for i := range want {
+		assert.Equal(t, prefixes[i], want[i])
+	}
+
+	_, err = parseTrustedProxies("10.0.0.0/33")
+	assert.Equal(t, err != nil, true)
+
+	_, err = parseTrustedProxies("not-an-ip")
+	assert.Equal(t, err != nil, true)
+}
+
+func TestProxyHeaders(t *testing.T) {
+	app := newTestApplication(t)
+
+	var err error
+	app.trustedProxies, err = parseTrustedProxies("10.0.0.0/8,2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		wantIP     string
+		wantScheme string
+	}{
+		{
+			name:       "Direct request",
+			remoteAddr: "203.0.113.7:1234",
+			wantIP:     "203.0.113.7",
+		},
+		{
+			name:       "Spoofed X-Forwarded-For from untrusted peer",
+			remoteAddr: "203.0.113.7:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			wantIP:     "203.0.113.7",
+		},
+		{
+			name:       "Spoofed Forwarded from untrusted peer",
+			remoteAddr: "203.0.113.7:1234",
+			headers:    map[string]string{"Forwarded": "for=198.51.100.1;proto=https"},
+			wantIP:     "203.0.113.7",
+		},
+		{
+			name:       "Spoofed X-Forwarded-Proto from untrusted peer",
+			remoteAddr: "203.0.113.7:1234",
+			headers:    map[string]string{"X-Forwarded-Proto": "https"},
+			wantIP:     "203.0.113.7",
+		},
+		{
+			name:       "Spoofed peer address in a trusted range",
+			remoteAddr: "203.0.113.7:1234",
+			headers:    map[string]string{"X-Forwarded-For": "10.0.0.1"},
+			wantIP:     "203.0.113.7",
+		},
+		{
+			name:       "Trusted proxy",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7", "X-Forwarded-Proto": "https"},
+			wantIP:     "203.0.113.7",
+			wantScheme: "https",
+		},
+		{
+			name:       "Client prepends a fake address",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.7"},
+			wantIP:     "203.0.113.7",
+		},
+		{
+			name:       "Chain of trusted proxies",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.7, 10.0.0.2"},
+			wantIP:     "203.0.113.7",
+		},
+		{
+			name:       "Only trusted proxies",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"},
+			wantIP:     "10.0.0.3",
+		},
+		{
+			name:       "Unparseable hop",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7, garbage"},
+			wantIP:     "10.0.0.1",
+		},
+		{
+			name:       "Client sets X-Forwarded-Proto as well as proxy",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7", "X-Forwarded-Proto": "https, http"},
+			wantIP:     "203.0.113.7",
+			wantScheme: "http",
+		},
+		{
+			name:       "Forwarded header",
+			remoteAddr: "[2001:db8::1]:1234",
+			headers: map[string]string{
+				"Forwarded":       `for=198.51.100.1, for=192.0.2.60;proto=https, for="[2001:db8:cafe::17]:4711"`,
+				"X-Forwarded-For": "203.0.113.7",
+			},
+			wantIP:     "192.0.2.60",
+			wantScheme: "https",
+		},
+		{
+			name:       "Obfuscated Forwarded identifier",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"Forwarded": "for=_hidden, for=unknown"},
+			wantIP:     "10.0.0.1",
+		},
+		{
+			name:       "Invalid scheme",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7", "X-Forwarded-Proto": "gopher"},
+			wantIP:     "203.0.113.7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+
+			var gotIP, gotScheme string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotIP = clientIP(r)
+				gotScheme = r.URL.Scheme
+			})
+
+			app.proxyHeaders(next).ServeHTTP(httptest.NewRecorder(), r)
+
+			assert.Equal(t, gotIP, tt.wantIP)
+			assert.Equal(t, gotScheme, tt.wantScheme)
+		})
+	}
+}
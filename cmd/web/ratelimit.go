@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// How a rate limit policy identifies the client that a request came from.
+type rateLimitKey int
+
+const (
+	// Every request from the same IP address shares a bucket.
+	keyByIP rateLimitKey = iota
+
+	// Every request from the same logged-in user shares a bucket, wherever it comes from.
+	// Requests from clients which aren't logged in fall back to being keyed by IP.
+	keyByUser
+)
+
+// Allows bursts of up to limit requests, refilling at a steady rate of limit requests per
+// period. For example, {limit: 10, period: time.Hour} allows 10 requests at once, after
+// which one more request is allowed every 6 minutes.
+type rateLimitPolicy struct {
+	limit  int
+	period time.Duration
+	keyBy  rateLimitKey
+}
+
+// The number of tokens added to the bucket per second.
+func (p rateLimitPolicy) rate() float64 {
+	return float64(p.limit) / p.period.Seconds()
+}
+
+// The rate limit policies for the application, keyed by route pattern. Routes which aren't
+// listed here aren't rate limited. These are aimed at the forms which create things, send
+// emails or check the user's password, as they're the ones most worth abusing.
+var defaultRateLimits = map[string]rateLimitPolicy{
+	"POST /user/signup":             {limit: 10, period: time.Hour, keyBy: keyByIP},
+	"POST /user/login":              {limit: 30, period: 10 * time.Minute, keyBy: keyByIP},
+	"POST /user/password/forgot":    {limit: 5, period: time.Hour, keyBy: keyByIP},
+	"POST /user/verify/resend":      {limit: 5, period: time.Hour, keyBy: keyByUser},
+	"POST /snippet/create":          {limit: 30, period: time.Hour, keyBy: keyByUser},
+	"POST /account/email/update":    {limit: 10, period: time.Hour, keyBy: keyByUser},
+	"POST /account/password/update": {limit: 10, period: time.Hour, keyBy: keyByUser},
+	"POST /snippet/report/{id}":     {limit: 10, period: time.Hour, keyBy: keyByIP},
+	"POST /org/invite/{id}":         {limit: 20, period: time.Hour, keyBy: keyByUser},
+}
+
+// How often the limiter looks for idle buckets to throw away.
+const rateLimitSweepInterval = time.Minute
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+
+	// How long the bucket takes to refill completely. Once it has been idle for this long
+	// it's indistinguishable from a new bucket, so it can be thrown away.
+	refill time.Duration
+}
+
+// A set of token buckets, keyed by route pattern and client. It's safe for concurrent use.
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+// The outcome of taking a token from a bucket.
+type rateLimitResult struct {
+	allowed   bool
+	remaining int
+
+	// How long until the bucket is full again.
+	reset time.Duration
+
+	// How long until the next token is available, if the request wasn't allowed.
+	retryAfter time.Duration
+}
+
+// Tries to take a token from the bucket for key, which is created (full) if it doesn't
+// exist yet.
+func (l *rateLimiter) take(key string, policy rateLimitPolicy, now time.Time) rateLimitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	rate := policy.rate()
+	burst := float64(policy.limit)
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &tokenBucket{tokens: burst, last: now, refill: policy.period}
+		l.buckets[key] = b
+	}
+
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	var result rateLimitResult
+	if b.tokens >= 1 {
+		b.tokens--
+		result.allowed = true
+	} else {
+		result.retryAfter = seconds((1 - b.tokens) / rate)
+	}
+
+	result.remaining = int(b.tokens)
+	result.reset = seconds((burst - b.tokens) / rate)
+
+	return result
+}
+
+// Throws away any buckets which have been idle for long enough to have refilled completely.
+// This keeps memory use proportional to the number of recently active clients.
+func (l *rateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= b.refill {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.lastSweep = now
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Applies the rate limit policy for the matched route pattern (if there is one). It sets the
+// RateLimit-* headers from the IETF draft on every response from a limited route, and
+// responds with 429 Too Many Requests when the client's bucket is empty.
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy, ok := app.rateLimits[r.Pattern]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := "ip:" + clientIP(r)
+		if policy.keyBy == keyByUser {
+			if id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID"); id != 0 {
+				key = fmt.Sprintf("user:%d", id)
+			}
+		}
+
+		result := app.rateLimiter.take(r.Pattern+" "+key, policy, time.Now())
+
+		w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.limit, int(policy.period.Seconds())))
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(policy.limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.reset.Seconds()))))
+
+		if !result.allowed {
+			app.metrics.rateLimited.WithLabelValues(r.Pattern).Inc()
+
+			setRetryAfter(w, result.retryAfter)
+			app.clientError(w, http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
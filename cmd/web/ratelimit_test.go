@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/assert"
+)
+
+func TestRateLimiterTake(t *testing.T) {
+	l := newRateLimiter()
+	policy := rateLimitPolicy{limit: 3, period: 3 * time.Minute}
+	now := time.Now()
+
+	// The bucket starts full, so a burst of up to the limit is allowed.
+	for i := 2; i >= 0; i-- {
+		result := l.take("key", policy, now)
+		assert.Equal(t, result.allowed, true)
+		assert.Equal(t, result.remaining, i)
+	}
+
+	result := l.take("key", policy, now)
+	assert.Equal(t, result.allowed, false)
+	assert.Equal(t, result.retryAfter, time.Minute)
+	assert.Equal(t, result.reset, 3*time.Minute)
+
+	// Other keys have their own buckets.
+	result = l.take("other", policy, now)
+	assert.Equal(t, result.allowed, true)
+
+	// One token is added every minute.
+	result = l.take("key", policy, now.Add(time.Minute))
+	assert.Equal(t, result.allowed, true)
+	assert.Equal(t, result.remaining, 0)
+
+	result = l.take("key", policy, now.Add(time.Minute))
+	assert.Equal(t, result.allowed, false)
+}
+
+func TestRateLimiterEviction(t *testing.T) {
+	l := newRateLimiter()
+	policy := rateLimitPolicy{limit: 3, period: 3 * time.Minute}
+	now := time.Now()
+
+	l.take("idle", policy, now)
+	l.take("active", policy, now.Add(2*time.Minute))
+	assert.Equal(t, len(l.buckets), 2)
+
+	// By now the idle bucket would have refilled, so it can be thrown away.
+	l.take("active", policy, now.Add(3*time.Minute))
+	assert.Equal(t, len(l.buckets), 1)
+
+	_, exists := l.buckets["active"]
+	assert.Equal(t, exists, true)
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	app := newTestApplication(t)
+	app.rateLimits = map[string]rateLimitPolicy{
+		"GET /user/login":  {limit: 2, period: time.Hour, keyBy: keyByIP},
+		"POST /user/login": {limit: 1, period: time.Hour, keyBy: keyByIP},
+	}
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	for _, wantRemaining := range []string{"1", "0"} {
+		code, headers, _ := ts.get(t, "/user/login")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, headers.Get("RateLimit-Policy"), "2;w=3600")
+		assert.Equal(t, headers.Get("RateLimit-Limit"), "2")
+		assert.Equal(t, headers.Get("RateLimit-Remaining"), wantRemaining)
+	}
+
+	code, headers, _ := ts.get(t, "/user/login")
+	assert.Equal(t, code, http.StatusTooManyRequests)
+	assert.Equal(t, headers.Get("Retry-After"), "1800")
+	assert.Equal(t, headers.Get("RateLimit-Reset"), "3600")
+
+	// Each route pattern has its own bucket, so this gets past the limiter (and is then
+	// rejected by the CSRF check).
+	code, _, _ = ts.postForm(t, "/user/login", url.Values{})
+	assert.Equal(t, code, http.StatusBadRequest)
+
+	// And routes without a policy aren't limited at all.
+	code, headers, _ = ts.get(t, "/")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, headers.Get("RateLimit-Limit"), "")
+
+	assert.StringContains(t, scrapeMetrics(t, app), `snippetbox_http_rate_limited_total{route="GET /user/login"} 1`)
+}
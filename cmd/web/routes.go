@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/justinas/alice"
+	"snippetbox.prajjmon.net/internal/models"
 	"snippetbox.prajjmon.net/ui"
 )
 
@@ -20,28 +21,107 @@ func (app *application) routes() http.Handler {
 
 	// This middleware chain is specific to the dynamic app routes (non-static) that
 	// are unprotected (AKA no-auth required)
-	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf, app.authenticate)
+	// The rate limiter comes straight after the session is loaded (which it needs in order to
+	// identify the user), so that rejected requests are turned away as cheaply as possible.
+	dynamic := alice.New(app.sessionManager.LoadAndSave, app.rateLimit, noSurf, app.authenticate)
 
 	mux.Handle("GET /{$}", dynamic.ThenFunc(app.home)) // Restrict this route to exact matches on "/" only.
 	mux.Handle("GET /snippet/view/{id}", dynamic.ThenFunc(app.snippetView))
+	mux.Handle("POST /snippet/report/{id}", dynamic.ThenFunc(app.snippetReportPost))
+	mux.Handle("GET /snippet/link/{token}", dynamic.ThenFunc(app.shareLinkView))
+	mux.Handle("GET /collection/view/{id}", dynamic.ThenFunc(app.collectionView))
 	mux.Handle("GET /user/signup", dynamic.ThenFunc(app.userSignup))
 	mux.Handle("POST /user/signup", dynamic.ThenFunc(app.userSignupPost))
 	mux.Handle("GET /user/login", dynamic.ThenFunc(app.userLogin))
 	mux.Handle("POST /user/login", dynamic.ThenFunc(app.userLoginPost))
+	mux.Handle("GET /user/login/mfa", dynamic.ThenFunc(app.userLoginMFA))
+	mux.Handle("POST /user/login/mfa", dynamic.ThenFunc(app.userLoginMFAPost))
+	mux.Handle("GET /user/password/forgot", dynamic.ThenFunc(app.passwordForgot))
+	mux.Handle("POST /user/password/forgot", dynamic.ThenFunc(app.passwordForgotPost))
+	mux.Handle("GET /user/password/reset/{token}", dynamic.ThenFunc(app.passwordReset))
+	mux.Handle("POST /user/password/reset/{token}", dynamic.ThenFunc(app.passwordResetPost))
+	mux.Handle("GET /user/verify/{token}", dynamic.ThenFunc(app.userVerify))
 
 	// Protected (authenticated-only) application routes, using a new "protected"
 	// middleware chain which includes the requireAuthentication middleware.
 	protected := dynamic.Append(app.requireAuthentication)
 
-	mux.Handle("GET /snippet/create", protected.ThenFunc(app.snippetCreate))
-	mux.Handle("POST /snippet/create", protected.ThenFunc(app.snippetCreatePost))
 	mux.Handle("POST /user/logout", protected.ThenFunc(app.userLogoutPost))
+	mux.Handle("POST /user/verify/resend", protected.ThenFunc(app.userVerifyResendPost))
+	mux.Handle("GET /account/view", protected.ThenFunc(app.accountView))
+	mux.Handle("GET /account/name/update", protected.ThenFunc(app.accountNameUpdate))
+	mux.Handle("POST /account/name/update", protected.ThenFunc(app.accountNameUpdatePost))
+	mux.Handle("GET /account/email/update", protected.ThenFunc(app.accountEmailUpdate))
+	mux.Handle("POST /account/email/update", protected.ThenFunc(app.accountEmailUpdatePost))
+	mux.Handle("GET /account/password/update", protected.ThenFunc(app.accountPasswordUpdate))
+	mux.Handle("POST /account/password/update", protected.ThenFunc(app.accountPasswordUpdatePost))
+	mux.Handle("GET /account/mfa/setup", protected.ThenFunc(app.accountMFASetup))
+	mux.Handle("POST /account/mfa/setup", protected.ThenFunc(app.accountMFASetupPost))
+	mux.Handle("GET /account/mfa/disable", protected.ThenFunc(app.accountMFADisable))
+	mux.Handle("POST /account/mfa/disable", protected.ThenFunc(app.accountMFADisablePost))
+	mux.Handle("GET /account/sessions", protected.ThenFunc(app.accountSessions))
+	mux.Handle("POST /account/sessions/revoke/{id}", protected.ThenFunc(app.accountSessionRevokePost))
+	mux.Handle("POST /account/sessions/revoke-others", protected.ThenFunc(app.accountSessionRevokeOthersPost))
+	mux.Handle("GET /account/activity", protected.ThenFunc(app.accountActivity))
+	mux.Handle("GET /snippet/edit/{id}", protected.ThenFunc(app.snippetEdit))
+	mux.Handle("POST /snippet/edit/{id}", protected.ThenFunc(app.snippetEditPost))
+	mux.Handle("POST /snippet/share/{id}", protected.ThenFunc(app.snippetSharePost))
+	mux.Handle("POST /snippet/unshare/{id}", protected.ThenFunc(app.snippetUnsharePost))
+	mux.Handle("GET /user/shared", protected.ThenFunc(app.snippetsShared))
+	mux.Handle("POST /snippet/star/{id}", protected.ThenFunc(app.snippetStarPost))
+	mux.Handle("POST /snippet/unstar/{id}", protected.ThenFunc(app.snippetUnstarPost))
+	mux.Handle("GET /user/stars", protected.ThenFunc(app.snippetsStarred))
+	mux.Handle("GET /snippet/settings/{id}", protected.ThenFunc(app.snippetSettings))
+	mux.Handle("POST /snippet/links/create/{id}", protected.ThenFunc(app.shareLinkCreatePost))
+	mux.Handle("POST /snippet/links/revoke/{id}", protected.ThenFunc(app.shareLinkRevokePost))
+	mux.Handle("GET /org/view/{id}", protected.ThenFunc(app.orgView))
+	mux.Handle("POST /org/invite/{id}", protected.ThenFunc(app.orgInvitePost))
+	mux.Handle("GET /org/join/{token}", protected.ThenFunc(app.orgJoin))
+	mux.Handle("POST /org/join/{token}", protected.ThenFunc(app.orgJoinPost))
+	mux.Handle("POST /collection/rename/{id}", protected.ThenFunc(app.collectionRenamePost))
+	mux.Handle("POST /collection/add/{id}", protected.ThenFunc(app.collectionAddPost))
+	mux.Handle("POST /collection/remove/{id}", protected.ThenFunc(app.collectionRemovePost))
+	mux.Handle("POST /collection/move/{id}", protected.ThenFunc(app.collectionMovePost))
+
+	// Routes which are only available to users who have verified their email address.
+	verified := protected.Append(app.requireVerified)
+
+	mux.Handle("GET /snippet/create", verified.ThenFunc(app.snippetCreate))
+	mux.Handle("POST /snippet/create", verified.ThenFunc(app.snippetCreatePost))
+	mux.Handle("GET /org/create", verified.ThenFunc(app.orgCreate))
+	mux.Handle("POST /org/create", verified.ThenFunc(app.orgCreatePost))
+	mux.Handle("GET /collection/create", verified.ThenFunc(app.collectionCreate))
+	mux.Handle("POST /collection/create", verified.ThenFunc(app.collectionCreatePost))
+
+	// Routes which are available to moderators (and admins).
+	moderator := protected.Append(app.requireRole(models.RoleModerator, models.RoleAdmin))
+
+	mux.Handle("GET /moderation", moderator.ThenFunc(app.moderation))
+	mux.Handle("POST /moderation/dismiss/{id}", moderator.ThenFunc(app.moderationDismissPost))
+	mux.Handle("POST /moderation/hide/{id}", moderator.ThenFunc(app.moderationHidePost))
+	mux.Handle("POST /moderation/delete/{id}", moderator.ThenFunc(app.moderationDeletePost))
+
+	// Routes which are only available to admins.
+	admin := protected.Append(app.requireRole(models.RoleAdmin))
+
+	mux.Handle("GET /admin", admin.ThenFunc(app.adminDashboard))
+	mux.Handle("GET /admin/users", admin.ThenFunc(app.adminUsers))
+	mux.Handle("GET /admin/audit", admin.ThenFunc(app.adminAudit))
+	mux.Handle("POST /admin/users/disable/{id}", admin.ThenFunc(app.adminUserDisablePost))
+	mux.Handle("POST /admin/users/enable/{id}", admin.ThenFunc(app.adminUserEnablePost))
+	mux.Handle("POST /admin/users/role/{id}", admin.ThenFunc(app.adminUserRolePost))
+	mux.Handle("POST /admin/snippets/expire/{id}", admin.ThenFunc(app.adminSnippetExpirePost))
+	mux.Handle("POST /admin/snippets/delete/{id}", admin.ThenFunc(app.adminSnippetDeletePost))
 
 	// Create a middleware chain containing our 'standard' middleware which will be used for
 	// every request our application receives.
-	standard := alice.New(app.recoverFromPanic, app.logRequest, commonHeaders)
+	// The requestID middleware comes first so that every log entry, including the one written
+	// by recoverFromPanic, can include the request ID. logRequest wraps recoverFromPanic so
+	// that requests which panicked are still logged (with their 500 status).
+	// proxyHeaders runs before everything else, so that they all see the real client IP.
+	standard := alice.New(app.proxyHeaders, app.requestID, app.logRequest, app.recoverFromPanic, commonHeaders, app.traceRequest, app.instrumentRequest)
 
 	// flow of control (reading from left to right) looks like this:
-	// 		logRequest ↔ commonHeaders ↔ servemux ↔ application handler
+	// 		proxyHeaders ↔ requestID ↔ logRequest ↔ recoverFromPanic ↔ commonHeaders ↔ traceRequest ↔ instrumentRequest ↔ servemux ↔ application handler
 	return standard.Then(mux)
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace/noop"
+	"snippetbox.prajjmon.net/internal/assert"
+	"snippetbox.prajjmon.net/internal/models"
+	"snippetbox.prajjmon.net/internal/passhash"
+)
+
+func TestMakeAdmin(t *testing.T) {
+	store, err := openStorage("memory", "", 0, passhash.DefaultParams, noop.NewTracerProvider().Tracer(tracerName), newMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.close()
+
+	ctx := context.Background()
+
+	id, err := store.users.Insert(ctx, "Alice", "alice@example.com", "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = makeAdmin(ctx, store, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := store.users.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, user.Role, models.RoleAdmin)
+
+	entries, err := store.auditLog.List(ctx, models.AuditFilter{Action: models.AuditUserRoleChange})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].TargetID, id)
+
+	err = makeAdmin(ctx, store, "bob@example.com")
+	assert.Equal(t, err != nil, true)
+}
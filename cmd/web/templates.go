@@ -1,9 +1,9 @@
 package main
 
 import (
+	"html/template"
 	"io/fs"
 	"path/filepath"
-	"text/template"
 	"time"
 
 	"snippetbox.prajjmon.net/internal/models"
@@ -14,10 +14,82 @@ type templateData struct {
 	CurrentYear     int
 	Snippet         models.Snippet
 	Snippets        []models.Snippet
+	User            models.User
 	Form            any
 	Flash           string
 	IsAuthenticated bool
 	CsrfToken       string
+
+	// The role of the logged in user, which is empty if nobody is logged in.
+	Role models.Role
+
+	// Whether the logged in user can edit the snippet being viewed, and whether they're one of
+	// its owners (who can change its visibility and share it).
+	CanEdit     bool
+	OwnsSnippet bool
+
+	// The people that the snippet being viewed has been shared with, and the form for sharing
+	// it with someone else.
+	Shares    []snippetShare
+	ShareForm any
+
+	// The snippets which have been shared with the logged in user.
+	SharedSnippets []sharedSnippet
+
+	// The links which let people without an account see the snippet, and whether the snippet
+	// is being viewed through one of them.
+	ShareLinks   []models.ShareLink
+	ViaShareLink bool
+
+	// A collection and whether the logged in user owns it, the logged in user's collections,
+	// and the public collections which include the snippet being viewed.
+	Collection         models.Collection
+	OwnsCollection     bool
+	Collections        []models.Collection
+	SnippetCollections []models.Collection
+
+	// How many people have starred the snippet being viewed, and whether the logged in user
+	// is one of them.
+	StarCount int
+	Starred   bool
+
+	// The snippets which have been given the most stars over the past week.
+	MostStarred []starredSnippet
+
+	// An organization, the logged in user's role in it and its members, along with the
+	// organizations that the user belongs to and an invitation to join one.
+	Org        models.Org
+	OrgRole    models.OrgRole
+	OrgMembers []orgMember
+	Orgs       []models.Org
+	Invitation models.OrgInvitation
+
+	// Site statistics and lists of users, shown in the admin section, along with the roles
+	// that users can be given.
+	UserCount       int
+	SnippetCounts   models.SnippetCounts
+	OpenReportCount int
+	Users           []models.User
+	TopCreators     []topCreator
+	Query           string
+	Roles           []models.Role
+
+	// The moderation queue.
+	ReportedSnippets []reportedSnippet
+
+	// Audit log entries, and the actions they can be filtered by.
+	AuditEntries []auditEntry
+	AuditActions []models.AuditAction
+	AuditAction  models.AuditAction
+
+	// Two-factor authentication settings, shown on the account pages.
+	MFAEnabled             bool
+	RecoveryCodesRemaining int
+	RecoveryCodes          []string
+
+	// The user's logged in sessions, and the ID of the one making the request.
+	Sessions         []models.UserSession
+	CurrentSessionID string
 }
 
 // Create a humanDate function which returns a nicely formatted string representation of
@@ -10,12 +10,16 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"regexp"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
+	"go.opentelemetry.io/otel/trace/noop"
+	"snippetbox.prajjmon.net/internal/models/memory"
 	"snippetbox.prajjmon.net/internal/models/mocks"
+	"snippetbox.prajjmon.net/internal/validator/passwordpolicy"
 )
 
 // Returns an instance of our application struct containing mocked dependencies
@@ -32,7 +36,8 @@ func newTestApplication(t *testing.T) *application {
 	// that we *don't* set a Store for the session manager. If no store is set, the SCS
 	// package will default to using a transient in-memory store, which is ideal for testing purposes.
 	sessionManager := scs.New()
-	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Lifetime = 30 * 24 * time.Hour
+	sessionManager.Cookie.Persist = false
 	sessionManager.Cookie.Secure = true
 
 	// Create a new instance of our application struct.
@@ -40,14 +45,75 @@ func newTestApplication(t *testing.T) *application {
 		logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
 		snippets:       &mocks.SnippetModel{},
 		users:          &mocks.UserModel{},
+		tokens:         &mocks.TokenModel{},
+		mfa:            &mocks.MFAModel{},
+		passwordPolicy: &passwordpolicy.Policy{Breached: passwordpolicy.Bundled()},
+		mailer:         &testMailer{},
+		baseURL:        "https://snippetbox.example.com",
 		templateCache:  templateCache,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
+		metrics:        newMetrics(),
+		tracer:         noop.NewTracerProvider().Tracer(tracerName),
+		propagator:     newPropagator(),
+
+		// The in-memory store is simple and fast enough to use as-is, and lets the tests
+		// check the throttling, session revocation, duplicate reports, organization
+		// membership, sharing, share links, collections, stars and audit log properly.
+		loginAttempts: &memory.LoginAttemptModel{},
+		userSessions:  &memory.UserSessionModel{},
+		reports:       &memory.ReportModel{},
+		orgs:          &memory.OrgModel{},
+		shares:        &memory.ShareModel{},
+		links:         &memory.ShareLinkModel{},
+		collections:   &memory.CollectionModel{},
+		stars:         &memory.StarModel{},
+		auditLog:      &memory.AuditLogModel{},
+
+		// No routes are rate limited, unless a test sets its own policies.
+		rateLimiter: newRateLimiter(),
+
+		sessionLifetime:    12 * time.Hour,
+		sessionIdleTimeout: time.Hour,
+
+		reportThreshold: 2,
 	}
 }
 
+// A mailer which records the emails that it is asked to send, instead of sending them.
+type testMailer struct {
+	mu   sync.Mutex
+	sent []testEmail
+}
+
+type testEmail struct {
+	recipient    string
+	templateFile string
+	data         any
+}
+
+func (m *testMailer) Send(recipient, templateFile string, data any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, testEmail{recipient: recipient, templateFile: templateFile, data: data})
+	return nil
+}
+
+// Returns the emails sent so far.
+func (m *testMailer) emails() []testEmail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]testEmail(nil), m.sent...)
+}
+
 type testServer struct {
 	*httptest.Server
+
+	// The client used to make requests. Each client has its own cookie jar, so it behaves
+	// like a separate browser.
+	client *http.Client
 }
 
 // Initalizes and returns a new instance of our custom testServer type.
@@ -59,24 +125,53 @@ func newTestServer(t *testing.T, h http.Handler) *testServer {
 	// If we're testing a HTTP (not HTTPS) server then we should use the httptest.NewServer function
 	ts := httptest.NewTLSServer(h)
 
+	return &testServer{Server: ts, client: newTestClient(t, ts)}
+}
+
+// Returns a copy of the test server which makes its requests using a new client, with its own
+// (empty) cookie jar.
+func (ts *testServer) newClient(t *testing.T) *testServer {
+	return &testServer{Server: ts.Server, client: newTestClient(t, ts.Server)}
+}
+
+// Makes the client send the given User-Agent header with all of its requests.
+func (ts *testServer) setUserAgent(userAgent string) {
+	ts.client.Transport = userAgentTransport{base: ts.client.Transport, userAgent: userAgent}
+}
+
+type userAgentTransport struct {
+	base      http.RoundTripper
+	userAgent string
+}
+
+func (t userAgentTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("User-Agent", t.userAgent)
+	return t.base.RoundTrip(r)
+}
+
+func newTestClient(t *testing.T, ts *httptest.Server) *http.Client {
 	jar, err := cookiejar.New(nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// Add the cookie jar to the test server client. Any response cookies will
-	// now be stored and sent with subsequent requests when using this client.
-	ts.Client().Jar = jar
-
-	// Disable redirect-following for the test server client by setting a custom
-	// CheckRedirect function. This function will be called whenever a 3xx response is
-	// received by the client, and by always returning a http.ErrUseLastResponse error it
-	// forces the client to immediately return the received response.
-	ts.Client().CheckRedirect = func(req *http.Request, via []*http.Request) error {
-		return http.ErrUseLastResponse
+	return &http.Client{
+		// Use the test server's transport, which trusts its self-signed TLS certificate.
+		Transport: ts.Client().Transport,
+
+		// Any response cookies will be stored and sent with subsequent requests when
+		// using this client.
+		Jar: jar,
+
+		// Disable redirect-following by setting a custom CheckRedirect function. This
+		// function will be called whenever a 3xx response is received by the client, and by
+		// always returning a http.ErrUseLastResponse error it forces the client to
+		// immediately return the received response.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
 	}
-
-	return &testServer{ts}
 }
 
 // Makes a GET request to a given url path using the test server client, and returns the
@@ -84,9 +179,9 @@ func newTestServer(t *testing.T, h http.Handler) *testServer {
 func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, string) {
 
 	// The network address that the test server is listening on is contained in the ts.URL
-	// field. We can use this along with the ts.Client().Get() method to make a GET /ping
+	// field. We can use this along with the ts.client.Get() method to make a GET /ping
 	// request against the test server. This returns a http.Response struct containing the response.
-	result, err := ts.Client().Get(ts.URL + urlPath)
+	result, err := ts.client.Get(ts.URL + urlPath)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -121,7 +216,7 @@ func extractCsrfToken(t *testing.T, htmlBody string) string {
 }
 
 func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (int, http.Header, string) {
-	rs, err := ts.Client().PostForm(ts.URL+urlPath, form)
+	rs, err := ts.client.PostForm(ts.URL+urlPath, form)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -135,3 +230,20 @@ func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (i
 	body = bytes.TrimSpace(body)
 	return rs.StatusCode, rs.Header, string(body)
 }
+
+// Logs in with the given credentials, failing the test if the login doesn't succeed.
+func (ts *testServer) login(t *testing.T, email, password string) {
+	t.Helper()
+
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", password)
+	form.Add("csrf_token", extractCsrfToken(t, body))
+
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("login failed: got status %d", code)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+// Each failed login attempt costs us a password hash comparison, so we throttle them to limit
+// both password guessing and the CPU that an attacker can make us burn. Failures are counted over
+// a sliding window (see models.LoginAttemptModelInterface) against several keys at once; the
+// most restrictive one wins.
+//
+// Each attempt is counted as a failure before the credentials are checked, so that a burst of
+// concurrent attempts can't all get past the throttle before any of them has been recorded.
+// Attempts which are refused, or which turn out to succeed, are taken back afterwards.
+type throttleRule struct {
+	// Identifies the kind of key (e.g. "email"). It prefixes the keys in the store, and is
+	// used as a label in the logs and metrics.
+	scope string
+
+	// The number of failures allowed within the window before we start making the client
+	// wait between attempts.
+	freeAttempts int
+
+	// The number of failures within the window after which we refuse any more attempts
+	// until the window has passed.
+	lockoutAfter int
+
+	// Whether a successful login clears all of the failures for the key, rather than just
+	// taking back the attempt itself.
+	resetOnSuccess bool
+}
+
+var (
+	// Protects a single account against guessing, wherever the attempts come from.
+	emailThrottle = throttleRule{scope: "email", freeAttempts: 3, lockoutAfter: 10, resetOnSuccess: true}
+
+	// Limits how many accounts a single client can try. This is much more lenient, as many
+	// users can share an IP address. It isn't reset when the client logs in, as otherwise it
+	// could keep guessing other users' passwords indefinitely by logging into its own account
+	// every so often.
+	ipThrottle = throttleRule{scope: "ip", freeAttempts: 20, lockoutAfter: 100}
+
+	// Protects the second step of logging in, as a 6-digit code is easy to guess otherwise.
+	mfaThrottle = throttleRule{scope: "mfa", freeAttempts: 3, lockoutAfter: 10, resetOnSuccess: true}
+)
+
+const (
+	// The delay imposed after the first failure beyond the free attempts. It doubles with
+	// each further failure, up to throttleMaxDelay.
+	throttleBaseDelay = time.Second
+	throttleMaxDelay  = time.Minute
+
+	// How long a lockout lasts. Failures are forgotten after this long, so it matches the
+	// window used by the login attempt store.
+	throttleWindow = models.DefaultLoginAttemptWindow
+)
+
+// Returns how long the client must wait (after now) before making another attempt, given
+// the number of failures in the window and the time of the latest one, and whether that's
+// because the key is locked out rather than just delayed.
+func (rule throttleRule) check(failures int, last, now time.Time) (time.Duration, bool) {
+	if failures >= rule.lockoutAfter {
+		return last.Add(throttleWindow).Sub(now), true
+	}
+
+	if failures <= rule.freeAttempts {
+		return 0, false
+	}
+
+	delay := throttleMaxDelay
+	if shift := failures - rule.freeAttempts - 1; shift < 16 {
+		delay = min(throttleBaseDelay<<shift, throttleMaxDelay)
+	}
+
+	return max(last.Add(delay).Sub(now), 0), false
+}
+
+type throttleKey struct {
+	rule  throttleRule
+	value string
+}
+
+func (k throttleKey) String() string {
+	return k.rule.scope + ":" + k.value
+}
+
+// A login attempt which has been counted against its throttle keys, along with the number of
+// failures (including itself) for each key.
+type loginAttempt struct {
+	keys     []throttleKey
+	failures []int
+}
+
+// Counts a login attempt against each of the keys, before the credentials are checked. Returns
+// how long the client must wait before it can try again, which is zero if it can go ahead now,
+// and whether that's because of a lockout. An attempt which has to wait isn't counted.
+func (app *application) startLoginAttempt(ctx context.Context, keys ...throttleKey) (*loginAttempt, time.Duration, bool, error) {
+	attempt := &loginAttempt{keys: keys}
+
+	var wait time.Duration
+	var locked bool
+
+	now := time.Now()
+
+	for _, key := range keys {
+		failures, last, err := app.loginAttempts.RecordFailure(ctx, key.String())
+		if err != nil {
+			return nil, 0, false, err
+		}
+		attempt.failures = append(attempt.failures, failures)
+
+		// Whether this attempt may go ahead depends on the failures before it.
+		w, l := key.rule.check(failures-1, last, now)
+		if w > wait {
+			wait, locked = w, l
+		}
+	}
+
+	if wait > 0 {
+		err := app.cancelLoginAttempt(ctx, attempt)
+		if err != nil {
+			return nil, 0, false, err
+		}
+	}
+
+	return attempt, wait, locked, nil
+}
+
+// Counts a check of the logged in user's current password, such as before they change their
+// email address, against the same keys as logging in. Being able to check the password is as
+// good as being able to log in with it, so a hijacked session mustn't allow unlimited guesses.
+func (app *application) startPasswordCheck(r *http.Request, user models.User) (*loginAttempt, time.Duration, bool, error) {
+	return app.startLoginAttempt(r.Context(),
+		throttleKey{emailThrottle, strings.ToLower(user.Email)},
+		throttleKey{ipThrottle, clientIP(r)},
+	)
+}
+
+// Leaves a login attempt counted as a failure. Keys which have just reached the lockout
+// threshold are logged and counted, so that we can spot attacks in progress.
+func (app *application) failLoginAttempt(r *http.Request, attempt *loginAttempt) {
+	for i, key := range attempt.keys {
+		failures := attempt.failures[i]
+
+		if failures == key.rule.lockoutAfter {
+			app.metrics.loginLockouts.WithLabelValues(key.rule.scope).Inc()
+			app.requestLogger(r).Warn("login locked out", "scope", key.rule.scope, "key", key.value, "failures", failures, "duration", throttleWindow)
+		}
+	}
+}
+
+// Takes back a login attempt which shouldn't count as a failure.
+func (app *application) cancelLoginAttempt(ctx context.Context, attempt *loginAttempt) error {
+	for _, key := range attempt.keys {
+		err := app.loginAttempts.Forget(ctx, key.String())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Takes back a successful login attempt, clearing the failures for the keys which are reset
+// on success.
+func (app *application) succeedLoginAttempt(ctx context.Context, attempt *loginAttempt) error {
+	for _, key := range attempt.keys {
+		var err error
+		if key.rule.resetOnSuccess {
+			err = app.loginAttempts.Reset(ctx, key.String())
+		} else {
+			err = app.loginAttempts.Forget(ctx, key.String())
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the message shown to a client which has to wait before trying to log in again.
+func throttleMessage(wait time.Duration, locked bool) string {
+	if locked {
+		return fmt.Sprintf("Too many failed login attempts. Logging in has been locked for now; please try again in %s", humanDuration(wait))
+	}
+
+	return fmt.Sprintf("Too many failed login attempts. Please wait %s before trying again", humanDuration(wait))
+}
+
+// Sets the Retry-After header to the given wait, in whole seconds (rounded up).
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+}
+
+// Formats a (short) duration for people, rounding up to whole seconds or minutes.
+func humanDuration(d time.Duration) string {
+	if d > time.Minute {
+		minutes := int((d + time.Minute - 1) / time.Minute)
+		return fmt.Sprintf("%d minutes", minutes)
+	}
+
+	seconds := max(int((d+time.Second-1)/time.Second), 1)
+	if seconds == 1 {
+		return "1 second"
+	}
+	return fmt.Sprintf("%d seconds", seconds)
+}
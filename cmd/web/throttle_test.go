@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/assert"
+)
+
+func TestThrottleRuleCheck(t *testing.T) {
+	rule := throttleRule{scope: "test", freeAttempts: 3, lockoutAfter: 20}
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		failures   int
+		last       time.Time
+		wantWait   time.Duration
+		wantLocked bool
+	}{
+		{"No failures", 0, time.Time{}, 0, false},
+		{"Free attempts", 3, now, 0, false},
+		{"First delay", 4, now, time.Second, false},
+		{"Delay doubles", 6, now, 4 * time.Second, false},
+		{"Delay has passed", 6, now.Add(-5 * time.Second), 0, false},
+		{"Delay is capped", 12, now, time.Minute, false},
+		{"Locked out", 20, now, throttleWindow, true},
+		{"Lockout partly over", 20, now.Add(-time.Minute), throttleWindow - time.Minute, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, locked := rule.check(tt.failures, tt.last, now)
+
+			assert.Equal(t, wait, tt.wantWait)
+			assert.Equal(t, locked, tt.wantLocked)
+		})
+	}
+}
+
+func TestHumanDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{100 * time.Millisecond, "1 second"},
+		{1500 * time.Millisecond, "2 seconds"},
+		{time.Minute, "60 seconds"},
+		{14*time.Minute + time.Second, "15 minutes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, humanDuration(tt.d), tt.want)
+		})
+	}
+}
+
+func TestUserLoginThrottle(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/login")
+	csrfToken := extractCsrfToken(t, body)
+
+	login := func(password string) (int, http.Header, string) {
+		form := url.Values{}
+		form.Add("email", "alice@example.com")
+		form.Add("password", password)
+		form.Add("csrf_token", csrfToken)
+
+		return ts.postForm(t, "/user/login", form)
+	}
+
+	// The first few failures are let through straight away.
+	for i := 0; i <= emailThrottle.freeAttempts; i++ {
+		code, _, _ := login("wrong password")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+	}
+
+	// After that, even the right password is refused until the delay has passed.
+	code, headers, body := login("pa$$word")
+	assert.Equal(t, code, http.StatusTooManyRequests)
+	assert.Equal(t, headers.Get("Retry-After"), "1")
+	assert.StringContains(t, body, "Please wait 1 second before trying again")
+
+	time.Sleep(time.Second)
+
+	code, _, _ = login("pa$$word")
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	// Logging in successfully clears the count for the account.
+	failures, _, err := app.loginAttempts.Failures(context.Background(), "email:alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, failures, 0)
+
+	// But not for the client, where neither the refused attempt nor the successful one is
+	// counted.
+	failures, _, err = app.loginAttempts.Failures(context.Background(), "ip:127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, failures, emailThrottle.freeAttempts+1)
+}
+
+func TestUserLoginThrottleConcurrent(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", "alice@example.com")
+	form.Add("password", "wrong password")
+	form.Add("csrf_token", extractCsrfToken(t, body))
+
+	const attempts = 20
+
+	var wg sync.WaitGroup
+	codes := make(chan int, attempts)
+
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			rs, err := ts.client.PostForm(ts.URL+"/user/login", form)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			rs.Body.Close()
+
+			codes <- rs.StatusCode
+		}()
+	}
+
+	wg.Wait()
+	close(codes)
+
+	counts := make(map[int]int)
+	for code := range codes {
+		counts[code]++
+	}
+
+	// Only the free attempts get as far as checking the password, however many of them
+	// arrive at once. The rest are refused, and aren't counted as failures.
+	assert.Equal(t, counts[http.StatusUnprocessableEntity], emailThrottle.freeAttempts+1)
+	assert.Equal(t, counts[http.StatusTooManyRequests], attempts-emailThrottle.freeAttempts-1)
+
+	failures, _, err := app.loginAttempts.Failures(context.Background(), "email:alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, failures, emailThrottle.freeAttempts+1)
+}
+
+func TestFailLoginAttemptLockout(t *testing.T) {
+	var buf bytes.Buffer
+
+	app := newTestApplication(t)
+	app.logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+	r, err := http.NewRequest(http.MethodPost, "/user/login", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := throttleKey{emailThrottle, "alice@example.com"}
+
+	for i := 1; i <= emailThrottle.lockoutAfter+2; i++ {
+		app.failLoginAttempt(r, &loginAttempt{keys: []throttleKey{key}, failures: []int{i}})
+	}
+
+	// The lockout is only reported once, when the threshold is reached.
+	assert.Equal(t, strings.Count(buf.String(), `msg="login locked out"`), 1)
+	assert.StringContains(t, buf.String(), "scope=email key=alice@example.com")
+	assert.StringContains(t, scrapeMetrics(t, app), `snippetbox_login_lockouts_total{scope="email"} 1`)
+}
+
+func TestAccountPasswordCheckThrottle(t *testing.T) {
+	tests := []struct {
+		name    string
+		urlPath string
+		form    url.Values
+	}{
+		{
+			name:    "Email update",
+			urlPath: "/account/email/update",
+			form:    url.Values{"email": {"alice@example.org"}},
+		},
+		{
+			name:    "Password update",
+			urlPath: "/account/password/update",
+			form:    url.Values{"new_password": {"n3w pa$$word"}, "confirm_password": {"n3w pa$$word"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			ts.login(t, "alice@example.com", "pa$$word")
+
+			_, _, body := ts.get(t, tt.urlPath)
+			tt.form.Set("csrf_token", extractCsrfToken(t, body))
+
+			post := func(password string) (int, http.Header, string) {
+				tt.form.Set("current_password", password)
+				return ts.postForm(t, tt.urlPath, tt.form)
+			}
+
+			// Checking the current password shares the login throttle for the account.
+			for i := 0; i <= emailThrottle.freeAttempts; i++ {
+				code, _, body := post("wrong password")
+				assert.Equal(t, code, http.StatusUnprocessableEntity)
+				assert.StringContains(t, body, "Current password is incorrect")
+			}
+
+			code, headers, body := post("pa$$word")
+			assert.Equal(t, code, http.StatusTooManyRequests)
+			assert.Equal(t, headers.Get("Retry-After"), "1")
+			assert.StringContains(t, body, "Please wait 1 second before trying again")
+
+			time.Sleep(time.Second)
+
+			code, _, _ = post("pa$$word")
+			assert.Equal(t, code, http.StatusSeeOther)
+
+			failures, _, err := app.loginAttempts.Failures(context.Background(), "email:alice@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, failures, 0)
+		})
+	}
+}
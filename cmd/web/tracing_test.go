@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"snippetbox.prajjmon.net/internal/assert"
+)
+
+func TestTraceRequest(t *testing.T) {
+	// Use an in-memory exporter with a synchronous span processor, so that spans are
+	// available to inspect as soon as they have ended.
+	exporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tracerProvider.Shutdown(context.Background())
+
+	app := newTestApplication(t)
+	app.tracer = tracerProvider.Tracer(tracerName)
+
+	ts := newTestServer(t, app.routes())
+
+	const (
+		traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentSpanID = "00f067aa0ba902b7"
+	)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/snippet/view/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentSpanID+"-01")
+
+	rs, err := ts.client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	// Close blocks until all outstanding requests have completed, which guarantees that the
+	// server span has ended before we look at it.
+	ts.Close()
+
+	spans := exporter.GetSpans()
+	assert.Equal(t, len(spans), 2)
+
+	// Spans are exported in the order they end, so the render span comes first.
+	render, server := spans[0], spans[1]
+
+	assert.Equal(t, server.Name, "GET /snippet/view/{id}")
+	assert.Equal(t, server.SpanContext.TraceID().String(), traceID)
+	assert.Equal(t, server.Parent.SpanID().String(), parentSpanID)
+
+	assert.Equal(t, render.Name, "render view.html")
+	assert.Equal(t, render.Parent.SpanID(), server.SpanContext.SpanID())
+}
@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Writes each email to a new .eml file in Dir instead of sending it, which is handy for
+// looking at emails during development.
+type File struct {
+	Dir    string
+	Sender string
+}
+
+func (m *File) Send(recipient, templateFile string, data any) error {
+	msg, err := render(recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(m.Dir, 0o750)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), filepath.Base(recipient))
+
+	return os.WriteFile(filepath.Join(m.Dir, name), formatMessage(m.Sender, msg), 0o640)
+}
+
+// Writes each email to a logger instead of sending it.
+type Log struct {
+	Logger *slog.Logger
+}
+
+func (m *Log) Send(recipient, templateFile string, data any) error {
+	msg, err := render(recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	m.Logger.Info("email", slog.String("to", msg.To), slog.String("subject", msg.Subject), slog.String("body", msg.PlainBody))
+
+	return nil
+}
@@ -0,0 +1,55 @@
+// Package mailer sends the application's transactional emails. Messages are rendered from
+// the templates embedded in the templates directory, and delivered by one of the Mailer
+// implementations: SMTP for production, or File and Log for development and tests, which
+// don't need a network connection.
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"text/template"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+// Implemented by everything that can deliver an email.
+type Mailer interface {
+	// Renders the named template (e.g. "password_reset.tmpl") with the given dynamic data and
+	// sends the result to the recipient.
+	Send(recipient, templateFile string, data any) error
+}
+
+// A rendered email.
+type Message struct {
+	To        string
+	Subject   string
+	PlainBody string
+}
+
+// Renders an email template. Each template must define a "subject" and a "plainBody"
+// template.
+func render(recipient, templateFile string, data any) (*Message, error) {
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+
+	plainBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		To:        recipient,
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+	}, nil
+}
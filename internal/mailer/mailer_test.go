@@ -0,0 +1,61 @@
+package mailer
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"snippetbox.prajjmon.net/internal/assert"
+)
+
+var testData = map[string]any{
+	"Name":     "Alice",
+	"ResetURL": "https://example.com/user/password/reset/abc123",
+	"TTL":      "1 hour",
+}
+
+func TestFile(t *testing.T) {
+	m := &File{Dir: t.TempDir(), Sender: "Snippetbox <no-reply@example.com>"}
+
+	err := m.Send("alice@example.com", "password_reset.tmpl", testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(m.Dir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(files), 1)
+
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.StringContains(t, string(b), "To: alice@example.com\r\n")
+	assert.StringContains(t, string(b), "Subject: Reset your Snippetbox password\r\n")
+	assert.StringContains(t, string(b), "https://example.com/user/password/reset/abc123")
+}
+
+func TestLog(t *testing.T) {
+	var buf bytes.Buffer
+	m := &Log{Logger: slog.New(slog.NewTextHandler(&buf, nil))}
+
+	err := m.Send("alice@example.com", "password_reset.tmpl", testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.StringContains(t, buf.String(), "to=alice@example.com")
+	assert.StringContains(t, buf.String(), "Hi Alice,")
+}
+
+func TestMissingTemplate(t *testing.T) {
+	m := &Log{Logger: slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))}
+
+	err := m.Send("alice@example.com", "does_not_exist.tmpl", nil)
+	assert.Equal(t, err != nil, true)
+}
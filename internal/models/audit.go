@@ -0,0 +1,200 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The kind of event recorded by an audit log entry.
+type AuditAction string
+
+const (
+	AuditSignup          AuditAction = "signup"
+	AuditLogin           AuditAction = "login"
+	AuditLoginFailed     AuditAction = "login_failed"
+	AuditLogout          AuditAction = "logout"
+	AuditPasswordChange  AuditAction = "password_change"
+	AuditMFAEnable       AuditAction = "mfa_enable"
+	AuditMFADisable      AuditAction = "mfa_disable"
+	AuditSnippetCreate   AuditAction = "snippet_create"
+	AuditSnippetEdit     AuditAction = "snippet_edit"
+	AuditSnippetShare    AuditAction = "snippet_share"
+	AuditSnippetUnshare  AuditAction = "snippet_unshare"
+	AuditShareLinkCreate AuditAction = "share_link_create"
+	AuditShareLinkRevoke AuditAction = "share_link_revoke"
+	AuditSnippetExpire   AuditAction = "snippet_expire"
+	AuditSnippetHide     AuditAction = "snippet_hide"
+	AuditSnippetDelete   AuditAction = "snippet_delete"
+	AuditReportsDismiss  AuditAction = "reports_dismiss"
+	AuditUserDisable     AuditAction = "user_disable"
+	AuditUserEnable      AuditAction = "user_enable"
+	AuditUserRoleChange  AuditAction = "user_role_change"
+	AuditOrgInvite       AuditAction = "org_invite"
+	AuditOrgJoin         AuditAction = "org_join"
+)
+
+var auditActionLabels = map[AuditAction]string{
+	AuditSignup:          "Signed up",
+	AuditLogin:           "Logged in",
+	AuditLoginFailed:     "Failed login",
+	AuditLogout:          "Logged out",
+	AuditPasswordChange:  "Changed password",
+	AuditMFAEnable:       "Turned on two-factor authentication",
+	AuditMFADisable:      "Turned off two-factor authentication",
+	AuditSnippetCreate:   "Created snippet",
+	AuditSnippetEdit:     "Edited snippet",
+	AuditSnippetShare:    "Shared snippet",
+	AuditSnippetUnshare:  "Stopped sharing snippet",
+	AuditShareLinkCreate: "Created share link",
+	AuditShareLinkRevoke: "Revoked share link",
+	AuditSnippetExpire:   "Expired snippet",
+	AuditSnippetHide:     "Hid snippet",
+	AuditSnippetDelete:   "Deleted snippet",
+	AuditReportsDismiss:  "Dismissed reports",
+	AuditUserDisable:     "Disabled account",
+	AuditUserEnable:      "Enabled account",
+	AuditUserRoleChange:  "Changed role",
+	AuditOrgInvite:       "Invited to organization",
+	AuditOrgJoin:         "Joined organization",
+}
+
+// Every action, in the order that they're listed when filtering the audit log.
+var AuditActions = []AuditAction{
+	AuditSignup, AuditLogin, AuditLoginFailed, AuditLogout, AuditPasswordChange,
+	AuditMFAEnable, AuditMFADisable,
+	AuditSnippetCreate, AuditSnippetEdit, AuditSnippetShare, AuditSnippetUnshare,
+	AuditShareLinkCreate, AuditShareLinkRevoke,
+	AuditSnippetExpire, AuditSnippetHide, AuditSnippetDelete,
+	AuditReportsDismiss, AuditUserDisable, AuditUserEnable, AuditUserRoleChange,
+	AuditOrgInvite, AuditOrgJoin,
+}
+
+// Returns a human-readable description of the action.
+func (a AuditAction) Label() string {
+	if label, ok := auditActionLabels[a]; ok {
+		return label
+	}
+	return string(a)
+}
+
+// Reports whether a is one of the known actions.
+func (a AuditAction) Valid() bool {
+	_, ok := auditActionLabels[a]
+	return ok
+}
+
+// The kinds of thing that an audit log entry can be about.
+const (
+	AuditTargetUser    = "user"
+	AuditTargetSnippet = "snippet"
+	AuditTargetOrg     = "org"
+)
+
+// A record of something security-relevant which happened. Entries are never changed or
+// removed once they have been written, and they outlive the users they mention.
+type AuditEntry struct {
+	ID      int
+	Created time.Time
+
+	// The user who did it, or 0 if nobody was logged in.
+	ActorID   int
+	IP        string
+	UserAgent string
+
+	Action AuditAction
+
+	// What it was done to, e.g. AuditTargetSnippet and the snippet's ID. TargetType is empty
+	// if the action doesn't have a target.
+	TargetType string
+	TargetID   int
+
+	// Anything else worth knowing about the event. It's stored as a JSON object.
+	Details map[string]string
+}
+
+// Narrows down the entries returned by AuditLogger.List. The zero value matches everything.
+type AuditFilter struct {
+	// Only entries where this user is the actor or the target.
+	UserID int
+
+	// Only entries with this action.
+	Action AuditAction
+
+	// The maximum number of entries to return. If zero, there's no limit.
+	Limit int
+}
+
+// An append-only log of security-relevant events.
+type AuditLogger interface {
+	Log(ctx context.Context, entry AuditEntry) error
+	List(ctx context.Context, filter AuditFilter) ([]AuditEntry, error)
+}
+
+type AuditLogModel struct {
+	DbPool *pgxpool.Pool
+
+	// The deadline applied to each query. If zero, DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Appends an entry to the log. The ID and Created fields of entry are ignored.
+func (m *AuditLogModel) Log(ctx context.Context, entry AuditEntry) error {
+	stmt := `INSERT INTO audit_log (created_at, actor_id, ip, user_agent, action, target_type, target_id, details)
+	VALUES(NOW(), NULLIF($1, 0), $2, $3, $4, NULLIF($5, ''), NULLIF($6, 0), $7)`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	details := entry.Details
+	if details == nil {
+		details = map[string]string{}
+	}
+
+	_, err := m.DbPool.Exec(ctx, stmt, entry.ActorID, entry.IP, entry.UserAgent, entry.Action, entry.TargetType, entry.TargetID, details)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
+
+// Returns the entries which match the filter, newest first.
+func (m *AuditLogModel) List(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	stmt := `SELECT id, created_at, COALESCE(actor_id, 0), ip, user_agent, action, COALESCE(target_type, ''),
+		COALESCE(target_id, 0), details
+	FROM audit_log
+	WHERE ($1 = 0 OR actor_id = $1 OR (target_type = 'user' AND target_id = $1))
+	AND ($2 = '' OR action = $2)
+	ORDER BY id DESC
+	LIMIT NULLIF($3, 0)`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DbPool.Query(ctx, stmt, filter.UserID, string(filter.Action), filter.Limit)
+	if err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var entries []AuditEntry
+
+	for rows.Next() {
+		var e AuditEntry
+		err = rows.Scan(&e.ID, &e.Created, &e.ActorID, &e.IP, &e.UserAgent, &e.Action, &e.TargetType, &e.TargetID, &e.Details)
+		if err != nil {
+			return nil, TranslateContextError(ctx, err)
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	return entries, nil
+}
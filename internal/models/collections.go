@@ -0,0 +1,280 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// A named, ordered list of snippets which a user has put together. Public collections can
+// be seen by anyone, and private ones only by the user who owns them.
+type Collection struct {
+	ID         int
+	UserID     int
+	Name       string
+	Visibility Visibility
+	Created    time.Time
+}
+
+// Reports whether v is a visibility that a collection can have. Collections belong to a
+// single user, so they can't be limited to an organization's members.
+func ValidCollectionVisibility(v Visibility) bool {
+	return v == VisibilityPublic || v == VisibilityPrivate
+}
+
+// Returns the snippet IDs with the one at index i moved delta places (towards the start if
+// delta is negative). The move stops at either end of the list.
+func MoveSnippetID(ids []int, i, delta int) []int {
+	id := ids[i]
+	ids = slices.Delete(ids, i, i+1)
+
+	j := min(max(i+delta, 0), len(ids))
+
+	return slices.Insert(ids, j, id)
+}
+
+type CollectionModelInterface interface {
+	Insert(ctx context.Context, userID int, name string, visibility Visibility) (int, error)
+	Get(ctx context.Context, id int) (Collection, error)
+	Update(ctx context.Context, id int, name string, visibility Visibility) error
+	ListForUser(ctx context.Context, userID int) ([]Collection, error)
+	PublicForSnippet(ctx context.Context, snippetID int) ([]Collection, error)
+	SnippetIDs(ctx context.Context, id int) ([]int, error)
+	AddSnippet(ctx context.Context, id, snippetID int) error
+	RemoveSnippet(ctx context.Context, id, snippetID int) error
+	MoveSnippet(ctx context.Context, id, snippetID, delta int) error
+}
+
+type CollectionModel struct {
+	DbPool *pgxpool.Pool
+
+	// The deadline applied to each query. If zero, DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Creates an empty collection and returns its ID.
+func (m *CollectionModel) Insert(ctx context.Context, userID int, name string, visibility Visibility) (int, error) {
+	var id int
+
+	stmt := `INSERT INTO collections (user_id, name, visibility, created_at)
+	VALUES($1, $2, $3, NOW()) RETURNING id`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, stmt, userID, name, visibility).Scan(&id)
+	if err != nil {
+		return 0, TranslateContextError(ctx, err)
+	}
+
+	return id, nil
+}
+
+func (m *CollectionModel) Get(ctx context.Context, id int) (Collection, error) {
+	var c Collection
+
+	stmt := "SELECT id, user_id, name, visibility, created_at FROM collections WHERE id = $1"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, stmt, id).Scan(&c.ID, &c.UserID, &c.Name, &c.Visibility, &c.Created)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Collection{}, ErrNoRecord
+		}
+		return Collection{}, TranslateContextError(ctx, err)
+	}
+
+	return c, nil
+}
+
+// Renames the collection and changes who can see it.
+func (m *CollectionModel) Update(ctx context.Context, id int, name string, visibility Visibility) error {
+	stmt := "UPDATE collections SET name = $1, visibility = $2 WHERE id = $3"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, name, visibility, id)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Returns the user's collections, in name order.
+func (m *CollectionModel) ListForUser(ctx context.Context, userID int) ([]Collection, error) {
+	stmt := `SELECT id, user_id, name, visibility, created_at FROM collections
+	WHERE user_id = $1
+	ORDER BY name, id`
+
+	return m.list(ctx, stmt, userID)
+}
+
+// Returns the public collections which include the snippet, in name order.
+func (m *CollectionModel) PublicForSnippet(ctx context.Context, snippetID int) ([]Collection, error) {
+	stmt := `SELECT c.id, c.user_id, c.name, c.visibility, c.created_at FROM collections c
+	JOIN collection_snippets cs ON cs.collection_id = c.id
+	WHERE cs.snippet_id = $1 AND c.visibility = 'public'
+	ORDER BY c.name, c.id`
+
+	return m.list(ctx, stmt, snippetID)
+}
+
+func (m *CollectionModel) list(ctx context.Context, stmt string, args ...any) ([]Collection, error) {
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DbPool.Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var collections []Collection
+
+	for rows.Next() {
+		var c Collection
+		err = rows.Scan(&c.ID, &c.UserID, &c.Name, &c.Visibility, &c.Created)
+		if err != nil {
+			return nil, TranslateContextError(ctx, err)
+		}
+
+		collections = append(collections, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	return collections, nil
+}
+
+// Returns the IDs of the snippets in the collection, in order. Snippets are removed from
+// collections when they're deleted, but expired and hidden snippets are still included.
+func (m *CollectionModel) SnippetIDs(ctx context.Context, id int) ([]int, error) {
+	stmt := `SELECT snippet_id FROM collection_snippets
+	WHERE collection_id = $1
+	ORDER BY position, snippet_id`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DbPool.Query(ctx, stmt, id)
+	if err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	return ids, nil
+}
+
+// Adds the snippet to the end of the collection. Returns ErrDuplicateSnippet if it's already
+// in the collection.
+func (m *CollectionModel) AddSnippet(ctx context.Context, id, snippetID int) error {
+	stmt := `INSERT INTO collection_snippets (collection_id, snippet_id, position)
+	SELECT $1, $2, COALESCE(MAX(position), 0) + 1 FROM collection_snippets WHERE collection_id = $1
+	ON CONFLICT (collection_id, snippet_id) DO NOTHING`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, id, snippetID)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrDuplicateSnippet
+	}
+
+	return nil
+}
+
+// Removes the snippet from the collection. Returns ErrNoRecord if it isn't in it.
+func (m *CollectionModel) RemoveSnippet(ctx context.Context, id, snippetID int) error {
+	stmt := "DELETE FROM collection_snippets WHERE collection_id = $1 AND snippet_id = $2"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, id, snippetID)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Moves the snippet delta places through the collection, towards the start if delta is
+// negative, stopping at either end. Returns ErrNoRecord if the snippet isn't in it.
+func (m *CollectionModel) MoveSnippet(ctx context.Context, id, snippetID, delta int) error {
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DbPool.Begin(ctx)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the collection, so that concurrent moves are applied one after the other.
+	_, err = tx.Exec(ctx, "SELECT id FROM collections WHERE id = $1 FOR UPDATE", id)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	stmt := `SELECT snippet_id FROM collection_snippets
+	WHERE collection_id = $1
+	ORDER BY position, snippet_id`
+
+	rows, err := tx.Query(ctx, stmt, id)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	i := slices.Index(ids, snippetID)
+	if i == -1 {
+		return ErrNoRecord
+	}
+
+	stmt = "UPDATE collection_snippets SET position = $1 WHERE collection_id = $2 AND snippet_id = $3"
+
+	for position, snippetID := range MoveSnippetID(ids, i, delta) {
+		_, err = tx.Exec(ctx, stmt, position+1, id, snippetID)
+		if err != nil {
+			return TranslateContextError(ctx, err)
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
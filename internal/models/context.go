@@ -0,0 +1,38 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// The deadline applied to each query when a model's QueryTimeout field isn't set. This is
+// deliberately well below the server's WriteTimeout, so that a slow database results in an
+// error page rather than the connection being dropped mid-response.
+const DefaultQueryTimeout = 3 * time.Second
+
+// Returns a copy of ctx which is cancelled after the given timeout (or DefaultQueryTimeout
+// if timeout is zero). The caller must call the returned cancel function once the query,
+// including any iteration over its rows, has finished. This (and TranslateContextError) are
+// exported so that the storage backends in the sqlite and memory packages can share them.
+func WithQueryTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = DefaultQueryTimeout
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Translates errors caused by the query context ending into ErrQueryTimeout (the deadline
+// passed) or ErrQueryCanceled (the caller gave up, e.g. because the client disconnected).
+// Any other error is returned unchanged.
+func TranslateContextError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return ErrQueryTimeout
+	case errors.Is(err, context.Canceled), errors.Is(ctx.Err(), context.Canceled):
+		return ErrQueryCanceled
+	default:
+		return err
+	}
+}
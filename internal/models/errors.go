@@ -14,4 +14,31 @@ var (
 	ErrInvalidCredentials = errors.New("models: invalid credentials")
 
 	ErrDuplicateEmail = errors.New("models: duplicate email")
+
+	// Returned when someone reports a snippet which they have already reported.
+	ErrDuplicateReport = errors.New("models: duplicate report")
+
+	// Returned when someone accepts an invitation to an organization which they already
+	// belong to.
+	ErrDuplicateMember = errors.New("models: duplicate organization member")
+
+	// Returned when a snippet is added to a collection which already includes it.
+	ErrDuplicateSnippet = errors.New("models: snippet already in collection")
+
+	// Returned when someone stars a snippet which they have already starred.
+	ErrDuplicateStar = errors.New("models: duplicate star")
+
+	// Returned when a user whose account has been disabled tries to log in with the right
+	// password.
+	ErrAccountDisabled = errors.New("models: account disabled")
+
+	// Returned when asked to give a user a role which doesn't exist.
+	ErrInvalidRole = errors.New("models: invalid role")
+
+	// Returned when a query doesn't complete before its deadline.
+	ErrQueryTimeout = errors.New("models: query timed out")
+
+	// Returned when a query is abandoned because its context was cancelled, which normally
+	// means that the client went away before we could respond.
+	ErrQueryCanceled = errors.New("models: query canceled")
 )
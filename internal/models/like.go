@@ -0,0 +1,13 @@
+package models
+
+import "strings"
+
+// Escapes the LIKE wildcards (and the escape character itself) in search queries.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Returns a LIKE pattern which matches any string containing s. Wildcards in s are escaped
+// with a backslash, which is the default escape character in Postgres. SQLite has no default,
+// so its queries need an explicit ESCAPE '\' clause.
+func ContainsPattern(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
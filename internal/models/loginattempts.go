@@ -0,0 +1,152 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The default length of the sliding window over which failed login attempts are counted.
+const DefaultLoginAttemptWindow = 15 * time.Minute
+
+// Records failed login attempts against a key (such as an email address or a client IP), so
+// that the application can throttle guessing. Attempts are counted over a sliding window:
+// each failure is remembered for the length of the window and then forgotten.
+//
+// An attempt should be recorded as a failure before the credentials are checked, so that
+// concurrent attempts can't all get past the throttle before any of them is counted; it can
+// be taken back with Forget (or Reset) if it turns out to succeed.
+type LoginAttemptModelInterface interface {
+	RecordFailure(ctx context.Context, key string) (int, time.Time, error)
+	Failures(ctx context.Context, key string) (int, time.Time, error)
+	Forget(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
+
+type LoginAttemptModel struct {
+	DbPool *pgxpool.Pool
+
+	// The deadline applied to each query. If zero, DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+
+	// How long each failure is counted for. If zero, DefaultLoginAttemptWindow is used.
+	Window time.Duration
+}
+
+func (m *LoginAttemptModel) window() time.Duration {
+	if m.Window == 0 {
+		return DefaultLoginAttemptWindow
+	}
+	return m.Window
+}
+
+// Records a failed attempt for the key. Returns the number of failures (including this one)
+// within the window, along with the time of the one before it (which is the zero time if
+// there wasn't one). Concurrent calls for the same key are serialized, so each of them sees
+// a different count.
+func (m *LoginAttemptModel) RecordFailure(ctx context.Context, key string) (int, time.Time, error) {
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DbPool.Begin(ctx)
+	if err != nil {
+		return 0, time.Time{}, TranslateContextError(ctx, err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Hold a lock on the key until the transaction ends, so that concurrent attempts for it
+	// can't count the same failures.
+	_, err = tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", key)
+	if err != nil {
+		return 0, time.Time{}, TranslateContextError(ctx, err)
+	}
+
+	cutoff := time.Now().Add(-m.window())
+
+	// Clear out failures which have dropped out of the window (for every key, so that keys
+	// which are never seen again don't hang around forever) before recording the new one.
+	_, err = tx.Exec(ctx, "DELETE FROM login_failures WHERE attempted_at <= $1", cutoff)
+	if err != nil {
+		return 0, time.Time{}, TranslateContextError(ctx, err)
+	}
+
+	var count int
+	var last *time.Time
+
+	stmt := "SELECT COUNT(*), MAX(attempted_at) FROM login_failures WHERE key = $1 AND attempted_at > $2"
+
+	err = tx.QueryRow(ctx, stmt, key, cutoff).Scan(&count, &last)
+	if err != nil {
+		return 0, time.Time{}, TranslateContextError(ctx, err)
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO login_failures (key, attempted_at) VALUES($1, clock_timestamp())", key)
+	if err != nil {
+		return 0, time.Time{}, TranslateContextError(ctx, err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, time.Time{}, TranslateContextError(ctx, err)
+	}
+
+	if last == nil {
+		return count + 1, time.Time{}, nil
+	}
+
+	return count + 1, *last, nil
+}
+
+// Returns the number of failures for the key within the window, along with the time of the
+// most recent one (which is the zero time if there haven't been any).
+func (m *LoginAttemptModel) Failures(ctx context.Context, key string) (int, time.Time, error) {
+	var count int
+	var last *time.Time
+
+	stmt := "SELECT COUNT(*), MAX(attempted_at) FROM login_failures WHERE key = $1 AND attempted_at > $2"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, stmt, key, time.Now().Add(-m.window())).Scan(&count, &last)
+	if err != nil {
+		return 0, time.Time{}, TranslateContextError(ctx, err)
+	}
+
+	if last == nil {
+		return 0, time.Time{}, nil
+	}
+
+	return count, *last, nil
+}
+
+// Forgets the most recent failure recorded for the key, if there is one.
+func (m *LoginAttemptModel) Forget(ctx context.Context, key string) error {
+	stmt := `DELETE FROM login_failures WHERE ctid = (
+		SELECT ctid FROM login_failures WHERE key = $1 ORDER BY attempted_at DESC LIMIT 1
+	)`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	_, err := m.DbPool.Exec(ctx, stmt, key)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
+
+// Forgets all of the failures recorded for the key.
+func (m *LoginAttemptModel) Reset(ctx context.Context, key string) error {
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	_, err := m.DbPool.Exec(ctx, "DELETE FROM login_failures WHERE key = $1", key)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type AuditLogModel struct {
+	mu      sync.RWMutex
+	entries []models.AuditEntry
+}
+
+// Appends an entry to the log. The ID and Created fields of entry are ignored.
+func (m *AuditLogModel) Log(ctx context.Context, entry models.AuditEntry) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry.ID = len(m.entries) + 1
+	entry.Created = time.Now().UTC()
+
+	// Take a copy, so that the caller can't change the entry after it has been logged.
+	entry.Details = maps.Clone(entry.Details)
+	if entry.Details == nil {
+		entry.Details = map[string]string{}
+	}
+
+	m.entries = append(m.entries, entry)
+
+	return nil
+}
+
+// Returns the entries which match the filter, newest first.
+func (m *AuditLogModel) List(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var entries []models.AuditEntry
+
+	for i := len(m.entries) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+
+		e := m.entries[i]
+
+		if filter.UserID != 0 && e.ActorID != filter.UserID && (e.TargetType != models.AuditTargetUser || e.TargetID != filter.UserID) {
+			continue
+		}
+
+		if filter.Action != "" && e.Action != filter.Action {
+			continue
+		}
+
+		e.Details = maps.Clone(e.Details)
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,184 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type CollectionModel struct {
+	mu sync.RWMutex
+
+	// Collections are stored in ID order, so each one is at index ID-1.
+	collections []models.Collection
+	snippets    map[int][]int // the IDs of each collection's snippets, in order
+}
+
+// Creates an empty collection and returns its ID.
+func (m *CollectionModel) Insert(ctx context.Context, userID int, name string, visibility models.Visibility) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := len(m.collections) + 1
+
+	m.collections = append(m.collections, models.Collection{
+		ID:         id,
+		UserID:     userID,
+		Name:       name,
+		Visibility: visibility,
+		Created:    time.Now().UTC(),
+	})
+
+	return id, nil
+}
+
+func (m *CollectionModel) Get(ctx context.Context, id int) (models.Collection, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Collection{}, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if id < 1 || id > len(m.collections) {
+		return models.Collection{}, models.ErrNoRecord
+	}
+
+	return m.collections[id-1], nil
+}
+
+// Renames the collection and changes who can see it.
+func (m *CollectionModel) Update(ctx context.Context, id int, name string, visibility models.Visibility) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > len(m.collections) {
+		return models.ErrNoRecord
+	}
+
+	m.collections[id-1].Name = name
+	m.collections[id-1].Visibility = visibility
+
+	return nil
+}
+
+// Returns the user's collections, in name order.
+func (m *CollectionModel) ListForUser(ctx context.Context, userID int) ([]models.Collection, error) {
+	return m.list(ctx, func(c models.Collection) bool { return c.UserID == userID })
+}
+
+// Returns the public collections which include the snippet, in name order.
+func (m *CollectionModel) PublicForSnippet(ctx context.Context, snippetID int) ([]models.Collection, error) {
+	return m.list(ctx, func(c models.Collection) bool {
+		return c.Visibility == models.VisibilityPublic && slices.Contains(m.snippets[c.ID], snippetID)
+	})
+}
+
+func (m *CollectionModel) list(ctx context.Context, match func(models.Collection) bool) ([]models.Collection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var collections []models.Collection
+	for _, c := range m.collections {
+		if match(c) {
+			collections = append(collections, c)
+		}
+	}
+
+	slices.SortFunc(collections, func(a, b models.Collection) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), cmp.Compare(a.ID, b.ID))
+	})
+
+	return collections, nil
+}
+
+// Returns the IDs of the snippets in the collection, in order.
+func (m *CollectionModel) SnippetIDs(ctx context.Context, id int) ([]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Clone(m.snippets[id]), nil
+}
+
+// Adds the snippet to the end of the collection. Returns ErrDuplicateSnippet if it's already
+// in the collection.
+func (m *CollectionModel) AddSnippet(ctx context.Context, id, snippetID int) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if slices.Contains(m.snippets[id], snippetID) {
+		return models.ErrDuplicateSnippet
+	}
+
+	if m.snippets == nil {
+		m.snippets = make(map[int][]int)
+	}
+
+	m.snippets[id] = append(m.snippets[id], snippetID)
+
+	return nil
+}
+
+// Removes the snippet from the collection. Returns ErrNoRecord if it isn't in it.
+func (m *CollectionModel) RemoveSnippet(ctx context.Context, id, snippetID int) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.Index(m.snippets[id], snippetID)
+	if i == -1 {
+		return models.ErrNoRecord
+	}
+
+	m.snippets[id] = slices.Delete(m.snippets[id], i, i+1)
+
+	return nil
+}
+
+// Moves the snippet delta places through the collection, towards the start if delta is
+// negative, stopping at either end. Returns ErrNoRecord if the snippet isn't in it.
+func (m *CollectionModel) MoveSnippet(ctx context.Context, id, snippetID, delta int) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.Index(m.snippets[id], snippetID)
+	if i == -1 {
+		return models.ErrNoRecord
+	}
+
+	m.snippets[id] = models.MoveSnippetID(m.snippets[id], i, delta)
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type LoginAttemptModel struct {
+	// How long each failure is counted for. If zero, models.DefaultLoginAttemptWindow is used.
+	Window time.Duration
+
+	mu       sync.Mutex
+	failures map[string][]time.Time // oldest first
+}
+
+func (m *LoginAttemptModel) window() time.Duration {
+	if m.Window == 0 {
+		return models.DefaultLoginAttemptWindow
+	}
+	return m.Window
+}
+
+// Records a failed attempt for the key. Returns the number of failures (including this one)
+// within the window, along with the time of the one before it (which is the zero time if
+// there wasn't one).
+func (m *LoginAttemptModel) RecordFailure(ctx context.Context, key string) (int, time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, time.Time{}, models.TranslateContextError(ctx, err)
+	}
+
+	now := time.Now()
+	cutoff := now.Add(-m.window())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.failures == nil {
+		m.failures = make(map[string][]time.Time)
+	}
+
+	// Forget about keys whose failures have all dropped out of the window, so that the map
+	// doesn't grow without limit.
+	for k, times := range m.failures {
+		if !times[len(times)-1].After(cutoff) {
+			delete(m.failures, k)
+		}
+	}
+
+	var last time.Time
+
+	times := prune(m.failures[key], cutoff)
+	if len(times) > 0 {
+		last = times[len(times)-1]
+	}
+
+	m.failures[key] = append(times, now)
+
+	return len(m.failures[key]), last, nil
+}
+
+// Returns the number of failures for the key within the window, along with the time of the
+// most recent one (which is the zero time if there haven't been any).
+func (m *LoginAttemptModel) Failures(ctx context.Context, key string) (int, time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, time.Time{}, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	times := prune(m.failures[key], time.Now().Add(-m.window()))
+	if len(times) == 0 {
+		return 0, time.Time{}, nil
+	}
+
+	return len(times), times[len(times)-1], nil
+}
+
+// Forgets the most recent failure recorded for the key, if there is one.
+func (m *LoginAttemptModel) Forget(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if times := m.failures[key]; len(times) > 1 {
+		m.failures[key] = times[:len(times)-1]
+	} else {
+		delete(m.failures, key)
+	}
+
+	return nil
+}
+
+// Forgets all of the failures recorded for the key.
+func (m *LoginAttemptModel) Reset(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.failures, key)
+
+	return nil
+}
+
+// Returns the times which are after the cutoff. As the times are in order, these are always
+// at the end of the slice.
+func prune(times []time.Time, cutoff time.Time) []time.Time {
+	for i, t := range times {
+		if t.After(cutoff) {
+			return times[i:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/assert"
+	"snippetbox.prajjmon.net/internal/models/modelstest"
+	"snippetbox.prajjmon.net/internal/passhash"
+)
+
+func TestConformance(t *testing.T) {
+	modelstest.Run(t, func(t *testing.T) *modelstest.Backend {
+		snippets := &SnippetModel{}
+		users := &UserModel{}
+
+		return &modelstest.Backend{
+			Snippets:      snippets,
+			Users:         users,
+			Tokens:        &TokenModel{},
+			MFA:           &MFAModel{},
+			Reports:       &ReportModel{},
+			Orgs:          &OrgModel{},
+			Shares:        &ShareModel{},
+			Links:         &ShareLinkModel{},
+			Collections:   &CollectionModel{},
+			Stars:         &StarModel{},
+			AuditLog:      &AuditLogModel{},
+			LoginAttempts: &LoginAttemptModel{},
+			UserSessions:  &UserSessionModel{},
+			ExpireSnippet: func(t *testing.T, id int) {
+				snippets.SetExpires(id, time.Now().Add(-time.Second))
+			},
+			SetPasswordParams: func(p passhash.Params) {
+				users.PasswordParams = p
+			},
+		}
+	})
+}
+
+func TestLoginAttemptWindow(t *testing.T) {
+	ctx := context.Background()
+	m := &LoginAttemptModel{Window: 50 * time.Millisecond}
+
+	_, _, err := m.RecordFailure(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	// The first failure has dropped out of the window, so isn't counted.
+	count, _, err := m.RecordFailure(ctx, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, count, 1)
+
+	count, _, err = m.Failures(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, count, 0)
+
+	// And recording the second one cleared the expired key out of the map.
+	assert.Equal(t, len(m.failures), 1)
+}
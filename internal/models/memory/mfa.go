@@ -0,0 +1,134 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type mfaSettings struct {
+	secret        string
+	lastStep      int64
+	recoveryCodes map[string]bool // keyed by the code hash
+}
+
+type MFAModel struct {
+	mu    sync.Mutex
+	users map[int]*mfaSettings
+}
+
+// Turns on two-factor authentication for the user, replacing any secret and recovery codes
+// which they had before.
+func (m *MFAModel) Enable(ctx context.Context, userID int, secret string, recoveryCodes []string) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	settings := &mfaSettings{secret: secret, recoveryCodes: make(map[string]bool)}
+	for _, code := range recoveryCodes {
+		settings.recoveryCodes[string(models.HashRecoveryCode(code))] = true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users == nil {
+		m.users = make(map[int]*mfaSettings)
+	}
+
+	m.users[userID] = settings
+
+	return nil
+}
+
+// Turns off two-factor authentication for the user.
+func (m *MFAModel) Disable(ctx context.Context, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.users, userID)
+
+	return nil
+}
+
+// Returns the user's TOTP secret, or ErrNoRecord if they haven't enabled two-factor
+// authentication.
+func (m *MFAModel) GetSecret(ctx context.Context, userID int) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	settings, exists := m.users[userID]
+	if !exists {
+		return "", models.ErrNoRecord
+	}
+
+	return settings.secret, nil
+}
+
+// Records that the user has logged in with the code for the given time step, returning
+// ErrNoRecord if a code for this step (or a later one) has already been used.
+func (m *MFAModel) RecordStep(ctx context.Context, userID int, step int64) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	settings, exists := m.users[userID]
+	if !exists || settings.lastStep >= step {
+		return models.ErrNoRecord
+	}
+
+	settings.lastStep = step
+
+	return nil
+}
+
+// Uses up one of the user's recovery codes, returning ErrNoRecord if the code isn't valid
+// (or has already been used).
+func (m *MFAModel) UseRecoveryCode(ctx context.Context, userID int, code string) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	hash := string(models.HashRecoveryCode(code))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	settings, exists := m.users[userID]
+	if !exists || !settings.recoveryCodes[hash] {
+		return models.ErrNoRecord
+	}
+
+	delete(settings.recoveryCodes, hash)
+
+	return nil
+}
+
+// Returns the number of recovery codes which the user has left.
+func (m *MFAModel) RecoveryCodesRemaining(ctx context.Context, userID int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	settings, exists := m.users[userID]
+	if !exists {
+		return 0, nil
+	}
+
+	return len(settings.recoveryCodes), nil
+}
@@ -0,0 +1,199 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type orgMembership struct {
+	orgID, userID int
+}
+
+type OrgModel struct {
+	mu sync.RWMutex
+
+	// Organizations are stored in ID order, so each one is at index ID-1.
+	orgs        []models.Org
+	members     map[orgMembership]models.OrgMember
+	invitations map[string]models.OrgInvitation // keyed by the token hash
+}
+
+// Creates an organization with the given user as its only owner, and returns its ID.
+func (m *OrgModel) Insert(ctx context.Context, name string, ownerID int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	o := models.Org{ID: len(m.orgs) + 1, Name: name, Created: now}
+	m.orgs = append(m.orgs, o)
+
+	if m.members == nil {
+		m.members = make(map[orgMembership]models.OrgMember)
+	}
+
+	m.members[orgMembership{o.ID, ownerID}] = models.OrgMember{UserID: ownerID, Role: models.OrgRoleOwner, Joined: now}
+
+	return o.ID, nil
+}
+
+func (m *OrgModel) Get(ctx context.Context, id int) (models.Org, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Org{}, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if id < 1 || id > len(m.orgs) {
+		return models.Org{}, models.ErrNoRecord
+	}
+
+	return m.orgs[id-1], nil
+}
+
+// Returns the organizations which the user belongs to, in name order.
+func (m *OrgModel) ListForUser(ctx context.Context, userID int) ([]models.Org, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var orgs []models.Org
+
+	for key := range m.members {
+		if key.userID == userID {
+			orgs = append(orgs, m.orgs[key.orgID-1])
+		}
+	}
+
+	slices.SortFunc(orgs, func(a, b models.Org) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.ID, b.ID))
+	})
+
+	return orgs, nil
+}
+
+// Returns the user's role in the organization, or ErrNoRecord if they aren't a member.
+func (m *OrgModel) MemberRole(ctx context.Context, orgID, userID int) (models.OrgRole, error) {
+	if err := ctx.Err(); err != nil {
+		return "", models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	om, ok := m.members[orgMembership{orgID, userID}]
+	if !ok {
+		return "", models.ErrNoRecord
+	}
+
+	return om.Role, nil
+}
+
+// Returns the members of the organization, in the order that they joined.
+func (m *OrgModel) Members(ctx context.Context, orgID int) ([]models.OrgMember, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var members []models.OrgMember
+
+	for key, om := range m.members {
+		if key.orgID == orgID {
+			members = append(members, om)
+		}
+	}
+
+	slices.SortFunc(members, func(a, b models.OrgMember) int {
+		return cmp.Or(a.Joined.Compare(b.Joined), cmp.Compare(a.UserID, b.UserID))
+	})
+
+	return members, nil
+}
+
+// Creates an invitation to join the organization with the given role, which expires after
+// ttl, and returns its token.
+func (m *OrgModel) Invite(ctx context.Context, orgID int, email string, role models.OrgRole, ttl time.Duration) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", models.TranslateContextError(ctx, err)
+	}
+
+	plaintext, hash, err := models.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.invitations == nil {
+		m.invitations = make(map[string]models.OrgInvitation)
+	}
+
+	m.invitations[string(hash)] = models.OrgInvitation{OrgID: orgID, Email: email, Role: role, Expiry: time.Now().Add(ttl)}
+
+	return plaintext, nil
+}
+
+// Returns the unexpired invitation with the given token, without using it up.
+func (m *OrgModel) GetInvitation(ctx context.Context, token string) (models.OrgInvitation, error) {
+	if err := ctx.Err(); err != nil {
+		return models.OrgInvitation{}, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	inv, ok := m.invitations[string(models.HashToken(token))]
+	if !ok || !inv.Expiry.After(time.Now()) {
+		return models.OrgInvitation{}, models.ErrNoRecord
+	}
+
+	return inv, nil
+}
+
+// Uses up an invitation, adding the user to the organization, and returns the organization's
+// ID. ErrDuplicateMember is returned if the user already belongs to the organization, in
+// which case the invitation is left alone.
+func (m *OrgModel) AcceptInvitation(ctx context.Context, token string, userID int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	hash := string(models.HashToken(token))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	inv, ok := m.invitations[hash]
+	if !ok || !inv.Expiry.After(now) {
+		return 0, models.ErrNoRecord
+	}
+
+	key := orgMembership{inv.OrgID, userID}
+	if _, exists := m.members[key]; exists {
+		return 0, models.ErrDuplicateMember
+	}
+
+	delete(m.invitations, hash)
+	m.members[key] = models.OrgMember{UserID: userID, Role: inv.Role, Joined: now}
+
+	return inv.OrgID, nil
+}
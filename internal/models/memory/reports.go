@@ -0,0 +1,110 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type ReportModel struct {
+	mu      sync.RWMutex
+	reports []report
+}
+
+type report struct {
+	models.Report
+	resolved bool
+}
+
+// Records a report and returns its ID. ErrDuplicateReport is returned if the reporter (told
+// apart by their user ID, or IP address if they're anonymous) already has an open report for
+// the snippet.
+func (m *ReportModel) Insert(ctx context.Context, snippetID, reporterID int, reporterIP, reason string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.reports {
+		if r.resolved || r.SnippetID != snippetID {
+			continue
+		}
+
+		if r.ReporterID == reporterID && (reporterID != 0 || r.ReporterIP == reporterIP) {
+			return 0, models.ErrDuplicateReport
+		}
+	}
+
+	r := report{Report: models.Report{
+		ID:         len(m.reports) + 1,
+		SnippetID:  snippetID,
+		ReporterID: reporterID,
+		ReporterIP: reporterIP,
+		Reason:     reason,
+		Created:    time.Now().UTC(),
+	}}
+
+	m.reports = append(m.reports, r)
+
+	return r.ID, nil
+}
+
+// Returns the number of open reports for the snippet.
+func (m *ReportModel) CountOpen(ctx context.Context, snippetID int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int
+	for _, r := range m.reports {
+		if !r.resolved && r.SnippetID == snippetID {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Returns every open report, oldest first.
+func (m *ReportModel) ListOpen(ctx context.Context) ([]models.Report, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var reports []models.Report
+	for _, r := range m.reports {
+		if !r.resolved {
+			reports = append(reports, r.Report)
+		}
+	}
+
+	return reports, nil
+}
+
+// Closes all of the open reports for the snippet.
+func (m *ReportModel) Resolve(ctx context.Context, snippetID int) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.reports {
+		if m.reports[i].SnippetID == snippetID {
+			m.reports[i].resolved = true
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type shareLink struct {
+	models.ShareLink
+	hash []byte
+}
+
+type ShareLinkModel struct {
+	mu     sync.RWMutex
+	links  map[int]shareLink
+	nextID int
+}
+
+// Creates a link to the snippet which expires after ttl and can be used maxViews times (or
+// any number of times if maxViews is zero). Returns the link's token.
+func (m *ShareLinkModel) Insert(ctx context.Context, snippetID int, ttl time.Duration, maxViews int) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", models.TranslateContextError(ctx, err)
+	}
+
+	secret, hash, err := models.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.links == nil {
+		m.links = make(map[int]shareLink)
+	}
+
+	m.nextID++
+	now := time.Now().UTC()
+
+	m.links[m.nextID] = shareLink{
+		ShareLink: models.ShareLink{
+			ID:        m.nextID,
+			SnippetID: snippetID,
+			Created:   now,
+			Expiry:    now.Add(ttl),
+			MaxViews:  maxViews,
+		},
+		hash: hash,
+	}
+
+	return models.FormatShareLinkToken(m.nextID, secret), nil
+}
+
+// Returns all of the snippet's links, including spent ones, newest first.
+func (m *ShareLinkModel) ListForSnippet(ctx context.Context, snippetID int) ([]models.ShareLink, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var links []models.ShareLink
+	for _, l := range m.links {
+		if l.SnippetID == snippetID {
+			links = append(links, l.ShareLink)
+		}
+	}
+
+	slices.SortFunc(links, func(a, b models.ShareLink) int { return b.ID - a.ID })
+
+	return links, nil
+}
+
+// Checks the token without counting a view of the link, returning the ID of the snippet that
+// it's for. ErrNoRecord is returned in the same cases as Use.
+func (m *ShareLinkModel) Check(ctx context.Context, token string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	id, secret, ok := models.ParseShareLinkToken(token)
+	if !ok {
+		return 0, models.ErrNoRecord
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	l, ok := m.links[id]
+	if !ok || !models.CheckShareLinkSecret(secret, l.hash) || l.Spent() {
+		return 0, models.ErrNoRecord
+	}
+
+	return l.SnippetID, nil
+}
+
+// Checks the token and counts a view of the link, returning the ID of the snippet that it's
+// for. ErrNoRecord is returned if the token is invalid or the link has been revoked, has
+// expired or has no views left.
+func (m *ShareLinkModel) Use(ctx context.Context, token string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	id, secret, ok := models.ParseShareLinkToken(token)
+	if !ok {
+		return 0, models.ErrNoRecord
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.links[id]
+	if !ok || !models.CheckShareLinkSecret(secret, l.hash) || l.Spent() {
+		return 0, models.ErrNoRecord
+	}
+
+	l.Views++
+	m.links[id] = l
+
+	return l.SnippetID, nil
+}
+
+// Revokes one of the snippet's links. Returns ErrNoRecord if the snippet has no such link.
+func (m *ShareLinkModel) Delete(ctx context.Context, snippetID, id int) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.links[id]
+	if !ok || l.SnippetID != snippetID {
+		return models.ErrNoRecord
+	}
+
+	delete(m.links, id)
+
+	return nil
+}
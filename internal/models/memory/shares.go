@@ -0,0 +1,130 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type shareKey struct {
+	snippetID, userID int
+}
+
+type ShareModel struct {
+	mu     sync.RWMutex
+	shares map[shareKey]models.Share
+}
+
+// Shares the snippet with the user, or changes their permission if it has already been
+// shared with them.
+func (m *ShareModel) Set(ctx context.Context, snippetID, userID int, permission models.SharePermission) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.shares == nil {
+		m.shares = make(map[shareKey]models.Share)
+	}
+
+	key := shareKey{snippetID, userID}
+
+	s, ok := m.shares[key]
+	if !ok {
+		s = models.Share{SnippetID: snippetID, UserID: userID, Created: time.Now().UTC()}
+	}
+
+	s.Permission = permission
+	m.shares[key] = s
+
+	return nil
+}
+
+// Returns the user's permission for the snippet, or ErrNoRecord if it hasn't been shared
+// with them.
+func (m *ShareModel) Get(ctx context.Context, snippetID, userID int) (models.SharePermission, error) {
+	if err := ctx.Err(); err != nil {
+		return "", models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.shares[shareKey{snippetID, userID}]
+	if !ok {
+		return "", models.ErrNoRecord
+	}
+
+	return s.Permission, nil
+}
+
+// Returns everyone the snippet has been shared with, in the order it was shared with them.
+func (m *ShareModel) ListForSnippet(ctx context.Context, snippetID int) ([]models.Share, error) {
+	shares, err := m.list(ctx, func(s models.Share) bool { return s.SnippetID == snippetID })
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(shares, func(a, b models.Share) int {
+		return cmp.Or(a.Created.Compare(b.Created), cmp.Compare(a.UserID, b.UserID))
+	})
+
+	return shares, nil
+}
+
+// Returns the snippets which have been shared with the user, most recently shared first.
+func (m *ShareModel) ListForUser(ctx context.Context, userID int) ([]models.Share, error) {
+	shares, err := m.list(ctx, func(s models.Share) bool { return s.UserID == userID })
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(shares, func(a, b models.Share) int {
+		return cmp.Or(b.Created.Compare(a.Created), cmp.Compare(b.SnippetID, a.SnippetID))
+	})
+
+	return shares, nil
+}
+
+func (m *ShareModel) list(ctx context.Context, match func(models.Share) bool) ([]models.Share, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var shares []models.Share
+	for _, s := range m.shares {
+		if match(s) {
+			shares = append(shares, s)
+		}
+	}
+
+	return shares, nil
+}
+
+// Stops sharing the snippet with the user. Returns ErrNoRecord if it wasn't shared with them.
+func (m *ShareModel) Delete(ctx context.Context, snippetID, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := shareKey{snippetID, userID}
+	if _, ok := m.shares[key]; !ok {
+		return models.ErrNoRecord
+	}
+
+	delete(m.shares, key)
+
+	return nil
+}
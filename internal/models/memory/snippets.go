@@ -0,0 +1,270 @@
+// Package memory provides in-memory implementations of the model interfaces. Nothing is
+// persisted, so they are intended for local development and tests where running a real
+// database isn't practical. The zero value of each model is ready to use, and all of the
+// models are safe for concurrent use.
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type SnippetModel struct {
+	mu sync.RWMutex
+
+	// Snippets are stored in ID order. Deleted snippets leave a zero value behind, so that
+	// each snippet stays at index ID-1.
+	snippets []models.Snippet
+}
+
+// Insert a new snippet. IDs start at 1.
+func (m *SnippetModel) Insert(ctx context.Context, userID, orgID int, title, content string, visibility models.Visibility) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	s := models.Snippet{
+		ID:         len(m.snippets) + 1,
+		Title:      title,
+		Content:    content,
+		Created:    now,
+		Expires:    now.Add(7 * 24 * time.Hour),
+		UserID:     userID,
+		OrgID:      orgID,
+		Visibility: visibility,
+	}
+
+	m.snippets = append(m.snippets, s)
+
+	return s.ID, nil
+}
+
+// Returns the snippet with the given ID, whether or not it has expired. The caller must hold
+// the mutex.
+func (m *SnippetModel) find(id int) (*models.Snippet, bool) {
+	if id < 1 || id > len(m.snippets) || m.snippets[id-1].ID == 0 {
+		return nil, false
+	}
+
+	return &m.snippets[id-1], true
+}
+
+// Return a specific snippet based on its id, provided that it hasn't expired.
+func (m *SnippetModel) Get(ctx context.Context, id int) (models.Snippet, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Snippet{}, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.find(id)
+	if !ok || !s.Expires.After(time.Now()) {
+		return models.Snippet{}, models.ErrNoRecord
+	}
+
+	return *s, nil
+}
+
+// Changes the title, content and visibility of a live snippet. Returns ErrNoRecord if there
+// isn't a live snippet with the given ID.
+func (m *SnippetModel) Update(ctx context.Context, id int, title, content string, visibility models.Visibility) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.find(id)
+	if !ok || !s.Expires.After(time.Now()) {
+		return models.ErrNoRecord
+	}
+
+	s.Title = title
+	s.Content = content
+	s.Visibility = visibility
+
+	return nil
+}
+
+// Return the 10 most recently created public snippets which haven't expired or been hidden.
+func (m *SnippetModel) Latest(ctx context.Context) ([]models.Snippet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var snippets []models.Snippet
+	now := time.Now()
+
+	for i := len(m.snippets) - 1; i >= 0 && len(snippets) < 10; i-- {
+		s := m.snippets[i]
+		if s.ID != 0 && !s.Hidden && s.Visibility == models.VisibilityPublic && s.Expires.After(now) {
+			snippets = append(snippets, s)
+		}
+	}
+
+	return snippets, nil
+}
+
+// Returns the organization's live snippets, newest first, whatever their visibility. Hidden
+// snippets are left out.
+func (m *SnippetModel) ListForOrg(ctx context.Context, orgID int) ([]models.Snippet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var snippets []models.Snippet
+	now := time.Now()
+
+	for i := len(m.snippets) - 1; i >= 0; i-- {
+		s := m.snippets[i]
+		if s.ID != 0 && s.OrgID == orgID && !s.Hidden && s.Expires.After(now) {
+			snippets = append(snippets, s)
+		}
+	}
+
+	return snippets, nil
+}
+
+// Returns the number of live and expired snippets.
+func (m *SnippetModel) Counts(ctx context.Context) (models.SnippetCounts, error) {
+	if err := ctx.Err(); err != nil {
+		return models.SnippetCounts{}, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var c models.SnippetCounts
+	now := time.Now()
+
+	for _, s := range m.snippets {
+		switch {
+		case s.ID == 0:
+		case s.Expires.After(now):
+			c.Live++
+		default:
+			c.Expired++
+		}
+	}
+
+	return c, nil
+}
+
+// Returns the users who have created the most snippets, most prolific first, counting
+// expired snippets as well as live ones.
+func (m *SnippetModel) TopCreators(ctx context.Context, limit int) ([]models.SnippetCreator, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	counts := make(map[int]int)
+	for _, s := range m.snippets {
+		if s.ID != 0 {
+			counts[s.UserID]++
+		}
+	}
+	m.mu.RUnlock()
+
+	var creators []models.SnippetCreator
+	for userID, n := range counts {
+		creators = append(creators, models.SnippetCreator{UserID: userID, Snippets: n})
+	}
+
+	slices.SortFunc(creators, func(a, b models.SnippetCreator) int {
+		return cmp.Or(cmp.Compare(b.Snippets, a.Snippets), cmp.Compare(a.UserID, b.UserID))
+	})
+
+	return creators[:min(limit, len(creators))], nil
+}
+
+// Makes a live snippet expire straight away. Returns ErrNoRecord if there isn't a live
+// snippet with the given ID.
+func (m *SnippetModel) Expire(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	s, ok := m.find(id)
+	if !ok || !s.Expires.After(now) {
+		return models.ErrNoRecord
+	}
+
+	s.Expires = now
+
+	return nil
+}
+
+// Deletes a snippet, whether or not it has expired. Returns ErrNoRecord if there isn't one
+// with the given ID.
+func (m *SnippetModel) Delete(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.find(id)
+	if !ok {
+		return models.ErrNoRecord
+	}
+
+	*s = models.Snippet{}
+
+	return nil
+}
+
+// Hides a snippet pending review, or puts it back. Returns ErrNoRecord if there isn't a
+// snippet with the given ID.
+func (m *SnippetModel) SetHidden(ctx context.Context, id int, hidden bool) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.find(id)
+	if !ok {
+		return models.ErrNoRecord
+	}
+
+	s.Hidden = hidden
+
+	return nil
+}
+
+// Sets the expiry time of a snippet to the given time. This isn't part of the
+// SnippetModelInterface; it's used by the conformance tests to check expiry behaviour.
+func (m *SnippetModel) SetExpires(id int, expires time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.find(id); ok {
+		s.Expires = expires
+	}
+}
@@ -0,0 +1,141 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type StarModel struct {
+	mu    sync.RWMutex
+	stars []models.Star // in the order they were given
+}
+
+// Stars the snippet for the user. Returns ErrDuplicateStar if they've already starred it.
+func (m *StarModel) Insert(ctx context.Context, userID, snippetID int) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.index(userID, snippetID) != -1 {
+		return models.ErrDuplicateStar
+	}
+
+	m.stars = append(m.stars, models.Star{
+		UserID:    userID,
+		SnippetID: snippetID,
+		Created:   time.Now().UTC(),
+	})
+
+	return nil
+}
+
+// Removes the user's star from the snippet. Returns ErrNoRecord if they haven't starred it.
+func (m *StarModel) Delete(ctx context.Context, userID, snippetID int) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(userID, snippetID)
+	if i == -1 {
+		return models.ErrNoRecord
+	}
+
+	m.stars = slices.Delete(m.stars, i, i+1)
+
+	return nil
+}
+
+// Reports whether the user has starred the snippet.
+func (m *StarModel) Exists(ctx context.Context, userID, snippetID int) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.index(userID, snippetID) != -1, nil
+}
+
+func (m *StarModel) index(userID, snippetID int) int {
+	return slices.IndexFunc(m.stars, func(s models.Star) bool {
+		return s.UserID == userID && s.SnippetID == snippetID
+	})
+}
+
+// Returns the number of users who have starred the snippet.
+func (m *StarModel) Count(ctx context.Context, snippetID int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, s := range m.stars {
+		if s.SnippetID == snippetID {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Returns the user's stars, most recent first.
+func (m *StarModel) ListForUser(ctx context.Context, userID int) ([]models.Star, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var stars []models.Star
+	for _, s := range slices.Backward(m.stars) {
+		if s.UserID == userID {
+			stars = append(stars, s)
+		}
+	}
+
+	return stars, nil
+}
+
+// Returns the snippets which have been given the most stars since the given time, counting
+// only those stars. Ties are broken by snippet ID.
+func (m *StarModel) MostStarred(ctx context.Context, since time.Time, limit int) ([]models.SnippetStars, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	counts := make(map[int]int)
+	for _, s := range m.stars {
+		if !s.Created.Before(since) {
+			counts[s.SnippetID]++
+		}
+	}
+	m.mu.RUnlock()
+
+	var starred []models.SnippetStars
+	for snippetID, n := range counts {
+		starred = append(starred, models.SnippetStars{SnippetID: snippetID, Stars: n})
+	}
+
+	slices.SortFunc(starred, func(a, b models.SnippetStars) int {
+		return cmp.Or(cmp.Compare(b.Stars, a.Stars), cmp.Compare(a.SnippetID, b.SnippetID))
+	})
+
+	return starred[:min(limit, len(starred))], nil
+}
@@ -0,0 +1,93 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type token struct {
+	userID int
+	expiry time.Time
+	scope  string
+}
+
+type TokenModel struct {
+	mu     sync.Mutex
+	tokens map[string]token // keyed by the token hash
+}
+
+// Creates a new token for the given user which expires after ttl, and returns its plaintext.
+func (m *TokenModel) New(ctx context.Context, userID int, ttl time.Duration, scope string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", models.TranslateContextError(ctx, err)
+	}
+
+	plaintext, hash, err := models.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.tokens == nil {
+		m.tokens = make(map[string]token)
+	}
+
+	m.tokens[string(hash)] = token{userID: userID, expiry: time.Now().Add(ttl), scope: scope}
+
+	return plaintext, nil
+}
+
+// Returns the ID of the user that a valid (unexpired) token belongs to, without using it up.
+func (m *TokenModel) GetUserID(ctx context.Context, plaintext, scope string) (int, error) {
+	return m.lookup(ctx, plaintext, scope, false)
+}
+
+// Like GetUserID, but also deletes the token so that it can't be used again.
+func (m *TokenModel) Consume(ctx context.Context, plaintext, scope string) (int, error) {
+	return m.lookup(ctx, plaintext, scope, true)
+}
+
+func (m *TokenModel) lookup(ctx context.Context, plaintext, scope string, consume bool) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	hash := string(models.HashToken(plaintext))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, exists := m.tokens[hash]
+	if !exists || t.scope != scope || !t.expiry.After(time.Now()) {
+		return 0, models.ErrNoRecord
+	}
+
+	if consume {
+		delete(m.tokens, hash)
+	}
+
+	return t.userID, nil
+}
+
+// Deletes all of a user's tokens for the given scope.
+func (m *TokenModel) DeleteAllForUser(ctx context.Context, userID int, scope string) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hash, t := range m.tokens {
+		if t.userID == userID && t.scope == scope {
+			delete(m.tokens, hash)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,365 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+	"snippetbox.prajjmon.net/internal/passhash"
+)
+
+type UserModel struct {
+	// How new passwords are hashed. Existing hashes are upgraded to these parameters when
+	// their users next log in.
+	PasswordParams passhash.Params
+
+	mu      sync.RWMutex
+	users   []models.User
+	byEmail map[string]int
+}
+
+// Inserts a new user and returns their ID. IDs start at 1.
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	hashedPassword, err := passhash.Hash(password, m.PasswordParams)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.byEmail[email]; exists {
+		return 0, models.ErrDuplicateEmail
+	}
+
+	if m.byEmail == nil {
+		m.byEmail = make(map[string]int)
+	}
+
+	u := models.User{
+		Id:             len(m.users) + 1,
+		Name:           name,
+		Email:          email,
+		HashedPassword: []byte(hashedPassword),
+		Created:        time.Now().UTC(),
+		Role:           models.RoleUser,
+	}
+
+	m.users = append(m.users, u)
+	m.byEmail[email] = u.Id
+
+	return u.Id, nil
+}
+
+// Returns the ID of the user with the given email address and password. It returns
+// ErrInvalidCredentials if there's no such user, or ErrAccountDisabled if the password is
+// right but the account has been disabled.
+func (m *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	id, exists := m.byEmail[email]
+	var hashedPassword string
+	var disabled bool
+	if exists {
+		hashedPassword = string(m.users[id-1].HashedPassword)
+		disabled = m.users[id-1].Disabled
+	}
+	m.mu.RUnlock()
+
+	if !exists {
+		return 0, models.ErrInvalidCredentials
+	}
+
+	match, err := passhash.Verify(password, hashedPassword)
+	if err != nil {
+		return 0, err
+	} else if !match {
+		return 0, models.ErrInvalidCredentials
+	}
+
+	if disabled {
+		return 0, models.ErrAccountDisabled
+	}
+
+	// A password which is too long for the current algorithm keeps its old hash.
+	if passhash.NeedsRehash(hashedPassword, m.PasswordParams) && len(password) <= m.PasswordParams.MaxPasswordLength() {
+		newHash, err := passhash.Hash(password, m.PasswordParams)
+		if err != nil {
+			return 0, err
+		}
+
+		// Leave the hash alone if the password has been changed since we read it.
+		m.mu.Lock()
+		if string(m.users[id-1].HashedPassword) == hashedPassword {
+			m.users[id-1].HashedPassword = []byte(newHash)
+		}
+		m.mu.Unlock()
+	}
+
+	return id, nil
+}
+
+func (m *UserModel) Exists(ctx context.Context, id int) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return id >= 1 && id <= len(m.users), nil
+}
+
+// Returns the user with the given ID, or ErrNoRecord if there isn't one.
+func (m *UserModel) Get(ctx context.Context, id int) (models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return models.User{}, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if id < 1 || id > len(m.users) {
+		return models.User{}, models.ErrNoRecord
+	}
+
+	return m.users[id-1], nil
+}
+
+// Returns the user with the given email address, or ErrNoRecord if there isn't one.
+func (m *UserModel) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return models.User{}, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, exists := m.byEmail[email]
+	if !exists {
+		return models.User{}, models.ErrNoRecord
+	}
+
+	return m.users[id-1], nil
+}
+
+// Replaces the password for the given user, returning ErrNoRecord if the user doesn't exist.
+func (m *UserModel) UpdatePassword(ctx context.Context, id int, password string) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	hashedPassword, err := passhash.Hash(password, m.PasswordParams)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > len(m.users) {
+		return models.ErrNoRecord
+	}
+
+	m.users[id-1].HashedPassword = []byte(hashedPassword)
+
+	return nil
+}
+
+// Replaces the user's password, provided that currentPassword matches the one they have now.
+// It returns ErrInvalidCredentials if it doesn't, or ErrNoRecord if the user doesn't exist.
+func (m *UserModel) ChangePassword(ctx context.Context, id int, currentPassword, newPassword string) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	var hashedPassword string
+	exists := id >= 1 && id <= len(m.users)
+	if exists {
+		hashedPassword = string(m.users[id-1].HashedPassword)
+	}
+	m.mu.RUnlock()
+
+	if !exists {
+		return models.ErrNoRecord
+	}
+
+	match, err := passhash.Verify(currentPassword, hashedPassword)
+	if err != nil {
+		return err
+	} else if !match {
+		return models.ErrInvalidCredentials
+	}
+
+	return m.UpdatePassword(ctx, id, newPassword)
+}
+
+// Changes the user's display name.
+func (m *UserModel) UpdateName(ctx context.Context, id int, name string) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > len(m.users) {
+		return models.ErrNoRecord
+	}
+
+	m.users[id-1].Name = name
+
+	return nil
+}
+
+// Changes the user's email address and marks the account as unverified again. Returns
+// ErrDuplicateEmail if another account already uses the address.
+func (m *UserModel) UpdateEmail(ctx context.Context, id int, email string) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > len(m.users) {
+		return models.ErrNoRecord
+	}
+
+	if owner, exists := m.byEmail[email]; exists && owner != id {
+		return models.ErrDuplicateEmail
+	}
+
+	u := &m.users[id-1]
+	delete(m.byEmail, u.Email)
+	m.byEmail[email] = id
+
+	u.Email = email
+	u.Verified = false
+
+	return nil
+}
+
+// Marks the user's email address as verified.
+func (m *UserModel) SetVerified(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > len(m.users) {
+		return models.ErrNoRecord
+	}
+
+	m.users[id-1].Verified = true
+
+	return nil
+}
+
+// Changes the user's role, returning ErrInvalidRole if it isn't one of the known roles.
+func (m *UserModel) SetRole(ctx context.Context, id int, role models.Role) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	if !role.Valid() {
+		return models.ErrInvalidRole
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > len(m.users) {
+		return models.ErrNoRecord
+	}
+
+	m.users[id-1].Role = role
+
+	return nil
+}
+
+// Disables or re-enables the user's account.
+func (m *UserModel) SetDisabled(ctx context.Context, id int, disabled bool) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > len(m.users) {
+		return models.ErrNoRecord
+	}
+
+	m.users[id-1].Disabled = disabled
+
+	return nil
+}
+
+// Returns the total number of users.
+func (m *UserModel) Count(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.users), nil
+}
+
+// Returns the users who signed up most recently, newest first.
+func (m *UserModel) Latest(ctx context.Context, limit int) ([]models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// Users are stored in the order that they signed up.
+	users := slices.Clone(m.users[max(len(m.users)-limit, 0):])
+	slices.Reverse(users)
+
+	return users, nil
+}
+
+// Returns the users whose name or email address contains the query (ignoring case), in the
+// order that they signed up.
+func (m *UserModel) Search(ctx context.Context, query string, limit int) ([]models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	query = strings.ToLower(query)
+
+	var users []models.User
+
+	for _, u := range m.users {
+		if len(users) == limit {
+			break
+		}
+
+		if strings.Contains(strings.ToLower(u.Name), query) || strings.Contains(strings.ToLower(u.Email), query) {
+			users = append(users, u)
+		}
+	}
+
+	return users, nil
+}
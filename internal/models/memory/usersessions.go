@@ -0,0 +1,159 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type UserSessionModel struct {
+	mu       sync.Mutex
+	sessions map[string]models.UserSession
+}
+
+// Records a new session for the user which lasts until expires, and returns its ID.
+func (m *UserSessionModel) Insert(ctx context.Context, userID int, ip, userAgent string, expires time.Time) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", models.TranslateContextError(ctx, err)
+	}
+
+	id, err := models.GenerateSessionID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sessions == nil {
+		m.sessions = make(map[string]models.UserSession)
+	}
+
+	for sid, s := range m.sessions {
+		if s.UserID == userID && !s.Expires.After(now) {
+			delete(m.sessions, sid)
+		}
+	}
+
+	m.sessions[id] = models.UserSession{
+		ID:        id,
+		UserID:    userID,
+		Created:   now,
+		LastSeen:  now,
+		Expires:   expires,
+		IP:        ip,
+		UserAgent: userAgent,
+	}
+
+	return id, nil
+}
+
+// Returns the session with the given ID, or ErrNoRecord if it has been revoked or expired.
+func (m *UserSessionModel) Get(ctx context.Context, id string) (models.UserSession, error) {
+	if err := ctx.Err(); err != nil {
+		return models.UserSession{}, models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, exists := m.sessions[id]
+	if !exists || !s.Expires.After(time.Now()) {
+		return models.UserSession{}, models.ErrNoRecord
+	}
+
+	return s, nil
+}
+
+// Marks the session as having been used just now, from the given IP address and user agent.
+func (m *UserSessionModel) Touch(ctx context.Context, id, ip, userAgent string) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, exists := m.sessions[id]
+	if !exists {
+		return models.ErrNoRecord
+	}
+
+	s.LastSeen = time.Now()
+	s.IP = ip
+	s.UserAgent = userAgent
+	m.sessions[id] = s
+
+	return nil
+}
+
+// Returns the user's unexpired sessions, most recently used first.
+func (m *UserSessionModel) ListForUser(ctx context.Context, userID int) ([]models.UserSession, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sessions []models.UserSession
+
+	for _, s := range m.sessions {
+		if s.UserID == userID && s.Expires.After(now) {
+			sessions = append(sessions, s)
+		}
+	}
+
+	slices.SortFunc(sessions, func(a, b models.UserSession) int {
+		if c := b.LastSeen.Compare(a.LastSeen); c != 0 {
+			return c
+		}
+		return b.Created.Compare(a.Created)
+	})
+
+	return sessions, nil
+}
+
+// Revokes one of the user's sessions, returning ErrNoRecord if they don't have one with that ID.
+func (m *UserSessionModel) Delete(ctx context.Context, userID int, id string) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, exists := m.sessions[id]
+	if !exists || s.UserID != userID {
+		return models.ErrNoRecord
+	}
+
+	delete(m.sessions, id)
+
+	return nil
+}
+
+// Revokes all of the user's sessions apart from the one with ID exceptID.
+func (m *UserSessionModel) DeleteAllForUser(ctx context.Context, userID int, exceptID string) error {
+	if err := ctx.Err(); err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, s := range m.sessions {
+		if s.UserID == userID && id != exceptID {
+			delete(m.sessions, id)
+		}
+	}
+
+	return nil
+}
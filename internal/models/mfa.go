@@ -0,0 +1,215 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The number of recovery codes generated when a user enables two-factor authentication.
+const RecoveryCodeCount = 10
+
+// Stores each user's TOTP secret, along with the recovery codes they can use to log in if
+// they lose their authenticator. The secret has to be kept in a form we can read back (it's
+// the HMAC key), but like tokens, only a SHA-256 hash of each recovery code is stored.
+type MFAModelInterface interface {
+	Enable(ctx context.Context, userID int, secret string, recoveryCodes []string) error
+	Disable(ctx context.Context, userID int) error
+	GetSecret(ctx context.Context, userID int) (string, error)
+	RecordStep(ctx context.Context, userID int, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int, code string) error
+	RecoveryCodesRemaining(ctx context.Context, userID int) (int, error)
+}
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Generates n random recovery codes, formatted as two groups of four characters (e.g.
+// "k3pq-7xzm") to make them easier to copy down.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+
+	for i := range codes {
+		b := make([]byte, 5)
+
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:]
+	}
+
+	return codes, nil
+}
+
+// Returns the hash which is stored for a recovery code. Case, spaces and dashes are
+// ignored, as users often type the codes in slightly differently from how we showed them.
+func HashRecoveryCode(code string) []byte {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+
+	return HashToken(code)
+}
+
+type MFAModel struct {
+	DbPool *pgxpool.Pool
+
+	// The deadline applied to each query. If zero, DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Turns on two-factor authentication for the user, replacing any secret and recovery codes
+// which they had before.
+func (m *MFAModel) Enable(ctx context.Context, userID int, secret string, recoveryCodes []string) error {
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DbPool.Begin(ctx)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+	defer tx.Rollback(ctx)
+
+	stmt := `INSERT INTO totp_secrets (user_id, secret, last_step, created_at) VALUES($1, $2, 0, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_step = 0, created_at = NOW()`
+
+	_, err = tx.Exec(ctx, stmt, userID, secret)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	for _, code := range recoveryCodes {
+		_, err = tx.Exec(ctx, "INSERT INTO recovery_codes (user_id, hash) VALUES($1, $2)", userID, HashRecoveryCode(code))
+		if err != nil {
+			return TranslateContextError(ctx, err)
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
+
+// Turns off two-factor authentication for the user, deleting their secret and any unused
+// recovery codes.
+func (m *MFAModel) Disable(ctx context.Context, userID int) error {
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DbPool.Begin(ctx)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM totp_secrets WHERE user_id = $1", userID)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
+
+// Returns the user's TOTP secret, or ErrNoRecord if they haven't enabled two-factor
+// authentication.
+func (m *MFAModel) GetSecret(ctx context.Context, userID int) (string, error) {
+	var secret string
+
+	stmt := "SELECT secret FROM totp_secrets WHERE user_id = $1"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, stmt, userID).Scan(&secret)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrNoRecord
+		}
+		return "", TranslateContextError(ctx, err)
+	}
+
+	return secret, nil
+}
+
+// Records that the user has logged in with the code for the given time step. It returns
+// ErrNoRecord if a code for this step (or a later one) has already been used, so that a code
+// which has been seen by someone else can't be replayed while it is still valid.
+func (m *MFAModel) RecordStep(ctx context.Context, userID int, step int64) error {
+	stmt := "UPDATE totp_secrets SET last_step = $1 WHERE user_id = $2 AND last_step < $1"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, step, userID)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Uses up one of the user's recovery codes, returning ErrNoRecord if the code isn't valid
+// (or has already been used).
+func (m *MFAModel) UseRecoveryCode(ctx context.Context, userID int, code string) error {
+	stmt := "DELETE FROM recovery_codes WHERE user_id = $1 AND hash = $2"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, userID, HashRecoveryCode(code))
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Returns the number of recovery codes which the user has left.
+func (m *MFAModel) RecoveryCodesRemaining(ctx context.Context, userID int) (int, error) {
+	var count int
+
+	stmt := "SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, stmt, userID).Scan(&count)
+	if err != nil {
+		return 0, TranslateContextError(ctx, err)
+	}
+
+	return count, nil
+}
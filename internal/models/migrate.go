@@ -0,0 +1,125 @@
+package models
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The Postgres migrations. Each file is named after its version and what it does, such as
+// "0002_tokens.sql", and is applied once, in order of version. A migration mustn't be changed
+// once it has been released: any further change to the schema needs a new one.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// A versioned change to the database schema.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Reads the migrations from the migrations directory of fsys, in order of version. The
+// versions must run from 1 with no gaps, so that a missing file can't go unnoticed.
+func ReadMigrations(fsys fs.FS) ([]Migration, error) {
+	paths, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+
+	for _, p := range paths {
+		name := strings.TrimSuffix(path.Base(p), ".sql")
+
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("models: migration %q doesn't start with a version number", p)
+		}
+
+		sql, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, Migration{Version: version, Name: name, SQL: string(sql)})
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("models: expected migration version %d, but found %q", i+1, m.Name)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Brings the database schema up to date, by applying the migrations which haven't been
+// applied yet. The versions which have been applied are recorded in the schema_migrations
+// table. A database from before there were migrations is assumed to have the original
+// schema.
+//
+// All of the migrations are applied in a single transaction, so a failure leaves the schema
+// as it was. The transaction holds an advisory lock, so that instances of the application
+// which start at the same time don't both try to apply them.
+func Migrate(ctx context.Context, dbpool *pgxpool.Pool) error {
+	migrations, err := ReadMigrations(migrationFiles)
+	if err != nil {
+		return err
+	}
+
+	tx, err := dbpool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))")
+	if err != nil {
+		return err
+	}
+
+	stmt := `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL
+	)`
+
+	_, err = tx.Exec(ctx, stmt)
+	if err != nil {
+		return err
+	}
+
+	var current int
+
+	err = tx.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations[min(current, len(migrations)):] {
+		// Without any arguments, the whole file is sent in one go using the simple query
+		// protocol, which allows it to contain several statements.
+		_, err = tx.Exec(ctx, m.SQL)
+		if err != nil {
+			return fmt.Errorf("models: migration %s: %w", m.Name, err)
+		}
+
+		_, err = tx.Exec(ctx, "INSERT INTO schema_migrations (version, applied_at) VALUES($1, NOW())", m.Version)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,7 @@
+-- One-time tokens, such as the ones in password reset links.
+CREATE TABLE tokens (
+    hash BYTEA PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+    expiry TIMESTAMPTZ NOT NULL,
+    scope TEXT NOT NULL
+);
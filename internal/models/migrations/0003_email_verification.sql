@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN verified BOOLEAN NOT NULL DEFAULT false;
+
+-- Accounts from before email verification existed were never sent a verification email, so
+-- they're treated as verified rather than being locked out.
+UPDATE users SET verified = true;
@@ -0,0 +1,12 @@
+CREATE TABLE totp_secrets (
+    user_id INTEGER PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    last_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE recovery_codes (
+    user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+    hash BYTEA NOT NULL,
+    PRIMARY KEY (user_id, hash)
+);
@@ -0,0 +1,9 @@
+ALTER TABLE users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT false;
+
+-- Snippets record the user who created them. Snippets from before then can't be attributed to
+-- anyone, and they only ever lasted for a week, so they're removed rather than given an owner.
+ALTER TABLE snippets ADD COLUMN user_id INTEGER REFERENCES users ON DELETE CASCADE;
+DELETE FROM snippets WHERE user_id IS NULL;
+ALTER TABLE snippets ALTER COLUMN user_id SET NOT NULL;
+
+CREATE INDEX idx_snippets_user_id ON snippets(user_id);
@@ -0,0 +1,32 @@
+CREATE TABLE orgs (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE org_members (
+    org_id INTEGER NOT NULL REFERENCES orgs ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'member')),
+    joined_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX org_members_user_id_idx ON org_members (user_id);
+
+CREATE TABLE org_invitations (
+    hash BYTEA PRIMARY KEY,
+    org_id INTEGER NOT NULL REFERENCES orgs ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'member')),
+    expiry TIMESTAMPTZ NOT NULL
+);
+
+ALTER TABLE snippets ADD COLUMN org_id INTEGER REFERENCES orgs ON DELETE CASCADE;
+ALTER TABLE snippets ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public'
+    CONSTRAINT snippets_visibility_check CHECK (visibility IN ('public', 'org'));
+
+-- Only snippets which belong to an organization can be limited to its members.
+ALTER TABLE snippets ADD CONSTRAINT snippets_check CHECK (visibility <> 'org' OR org_id IS NOT NULL);
+
+CREATE INDEX idx_snippets_org_id ON snippets(org_id);
@@ -0,0 +1,12 @@
+ALTER TABLE snippets DROP CONSTRAINT snippets_visibility_check;
+ALTER TABLE snippets ADD CONSTRAINT snippets_visibility_check CHECK (visibility IN ('public', 'org', 'private'));
+
+CREATE TABLE snippet_shares (
+    snippet_id INTEGER NOT NULL REFERENCES snippets ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+    permission TEXT NOT NULL CHECK (permission IN ('view', 'edit')),
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (snippet_id, user_id)
+);
+
+CREATE INDEX snippet_shares_user_id_idx ON snippet_shares (user_id);
@@ -0,0 +1,8 @@
+CREATE TABLE stars (
+    user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+    snippet_id INTEGER NOT NULL REFERENCES snippets ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL,
+    CONSTRAINT stars_uc_user_snippet UNIQUE (user_id, snippet_id)
+);
+
+CREATE INDEX stars_snippet_id_idx ON stars (snippet_id);
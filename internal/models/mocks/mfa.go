@@ -0,0 +1,51 @@
+package mocks
+
+import (
+	"context"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+const (
+	// The TOTP secret for the mock user Carol, who is the only user with two-factor
+	// authentication enabled. Tests can use it to generate valid codes.
+	MFASecret = "JBSWY3DPEHPK3PXP"
+
+	// The only recovery code which the mock MFAModel accepts.
+	ValidRecoveryCode = "abcd-efgh"
+)
+
+type MFAModel struct{}
+
+func (m *MFAModel) Enable(ctx context.Context, userID int, secret string, recoveryCodes []string) error {
+	return nil
+}
+
+func (m *MFAModel) Disable(ctx context.Context, userID int) error {
+	return nil
+}
+
+func (m *MFAModel) GetSecret(ctx context.Context, userID int) (string, error) {
+	if userID == mockCarol.Id {
+		return MFASecret, nil
+	}
+	return "", models.ErrNoRecord
+}
+
+func (m *MFAModel) RecordStep(ctx context.Context, userID int, step int64) error {
+	return nil
+}
+
+func (m *MFAModel) UseRecoveryCode(ctx context.Context, userID int, code string) error {
+	if userID == mockCarol.Id && code == ValidRecoveryCode {
+		return nil
+	}
+	return models.ErrNoRecord
+}
+
+func (m *MFAModel) RecoveryCodesRemaining(ctx context.Context, userID int) (int, error) {
+	if userID == mockCarol.Id {
+		return models.RecoveryCodeCount, nil
+	}
+	return 0, nil
+}
@@ -1,34 +1,125 @@
 package mocks
 
 import (
+	"context"
 	"time"
 
 	"snippetbox.prajjmon.net/internal/models"
 )
 
 var mockSnippet = models.Snippet{
-	ID:      1,
-	Title:   "An old silent pond",
-	Content: "An old silent pond...",
-	Created: time.Now(),
-	Expires: time.Now(),
+	ID:         1,
+	Title:      "An old silent pond",
+	Content:    "An old silent pond...",
+	Created:    time.Now(),
+	Expires:    time.Now(),
+	UserID:     1,
+	Visibility: models.VisibilityPublic,
+}
+
+// A snippet which has been hidden after being reported.
+var mockHiddenSnippet = models.Snippet{
+	ID:         5,
+	Title:      "Spam",
+	Content:    "Buy now!",
+	Created:    time.Now(),
+	Expires:    time.Now(),
+	UserID:     2,
+	Hidden:     true,
+	Visibility: models.VisibilityPublic,
+}
+
+// A snippet which only the members of the first organization can see.
+var mockOrgSnippet = models.Snippet{
+	ID:         6,
+	Title:      "Team notes",
+	Content:    "Members only",
+	Created:    time.Now(),
+	Expires:    time.Now(),
+	UserID:     2,
+	OrgID:      1,
+	Visibility: models.VisibilityOrg,
+}
+
+// A snippet which only its owner, and the people it has been shared with, can see.
+var mockPrivateSnippet = models.Snippet{
+	ID:         7,
+	Title:      "Draft",
+	Content:    "Not ready yet",
+	Created:    time.Now(),
+	Expires:    time.Now(),
+	UserID:     2,
+	Visibility: models.VisibilityPrivate,
 }
 
 type SnippetModel struct{}
 
-func (m *SnippetModel) Insert(title, content string) (int, error) {
+func (m *SnippetModel) Insert(ctx context.Context, userID, orgID int, title, content string, visibility models.Visibility) (int, error) {
 	return 2, nil
 }
 
-func (m *SnippetModel) Get(id int) (models.Snippet, error) {
+func (m *SnippetModel) Get(ctx context.Context, id int) (models.Snippet, error) {
 	switch id {
 	case 1:
 		return mockSnippet, nil
+	case 3:
+		return models.Snippet{}, models.ErrQueryTimeout
+	case 4:
+		return models.Snippet{}, models.ErrQueryCanceled
+	case 5:
+		return mockHiddenSnippet, nil
+	case 6:
+		return mockOrgSnippet, nil
+	case 7:
+		return mockPrivateSnippet, nil
 	default:
 		return models.Snippet{}, models.ErrNoRecord
 	}
 }
 
-func (m *SnippetModel) Latest() ([]models.Snippet, error) {
+func (m *SnippetModel) Update(ctx context.Context, id int, title, content string, visibility models.Visibility) error {
+	if id != 1 && id != 6 && id != 7 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *SnippetModel) Latest(ctx context.Context) ([]models.Snippet, error) {
 	return []models.Snippet{mockSnippet}, nil
 }
+
+func (m *SnippetModel) ListForOrg(ctx context.Context, orgID int) ([]models.Snippet, error) {
+	if orgID != mockOrgSnippet.OrgID {
+		return nil, nil
+	}
+	return []models.Snippet{mockOrgSnippet}, nil
+}
+
+func (m *SnippetModel) Counts(ctx context.Context) (models.SnippetCounts, error) {
+	return models.SnippetCounts{Live: 1, Expired: 2}, nil
+}
+
+func (m *SnippetModel) TopCreators(ctx context.Context, limit int) ([]models.SnippetCreator, error) {
+	return []models.SnippetCreator{{UserID: mockAlice.Id, Snippets: 3}}, nil
+}
+
+func (m *SnippetModel) Expire(ctx context.Context, id int) error {
+	if id != 1 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *SnippetModel) Delete(ctx context.Context, id int) error {
+	if id != 1 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *SnippetModel) SetHidden(ctx context.Context, id int, hidden bool) error {
+	if id != 1 && id != 5 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
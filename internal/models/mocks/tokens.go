@@ -0,0 +1,32 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+// The only token which the mock TokenModel considers valid. It belongs to user 1.
+const ValidToken = "valid-token"
+
+type TokenModel struct{}
+
+func (m *TokenModel) New(ctx context.Context, userID int, ttl time.Duration, scope string) (string, error) {
+	return ValidToken, nil
+}
+
+func (m *TokenModel) GetUserID(ctx context.Context, plaintext, scope string) (int, error) {
+	if plaintext == ValidToken {
+		return 1, nil
+	}
+	return 0, models.ErrNoRecord
+}
+
+func (m *TokenModel) Consume(ctx context.Context, plaintext, scope string) (int, error) {
+	return m.GetUserID(ctx, plaintext, scope)
+}
+
+func (m *TokenModel) DeleteAllForUser(ctx context.Context, userID int, scope string) error {
+	return nil
+}
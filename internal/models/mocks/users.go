@@ -1,30 +1,168 @@
 package mocks
 
-import "snippetbox.prajjmon.net/internal/models"
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
 
 type UserModel struct{}
 
-func (m *UserModel) Insert(name, email, password string) error {
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) (int, error) {
 	switch email {
 	case "dupe@example.com":
-		return models.ErrDuplicateEmail
+		return 0, models.ErrDuplicateEmail
 	default:
-		return nil
+		return 3, nil
 	}
 }
 
-func (m *UserModel) Authenticate(email, password string) (int, error) {
-	if email == "alice@example.com" && password == "pa$$word" {
-		return 1, nil
+// The mock users. Alice has verified her email address, but Bob hasn't. Carol has also
+// enabled two-factor authentication (see MFAModel). Dave is an admin, Eve's account has been
+// disabled and Frank is a moderator. All of them have the password "pa$$word".
+var (
+	mockAlice = models.User{Id: 1, Name: "Alice", Email: "alice@example.com", Verified: true, Role: models.RoleUser}
+	mockBob   = models.User{Id: 2, Name: "Bob", Email: "bob@example.com", Verified: false, Role: models.RoleUser}
+	mockCarol = models.User{Id: 4, Name: "Carol", Email: "carol@example.com", Verified: true, Role: models.RoleUser}
+	mockDave  = models.User{Id: 5, Name: "Dave", Email: "dave@example.com", Verified: true, Role: models.RoleAdmin}
+	mockEve   = models.User{Id: 6, Name: "Eve", Email: "eve@example.com", Verified: true, Role: models.RoleUser, Disabled: true}
+	mockFrank = models.User{Id: 7, Name: "Frank", Email: "frank@example.com", Verified: true, Role: models.RoleModerator}
+
+	mockUsers = []models.User{mockAlice, mockBob, mockCarol, mockDave, mockEve, mockFrank}
+)
+
+// Returns the mock user with the given ID.
+func findUser(id int) (models.User, bool) {
+	for _, u := range mockUsers {
+		if u.Id == id {
+			return u, true
+		}
 	}
-	return 0, models.ErrInvalidCredentials
+	return models.User{}, false
 }
 
-func (m *UserModel) Exists(id int) (bool, error) {
-	switch id {
-	case 1:
-		return true, nil
-	default:
-		return false, nil
+// Returns the mock user with the given email address.
+func findUserByEmail(email string) (models.User, bool) {
+	for _, u := range mockUsers {
+		if u.Email == email {
+			return u, true
+		}
+	}
+	return models.User{}, false
+}
+
+func (m *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
+	u, ok := findUserByEmail(email)
+	if !ok || password != "pa$$word" {
+		return 0, models.ErrInvalidCredentials
+	}
+	if u.Disabled {
+		return 0, models.ErrAccountDisabled
+	}
+	return u.Id, nil
+}
+
+func (m *UserModel) Exists(ctx context.Context, id int) (bool, error) {
+	_, ok := findUser(id)
+	return ok, nil
+}
+
+func (m *UserModel) Get(ctx context.Context, id int) (models.User, error) {
+	u, ok := findUser(id)
+	if !ok {
+		return models.User{}, models.ErrNoRecord
+	}
+	return u, nil
+}
+
+func (m *UserModel) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	u, ok := findUserByEmail(email)
+	if !ok {
+		return models.User{}, models.ErrNoRecord
+	}
+	return u, nil
+}
+
+func (m *UserModel) UpdatePassword(ctx context.Context, id int, password string) error {
+	if _, ok := findUser(id); !ok {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *UserModel) ChangePassword(ctx context.Context, id int, currentPassword, newPassword string) error {
+	if _, ok := findUser(id); !ok {
+		return models.ErrNoRecord
+	}
+	if currentPassword != "pa$$word" {
+		return models.ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (m *UserModel) UpdateName(ctx context.Context, id int, name string) error {
+	if _, ok := findUser(id); !ok {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *UserModel) UpdateEmail(ctx context.Context, id int, email string) error {
+	if _, ok := findUser(id); !ok {
+		return models.ErrNoRecord
+	}
+	if _, taken := findUserByEmail(email); taken || email == "dupe@example.com" {
+		return models.ErrDuplicateEmail
+	}
+	return nil
+}
+
+func (m *UserModel) SetVerified(ctx context.Context, id int) error {
+	if _, ok := findUser(id); !ok {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *UserModel) SetRole(ctx context.Context, id int, role models.Role) error {
+	if !role.Valid() {
+		return models.ErrInvalidRole
+	}
+	if _, ok := findUser(id); !ok {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *UserModel) SetDisabled(ctx context.Context, id int, disabled bool) error {
+	if _, ok := findUser(id); !ok {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *UserModel) Count(ctx context.Context) (int, error) {
+	return len(mockUsers), nil
+}
+
+// Returns the mock users, newest first.
+func (m *UserModel) Latest(ctx context.Context, limit int) ([]models.User, error) {
+	users := slices.Clone(mockUsers)
+	slices.Reverse(users)
+	return users[:min(limit, len(users))], nil
+}
+
+func (m *UserModel) Search(ctx context.Context, query string, limit int) ([]models.User, error) {
+	query = strings.ToLower(query)
+
+	var users []models.User
+	for _, u := range mockUsers {
+		match := strings.Contains(strings.ToLower(u.Name), query) || strings.Contains(u.Email, query)
+		if match && len(users) < limit {
+			users = append(users, u)
+		}
 	}
+	return users, nil
 }
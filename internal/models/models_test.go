@@ -0,0 +1,104 @@
+package models_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"snippetbox.prajjmon.net/internal/assert"
+	"snippetbox.prajjmon.net/internal/models"
+	"snippetbox.prajjmon.net/internal/models/modelstest"
+	"snippetbox.prajjmon.net/internal/passhash"
+)
+
+// Opens a connection pool to the test database named by the SNIPPETBOX_TEST_DSN environment
+// variable and migrates a fresh set of tables, which are dropped again when the test finishes.
+// The test is skipped if the variable isn't set.
+func newTestDB(t *testing.T) *pgxpool.Pool {
+	dsn := os.Getenv("SNIPPETBOX_TEST_DSN")
+	if dsn == "" {
+		t.Skip("SNIPPETBOX_TEST_DSN not set; skipping Postgres tests")
+	}
+
+	dbpool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	execScript(t, dbpool, "./testdata/teardown.sql")
+
+	err = models.Migrate(context.Background(), dbpool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		defer dbpool.Close()
+		execScript(t, dbpool, "./testdata/teardown.sql")
+	})
+
+	return dbpool
+}
+
+func execScript(t *testing.T, dbpool *pgxpool.Pool, path string) {
+	script, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = dbpool.Exec(context.Background(), string(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	modelstest.Run(t, func(t *testing.T) *modelstest.Backend {
+		dbpool := newTestDB(t)
+		users := &models.UserModel{DbPool: dbpool}
+
+		return &modelstest.Backend{
+			Snippets:      &models.SnippetModel{DbPool: dbpool},
+			Users:         users,
+			Tokens:        &models.TokenModel{DbPool: dbpool},
+			MFA:           &models.MFAModel{DbPool: dbpool},
+			Reports:       &models.ReportModel{DbPool: dbpool},
+			Orgs:          &models.OrgModel{DbPool: dbpool},
+			Shares:        &models.ShareModel{DbPool: dbpool},
+			Links:         &models.ShareLinkModel{DbPool: dbpool},
+			Collections:   &models.CollectionModel{DbPool: dbpool},
+			Stars:         &models.StarModel{DbPool: dbpool},
+			AuditLog:      &models.AuditLogModel{DbPool: dbpool},
+			LoginAttempts: &models.LoginAttemptModel{DbPool: dbpool},
+			UserSessions:  &models.UserSessionModel{DbPool: dbpool},
+			ExpireSnippet: func(t *testing.T, id int) {
+				_, err := dbpool.Exec(context.Background(), "UPDATE snippets SET expires = NOW() - INTERVAL '1 second' WHERE id = $1", id)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			SetPasswordParams: func(p passhash.Params) {
+				users.PasswordParams = p
+			},
+		}
+	})
+}
+
+func TestAuditLogAppendOnly(t *testing.T) {
+	dbpool := newTestDB(t)
+	ctx := context.Background()
+
+	m := &models.AuditLogModel{DbPool: dbpool}
+
+	err := m.Log(ctx, models.AuditEntry{ActorID: 1, Action: models.AuditLogin})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = dbpool.Exec(ctx, "UPDATE audit_log SET actor_id = 2")
+	assert.Equal(t, err != nil, true)
+
+	_, err = dbpool.Exec(ctx, "DELETE FROM audit_log")
+	assert.Equal(t, err != nil, true)
+}
@@ -0,0 +1,133 @@
+package modelstest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"snippetbox.prajjmon.net/internal/assert"
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+func testAuditLog(t *testing.T, newBackend func(t *testing.T) *Backend) {
+	ctx := context.Background()
+
+	t.Run("Log and List", func(t *testing.T) {
+		b := newBackend(t)
+
+		entries, err := b.AuditLog.List(ctx, models.AuditFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(entries), 0)
+
+		logged := []models.AuditEntry{
+			{ActorID: 1, IP: "192.0.2.1", UserAgent: "Firefox", Action: models.AuditSignup, TargetType: models.AuditTargetUser, TargetID: 1},
+			{IP: "192.0.2.2", Action: models.AuditLoginFailed, TargetType: models.AuditTargetUser, TargetID: 1, Details: map[string]string{"email": "alice@example.com"}},
+			{ActorID: 2, Action: models.AuditSnippetCreate, TargetType: models.AuditTargetSnippet, TargetID: 1},
+			{ActorID: 2, Action: models.AuditUserDisable, TargetType: models.AuditTargetUser, TargetID: 1},
+			{ActorID: 1, Action: models.AuditLogout},
+		}
+
+		for _, e := range logged {
+			err := b.AuditLog.Log(ctx, e)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Everything comes back, newest first.
+		entries, err = b.AuditLog.List(ctx, models.AuditFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(entries), 5)
+		assert.Equal(t, entries[0].Action, models.AuditLogout)
+		assert.Equal(t, entries[0].TargetType, "")
+		assert.Equal(t, entries[0].TargetID, 0)
+		assert.Equal(t, len(entries[0].Details), 0)
+		assert.Equal(t, entries[4].ActorID, 1)
+		assert.Equal(t, entries[4].IP, "192.0.2.1")
+		assert.Equal(t, entries[4].UserAgent, "Firefox")
+		assert.Equal(t, entries[4].Created.IsZero(), false)
+		assert.Equal(t, entries[0].ID > entries[4].ID, true)
+
+		failed := entries[3]
+		assert.Equal(t, failed.ActorID, 0)
+		assert.Equal(t, failed.TargetType, models.AuditTargetUser)
+		assert.Equal(t, failed.TargetID, 1)
+		assert.Equal(t, failed.Details["email"], "alice@example.com")
+
+		// A user's entries include the things done to them, as well as by them.
+		entries, err = b.AuditLog.List(ctx, models.AuditFilter{UserID: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(entries), 4)
+
+		entries, err = b.AuditLog.List(ctx, models.AuditFilter{UserID: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(entries), 2)
+		assert.Equal(t, entries[0].Action, models.AuditUserDisable)
+		assert.Equal(t, entries[1].Action, models.AuditSnippetCreate)
+
+		// The snippet's ID doesn't count as a user ID.
+		entries, err = b.AuditLog.List(ctx, models.AuditFilter{UserID: 2, Action: models.AuditSnippetCreate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(entries), 1)
+
+		entries, err = b.AuditLog.List(ctx, models.AuditFilter{UserID: 1, Action: models.AuditSnippetCreate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(entries), 0)
+
+		entries, err = b.AuditLog.List(ctx, models.AuditFilter{Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(entries), 2)
+		assert.Equal(t, entries[1].Action, models.AuditUserDisable)
+	})
+
+	t.Run("Details are copied", func(t *testing.T) {
+		b := newBackend(t)
+
+		details := map[string]string{"title": "Before"}
+
+		err := b.AuditLog.Log(ctx, models.AuditEntry{Action: models.AuditSnippetCreate, Details: details})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		details["title"] = "After"
+
+		entries, err := b.AuditLog.List(ctx, models.AuditFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, entries[0].Details["title"], "Before")
+
+		entries[0].Details["title"] = "After"
+
+		entries, err = b.AuditLog.List(ctx, models.AuditFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, entries[0].Details["title"], "Before")
+	})
+
+	t.Run("Canceled context", func(t *testing.T) {
+		b := newBackend(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := b.AuditLog.Log(ctx, models.AuditEntry{Action: models.AuditLogout})
+		assert.Equal(t, errors.Is(err, models.ErrQueryCanceled), true)
+	})
+}
@@ -0,0 +1,207 @@
+package modelstest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/assert"
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+func testCollections(t *testing.T, newBackend func(t *testing.T) *Backend) {
+	ctx := context.Background()
+
+	t.Run("Insert, Get and Update", func(t *testing.T) {
+		b := newBackend(t)
+
+		alice := insertUser(t, b, "alice@example.com")
+
+		id, err := b.Collections.Insert(ctx, alice, "Onboarding", models.VisibilityPrivate)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := b.Collections.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, c.ID, id)
+		assert.Equal(t, c.UserID, alice)
+		assert.Equal(t, c.Name, "Onboarding")
+		assert.Equal(t, c.Visibility, models.VisibilityPrivate)
+		assert.Equal(t, time.Since(c.Created) < time.Minute, true)
+
+		err = b.Collections.Update(ctx, id, "Postgres tricks", models.VisibilityPublic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, err = b.Collections.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, c.Name, "Postgres tricks")
+		assert.Equal(t, c.Visibility, models.VisibilityPublic)
+
+		_, err = b.Collections.Get(ctx, id+1)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		err = b.Collections.Update(ctx, id+1, "Missing", models.VisibilityPublic)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("ListForUser", func(t *testing.T) {
+		b := newBackend(t)
+
+		alice := insertUser(t, b, "alice@example.com")
+		bob := insertUser(t, b, "bob@example.com")
+
+		var ids []int
+		for _, name := range []string{"Zeta", "Alpha"} {
+			id, err := b.Collections.Insert(ctx, alice, name, models.VisibilityPublic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+
+		_, err := b.Collections.Insert(ctx, bob, "Bob's", models.VisibilityPublic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		collections, err := b.Collections.ListForUser(ctx, alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(collections), 2)
+		assert.Equal(t, collections[0].ID, ids[1])
+		assert.Equal(t, collections[1].ID, ids[0])
+	})
+
+	t.Run("Snippets", func(t *testing.T) {
+		b := newBackend(t)
+
+		alice := insertUser(t, b, "alice@example.com")
+
+		id, err := b.Collections.Insert(ctx, alice, "Incident commands", models.VisibilityPublic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var snippets []int
+		for i := 0; i < 3; i++ {
+			snippetID, err := b.Snippets.Insert(ctx, alice, 0, "Snippet", "Content", models.VisibilityPublic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			snippets = append(snippets, snippetID)
+
+			err = b.Collections.AddSnippet(ctx, id, snippetID)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = b.Collections.AddSnippet(ctx, id, snippets[0])
+		assert.Equal(t, errors.Is(err, models.ErrDuplicateSnippet), true)
+
+		ids, err := b.Collections.SnippetIDs(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(ids), 3)
+		assert.Equal(t, ids[0], snippets[0])
+		assert.Equal(t, ids[1], snippets[1])
+		assert.Equal(t, ids[2], snippets[2])
+
+		// Moves stop at either end of the collection.
+		for _, move := range []struct{ snippet, delta int }{
+			{snippets[2], -1},
+			{snippets[0], 5},
+			{snippets[2], -1},
+		} {
+			err = b.Collections.MoveSnippet(ctx, id, move.snippet, move.delta)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ids, err = b.Collections.SnippetIDs(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(ids), 3)
+		assert.Equal(t, ids[0], snippets[2])
+		assert.Equal(t, ids[1], snippets[1])
+		assert.Equal(t, ids[2], snippets[0])
+
+		err = b.Collections.RemoveSnippet(ctx, id, snippets[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = b.Collections.RemoveSnippet(ctx, id, snippets[1])
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		err = b.Collections.MoveSnippet(ctx, id, snippets[1], 1)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		// Snippets which are added again go on the end.
+		err = b.Collections.AddSnippet(ctx, id, snippets[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids, err = b.Collections.SnippetIDs(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(ids), 3)
+		assert.Equal(t, ids[0], snippets[2])
+		assert.Equal(t, ids[1], snippets[0])
+		assert.Equal(t, ids[2], snippets[1])
+	})
+
+	t.Run("PublicForSnippet", func(t *testing.T) {
+		b := newBackend(t)
+
+		alice := insertUser(t, b, "alice@example.com")
+
+		snippetID, err := b.Snippets.Insert(ctx, alice, 0, "Snippet", "Content", models.VisibilityPublic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []int
+		for _, c := range []models.Collection{
+			{Name: "Zeta", Visibility: models.VisibilityPublic},
+			{Name: "Private", Visibility: models.VisibilityPrivate},
+			{Name: "Alpha", Visibility: models.VisibilityPublic},
+			{Name: "Without it", Visibility: models.VisibilityPublic},
+		} {
+			id, err := b.Collections.Insert(ctx, alice, c.Name, c.Visibility)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+
+		for _, id := range ids[:3] {
+			err = b.Collections.AddSnippet(ctx, id, snippetID)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		collections, err := b.Collections.PublicForSnippet(ctx, snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(collections), 2)
+		assert.Equal(t, collections[0].Name, "Alpha")
+		assert.Equal(t, collections[1].Name, "Zeta")
+	})
+}
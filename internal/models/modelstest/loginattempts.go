@@ -0,0 +1,117 @@
+package modelstest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/assert"
+)
+
+func testLoginAttempts(t *testing.T, newBackend func(t *testing.T) *Backend) {
+	ctx := context.Background()
+
+	t.Run("Record and reset", func(t *testing.T) {
+		b := newBackend(t)
+
+		count, last, err := b.LoginAttempts.Failures(ctx, "email:alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, count, 0)
+		assert.Equal(t, last.IsZero(), true)
+
+		for i := 1; i <= 3; i++ {
+			count, previous, err := b.LoginAttempts.RecordFailure(ctx, "email:alice@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, count, i)
+
+			// The time of the failure before this one is returned.
+			assert.Equal(t, previous.IsZero(), i == 1)
+			assert.Equal(t, i == 1 || time.Since(previous) < time.Minute, true)
+		}
+
+		// Failures for other keys are counted separately.
+		count, _, err = b.LoginAttempts.RecordFailure(ctx, "ip:192.0.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, count, 1)
+
+		count, last, err = b.LoginAttempts.Failures(ctx, "email:alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, count, 3)
+		assert.Equal(t, time.Since(last) < time.Minute, true)
+
+		// Forgetting a failure takes back the most recent one.
+		err = b.LoginAttempts.Forget(ctx, "email:alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		count, _, err = b.LoginAttempts.Failures(ctx, "email:alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, count, 2)
+
+		err = b.LoginAttempts.Reset(ctx, "email:alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		count, _, err = b.LoginAttempts.Failures(ctx, "email:alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, count, 0)
+
+		count, _, err = b.LoginAttempts.Failures(ctx, "ip:192.0.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, count, 1)
+	})
+
+	t.Run("Concurrent failures", func(t *testing.T) {
+		b := newBackend(t)
+
+		const attempts = 20
+
+		var wg sync.WaitGroup
+		counts := make(chan int, attempts)
+
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				count, _, err := b.LoginAttempts.RecordFailure(ctx, "email:alice@example.com")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				counts <- count
+			}()
+		}
+
+		wg.Wait()
+		close(counts)
+
+		// Every attempt sees a different count, so none of them can miss the others.
+		seen := make(map[int]bool)
+		for count := range counts {
+			seen[count] = true
+		}
+		assert.Equal(t, len(seen), attempts)
+
+		for i := 1; i <= attempts; i++ {
+			assert.Equal(t, seen[i], true)
+		}
+	})
+}
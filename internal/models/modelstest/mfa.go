@@ -0,0 +1,139 @@
+package modelstest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"snippetbox.prajjmon.net/internal/assert"
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+func testMFA(t *testing.T, newBackend func(t *testing.T) *Backend) {
+	ctx := context.Background()
+
+	t.Run("Enable and disable", func(t *testing.T) {
+		b := newBackend(t)
+		userID := insertUser(t, b, "alice@example.com")
+
+		_, err := b.MFA.GetSecret(ctx, userID)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		codes, err := models.GenerateRecoveryCodes(models.RecoveryCodeCount)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = b.MFA.Enable(ctx, userID, "SECRET", codes)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		secret, err := b.MFA.GetSecret(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, secret, "SECRET")
+
+		remaining, err := b.MFA.RecoveryCodesRemaining(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, remaining, models.RecoveryCodeCount)
+
+		// Enabling again replaces the secret and recovery codes.
+		err = b.MFA.Enable(ctx, userID, "NEWSECRET", codes[:2])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		secret, err = b.MFA.GetSecret(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, secret, "NEWSECRET")
+
+		remaining, err = b.MFA.RecoveryCodesRemaining(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, remaining, 2)
+
+		err = b.MFA.Disable(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.MFA.GetSecret(ctx, userID)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		err = b.MFA.UseRecoveryCode(ctx, userID, codes[0])
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("Recovery codes are single use", func(t *testing.T) {
+		b := newBackend(t)
+		userID := insertUser(t, b, "alice@example.com")
+		otherID := insertUser(t, b, "bob@example.com")
+
+		codes, err := models.GenerateRecoveryCodes(models.RecoveryCodeCount)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = b.MFA.Enable(ctx, userID, "SECRET", codes)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = b.MFA.Enable(ctx, otherID, "SECRET", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Codes only work for the user that they were generated for.
+		err = b.MFA.UseRecoveryCode(ctx, otherID, codes[0])
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		// Codes are accepted however the user types them in.
+		err = b.MFA.UseRecoveryCode(ctx, userID, strings.ToUpper(strings.ReplaceAll(codes[0], "-", " ")))
+		assert.Equal(t, err, nil)
+
+		err = b.MFA.UseRecoveryCode(ctx, userID, codes[0])
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		remaining, err := b.MFA.RecoveryCodesRemaining(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, remaining, models.RecoveryCodeCount-1)
+	})
+
+	t.Run("RecordStep", func(t *testing.T) {
+		b := newBackend(t)
+		userID := insertUser(t, b, "alice@example.com")
+
+		// Users without a secret can't log in with a code.
+		err := b.MFA.RecordStep(ctx, userID, 100)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		err = b.MFA.Enable(ctx, userID, "SECRET", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = b.MFA.RecordStep(ctx, userID, 100)
+		assert.Equal(t, err, nil)
+
+		// The same code, or one from an earlier step, can't be used again.
+		err = b.MFA.RecordStep(ctx, userID, 100)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		err = b.MFA.RecordStep(ctx, userID, 99)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		err = b.MFA.RecordStep(ctx, userID, 101)
+		assert.Equal(t, err, nil)
+	})
+}
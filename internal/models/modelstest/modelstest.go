@@ -0,0 +1,869 @@
+// Package modelstest provides a conformance test suite for implementations of the model
+// interfaces. Every storage backend runs the same suite from its own tests, which ensures
+// that the handlers behave the same way whichever backend is selected.
+package modelstest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/assert"
+	"snippetbox.prajjmon.net/internal/models"
+	"snippetbox.prajjmon.net/internal/passhash"
+)
+
+// Holds the models under test, along with any backend-specific hooks that the suite needs.
+type Backend struct {
+	Snippets    models.SnippetModelInterface
+	Users       models.UserModelInterface
+	Tokens      models.TokenModelInterface
+	MFA         models.MFAModelInterface
+	Reports     models.ReportModelInterface
+	Orgs        models.OrgModelInterface
+	Shares      models.ShareModelInterface
+	Links       models.ShareLinkModelInterface
+	Collections models.CollectionModelInterface
+	Stars       models.StarModelInterface
+	AuditLog    models.AuditLogger
+
+	LoginAttempts models.LoginAttemptModelInterface
+	UserSessions  models.UserSessionModelInterface
+
+	// Makes the snippet with the given ID expire immediately.
+	ExpireSnippet func(t *testing.T, id int)
+
+	// Changes the parameters which Users uses to hash passwords.
+	SetPasswordParams func(p passhash.Params)
+}
+
+// Runs the full conformance suite. The newBackend function is called once for each subtest
+// and must return models backed by an empty store.
+func Run(t *testing.T, newBackend func(t *testing.T) *Backend) {
+	t.Run("Snippets", func(t *testing.T) {
+		testSnippets(t, newBackend)
+	})
+
+	t.Run("Users", func(t *testing.T) {
+		testUsers(t, newBackend)
+	})
+
+	t.Run("Tokens", func(t *testing.T) {
+		testTokens(t, newBackend)
+	})
+
+	t.Run("MFA", func(t *testing.T) {
+		testMFA(t, newBackend)
+	})
+
+	t.Run("Reports", func(t *testing.T) {
+		testReports(t, newBackend)
+	})
+
+	t.Run("Orgs", func(t *testing.T) {
+		testOrgs(t, newBackend)
+	})
+
+	t.Run("Shares", func(t *testing.T) {
+		testShares(t, newBackend)
+	})
+
+	t.Run("ShareLinks", func(t *testing.T) {
+		testShareLinks(t, newBackend)
+	})
+
+	t.Run("Collections", func(t *testing.T) {
+		testCollections(t, newBackend)
+	})
+
+	t.Run("Stars", func(t *testing.T) {
+		testStars(t, newBackend)
+	})
+
+	t.Run("AuditLog", func(t *testing.T) {
+		testAuditLog(t, newBackend)
+	})
+
+	t.Run("LoginAttempts", func(t *testing.T) {
+		testLoginAttempts(t, newBackend)
+	})
+
+	t.Run("UserSessions", func(t *testing.T) {
+		testUserSessions(t, newBackend)
+	})
+}
+
+// Creates a user with the given email address (and the password "pa$$word") and returns
+// their ID.
+func insertUser(t *testing.T, b *Backend, email string) int {
+	t.Helper()
+
+	ctx := context.Background()
+
+	id, err := b.Users.Insert(ctx, "Test User", email, "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+func testSnippets(t *testing.T, newBackend func(t *testing.T) *Backend) {
+	ctx := context.Background()
+
+	t.Run("Insert and Get", func(t *testing.T) {
+		b := newBackend(t)
+
+		userID := insertUser(t, b, "alice@example.com")
+
+		id, err := b.Snippets.Insert(ctx, userID, 0, "An old silent pond", "A frog jumps into the pond", models.VisibilityPublic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := b.Snippets.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, s.ID, id)
+		assert.Equal(t, s.Title, "An old silent pond")
+		assert.Equal(t, s.Content, "A frog jumps into the pond")
+		assert.Equal(t, s.UserID, userID)
+		assert.Equal(t, s.OrgID, 0)
+		assert.Equal(t, s.Visibility, models.VisibilityPublic)
+
+		// Snippets expire 7 days after they are created. We allow a little leeway, as some
+		// backends store timestamps at a lower precision than others.
+		lifetime := s.Expires.Sub(s.Created)
+		assert.Equal(t, lifetime > 7*24*time.Hour-time.Second && lifetime < 7*24*time.Hour+time.Second, true)
+		assert.Equal(t, time.Since(s.Created) < time.Minute, true)
+	})
+
+	t.Run("Get missing", func(t *testing.T) {
+		b := newBackend(t)
+
+		_, err := b.Snippets.Get(ctx, 1)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("Get expired", func(t *testing.T) {
+		b := newBackend(t)
+
+		id, err := b.Snippets.Insert(ctx, insertUser(t, b, "alice@example.com"), 0, "Expired", "Gone", models.VisibilityPublic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b.ExpireSnippet(t, id)
+
+		_, err = b.Snippets.Get(ctx, id)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("Latest", func(t *testing.T) {
+		b := newBackend(t)
+
+		latest, err := b.Snippets.Latest(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(latest), 0)
+
+		userID := insertUser(t, b, "alice@example.com")
+
+		var ids []int
+		for i := 0; i < 12; i++ {
+			id, err := b.Snippets.Insert(ctx, userID, 0, "Title", "Content", models.VisibilityPublic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+
+		// Expire the newest snippet, which should then be left out.
+		b.ExpireSnippet(t, ids[11])
+
+		latest, err = b.Snippets.Latest(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, len(latest), 10)
+		for i, s := range latest {
+			assert.Equal(t, s.ID, ids[10-i])
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		b := newBackend(t)
+
+		userID := insertUser(t, b, "alice@example.com")
+
+		id, err := b.Snippets.Insert(ctx, userID, 0, "Title", "Content", models.VisibilityPublic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = b.Snippets.Update(ctx, id, "New title", "New content", models.VisibilityPublic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := b.Snippets.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, s.Title, "New title")
+		assert.Equal(t, s.Content, "New content")
+		assert.Equal(t, s.UserID, userID)
+
+		// Expired snippets can't be changed.
+		b.ExpireSnippet(t, id)
+
+		err = b.Snippets.Update(ctx, id, "Title", "Content", models.VisibilityPublic)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		err = b.Snippets.Update(ctx, id+1, "Title", "Content", models.VisibilityPublic)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("Expire and Delete", func(t *testing.T) {
+		b := newBackend(t)
+
+		userID := insertUser(t, b, "alice@example.com")
+
+		var ids []int
+		for i := 0; i < 3; i++ {
+			id, err := b.Snippets.Insert(ctx, userID, 0, "Title", "Content", models.VisibilityPublic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+
+		err := b.Snippets.Expire(ctx, ids[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.Snippets.Get(ctx, ids[0])
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		// A snippet can only be expired once.
+		err = b.Snippets.Expire(ctx, ids[0])
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		counts, err := b.Snippets.Counts(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, counts, models.SnippetCounts{Live: 2, Expired: 1})
+
+		// Expired snippets can still be deleted.
+		for _, id := range ids[:2] {
+			err = b.Snippets.Delete(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		_, err = b.Snippets.Get(ctx, ids[1])
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		err = b.Snippets.Delete(ctx, ids[1])
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		err = b.Snippets.Expire(ctx, ids[1])
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		counts, err = b.Snippets.Counts(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, counts, models.SnippetCounts{Live: 1, Expired: 0})
+
+		latest, err := b.Snippets.Latest(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(latest), 1)
+		assert.Equal(t, latest[0].ID, ids[2])
+
+		// IDs aren't reused after a delete.
+		id, err := b.Snippets.Insert(ctx, userID, 0, "Title", "Content", models.VisibilityPublic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, id > ids[2], true)
+	})
+
+	t.Run("SetHidden", func(t *testing.T) {
+		b := newBackend(t)
+
+		userID := insertUser(t, b, "alice@example.com")
+
+		id, err := b.Snippets.Insert(ctx, userID, 0, "Title", "Content", models.VisibilityPublic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = b.Snippets.SetHidden(ctx, id, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Hidden snippets are still returned by Get, but aren't in the latest snippets.
+		s, err := b.Snippets.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, s.Hidden, true)
+
+		latest, err := b.Snippets.Latest(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(latest), 0)
+
+		err = b.Snippets.SetHidden(ctx, id, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s, err = b.Snippets.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, s.Hidden, false)
+
+		latest, err = b.Snippets.Latest(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(latest), 1)
+
+		err = b.Snippets.SetHidden(ctx, id+1, true)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("TopCreators", func(t *testing.T) {
+		b := newBackend(t)
+
+		alice := insertUser(t, b, "alice@example.com")
+		bob := insertUser(t, b, "bob@example.com")
+		carol := insertUser(t, b, "carol@example.com")
+
+		creators, err := b.Snippets.TopCreators(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(creators), 0)
+
+		for userID, n := range map[int]int{alice: 2, bob: 3, carol: 2} {
+			for i := 0; i < n; i++ {
+				_, err := b.Snippets.Insert(ctx, userID, 0, "Title", "Content", models.VisibilityPublic)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		// Expired snippets still count.
+		b.ExpireSnippet(t, 1)
+
+		creators, err = b.Snippets.TopCreators(ctx, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Ties are broken by user ID.
+		assert.Equal(t, len(creators), 2)
+		assert.Equal(t, creators[0], models.SnippetCreator{UserID: bob, Snippets: 3})
+		assert.Equal(t, creators[1], models.SnippetCreator{UserID: alice, Snippets: 2})
+	})
+
+	t.Run("Canceled context", func(t *testing.T) {
+		b := newBackend(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := b.Snippets.Latest(ctx)
+		assert.Equal(t, errors.Is(err, models.ErrQueryCanceled), true)
+	})
+}
+
+func testUsers(t *testing.T, newBackend func(t *testing.T) *Backend) {
+	ctx := context.Background()
+
+	const (
+		name     = "Alice Jones"
+		email    = "alice@example.com"
+		password = "pa$$word"
+	)
+
+	t.Run("Insert and Authenticate", func(t *testing.T) {
+		b := newBackend(t)
+
+		id, err := b.Users.Insert(ctx, name, email, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		authID, err := b.Users.Authenticate(ctx, email, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, authID, id)
+
+		exists, err := b.Users.Exists(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, exists, true)
+	})
+
+	t.Run("Duplicate email", func(t *testing.T) {
+		b := newBackend(t)
+
+		_, err := b.Users.Insert(ctx, name, email, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.Users.Insert(ctx, "Someone Else", email, "different password")
+		assert.Equal(t, errors.Is(err, models.ErrDuplicateEmail), true)
+
+		// The original account should be unaffected.
+		_, err = b.Users.Authenticate(ctx, email, password)
+		assert.Equal(t, err, nil)
+	})
+
+	t.Run("Invalid credentials", func(t *testing.T) {
+		b := newBackend(t)
+
+		_, err := b.Users.Insert(ctx, name, email, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.Users.Authenticate(ctx, email, "wrong password")
+		assert.Equal(t, errors.Is(err, models.ErrInvalidCredentials), true)
+
+		_, err = b.Users.Authenticate(ctx, "bob@example.com", password)
+		assert.Equal(t, errors.Is(err, models.ErrInvalidCredentials), true)
+	})
+
+	t.Run("GetByEmail", func(t *testing.T) {
+		b := newBackend(t)
+
+		_, err := b.Users.Insert(ctx, name, email, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		u, err := b.Users.GetByEmail(ctx, email)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		id, err := b.Users.Authenticate(ctx, email, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, u.Id, id)
+		assert.Equal(t, u.Name, name)
+		assert.Equal(t, u.Email, email)
+		assert.Equal(t, time.Since(u.Created) < time.Minute, true)
+
+		_, err = b.Users.GetByEmail(ctx, "bob@example.com")
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("UpdatePassword", func(t *testing.T) {
+		b := newBackend(t)
+
+		id := insertUser(t, b, email)
+
+		err := b.Users.UpdatePassword(ctx, id, "n3w pa$$word")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.Users.Authenticate(ctx, email, "pa$$word")
+		assert.Equal(t, errors.Is(err, models.ErrInvalidCredentials), true)
+
+		authID, err := b.Users.Authenticate(ctx, email, "n3w pa$$word")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, authID, id)
+
+		err = b.Users.UpdatePassword(ctx, id+1, "n3w pa$$word")
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		b := newBackend(t)
+
+		id := insertUser(t, b, email)
+
+		u, err := b.Users.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, u.Id, id)
+		assert.Equal(t, u.Email, email)
+
+		_, err = b.Users.Get(ctx, id+1)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("SetVerified", func(t *testing.T) {
+		b := newBackend(t)
+
+		id := insertUser(t, b, email)
+
+		// New users haven't verified their email address yet.
+		u, err := b.Users.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, u.Verified, false)
+
+		err = b.Users.SetVerified(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		u, err = b.Users.GetByEmail(ctx, email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, u.Verified, true)
+
+		err = b.Users.SetVerified(ctx, id+1)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("SetRole", func(t *testing.T) {
+		b := newBackend(t)
+
+		id := insertUser(t, b, email)
+
+		// Everyone starts off as an ordinary user.
+		u, err := b.Users.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, u.Role, models.RoleUser)
+
+		err = b.Users.SetRole(ctx, id, models.RoleAdmin)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		u, err = b.Users.GetByEmail(ctx, email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, u.Role, models.RoleAdmin)
+
+		err = b.Users.SetRole(ctx, id, models.Role("superuser"))
+		assert.Equal(t, errors.Is(err, models.ErrInvalidRole), true)
+
+		u, err = b.Users.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, u.Role, models.RoleAdmin)
+
+		err = b.Users.SetRole(ctx, id+1, models.RoleModerator)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("SetDisabled", func(t *testing.T) {
+		b := newBackend(t)
+
+		id := insertUser(t, b, email)
+
+		err := b.Users.SetDisabled(ctx, id, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		u, err := b.Users.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, u.Disabled, true)
+
+		// Disabled users can't log in, but they're only told so if the password is right.
+		_, err = b.Users.Authenticate(ctx, email, "pa$$word")
+		assert.Equal(t, errors.Is(err, models.ErrAccountDisabled), true)
+
+		_, err = b.Users.Authenticate(ctx, email, "wrong password")
+		assert.Equal(t, errors.Is(err, models.ErrInvalidCredentials), true)
+
+		err = b.Users.SetDisabled(ctx, id, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		authID, err := b.Users.Authenticate(ctx, email, "pa$$word")
+		assert.Equal(t, err, nil)
+		assert.Equal(t, authID, id)
+
+		err = b.Users.SetDisabled(ctx, id+1, true)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("Count and Latest", func(t *testing.T) {
+		b := newBackend(t)
+
+		count, err := b.Users.Count(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, count, 0)
+
+		var ids []int
+		for _, email := range []string{"alice@example.com", "bob@example.com", "carol@example.com"} {
+			ids = append(ids, insertUser(t, b, email))
+		}
+
+		count, err = b.Users.Count(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, count, 3)
+
+		latest, err := b.Users.Latest(ctx, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(latest), 2)
+		assert.Equal(t, latest[0].Id, ids[2])
+		assert.Equal(t, latest[1].Id, ids[1])
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		b := newBackend(t)
+
+		alice, err := b.Users.Insert(ctx, "Alice Jones", "alice@example.com", "pa$$word")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bob, err := b.Users.Insert(ctx, "Bob Smith", "bob_smith@example.org", "pa$$word")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.Users.Insert(ctx, "Carol Jonas", "carol@example.net", "pa$$word")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			query string
+			limit int
+			want  []int
+		}{
+			{"jones", 10, []int{alice}},
+			{"SMITH", 10, []int{bob}},
+			{"example.org", 10, []int{bob}},
+			{"example", 2, []int{alice, bob}},
+			{"_", 10, []int{bob}},
+			{"%", 10, nil},
+			{"dave", 10, nil},
+		}
+
+		for _, tt := range tests {
+			users, err := b.Users.Search(ctx, tt.query, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []int
+			for _, u := range users {
+				got = append(got, u.Id)
+			}
+			assert.Equal(t, slices.Equal(got, tt.want), true)
+		}
+	})
+
+	t.Run("ChangePassword", func(t *testing.T) {
+		b := newBackend(t)
+
+		id := insertUser(t, b, email)
+
+		err := b.Users.ChangePassword(ctx, id, "wrong password", "n3w pa$$word")
+		assert.Equal(t, errors.Is(err, models.ErrInvalidCredentials), true)
+
+		// The password shouldn't have changed after a failed attempt.
+		_, err = b.Users.Authenticate(ctx, email, "pa$$word")
+		assert.Equal(t, err, nil)
+
+		err = b.Users.ChangePassword(ctx, id, "pa$$word", "n3w pa$$word")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.Users.Authenticate(ctx, email, "n3w pa$$word")
+		assert.Equal(t, err, nil)
+
+		err = b.Users.ChangePassword(ctx, id+1, "pa$$word", "n3w pa$$word")
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("UpdateName", func(t *testing.T) {
+		b := newBackend(t)
+
+		id := insertUser(t, b, email)
+
+		err := b.Users.UpdateName(ctx, id, "Alice Smith")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		u, err := b.Users.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, u.Name, "Alice Smith")
+
+		err = b.Users.UpdateName(ctx, id+1, "Alice Smith")
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("UpdateEmail", func(t *testing.T) {
+		b := newBackend(t)
+
+		id := insertUser(t, b, email)
+		otherID := insertUser(t, b, "bob@example.com")
+
+		err := b.Users.SetVerified(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = b.Users.UpdateEmail(ctx, id, "alice@example.org")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The new address needs to be verified, and the old one should no longer be in use.
+		u, err := b.Users.GetByEmail(ctx, "alice@example.org")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, u.Id, id)
+		assert.Equal(t, u.Verified, false)
+
+		_, err = b.Users.GetByEmail(ctx, email)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		_, err = b.Users.Authenticate(ctx, "alice@example.org", "pa$$word")
+		assert.Equal(t, err, nil)
+
+		err = b.Users.UpdateEmail(ctx, otherID, "alice@example.org")
+		assert.Equal(t, errors.Is(err, models.ErrDuplicateEmail), true)
+
+		// The old address is free for someone else to use.
+		err = b.Users.UpdateEmail(ctx, otherID, email)
+		assert.Equal(t, err, nil)
+
+		err = b.Users.UpdateEmail(ctx, otherID+1, "carol@example.com")
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("Rehash on login", func(t *testing.T) {
+		b := newBackend(t)
+
+		// Start off with a bcrypt hash, as if the user signed up before argon2id was
+		// supported.
+		b.SetPasswordParams(passhash.Params{Algorithm: passhash.Bcrypt, BcryptCost: 4})
+
+		id := insertUser(t, b, email)
+
+		u, err := b.Users.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, strings.HasPrefix(string(u.HashedPassword), "$2a$04$"), true)
+
+		argon2Params := passhash.Params{Algorithm: passhash.Argon2id, Argon2Memory: 64, Argon2Time: 1, Argon2Threads: 1}
+		b.SetPasswordParams(argon2Params)
+
+		// A failed login leaves the hash alone.
+		_, err = b.Users.Authenticate(ctx, email, "wrong password")
+		assert.Equal(t, errors.Is(err, models.ErrInvalidCredentials), true)
+
+		u, err = b.Users.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, passhash.NeedsRehash(string(u.HashedPassword), argon2Params), true)
+
+		authID, err := b.Users.Authenticate(ctx, email, "pa$$word")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, authID, id)
+
+		u, err = b.Users.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, strings.HasPrefix(string(u.HashedPassword), "$argon2id$v=19$m=64,t=1,p=1$"), true)
+
+		// The new hash still works.
+		_, err = b.Users.Authenticate(ctx, email, "pa$$word")
+		assert.Equal(t, err, nil)
+	})
+
+	t.Run("No rehash of passwords too long for bcrypt", func(t *testing.T) {
+		b := newBackend(t)
+
+		b.SetPasswordParams(passhash.Params{Algorithm: passhash.Argon2id, Argon2Memory: 64, Argon2Time: 1, Argon2Threads: 1})
+
+		password := strings.Repeat("pa$$word", 10)
+
+		id, err := b.Users.Insert(ctx, "Alice", email, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// bcrypt can't hash the password, so logging in keeps the argon2id hash rather than
+		// failing.
+		b.SetPasswordParams(passhash.Params{Algorithm: passhash.Bcrypt, BcryptCost: 4})
+
+		authID, err := b.Users.Authenticate(ctx, email, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, authID, id)
+
+		u, err := b.Users.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, strings.HasPrefix(string(u.HashedPassword), "$argon2id$"), true)
+	})
+
+	t.Run("Exists missing", func(t *testing.T) {
+		b := newBackend(t)
+
+		exists, err := b.Users.Exists(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, exists, false)
+	})
+}
@@ -0,0 +1,241 @@
+package modelstest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/assert"
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+func testOrgs(t *testing.T, newBackend func(t *testing.T) *Backend) {
+	ctx := context.Background()
+
+	t.Run("Insert and Get", func(t *testing.T) {
+		b := newBackend(t)
+
+		ownerID := insertUser(t, b, "alice@example.com")
+
+		id, err := b.Orgs.Insert(ctx, "Acme", ownerID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		o, err := b.Orgs.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, o.ID, id)
+		assert.Equal(t, o.Name, "Acme")
+		assert.Equal(t, time.Since(o.Created) < time.Minute, true)
+
+		// The creator is the organization's owner.
+		role, err := b.Orgs.MemberRole(ctx, id, ownerID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, role, models.OrgRoleOwner)
+
+		members, err := b.Orgs.Members(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(members), 1)
+		assert.Equal(t, members[0].UserID, ownerID)
+
+		_, err = b.Orgs.Get(ctx, id+1)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("ListForUser", func(t *testing.T) {
+		b := newBackend(t)
+
+		alice := insertUser(t, b, "alice@example.com")
+		bob := insertUser(t, b, "bob@example.com")
+
+		zeta, err := b.Orgs.Insert(ctx, "Zeta", alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		acme, err := b.Orgs.Insert(ctx, "Acme", alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.Orgs.Insert(ctx, "Bob's org", bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		orgs, err := b.Orgs.ListForUser(ctx, alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(orgs), 2)
+		assert.Equal(t, orgs[0].ID, acme)
+		assert.Equal(t, orgs[1].ID, zeta)
+
+		_, err = b.Orgs.MemberRole(ctx, acme, bob)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("Invitations", func(t *testing.T) {
+		b := newBackend(t)
+
+		alice := insertUser(t, b, "alice@example.com")
+		bob := insertUser(t, b, "bob@example.com")
+
+		orgID, err := b.Orgs.Insert(ctx, "Acme", alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := b.Orgs.Invite(ctx, orgID, "bob@example.com", models.OrgRoleMember, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		inv, err := b.Orgs.GetInvitation(ctx, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, inv.OrgID, orgID)
+		assert.Equal(t, inv.Email, "bob@example.com")
+		assert.Equal(t, inv.Role, models.OrgRoleMember)
+
+		// Existing members can't use up someone else's invitation.
+		_, err = b.Orgs.AcceptInvitation(ctx, token, alice)
+		assert.Equal(t, errors.Is(err, models.ErrDuplicateMember), true)
+
+		acceptedID, err := b.Orgs.AcceptInvitation(ctx, token, bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, acceptedID, orgID)
+
+		role, err := b.Orgs.MemberRole(ctx, orgID, bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, role, models.OrgRoleMember)
+
+		members, err := b.Orgs.Members(ctx, orgID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(members), 2)
+
+		// Invitations can only be used once.
+		_, err = b.Orgs.GetInvitation(ctx, token)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		_, err = b.Orgs.AcceptInvitation(ctx, token, bob)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("Expired invitation", func(t *testing.T) {
+		b := newBackend(t)
+
+		alice := insertUser(t, b, "alice@example.com")
+		bob := insertUser(t, b, "bob@example.com")
+
+		orgID, err := b.Orgs.Insert(ctx, "Acme", alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := b.Orgs.Invite(ctx, orgID, "bob@example.com", models.OrgRoleMember, -time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.Orgs.GetInvitation(ctx, token)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		_, err = b.Orgs.AcceptInvitation(ctx, token, bob)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		_, err = b.Orgs.MemberRole(ctx, orgID, bob)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("Snippets", func(t *testing.T) {
+		b := newBackend(t)
+
+		alice := insertUser(t, b, "alice@example.com")
+
+		orgID, err := b.Orgs.Insert(ctx, "Acme", alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		public, err := b.Snippets.Insert(ctx, alice, orgID, "Public", "Content", models.VisibilityPublic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		private, err := b.Snippets.Insert(ctx, alice, orgID, "Members only", "Content", models.VisibilityOrg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.Snippets.Insert(ctx, alice, 0, "Personal", "Content", models.VisibilityPublic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := b.Snippets.Get(ctx, private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, s.OrgID, orgID)
+		assert.Equal(t, s.Visibility, models.VisibilityOrg)
+
+		// Snippets which only the members can see aren't in the latest snippets.
+		latest, err := b.Snippets.Latest(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(latest), 2)
+		for _, s := range latest {
+			assert.Equal(t, s.ID != private, true)
+		}
+
+		snippets, err := b.Snippets.ListForOrg(ctx, orgID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(snippets), 2)
+		assert.Equal(t, snippets[0].ID, private)
+		assert.Equal(t, snippets[1].ID, public)
+
+		// Changing the visibility takes the snippet off the home page.
+		err = b.Snippets.Update(ctx, public, "Public", "Content", models.VisibilityOrg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		latest, err = b.Snippets.Latest(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(latest), 1)
+
+		// Hidden and expired snippets are left out.
+		err = b.Snippets.SetHidden(ctx, public, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b.ExpireSnippet(t, private)
+
+		snippets, err = b.Snippets.ListForOrg(ctx, orgID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(snippets), 0)
+	})
+}
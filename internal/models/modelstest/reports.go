@@ -0,0 +1,143 @@
+package modelstest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"snippetbox.prajjmon.net/internal/assert"
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+func testReports(t *testing.T, newBackend func(t *testing.T) *Backend) {
+	ctx := context.Background()
+
+	// Creates a user and a snippet for them to report, and returns their IDs.
+	setup := func(t *testing.T, b *Backend) (userID, snippetID int) {
+		t.Helper()
+
+		userID = insertUser(t, b, "alice@example.com")
+
+		snippetID, err := b.Snippets.Insert(ctx, userID, 0, "Title", "Content", models.VisibilityPublic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return userID, snippetID
+	}
+
+	t.Run("Insert and count", func(t *testing.T) {
+		b := newBackend(t)
+		userID, snippetID := setup(t, b)
+
+		_, err := b.Reports.Insert(ctx, snippetID, userID, "192.0.2.1", "Spam")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A logged in user can't report the same snippet twice, even from somewhere else.
+		_, err = b.Reports.Insert(ctx, snippetID, userID, "192.0.2.2", "Still spam")
+		assert.Equal(t, errors.Is(err, models.ErrDuplicateReport), true)
+
+		// Anonymous reports from the same IP address as a logged in one are fine.
+		_, err = b.Reports.Insert(ctx, snippetID, 0, "192.0.2.1", "Spam")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// But not two from the same IP address.
+		_, err = b.Reports.Insert(ctx, snippetID, 0, "192.0.2.1", "Spam")
+		assert.Equal(t, errors.Is(err, models.ErrDuplicateReport), true)
+
+		_, err = b.Reports.Insert(ctx, snippetID, 0, "192.0.2.3", "Spam")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		count, err := b.Reports.CountOpen(ctx, snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, count, 3)
+
+		count, err = b.Reports.CountOpen(ctx, snippetID+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, count, 0)
+	})
+
+	t.Run("ListOpen and Resolve", func(t *testing.T) {
+		b := newBackend(t)
+		userID, snippetID := setup(t, b)
+
+		otherID, err := b.Snippets.Insert(ctx, userID, 0, "Other", "Content", models.VisibilityPublic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reports, err := b.Reports.ListOpen(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(reports), 0)
+
+		first, err := b.Reports.Insert(ctx, snippetID, userID, "192.0.2.1", "Spam")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		second, err := b.Reports.Insert(ctx, otherID, 0, "192.0.2.2", "Offensive")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reports, err = b.Reports.ListOpen(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(reports), 2)
+		assert.Equal(t, reports[0].ID, first)
+		assert.Equal(t, reports[0].SnippetID, snippetID)
+		assert.Equal(t, reports[0].ReporterID, userID)
+		assert.Equal(t, reports[0].ReporterIP, "192.0.2.1")
+		assert.Equal(t, reports[0].Reason, "Spam")
+		assert.Equal(t, reports[0].Created.IsZero(), false)
+		assert.Equal(t, reports[1].ID, second)
+		assert.Equal(t, reports[1].ReporterID, 0)
+
+		err = b.Reports.Resolve(ctx, snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reports, err = b.Reports.ListOpen(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(reports), 1)
+		assert.Equal(t, reports[0].ID, second)
+
+		// Once their report has been resolved, the same user can report the snippet again.
+		_, err = b.Reports.Insert(ctx, snippetID, userID, "192.0.2.1", "Spam again")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		count, err := b.Reports.CountOpen(ctx, snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, count, 1)
+	})
+
+	t.Run("Canceled context", func(t *testing.T) {
+		b := newBackend(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := b.Reports.ListOpen(ctx)
+		assert.Equal(t, errors.Is(err, models.ErrQueryCanceled), true)
+	})
+}
@@ -0,0 +1,217 @@
+package modelstest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/assert"
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+func testShareLinks(t *testing.T, newBackend func(t *testing.T) *Backend) {
+	ctx := context.Background()
+
+	newSnippet := func(t *testing.T, b *Backend) int {
+		userID := insertUser(t, b, "alice@example.com")
+
+		id, err := b.Snippets.Insert(ctx, userID, 0, "Private", "Content", models.VisibilityPrivate)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return id
+	}
+
+	t.Run("Use", func(t *testing.T) {
+		b := newBackend(t)
+		snippetID := newSnippet(t, b)
+
+		token, err := b.Links.Insert(ctx, snippetID, time.Hour, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 3; i++ {
+			id, err := b.Links.Use(ctx, token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, id, snippetID)
+		}
+
+		links, err := b.Links.ListForSnippet(ctx, snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(links), 1)
+		assert.Equal(t, links[0].SnippetID, snippetID)
+		assert.Equal(t, links[0].MaxViews, 0)
+		assert.Equal(t, links[0].Views, 3)
+		assert.Equal(t, links[0].Spent(), false)
+		assert.Equal(t, time.Until(links[0].Expiry) > 59*time.Minute, true)
+
+		// Tokens with the wrong secret, or for another link, don't work.
+		linkID, _, _ := models.ParseShareLinkToken(token)
+
+		for _, token := range []string{
+			"",
+			"nonsense",
+			models.FormatShareLinkToken(linkID, "wrong"),
+			models.FormatShareLinkToken(linkID+1, "wrong"),
+		} {
+			_, err = b.Links.Use(ctx, token)
+			assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+		}
+	})
+
+	t.Run("Check", func(t *testing.T) {
+		b := newBackend(t)
+		snippetID := newSnippet(t, b)
+
+		token, err := b.Links.Insert(ctx, snippetID, time.Hour, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Checking the token doesn't use up any of the link's views.
+		for i := 0; i < 3; i++ {
+			id, err := b.Links.Check(ctx, token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, id, snippetID)
+		}
+
+		links, err := b.Links.ListForSnippet(ctx, snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, links[0].Views, 0)
+
+		linkID, _, _ := models.ParseShareLinkToken(token)
+
+		_, err = b.Links.Check(ctx, models.FormatShareLinkToken(linkID, "wrong"))
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		// Once the link is spent, it fails the check too.
+		_, err = b.Links.Use(ctx, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.Links.Check(ctx, token)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("Max views", func(t *testing.T) {
+		b := newBackend(t)
+		snippetID := newSnippet(t, b)
+
+		token, err := b.Links.Insert(ctx, snippetID, time.Hour, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Concurrent requests can't use more views than the link allows.
+		var (
+			wg   sync.WaitGroup
+			mu   sync.Mutex
+			used int
+		)
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				_, err := b.Links.Use(ctx, token)
+				if err == nil {
+					mu.Lock()
+					used++
+					mu.Unlock()
+				} else if !errors.Is(err, models.ErrNoRecord) {
+					t.Error(err)
+				}
+			}()
+		}
+
+		wg.Wait()
+		assert.Equal(t, used, 5)
+
+		links, err := b.Links.ListForSnippet(ctx, snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, links[0].Views, 5)
+		assert.Equal(t, links[0].Spent(), true)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		b := newBackend(t)
+		snippetID := newSnippet(t, b)
+
+		token, err := b.Links.Insert(ctx, snippetID, -time.Second, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.Links.Use(ctx, token)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		links, err := b.Links.ListForSnippet(ctx, snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, links[0].Views, 0)
+		assert.Equal(t, links[0].Spent(), true)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		b := newBackend(t)
+		snippetID := newSnippet(t, b)
+
+		first, err := b.Links.Insert(ctx, snippetID, time.Hour, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.Links.Insert(ctx, snippetID, time.Hour, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The newest link comes first.
+		links, err := b.Links.ListForSnippet(ctx, snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(links), 2)
+
+		firstID, _, _ := models.ParseShareLinkToken(first)
+		assert.Equal(t, links[1].ID, firstID)
+
+		// Links can only be revoked through the snippet they belong to.
+		err = b.Links.Delete(ctx, snippetID+1, firstID)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		err = b.Links.Delete(ctx, snippetID, firstID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.Links.Use(ctx, first)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		err = b.Links.Delete(ctx, snippetID, firstID)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		links, err = b.Links.ListForSnippet(ctx, snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(links), 1)
+	})
+}
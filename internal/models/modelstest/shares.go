@@ -0,0 +1,126 @@
+package modelstest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/assert"
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+func testShares(t *testing.T, newBackend func(t *testing.T) *Backend) {
+	ctx := context.Background()
+
+	t.Run("Set and Get", func(t *testing.T) {
+		b := newBackend(t)
+
+		alice := insertUser(t, b, "alice@example.com")
+		bob := insertUser(t, b, "bob@example.com")
+
+		snippetID, err := b.Snippets.Insert(ctx, alice, 0, "Private", "Content", models.VisibilityPrivate)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Private snippets aren't in the latest snippets.
+		latest, err := b.Snippets.Latest(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(latest), 0)
+
+		_, err = b.Shares.Get(ctx, snippetID, bob)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		err = b.Shares.Set(ctx, snippetID, bob, models.ShareView)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		permission, err := b.Shares.Get(ctx, snippetID, bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, permission, models.ShareView)
+
+		// Sharing it again changes the permission.
+		err = b.Shares.Set(ctx, snippetID, bob, models.ShareEdit)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		shares, err := b.Shares.ListForSnippet(ctx, snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(shares), 1)
+		assert.Equal(t, shares[0].UserID, bob)
+		assert.Equal(t, shares[0].Permission, models.ShareEdit)
+		assert.Equal(t, time.Since(shares[0].Created) < time.Minute, true)
+
+		err = b.Shares.Delete(ctx, snippetID, bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.Shares.Get(ctx, snippetID, bob)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		err = b.Shares.Delete(ctx, snippetID, bob)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("Lists", func(t *testing.T) {
+		b := newBackend(t)
+
+		alice := insertUser(t, b, "alice@example.com")
+		bob := insertUser(t, b, "bob@example.com")
+		carol := insertUser(t, b, "carol@example.com")
+
+		var ids []int
+		for i := 0; i < 2; i++ {
+			id, err := b.Snippets.Insert(ctx, alice, 0, "Private", "Content", models.VisibilityPrivate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+
+		for _, share := range []models.Share{
+			{SnippetID: ids[0], UserID: bob, Permission: models.ShareView},
+			{SnippetID: ids[0], UserID: carol, Permission: models.ShareEdit},
+			{SnippetID: ids[1], UserID: bob, Permission: models.ShareEdit},
+		} {
+			err := b.Shares.Set(ctx, share.SnippetID, share.UserID, share.Permission)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		shares, err := b.Shares.ListForSnippet(ctx, ids[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(shares), 2)
+		assert.Equal(t, shares[0].UserID, bob)
+		assert.Equal(t, shares[1].UserID, carol)
+
+		// The most recently shared snippet comes first.
+		shares, err = b.Shares.ListForUser(ctx, bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(shares), 2)
+		assert.Equal(t, shares[0].SnippetID, ids[1])
+		assert.Equal(t, shares[0].Permission, models.ShareEdit)
+		assert.Equal(t, shares[1].SnippetID, ids[0])
+
+		shares, err = b.Shares.ListForUser(ctx, alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(shares), 0)
+	})
+}
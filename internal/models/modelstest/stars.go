@@ -0,0 +1,177 @@
+package modelstest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/assert"
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+func testStars(t *testing.T, newBackend func(t *testing.T) *Backend) {
+	ctx := context.Background()
+
+	t.Run("Insert, Exists and Delete", func(t *testing.T) {
+		b := newBackend(t)
+
+		alice := insertUser(t, b, "alice@example.com")
+		bob := insertUser(t, b, "bob@example.com")
+
+		snippetID, err := b.Snippets.Insert(ctx, alice, 0, "Title", "Content", models.VisibilityPublic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = b.Stars.Insert(ctx, bob, snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		exists, err := b.Stars.Exists(ctx, bob, snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, exists, true)
+
+		exists, err = b.Stars.Exists(ctx, alice, snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, exists, false)
+
+		// Each user can only star a snippet once.
+		err = b.Stars.Insert(ctx, bob, snippetID)
+		assert.Equal(t, errors.Is(err, models.ErrDuplicateStar), true)
+
+		err = b.Stars.Insert(ctx, alice, snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		count, err := b.Stars.Count(ctx, snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, count, 2)
+
+		err = b.Stars.Delete(ctx, bob, snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = b.Stars.Delete(ctx, bob, snippetID)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		exists, err = b.Stars.Exists(ctx, bob, snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, exists, false)
+
+		count, err = b.Stars.Count(ctx, snippetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, count, 1)
+
+		// Unstarring lets the user star the snippet again.
+		err = b.Stars.Insert(ctx, bob, snippetID)
+		assert.Equal(t, err, nil)
+	})
+
+	t.Run("ListForUser", func(t *testing.T) {
+		b := newBackend(t)
+
+		alice := insertUser(t, b, "alice@example.com")
+		bob := insertUser(t, b, "bob@example.com")
+
+		var ids []int
+		for i := 0; i < 3; i++ {
+			id, err := b.Snippets.Insert(ctx, alice, 0, "Title", "Content", models.VisibilityPublic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+
+		for _, id := range ids[:2] {
+			err := b.Stars.Insert(ctx, bob, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err := b.Stars.Insert(ctx, alice, ids[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stars, err := b.Stars.ListForUser(ctx, bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(stars), 2)
+		assert.Equal(t, stars[0].SnippetID, ids[1])
+		assert.Equal(t, stars[1].SnippetID, ids[0])
+		assert.Equal(t, stars[0].UserID, bob)
+		assert.Equal(t, time.Since(stars[0].Created) < time.Minute, true)
+
+		stars, err = b.Stars.ListForUser(ctx, insertUser(t, b, "carol@example.com"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(stars), 0)
+	})
+
+	t.Run("MostStarred", func(t *testing.T) {
+		b := newBackend(t)
+
+		alice := insertUser(t, b, "alice@example.com")
+		bob := insertUser(t, b, "bob@example.com")
+		carol := insertUser(t, b, "carol@example.com")
+
+		var ids []int
+		for i := 0; i < 3; i++ {
+			id, err := b.Snippets.Insert(ctx, alice, 0, "Title", "Content", models.VisibilityPublic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+
+		stars := map[int][]int{
+			ids[0]: {alice},
+			ids[1]: {alice, bob, carol},
+			ids[2]: {bob},
+		}
+		for snippetID, userIDs := range stars {
+			for _, userID := range userIDs {
+				err := b.Stars.Insert(ctx, userID, snippetID)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		weekAgo := time.Now().Add(-7 * 24 * time.Hour)
+
+		starred, err := b.Stars.MostStarred(ctx, weekAgo, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Ties are broken by snippet ID.
+		assert.Equal(t, len(starred), 2)
+		assert.Equal(t, starred[0], models.SnippetStars{SnippetID: ids[1], Stars: 3})
+		assert.Equal(t, starred[1], models.SnippetStars{SnippetID: ids[0], Stars: 1})
+
+		// Stars given before the cut-off aren't counted.
+		starred, err = b.Stars.MostStarred(ctx, time.Now().Add(time.Hour), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(starred), 0)
+	})
+}
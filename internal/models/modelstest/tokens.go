@@ -0,0 +1,110 @@
+package modelstest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/assert"
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+func testTokens(t *testing.T, newBackend func(t *testing.T) *Backend) {
+	ctx := context.Background()
+
+	t.Run("Lookup and consume", func(t *testing.T) {
+		b := newBackend(t)
+		userID := insertUser(t, b, "alice@example.com")
+
+		token, err := b.Tokens.New(ctx, userID, time.Hour, models.ScopePasswordReset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Looking a token up doesn't use it.
+		for i := 0; i < 2; i++ {
+			id, err := b.Tokens.GetUserID(ctx, token, models.ScopePasswordReset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, id, userID)
+		}
+
+		id, err := b.Tokens.Consume(ctx, token, models.ScopePasswordReset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, id, userID)
+
+		// But consuming it does.
+		_, err = b.Tokens.Consume(ctx, token, models.ScopePasswordReset)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		_, err = b.Tokens.GetUserID(ctx, token, models.ScopePasswordReset)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("Wrong scope", func(t *testing.T) {
+		b := newBackend(t)
+		userID := insertUser(t, b, "alice@example.com")
+
+		token, err := b.Tokens.New(ctx, userID, time.Hour, models.ScopePasswordReset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.Tokens.Consume(ctx, token, "some-other-scope")
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		b := newBackend(t)
+		userID := insertUser(t, b, "alice@example.com")
+
+		token, err := b.Tokens.New(ctx, userID, -time.Second, models.ScopePasswordReset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.Tokens.GetUserID(ctx, token, models.ScopePasswordReset)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		_, err = b.Tokens.Consume(ctx, token, models.ScopePasswordReset)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("Unknown token", func(t *testing.T) {
+		b := newBackend(t)
+
+		_, err := b.Tokens.GetUserID(ctx, "not-a-real-token", models.ScopePasswordReset)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("DeleteAllForUser", func(t *testing.T) {
+		b := newBackend(t)
+		alice := insertUser(t, b, "alice@example.com")
+		bob := insertUser(t, b, "bob@example.com")
+
+		aliceToken, err := b.Tokens.New(ctx, alice, time.Hour, models.ScopePasswordReset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bobToken, err := b.Tokens.New(ctx, bob, time.Hour, models.ScopePasswordReset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = b.Tokens.DeleteAllForUser(ctx, alice, models.ScopePasswordReset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.Tokens.GetUserID(ctx, aliceToken, models.ScopePasswordReset)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		_, err = b.Tokens.GetUserID(ctx, bobToken, models.ScopePasswordReset)
+		assert.Equal(t, err, nil)
+	})
+}
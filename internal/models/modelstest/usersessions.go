@@ -0,0 +1,149 @@
+package modelstest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/assert"
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+func testUserSessions(t *testing.T, newBackend func(t *testing.T) *Backend) {
+	ctx := context.Background()
+
+	t.Run("Insert and Get", func(t *testing.T) {
+		b := newBackend(t)
+
+		userID := insertUser(t, b, "alice@example.com")
+
+		id, err := b.UserSessions.Insert(ctx, userID, "192.0.2.1", "Firefox", time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := b.UserSessions.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, s.ID, id)
+		assert.Equal(t, s.UserID, userID)
+		assert.Equal(t, s.IP, "192.0.2.1")
+		assert.Equal(t, s.UserAgent, "Firefox")
+		assert.Equal(t, time.Since(s.Created) < time.Minute, true)
+		assert.Equal(t, time.Since(s.LastSeen) < time.Minute, true)
+		assert.Equal(t, time.Until(s.Expires) > 59*time.Minute, true)
+
+		_, err = b.UserSessions.Get(ctx, "missing")
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		b := newBackend(t)
+
+		userID := insertUser(t, b, "alice@example.com")
+
+		id, err := b.UserSessions.Insert(ctx, userID, "192.0.2.1", "Firefox", time.Now().Add(-time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.UserSessions.Get(ctx, id)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		sessions, err := b.UserSessions.ListForUser(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(sessions), 0)
+	})
+
+	t.Run("Touch", func(t *testing.T) {
+		b := newBackend(t)
+
+		userID := insertUser(t, b, "alice@example.com")
+
+		id, err := b.UserSessions.Insert(ctx, userID, "192.0.2.1", "Firefox", time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = b.UserSessions.Touch(ctx, id, "198.51.100.7", "Chrome")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := b.UserSessions.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, s.IP, "198.51.100.7")
+		assert.Equal(t, s.UserAgent, "Chrome")
+
+		err = b.UserSessions.Touch(ctx, "missing", "192.0.2.1", "Firefox")
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	})
+
+	t.Run("List and revoke", func(t *testing.T) {
+		b := newBackend(t)
+
+		aliceID := insertUser(t, b, "alice@example.com")
+		bobID := insertUser(t, b, "bob@example.com")
+
+		var ids []string
+		for i := 0; i < 3; i++ {
+			id, err := b.UserSessions.Insert(ctx, aliceID, "192.0.2.1", "Firefox", time.Now().Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+
+		bobSession, err := b.UserSessions.Insert(ctx, bobID, "192.0.2.2", "Safari", time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The most recently used session comes first.
+		err = b.UserSessions.Touch(ctx, ids[1], "192.0.2.1", "Firefox")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sessions, err := b.UserSessions.ListForUser(ctx, aliceID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(sessions), 3)
+		assert.Equal(t, sessions[0].ID, ids[1])
+
+		// Users can only revoke their own sessions.
+		err = b.UserSessions.Delete(ctx, aliceID, bobSession)
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		err = b.UserSessions.Delete(ctx, aliceID, ids[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = b.UserSessions.Get(ctx, ids[0])
+		assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+		err = b.UserSessions.DeleteAllForUser(ctx, aliceID, ids[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sessions, err = b.UserSessions.ListForUser(ctx, aliceID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(sessions), 1)
+		assert.Equal(t, sessions[0].ID, ids[2])
+
+		_, err = b.UserSessions.Get(ctx, bobSession)
+		assert.Equal(t, err, nil)
+	})
+}
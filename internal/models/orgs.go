@@ -0,0 +1,291 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// A member's role in an organization. Owners can invite people; every member can create and
+// edit the organization's snippets.
+type OrgRole string
+
+const (
+	OrgRoleOwner  OrgRole = "owner"
+	OrgRoleMember OrgRole = "member"
+)
+
+// Reports whether r is one of the known organization roles.
+func (r OrgRole) Valid() bool {
+	return r == OrgRoleOwner || r == OrgRoleMember
+}
+
+// A group of users who share ownership of snippets.
+type Org struct {
+	ID      int
+	Name    string
+	Created time.Time
+}
+
+type OrgMember struct {
+	UserID int
+	Role   OrgRole
+	Joined time.Time
+}
+
+// An outstanding invitation for whoever owns the email address to join an organization.
+type OrgInvitation struct {
+	OrgID  int
+	Email  string
+	Role   OrgRole
+	Expiry time.Time
+}
+
+type OrgModelInterface interface {
+	Insert(ctx context.Context, name string, ownerID int) (int, error)
+	Get(ctx context.Context, id int) (Org, error)
+	ListForUser(ctx context.Context, userID int) ([]Org, error)
+	MemberRole(ctx context.Context, orgID, userID int) (OrgRole, error)
+	Members(ctx context.Context, orgID int) ([]OrgMember, error)
+	Invite(ctx context.Context, orgID int, email string, role OrgRole, ttl time.Duration) (string, error)
+	GetInvitation(ctx context.Context, token string) (OrgInvitation, error)
+	AcceptInvitation(ctx context.Context, token string, userID int) (int, error)
+}
+
+type OrgModel struct {
+	DbPool *pgxpool.Pool
+
+	// The deadline applied to each query. If zero, DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Creates an organization with the given user as its only owner, and returns its ID.
+func (m *OrgModel) Insert(ctx context.Context, name string, ownerID int) (int, error) {
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DbPool.Begin(ctx)
+	if err != nil {
+		return 0, TranslateContextError(ctx, err)
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	err = tx.QueryRow(ctx, "INSERT INTO orgs (name, created_at) VALUES($1, NOW()) RETURNING id", name).Scan(&id)
+	if err != nil {
+		return 0, TranslateContextError(ctx, err)
+	}
+
+	stmt := "INSERT INTO org_members (org_id, user_id, role, joined_at) VALUES($1, $2, $3, NOW())"
+
+	_, err = tx.Exec(ctx, stmt, id, ownerID, OrgRoleOwner)
+	if err != nil {
+		return 0, TranslateContextError(ctx, err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, TranslateContextError(ctx, err)
+	}
+
+	return id, nil
+}
+
+func (m *OrgModel) Get(ctx context.Context, id int) (Org, error) {
+	var o Org
+
+	stmt := "SELECT id, name, created_at FROM orgs WHERE id = $1"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, stmt, id).Scan(&o.ID, &o.Name, &o.Created)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Org{}, ErrNoRecord
+		}
+		return Org{}, TranslateContextError(ctx, err)
+	}
+
+	return o, nil
+}
+
+// Returns the organizations which the user belongs to, in name order.
+func (m *OrgModel) ListForUser(ctx context.Context, userID int) ([]Org, error) {
+	stmt := `SELECT o.id, o.name, o.created_at FROM orgs o
+	JOIN org_members om ON om.org_id = o.id
+	WHERE om.user_id = $1
+	ORDER BY o.name, o.id`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DbPool.Query(ctx, stmt, userID)
+	if err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var orgs []Org
+
+	for rows.Next() {
+		var o Org
+		err = rows.Scan(&o.ID, &o.Name, &o.Created)
+		if err != nil {
+			return nil, TranslateContextError(ctx, err)
+		}
+
+		orgs = append(orgs, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	return orgs, nil
+}
+
+// Returns the user's role in the organization, or ErrNoRecord if they aren't a member.
+func (m *OrgModel) MemberRole(ctx context.Context, orgID, userID int) (OrgRole, error) {
+	var role OrgRole
+
+	stmt := "SELECT role FROM org_members WHERE org_id = $1 AND user_id = $2"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, stmt, orgID, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrNoRecord
+		}
+		return "", TranslateContextError(ctx, err)
+	}
+
+	return role, nil
+}
+
+// Returns the members of the organization, in the order that they joined.
+func (m *OrgModel) Members(ctx context.Context, orgID int) ([]OrgMember, error) {
+	stmt := "SELECT user_id, role, joined_at FROM org_members WHERE org_id = $1 ORDER BY joined_at, user_id"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DbPool.Query(ctx, stmt, orgID)
+	if err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var members []OrgMember
+
+	for rows.Next() {
+		var om OrgMember
+		err = rows.Scan(&om.UserID, &om.Role, &om.Joined)
+		if err != nil {
+			return nil, TranslateContextError(ctx, err)
+		}
+
+		members = append(members, om)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	return members, nil
+}
+
+// Creates an invitation to join the organization with the given role, which expires after
+// ttl, and returns its token. Like the tokens in TokenModel, only a hash of it is stored.
+func (m *OrgModel) Invite(ctx context.Context, orgID int, email string, role OrgRole, ttl time.Duration) (string, error) {
+	plaintext, hash, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	stmt := "INSERT INTO org_invitations (hash, org_id, email, role, expiry) VALUES($1, $2, $3, $4, $5)"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	_, err = m.DbPool.Exec(ctx, stmt, hash, orgID, email, role, time.Now().Add(ttl))
+	if err != nil {
+		return "", TranslateContextError(ctx, err)
+	}
+
+	return plaintext, nil
+}
+
+// Returns the unexpired invitation with the given token, without using it up.
+func (m *OrgModel) GetInvitation(ctx context.Context, token string) (OrgInvitation, error) {
+	var inv OrgInvitation
+
+	stmt := "SELECT org_id, email, role, expiry FROM org_invitations WHERE hash = $1 AND expiry > NOW()"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, stmt, HashToken(token)).Scan(&inv.OrgID, &inv.Email, &inv.Role, &inv.Expiry)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return OrgInvitation{}, ErrNoRecord
+		}
+		return OrgInvitation{}, TranslateContextError(ctx, err)
+	}
+
+	return inv, nil
+}
+
+// Uses up an invitation, adding the user to the organization, and returns the organization's
+// ID. ErrNoRecord is returned if the invitation doesn't exist or has expired, and
+// ErrDuplicateMember if the user already belongs to the organization (in which case the
+// invitation is left alone).
+func (m *OrgModel) AcceptInvitation(ctx context.Context, token string, userID int) (int, error) {
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DbPool.Begin(ctx)
+	if err != nil {
+		return 0, TranslateContextError(ctx, err)
+	}
+	defer tx.Rollback(ctx)
+
+	var orgID int
+	var role OrgRole
+
+	stmt := "DELETE FROM org_invitations WHERE hash = $1 AND expiry > NOW() RETURNING org_id, role"
+
+	err = tx.QueryRow(ctx, stmt, HashToken(token)).Scan(&orgID, &role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, TranslateContextError(ctx, err)
+	}
+
+	stmt = `INSERT INTO org_members (org_id, user_id, role, joined_at) VALUES($1, $2, $3, NOW())
+	ON CONFLICT (org_id, user_id) DO NOTHING`
+
+	tag, err := tx.Exec(ctx, stmt, orgID, userID, role)
+	if err != nil {
+		return 0, TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return 0, ErrDuplicateMember
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, TranslateContextError(ctx, err)
+	}
+
+	return orgID, nil
+}
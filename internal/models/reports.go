@@ -0,0 +1,139 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// A complaint about a snippet, which stays open until a moderator deals with it. Anyone can
+// make a report, so ReporterID is 0 if the reporter wasn't logged in. The IP address is
+// recorded either way.
+type Report struct {
+	ID         int
+	SnippetID  int
+	ReporterID int
+	ReporterIP string
+	Reason     string
+	Created    time.Time
+}
+
+type ReportModelInterface interface {
+	Insert(ctx context.Context, snippetID, reporterID int, reporterIP, reason string) (int, error)
+	CountOpen(ctx context.Context, snippetID int) (int, error)
+	ListOpen(ctx context.Context) ([]Report, error)
+	Resolve(ctx context.Context, snippetID int) error
+}
+
+type ReportModel struct {
+	DbPool *pgxpool.Pool
+
+	// The deadline applied to each query. If zero, DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Records a report and returns its ID. Each reporter can only have one open report for a
+// snippet, so that nobody can get a snippet hidden on their own. Logged in reporters are told
+// apart by their user ID, and anonymous ones by their IP address. ErrDuplicateReport is
+// returned if the reporter has already reported the snippet.
+func (m *ReportModel) Insert(ctx context.Context, snippetID, reporterID int, reporterIP, reason string) (int, error) {
+	stmt := `INSERT INTO reports (snippet_id, reporter_id, reporter_ip, reason, created)
+	VALUES($1, NULLIF($2, 0), $3, $4, NOW()) RETURNING id`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	var id int
+	err := m.DbPool.QueryRow(ctx, stmt, snippetID, reporterID, reporterIP, reason).Scan(&id)
+	if err != nil {
+		if isDuplicateReport(err) {
+			return 0, ErrDuplicateReport
+		}
+		return 0, TranslateContextError(ctx, err)
+	}
+
+	return id, nil
+}
+
+// Returns the number of open reports for the snippet.
+func (m *ReportModel) CountOpen(ctx context.Context, snippetID int) (int, error) {
+	var count int
+
+	stmt := "SELECT COUNT(*) FROM reports WHERE snippet_id = $1 AND NOT resolved"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, stmt, snippetID).Scan(&count)
+	if err != nil {
+		return 0, TranslateContextError(ctx, err)
+	}
+
+	return count, nil
+}
+
+// Returns every open report, oldest first.
+func (m *ReportModel) ListOpen(ctx context.Context) ([]Report, error) {
+	stmt := `SELECT id, snippet_id, COALESCE(reporter_id, 0), reporter_ip, reason, created FROM reports
+	WHERE NOT resolved
+	ORDER BY id`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DbPool.Query(ctx, stmt)
+	if err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var reports []Report
+
+	for rows.Next() {
+		var r Report
+		err = rows.Scan(&r.ID, &r.SnippetID, &r.ReporterID, &r.ReporterIP, &r.Reason, &r.Created)
+		if err != nil {
+			return nil, TranslateContextError(ctx, err)
+		}
+
+		reports = append(reports, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	return reports, nil
+}
+
+// Closes all of the open reports for the snippet, once a moderator has dealt with them. The
+// reports are kept, but the same people can report the snippet again afterwards.
+func (m *ReportModel) Resolve(ctx context.Context, snippetID int) error {
+	stmt := "UPDATE reports SET resolved = true WHERE snippet_id = $1 AND NOT resolved"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	_, err := m.DbPool.Exec(ctx, stmt, snippetID)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
+
+// Reports whether err is a violation of one of the unique indexes which stop people from
+// reporting the same snippet twice.
+func isDuplicateReport(err error) bool {
+	var postgresError *pgconn.PgError
+	if errors.As(err, &postgresError) {
+		return postgresError.Code == "23505" && strings.HasPrefix(postgresError.ConstraintName, "reports_open_")
+	}
+
+	return false
+}
@@ -0,0 +1,229 @@
+package models
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// A link which lets anyone who has it see a snippet, whoever can normally see it. Links
+// expire, can be limited to a number of views and can be revoked by deleting them.
+type ShareLink struct {
+	ID        int
+	SnippetID int
+	Created   time.Time
+	Expiry    time.Time
+
+	// The number of times the link can be used, or zero if there's no limit.
+	MaxViews int
+	Views    int
+}
+
+// Reports whether the link can't be used any more, because it has expired or all of its
+// views have been used up.
+func (l ShareLink) Spent() bool {
+	return !time.Now().Before(l.Expiry) || (l.MaxViews > 0 && l.Views >= l.MaxViews)
+}
+
+// A share link's token is its ID followed by a random secret. Only a hash of the secret is
+// stored, in the same way as other tokens, so the ID is needed to find the link's hash
+// without searching by a value that the client controls.
+func FormatShareLinkToken(id int, secret string) string {
+	return strconv.Itoa(id) + "." + secret
+}
+
+// Splits a share link's token into the link's ID and its secret.
+func ParseShareLinkToken(token string) (id int, secret string, ok bool) {
+	idStr, secret, ok := strings.Cut(token, ".")
+	if !ok || secret == "" {
+		return 0, "", false
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id < 1 {
+		return 0, "", false
+	}
+
+	return id, secret, true
+}
+
+// Reports whether secret matches the stored hash. The comparison takes the same time however
+// much of the hash matches, so it can't be used to work out the secret a byte at a time.
+func CheckShareLinkSecret(secret string, hash []byte) bool {
+	return subtle.ConstantTimeCompare(HashToken(secret), hash) == 1
+}
+
+type ShareLinkModelInterface interface {
+	Insert(ctx context.Context, snippetID int, ttl time.Duration, maxViews int) (string, error)
+	ListForSnippet(ctx context.Context, snippetID int) ([]ShareLink, error)
+	Check(ctx context.Context, token string) (int, error)
+	Use(ctx context.Context, token string) (int, error)
+	Delete(ctx context.Context, snippetID, id int) error
+}
+
+type ShareLinkModel struct {
+	DbPool *pgxpool.Pool
+
+	// The deadline applied to each query. If zero, DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Creates a link to the snippet which expires after ttl and can be used maxViews times (or
+// any number of times if maxViews is zero). Returns the link's token.
+func (m *ShareLinkModel) Insert(ctx context.Context, snippetID int, ttl time.Duration, maxViews int) (string, error) {
+	secret, hash, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	var id int
+
+	stmt := `INSERT INTO share_links (snippet_id, hash, created_at, expiry, max_views, views)
+	VALUES($1, $2, NOW(), $3, $4, 0) RETURNING id`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err = m.DbPool.QueryRow(ctx, stmt, snippetID, hash, time.Now().Add(ttl), maxViews).Scan(&id)
+	if err != nil {
+		return "", TranslateContextError(ctx, err)
+	}
+
+	return FormatShareLinkToken(id, secret), nil
+}
+
+// Returns all of the snippet's links, including spent ones, newest first.
+func (m *ShareLinkModel) ListForSnippet(ctx context.Context, snippetID int) ([]ShareLink, error) {
+	stmt := `SELECT id, snippet_id, created_at, expiry, max_views, views FROM share_links
+	WHERE snippet_id = $1
+	ORDER BY id DESC`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DbPool.Query(ctx, stmt, snippetID)
+	if err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var links []ShareLink
+
+	for rows.Next() {
+		var l ShareLink
+		err = rows.Scan(&l.ID, &l.SnippetID, &l.Created, &l.Expiry, &l.MaxViews, &l.Views)
+		if err != nil {
+			return nil, TranslateContextError(ctx, err)
+		}
+
+		links = append(links, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	return links, nil
+}
+
+// Checks the token without counting a view of the link, returning the ID of the snippet that
+// it's for. ErrNoRecord is returned in the same cases as Use.
+func (m *ShareLinkModel) Check(ctx context.Context, token string) (int, error) {
+	id, secret, ok := ParseShareLinkToken(token)
+	if !ok {
+		return 0, ErrNoRecord
+	}
+
+	var snippetID int
+	var hash []byte
+
+	stmt := `SELECT snippet_id, hash FROM share_links
+	WHERE id = $1 AND expiry > NOW() AND (max_views = 0 OR views < max_views)`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, stmt, id).Scan(&snippetID, &hash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, TranslateContextError(ctx, err)
+	}
+
+	if !CheckShareLinkSecret(secret, hash) {
+		return 0, ErrNoRecord
+	}
+
+	return snippetID, nil
+}
+
+// Checks the token and counts a view of the link, returning the ID of the snippet that it's
+// for. ErrNoRecord is returned if the token is invalid or the link has been revoked, has
+// expired or has no views left. The view is counted by a single conditional update, so
+// concurrent requests can't use the link more times than it allows.
+func (m *ShareLinkModel) Use(ctx context.Context, token string) (int, error) {
+	id, secret, ok := ParseShareLinkToken(token)
+	if !ok {
+		return 0, ErrNoRecord
+	}
+
+	var hash []byte
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, "SELECT hash FROM share_links WHERE id = $1", id).Scan(&hash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, TranslateContextError(ctx, err)
+	}
+
+	if !CheckShareLinkSecret(secret, hash) {
+		return 0, ErrNoRecord
+	}
+
+	var snippetID int
+
+	stmt := `UPDATE share_links SET views = views + 1
+	WHERE id = $1 AND expiry > NOW() AND (max_views = 0 OR views < max_views)
+	RETURNING snippet_id`
+
+	err = m.DbPool.QueryRow(ctx, stmt, id).Scan(&snippetID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, TranslateContextError(ctx, err)
+	}
+
+	return snippetID, nil
+}
+
+// Revokes one of the snippet's links. Returns ErrNoRecord if the snippet has no such link.
+func (m *ShareLinkModel) Delete(ctx context.Context, snippetID, id int) error {
+	stmt := "DELETE FROM share_links WHERE id = $1 AND snippet_id = $2"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, id, snippetID)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
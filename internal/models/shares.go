@@ -0,0 +1,152 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// What someone that a snippet has been shared with is allowed to do with it.
+type SharePermission string
+
+const (
+	ShareView SharePermission = "view"
+	ShareEdit SharePermission = "edit"
+)
+
+// Reports whether p is one of the known permissions.
+func (p SharePermission) Valid() bool {
+	return p == ShareView || p == ShareEdit
+}
+
+// An entry in a snippet's access-control list, which lets a user see (or edit) the snippet
+// whatever its visibility.
+type Share struct {
+	SnippetID  int
+	UserID     int
+	Permission SharePermission
+	Created    time.Time
+}
+
+type ShareModelInterface interface {
+	Set(ctx context.Context, snippetID, userID int, permission SharePermission) error
+	Get(ctx context.Context, snippetID, userID int) (SharePermission, error)
+	ListForSnippet(ctx context.Context, snippetID int) ([]Share, error)
+	ListForUser(ctx context.Context, userID int) ([]Share, error)
+	Delete(ctx context.Context, snippetID, userID int) error
+}
+
+type ShareModel struct {
+	DbPool *pgxpool.Pool
+
+	// The deadline applied to each query. If zero, DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Shares the snippet with the user, or changes their permission if it has already been
+// shared with them.
+func (m *ShareModel) Set(ctx context.Context, snippetID, userID int, permission SharePermission) error {
+	stmt := `INSERT INTO snippet_shares (snippet_id, user_id, permission, created_at) VALUES($1, $2, $3, NOW())
+		ON CONFLICT (snippet_id, user_id) DO UPDATE SET permission = EXCLUDED.permission`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	_, err := m.DbPool.Exec(ctx, stmt, snippetID, userID, permission)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
+
+// Returns the user's permission for the snippet, or ErrNoRecord if it hasn't been shared
+// with them.
+func (m *ShareModel) Get(ctx context.Context, snippetID, userID int) (SharePermission, error) {
+	var permission SharePermission
+
+	stmt := "SELECT permission FROM snippet_shares WHERE snippet_id = $1 AND user_id = $2"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, stmt, snippetID, userID).Scan(&permission)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrNoRecord
+		}
+		return "", TranslateContextError(ctx, err)
+	}
+
+	return permission, nil
+}
+
+// Returns everyone the snippet has been shared with, in the order it was shared with them.
+func (m *ShareModel) ListForSnippet(ctx context.Context, snippetID int) ([]Share, error) {
+	stmt := `SELECT snippet_id, user_id, permission, created_at FROM snippet_shares
+	WHERE snippet_id = $1
+	ORDER BY created_at, user_id`
+
+	return m.list(ctx, stmt, snippetID)
+}
+
+// Returns the snippets which have been shared with the user, most recently shared first.
+func (m *ShareModel) ListForUser(ctx context.Context, userID int) ([]Share, error) {
+	stmt := `SELECT snippet_id, user_id, permission, created_at FROM snippet_shares
+	WHERE user_id = $1
+	ORDER BY created_at DESC, snippet_id DESC`
+
+	return m.list(ctx, stmt, userID)
+}
+
+func (m *ShareModel) list(ctx context.Context, stmt string, args ...any) ([]Share, error) {
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DbPool.Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var shares []Share
+
+	for rows.Next() {
+		var s Share
+		err = rows.Scan(&s.SnippetID, &s.UserID, &s.Permission, &s.Created)
+		if err != nil {
+			return nil, TranslateContextError(ctx, err)
+		}
+
+		shares = append(shares, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	return shares, nil
+}
+
+// Stops sharing the snippet with the user. Returns ErrNoRecord if it wasn't shared with them.
+func (m *ShareModel) Delete(ctx context.Context, snippetID, userID int) error {
+	stmt := "DELETE FROM snippet_shares WHERE snippet_id = $1 AND user_id = $2"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, snippetID, userID)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
@@ -10,9 +10,16 @@ import (
 )
 
 type SnippetModelInterface interface {
-	Insert(title, content string) (int, error)
-	Get(id int) (Snippet, error)
-	Latest() ([]Snippet, error)
+	Insert(ctx context.Context, userID, orgID int, title, content string, visibility Visibility) (int, error)
+	Get(ctx context.Context, id int) (Snippet, error)
+	Update(ctx context.Context, id int, title, content string, visibility Visibility) error
+	Latest(ctx context.Context) ([]Snippet, error)
+	ListForOrg(ctx context.Context, orgID int) ([]Snippet, error)
+	Counts(ctx context.Context) (SnippetCounts, error)
+	TopCreators(ctx context.Context, limit int) ([]SnippetCreator, error)
+	Expire(ctx context.Context, id int) error
+	Delete(ctx context.Context, id int) error
+	SetHidden(ctx context.Context, id int, hidden bool) error
 }
 
 type Snippet struct {
@@ -21,32 +28,86 @@ type Snippet struct {
 	Content string
 	Created time.Time
 	Expires time.Time
+
+	// The user who created the snippet, and the organization which owns it (or 0 if it
+	// belongs to the user alone).
+	UserID int
+	OrgID  int
+
+	Visibility Visibility
+
+	// Hidden snippets have been taken down pending review by a moderator. They are left out
+	// of the latest snippets, but Get still returns them so that the caller can decide what to
+	// do with them.
+	Hidden bool
+}
+
+// Who can see a snippet.
+type Visibility string
+
+const (
+	// Anyone can see the snippet, and it's listed on the home page.
+	VisibilityPublic Visibility = "public"
+
+	// Only members of the organization which owns the snippet can see it.
+	VisibilityOrg Visibility = "org"
+
+	// Only the snippet's owners, and the people it has been shared with, can see it.
+	VisibilityPrivate Visibility = "private"
+)
+
+// Reports whether v is one of the known visibilities.
+func (v Visibility) Valid() bool {
+	return v == VisibilityPublic || v == VisibilityOrg || v == VisibilityPrivate
+}
+
+// The number of snippets which are still live, and the number which have expired.
+type SnippetCounts struct {
+	Live    int
+	Expired int
+}
+
+// A user, and how many snippets (live or expired) they have created.
+type SnippetCreator struct {
+	UserID   int
+	Snippets int
 }
 
 type SnippetModel struct {
 	DbPool *pgxpool.Pool
+
+	// The deadline applied to each query. If zero, DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
 }
 
 // Insert a new snippet into the database.
-func (m *SnippetModel) Insert(title, content string) (int, error) {
-	stmt := "INSERT INTO snippets(title, content, created, expires) VALUES($1, $2, NOW(), NOW() + INTERVAL '7 days') returning id"
+func (m *SnippetModel) Insert(ctx context.Context, userID, orgID int, title, content string, visibility Visibility) (int, error) {
+	stmt := `INSERT INTO snippets(title, content, created, expires, user_id, org_id, visibility)
+	VALUES($1, $2, NOW(), NOW() + INTERVAL '7 days', $3, NULLIF($4, 0), $5) returning id`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
 
 	var id int
-	err := m.DbPool.QueryRow(context.Background(), stmt, title, content).Scan(&id)
+	err := m.DbPool.QueryRow(ctx, stmt, title, content, userID, orgID, visibility).Scan(&id)
 	if err != nil {
-		return 0, err
+		return 0, TranslateContextError(ctx, err)
 	}
 
 	return id, nil
 }
 
 // Return a specific snippet based on its id
-func (m *SnippetModel) Get(id int) (Snippet, error) {
-	stmt := "SELECT id, title, content, created, expires from snippets WHERE expires > NOW() AND id = $1"
+func (m *SnippetModel) Get(ctx context.Context, id int) (Snippet, error) {
+	stmt := `SELECT id, title, content, created, expires, user_id, hidden, COALESCE(org_id, 0), visibility from snippets
+	WHERE expires > NOW() AND id = $1`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
 
 	var s Snippet
 
-	row := m.DbPool.QueryRow(context.Background(), stmt, id)
+	row := m.DbPool.QueryRow(ctx, stmt, id)
 
 	// Use row.Scan() to copy the values from each field in sql.Row to the corresponding field
 	// in the Snippet struct. The arguments to row.Scan are *pointers* to the place you want to
@@ -54,28 +115,31 @@ func (m *SnippetModel) Get(id int) (Snippet, error) {
 	// of columns returned by your statement.
 	// Behind the scenes of rows.Scan() your driver will automatically convert the raw output
 	// from the SQL database to the required native Go types
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.UserID, &s.Hidden, &s.OrgID, &s.Visibility)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Snippet{}, ErrNoRecord
 		} else {
-			return Snippet{}, err
+			return Snippet{}, TranslateContextError(ctx, err)
 		}
 	}
 
 	return s, nil
 }
 
-// This will return the 10 most recently created snippets.
-func (m *SnippetModel) Latest() ([]Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets 
-	WHERE expires > NOW() 
+// This will return the 10 most recently created public snippets.
+func (m *SnippetModel) Latest(ctx context.Context) ([]Snippet, error) {
+	stmt := `SELECT id, title, content, created, expires, user_id, hidden, COALESCE(org_id, 0), visibility FROM snippets 
+	WHERE expires > NOW() AND NOT hidden AND visibility = 'public'
 	ORDER BY id DESC LIMIT 10`
 
-	rows, err := m.DbPool.Query(context.Background(), stmt)
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DbPool.Query(ctx, stmt)
 	if err != nil {
-		return nil, err
+		return nil, TranslateContextError(ctx, err)
 	}
 
 	defer rows.Close()
@@ -87,9 +151,9 @@ func (m *SnippetModel) Latest() ([]Snippet, error) {
 	// database connection.
 	for rows.Next() {
 		var s Snippet
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.UserID, &s.Hidden, &s.OrgID, &s.Visibility)
 		if err != nil {
-			return nil, err
+			return nil, TranslateContextError(ctx, err)
 		}
 
 		snippets = append(snippets, s)
@@ -99,8 +163,178 @@ func (m *SnippetModel) Latest() ([]Snippet, error) {
 	// encountered during the iteration. It's important to call this! We shouldn't assume that a
 	// successful iteration was completed over the whole resultset.
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	return snippets, nil
+}
+
+// Changes the title, content and visibility of a live snippet. Returns ErrNoRecord if there
+// isn't a live snippet with the given ID.
+func (m *SnippetModel) Update(ctx context.Context, id int, title, content string, visibility Visibility) error {
+	stmt := "UPDATE snippets SET title = $2, content = $3, visibility = $4 WHERE id = $1 AND expires > NOW()"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, id, title, content, visibility)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Returns the organization's live snippets, newest first, whatever their visibility. Hidden
+// snippets are left out.
+func (m *SnippetModel) ListForOrg(ctx context.Context, orgID int) ([]Snippet, error) {
+	stmt := `SELECT id, title, content, created, expires, user_id, hidden, COALESCE(org_id, 0), visibility FROM snippets
+	WHERE org_id = $1 AND expires > NOW() AND NOT hidden
+	ORDER BY id DESC`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DbPool.Query(ctx, stmt, orgID)
+	if err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var snippets []Snippet
+
+	for rows.Next() {
+		var s Snippet
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.UserID, &s.Hidden, &s.OrgID, &s.Visibility)
+		if err != nil {
+			return nil, TranslateContextError(ctx, err)
+		}
+
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, TranslateContextError(ctx, err)
 	}
 
 	return snippets, nil
 }
+
+// Returns the number of live and expired snippets.
+func (m *SnippetModel) Counts(ctx context.Context) (SnippetCounts, error) {
+	stmt := `SELECT COUNT(*) FILTER (WHERE expires > NOW()), COUNT(*) FILTER (WHERE expires <= NOW())
+	FROM snippets`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	var c SnippetCounts
+
+	err := m.DbPool.QueryRow(ctx, stmt).Scan(&c.Live, &c.Expired)
+	if err != nil {
+		return SnippetCounts{}, TranslateContextError(ctx, err)
+	}
+
+	return c, nil
+}
+
+// Returns the users who have created the most snippets, most prolific first, counting
+// expired snippets as well as live ones.
+func (m *SnippetModel) TopCreators(ctx context.Context, limit int) ([]SnippetCreator, error) {
+	stmt := `SELECT user_id, COUNT(*) FROM snippets
+	GROUP BY user_id
+	ORDER BY COUNT(*) DESC, user_id LIMIT $1`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DbPool.Query(ctx, stmt, limit)
+	if err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var creators []SnippetCreator
+
+	for rows.Next() {
+		var c SnippetCreator
+		err = rows.Scan(&c.UserID, &c.Snippets)
+		if err != nil {
+			return nil, TranslateContextError(ctx, err)
+		}
+
+		creators = append(creators, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	return creators, nil
+}
+
+// Makes a live snippet expire straight away. Returns ErrNoRecord if there isn't a live
+// snippet with the given ID.
+func (m *SnippetModel) Expire(ctx context.Context, id int) error {
+	stmt := "UPDATE snippets SET expires = NOW() WHERE id = $1 AND expires > NOW()"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, id)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Deletes a snippet, whether or not it has expired. Returns ErrNoRecord if there isn't one
+// with the given ID.
+func (m *SnippetModel) Delete(ctx context.Context, id int) error {
+	stmt := "DELETE FROM snippets WHERE id = $1"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, id)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Hides a snippet pending review, or puts it back. Returns ErrNoRecord if there isn't a
+// snippet with the given ID.
+func (m *SnippetModel) SetHidden(ctx context.Context, id int, hidden bool) error {
+	stmt := "UPDATE snippets SET hidden = $2 WHERE id = $1"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, id, hidden)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
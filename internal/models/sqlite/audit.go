@@ -0,0 +1,90 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type AuditLogModel struct {
+	DB *sql.DB
+
+	// The deadline applied to each query. If zero, models.DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Appends an entry to the log. The ID and Created fields of entry are ignored.
+func (m *AuditLogModel) Log(ctx context.Context, entry models.AuditEntry) error {
+	stmt := `INSERT INTO audit_log (created_at, actor_id, ip, user_agent, action, target_type, target_id, details)
+	VALUES(?, NULLIF(?, 0), ?, ?, ?, NULLIF(?, ''), NULLIF(?, 0), ?)`
+
+	details := entry.Details
+	if details == nil {
+		details = map[string]string{}
+	}
+
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, stmt, time.Now().UTC(), entry.ActorID, entry.IP, entry.UserAgent, entry.Action,
+		entry.TargetType, entry.TargetID, string(detailsJSON))
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
+
+// Returns the entries which match the filter, newest first.
+func (m *AuditLogModel) List(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	stmt := `SELECT id, created_at, COALESCE(actor_id, 0), ip, user_agent, action, COALESCE(target_type, ''),
+		COALESCE(target_id, 0), details
+	FROM audit_log
+	WHERE (?1 = 0 OR actor_id = ?1 OR (target_type = 'user' AND target_id = ?1))
+	AND (?2 = '' OR action = ?2)
+	ORDER BY id DESC
+	LIMIT COALESCE(NULLIF(?3, 0), -1)`
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, filter.UserID, string(filter.Action), filter.Limit)
+	if err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+
+	for rows.Next() {
+		var e models.AuditEntry
+		var details string
+
+		err = rows.Scan(&e.ID, &e.Created, &e.ActorID, &e.IP, &e.UserAgent, &e.Action, &e.TargetType, &e.TargetID, &details)
+		if err != nil {
+			return nil, models.TranslateContextError(ctx, err)
+		}
+
+		err = json.Unmarshal([]byte(details), &e.Details)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	return entries, nil
+}
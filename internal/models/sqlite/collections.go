@@ -0,0 +1,247 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type CollectionModel struct {
+	DB *sql.DB
+
+	// The deadline applied to each query. If zero, models.DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Creates an empty collection and returns its ID.
+func (m *CollectionModel) Insert(ctx context.Context, userID int, name string, visibility models.Visibility) (int, error) {
+	stmt := "INSERT INTO collections (user_id, name, visibility, created_at) VALUES(?, ?, ?, ?)"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, userID, name, visibility, time.Now().UTC())
+	if err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (m *CollectionModel) Get(ctx context.Context, id int) (models.Collection, error) {
+	var c models.Collection
+
+	stmt := "SELECT id, user_id, name, visibility, created_at FROM collections WHERE id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&c.ID, &c.UserID, &c.Name, &c.Visibility, &c.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Collection{}, models.ErrNoRecord
+		}
+		return models.Collection{}, models.TranslateContextError(ctx, err)
+	}
+
+	return c, nil
+}
+
+// Renames the collection and changes who can see it.
+func (m *CollectionModel) Update(ctx context.Context, id int, name string, visibility models.Visibility) error {
+	stmt := "UPDATE collections SET name = ?, visibility = ? WHERE id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, name, visibility, id)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+// Returns the user's collections, in name order.
+func (m *CollectionModel) ListForUser(ctx context.Context, userID int) ([]models.Collection, error) {
+	stmt := `SELECT id, user_id, name, visibility, created_at FROM collections
+	WHERE user_id = ?
+	ORDER BY name, id`
+
+	return m.list(ctx, stmt, userID)
+}
+
+// Returns the public collections which include the snippet, in name order.
+func (m *CollectionModel) PublicForSnippet(ctx context.Context, snippetID int) ([]models.Collection, error) {
+	stmt := `SELECT c.id, c.user_id, c.name, c.visibility, c.created_at FROM collections c
+	JOIN collection_snippets cs ON cs.collection_id = c.id
+	WHERE cs.snippet_id = ? AND c.visibility = 'public'
+	ORDER BY c.name, c.id`
+
+	return m.list(ctx, stmt, snippetID)
+}
+
+func (m *CollectionModel) list(ctx context.Context, stmt string, args ...any) ([]models.Collection, error) {
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var collections []models.Collection
+
+	for rows.Next() {
+		var c models.Collection
+		err = rows.Scan(&c.ID, &c.UserID, &c.Name, &c.Visibility, &c.Created)
+		if err != nil {
+			return nil, models.TranslateContextError(ctx, err)
+		}
+
+		collections = append(collections, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	return collections, nil
+}
+
+// Returns the IDs of the snippets in the collection, in order. Snippets are removed from
+// collections when they're deleted, but expired and hidden snippets are still included.
+func (m *CollectionModel) SnippetIDs(ctx context.Context, id int) ([]int, error) {
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	return snippetIDs(ctx, m.DB, id)
+}
+
+// Either a *sql.DB or a *sql.Tx.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func snippetIDs(ctx context.Context, q querier, collectionID int) ([]int, error) {
+	stmt := `SELECT snippet_id FROM collection_snippets
+	WHERE collection_id = ?
+	ORDER BY position, snippet_id`
+
+	rows, err := q.QueryContext(ctx, stmt, collectionID)
+	if err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var ids []int
+
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, models.TranslateContextError(ctx, err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	return ids, nil
+}
+
+// Adds the snippet to the end of the collection. Returns ErrDuplicateSnippet if it's already
+// in the collection.
+func (m *CollectionModel) AddSnippet(ctx context.Context, id, snippetID int) error {
+	stmt := `INSERT INTO collection_snippets (collection_id, snippet_id, position)
+	SELECT ?, ?, COALESCE(MAX(position), 0) + 1 FROM collection_snippets WHERE collection_id = ?
+	ON CONFLICT (collection_id, snippet_id) DO NOTHING`
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, id, snippetID, id)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return models.ErrDuplicateSnippet
+	}
+
+	return nil
+}
+
+// Removes the snippet from the collection. Returns ErrNoRecord if it isn't in it.
+func (m *CollectionModel) RemoveSnippet(ctx context.Context, id, snippetID int) error {
+	stmt := "DELETE FROM collection_snippets WHERE collection_id = ? AND snippet_id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, id, snippetID)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+// Moves the snippet delta places through the collection, towards the start if delta is
+// negative, stopping at either end. Returns ErrNoRecord if the snippet isn't in it.
+func (m *CollectionModel) MoveSnippet(ctx context.Context, id, snippetID, delta int) error {
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	ids, err := snippetIDs(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	i := slices.Index(ids, snippetID)
+	if i == -1 {
+		return models.ErrNoRecord
+	}
+
+	stmt := "UPDATE collection_snippets SET position = ? WHERE collection_id = ? AND snippet_id = ?"
+
+	for position, snippetID := range models.MoveSnippetID(ids, i, delta) {
+		_, err = tx.ExecContext(ctx, stmt, position+1, id, snippetID)
+		if err != nil {
+			return models.TranslateContextError(ctx, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type LoginAttemptModel struct {
+	DB *sql.DB
+
+	// The deadline applied to each query. If zero, models.DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+
+	// How long each failure is counted for. If zero, models.DefaultLoginAttemptWindow is used.
+	Window time.Duration
+}
+
+func (m *LoginAttemptModel) window() time.Duration {
+	if m.Window == 0 {
+		return models.DefaultLoginAttemptWindow
+	}
+	return m.Window
+}
+
+// Records a failed attempt for the key. Returns the number of failures (including this one)
+// within the window, along with the time of the one before it (which is the zero time if
+// there wasn't one). Concurrent calls for the same key are serialized, so each of them sees
+// a different count.
+func (m *LoginAttemptModel) RecordFailure(ctx context.Context, key string) (int, time.Time, error) {
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	cutoff := now.Add(-m.window())
+
+	// There's only ever one connection to the database, so the transaction keeps other
+	// attempts out until the new failure has been counted and recorded.
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, time.Time{}, models.TranslateContextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM login_failures WHERE attempted_at <= ?", cutoff)
+	if err != nil {
+		return 0, time.Time{}, models.TranslateContextError(ctx, err)
+	}
+
+	var count int
+	var last time.Time
+
+	stmt := "SELECT COUNT(*) FROM login_failures WHERE key = ? AND attempted_at > ?"
+
+	err = tx.QueryRowContext(ctx, stmt, key, cutoff).Scan(&count)
+	if err != nil {
+		return 0, time.Time{}, models.TranslateContextError(ctx, err)
+	}
+
+	if count > 0 {
+		stmt = "SELECT attempted_at FROM login_failures WHERE key = ? ORDER BY attempted_at DESC LIMIT 1"
+
+		err = tx.QueryRowContext(ctx, stmt, key).Scan(&last)
+		if err != nil {
+			return 0, time.Time{}, models.TranslateContextError(ctx, err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO login_failures (key, attempted_at) VALUES(?, ?)", key, now)
+	if err != nil {
+		return 0, time.Time{}, models.TranslateContextError(ctx, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, time.Time{}, models.TranslateContextError(ctx, err)
+	}
+
+	return count + 1, last, nil
+}
+
+// Returns the number of failures for the key within the window, along with the time of the
+// most recent one (which is the zero time if there haven't been any).
+func (m *LoginAttemptModel) Failures(ctx context.Context, key string) (int, time.Time, error) {
+	var count int
+	var last time.Time
+
+	cutoff := time.Now().UTC().Add(-m.window())
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	// The driver only converts columns declared as DATETIME into a time.Time, and not the
+	// result of an aggregate like MAX(), so we look up the latest failure separately.
+	stmt := "SELECT COUNT(*) FROM login_failures WHERE key = ? AND attempted_at > ?"
+
+	err := m.DB.QueryRowContext(ctx, stmt, key, cutoff).Scan(&count)
+	if err != nil {
+		return 0, time.Time{}, models.TranslateContextError(ctx, err)
+	}
+
+	if count == 0 {
+		return 0, time.Time{}, nil
+	}
+
+	stmt = "SELECT attempted_at FROM login_failures WHERE key = ? ORDER BY attempted_at DESC LIMIT 1"
+
+	err = m.DB.QueryRowContext(ctx, stmt, key).Scan(&last)
+	if err != nil {
+		return 0, time.Time{}, models.TranslateContextError(ctx, err)
+	}
+
+	return count, last, nil
+}
+
+// Forgets the most recent failure recorded for the key, if there is one.
+func (m *LoginAttemptModel) Forget(ctx context.Context, key string) error {
+	stmt := `DELETE FROM login_failures WHERE rowid = (
+		SELECT rowid FROM login_failures WHERE key = ? ORDER BY attempted_at DESC LIMIT 1
+	)`
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, key)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
+
+// Forgets all of the failures recorded for the key.
+func (m *LoginAttemptModel) Reset(ctx context.Context, key string) error {
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, "DELETE FROM login_failures WHERE key = ?", key)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type MFAModel struct {
+	DB *sql.DB
+
+	// The deadline applied to each query. If zero, models.DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Turns on two-factor authentication for the user, replacing any secret and recovery codes
+// which they had before.
+func (m *MFAModel) Enable(ctx context.Context, userID int, secret string, recoveryCodes []string) error {
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO totp_secrets (user_id, secret, last_step, created_at) VALUES(?, ?, 0, ?)
+		ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, last_step = 0, created_at = excluded.created_at`
+
+	_, err = tx.ExecContext(ctx, stmt, userID, secret, time.Now().UTC())
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = ?", userID)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	for _, code := range recoveryCodes {
+		_, err = tx.ExecContext(ctx, "INSERT INTO recovery_codes (user_id, hash) VALUES(?, ?)", userID, models.HashRecoveryCode(code))
+		if err != nil {
+			return models.TranslateContextError(ctx, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
+
+// Turns off two-factor authentication for the user, deleting their secret and any unused
+// recovery codes.
+func (m *MFAModel) Disable(ctx context.Context, userID int) error {
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = ?", userID)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM totp_secrets WHERE user_id = ?", userID)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
+
+// Returns the user's TOTP secret, or ErrNoRecord if they haven't enabled two-factor
+// authentication.
+func (m *MFAModel) GetSecret(ctx context.Context, userID int) (string, error) {
+	var secret string
+
+	stmt := "SELECT secret FROM totp_secrets WHERE user_id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, userID).Scan(&secret)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", models.ErrNoRecord
+		}
+		return "", models.TranslateContextError(ctx, err)
+	}
+
+	return secret, nil
+}
+
+// Records that the user has logged in with the code for the given time step, returning
+// ErrNoRecord if a code for this step (or a later one) has already been used.
+func (m *MFAModel) RecordStep(ctx context.Context, userID int, step int64) error {
+	stmt := "UPDATE totp_secrets SET last_step = ? WHERE user_id = ? AND last_step < ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, step, userID, step)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+// Uses up one of the user's recovery codes, returning ErrNoRecord if the code isn't valid
+// (or has already been used).
+func (m *MFAModel) UseRecoveryCode(ctx context.Context, userID int, code string) error {
+	stmt := "DELETE FROM recovery_codes WHERE user_id = ? AND hash = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, userID, models.HashRecoveryCode(code))
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+// Returns the number of recovery codes which the user has left.
+func (m *MFAModel) RecoveryCodesRemaining(ctx context.Context, userID int) (int, error) {
+	var count int
+
+	stmt := "SELECT COUNT(*) FROM recovery_codes WHERE user_id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, userID).Scan(&count)
+	if err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	return count, nil
+}
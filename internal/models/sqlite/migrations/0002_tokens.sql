@@ -0,0 +1,7 @@
+-- One-time tokens, such as the ones in password reset links.
+CREATE TABLE tokens (
+	hash BLOB PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+	expiry DATETIME NOT NULL,
+	scope TEXT NOT NULL
+);
@@ -0,0 +1,7 @@
+CREATE TABLE login_failures (
+	key TEXT NOT NULL,
+	attempted_at DATETIME NOT NULL
+);
+
+CREATE INDEX login_failures_key_idx ON login_failures(key, attempted_at);
+CREATE INDEX login_failures_attempted_at_idx ON login_failures(attempted_at);
@@ -0,0 +1,11 @@
+CREATE TABLE user_sessions (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+	created_at DATETIME NOT NULL,
+	last_seen_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	ip TEXT NOT NULL,
+	user_agent TEXT NOT NULL
+);
+
+CREATE INDEX user_sessions_user_id_idx ON user_sessions(user_id);
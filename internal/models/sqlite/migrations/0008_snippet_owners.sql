@@ -0,0 +1,19 @@
+ALTER TABLE users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT false;
+
+-- Snippets record the user who created them. Snippets from before then can't be attributed to
+-- anyone, and they only ever lasted for a week, so they're removed rather than given an owner.
+-- SQLite can't add a NOT NULL foreign key to an existing table, so the table is rebuilt.
+CREATE TABLE snippets_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title TEXT NOT NULL,
+	content TEXT NOT NULL,
+	created DATETIME NOT NULL,
+	expires DATETIME NOT NULL,
+	user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE
+);
+
+DROP TABLE snippets;
+ALTER TABLE snippets_new RENAME TO snippets;
+
+CREATE INDEX idx_snippets_created ON snippets(created);
+CREATE INDEX idx_snippets_user_id ON snippets(user_id);
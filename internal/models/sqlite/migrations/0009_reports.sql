@@ -0,0 +1,17 @@
+ALTER TABLE snippets ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE reports (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	snippet_id INTEGER NOT NULL REFERENCES snippets ON DELETE CASCADE,
+	reporter_id INTEGER REFERENCES users ON DELETE CASCADE,
+	reporter_ip TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	created DATETIME NOT NULL,
+	resolved BOOLEAN NOT NULL DEFAULT false
+);
+
+-- Each reporter can only have one open report per snippet.
+CREATE UNIQUE INDEX reports_open_user_uc ON reports(snippet_id, reporter_id)
+	WHERE NOT resolved AND reporter_id IS NOT NULL;
+CREATE UNIQUE INDEX reports_open_ip_uc ON reports(snippet_id, reporter_ip)
+	WHERE NOT resolved AND reporter_id IS NULL;
@@ -0,0 +1,27 @@
+-- There's deliberately no foreign key on actor_id or target_id, so that entries outlive the
+-- users and snippets they mention.
+CREATE TABLE audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at DATETIME NOT NULL,
+	actor_id INTEGER,
+	ip TEXT NOT NULL,
+	user_agent TEXT NOT NULL,
+	action TEXT NOT NULL,
+	target_type TEXT,
+	target_id INTEGER,
+	details TEXT NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX audit_log_actor_id_idx ON audit_log(actor_id);
+CREATE INDEX audit_log_target_idx ON audit_log(target_type, target_id);
+
+-- The audit log is append-only.
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
@@ -0,0 +1,47 @@
+CREATE TABLE orgs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	created_at DATETIME NOT NULL
+);
+
+CREATE TABLE org_members (
+	org_id INTEGER NOT NULL REFERENCES orgs ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+	role TEXT NOT NULL CHECK (role IN ('owner', 'member')),
+	joined_at DATETIME NOT NULL,
+	PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX org_members_user_id_idx ON org_members(user_id);
+
+CREATE TABLE org_invitations (
+	hash BLOB PRIMARY KEY,
+	org_id INTEGER NOT NULL REFERENCES orgs ON DELETE CASCADE,
+	email TEXT NOT NULL,
+	role TEXT NOT NULL CHECK (role IN ('owner', 'member')),
+	expiry DATETIME NOT NULL
+);
+
+-- SQLite can't add a table constraint to an existing table, so the table is rebuilt.
+CREATE TABLE snippets_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title TEXT NOT NULL,
+	content TEXT NOT NULL,
+	created DATETIME NOT NULL,
+	expires DATETIME NOT NULL,
+	user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+	hidden BOOLEAN NOT NULL DEFAULT false,
+	org_id INTEGER REFERENCES orgs ON DELETE CASCADE,
+	visibility TEXT NOT NULL DEFAULT 'public' CHECK (visibility IN ('public', 'org')),
+	CHECK (visibility <> 'org' OR org_id IS NOT NULL)
+);
+
+INSERT INTO snippets_new (id, title, content, created, expires, user_id, hidden)
+	SELECT id, title, content, created, expires, user_id, hidden FROM snippets;
+
+DROP TABLE snippets;
+ALTER TABLE snippets_new RENAME TO snippets;
+
+CREATE INDEX idx_snippets_created ON snippets(created);
+CREATE INDEX idx_snippets_user_id ON snippets(user_id);
+CREATE INDEX idx_snippets_org_id ON snippets(org_id);
@@ -0,0 +1,33 @@
+-- SQLite can't change a CHECK constraint, so the table is rebuilt to allow private snippets.
+CREATE TABLE snippets_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title TEXT NOT NULL,
+	content TEXT NOT NULL,
+	created DATETIME NOT NULL,
+	expires DATETIME NOT NULL,
+	user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+	hidden BOOLEAN NOT NULL DEFAULT false,
+	org_id INTEGER REFERENCES orgs ON DELETE CASCADE,
+	visibility TEXT NOT NULL DEFAULT 'public' CHECK (visibility IN ('public', 'org', 'private')),
+	CHECK (visibility <> 'org' OR org_id IS NOT NULL)
+);
+
+INSERT INTO snippets_new (id, title, content, created, expires, user_id, hidden, org_id, visibility)
+	SELECT id, title, content, created, expires, user_id, hidden, org_id, visibility FROM snippets;
+
+DROP TABLE snippets;
+ALTER TABLE snippets_new RENAME TO snippets;
+
+CREATE INDEX idx_snippets_created ON snippets(created);
+CREATE INDEX idx_snippets_user_id ON snippets(user_id);
+CREATE INDEX idx_snippets_org_id ON snippets(org_id);
+
+CREATE TABLE snippet_shares (
+	snippet_id INTEGER NOT NULL REFERENCES snippets ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+	permission TEXT NOT NULL CHECK (permission IN ('view', 'edit')),
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (snippet_id, user_id)
+);
+
+CREATE INDEX snippet_shares_user_id_idx ON snippet_shares(user_id);
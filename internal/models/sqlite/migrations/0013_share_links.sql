@@ -0,0 +1,11 @@
+CREATE TABLE share_links (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	snippet_id INTEGER NOT NULL REFERENCES snippets ON DELETE CASCADE,
+	hash BLOB NOT NULL,
+	created_at DATETIME NOT NULL,
+	expiry DATETIME NOT NULL,
+	max_views INTEGER NOT NULL CHECK (max_views >= 0),
+	views INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX share_links_snippet_id_idx ON share_links(snippet_id);
@@ -0,0 +1,18 @@
+CREATE TABLE collections (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	visibility TEXT NOT NULL CHECK (visibility IN ('public', 'private')),
+	created_at DATETIME NOT NULL
+);
+
+CREATE INDEX collections_user_id_idx ON collections(user_id);
+
+CREATE TABLE collection_snippets (
+	collection_id INTEGER NOT NULL REFERENCES collections ON DELETE CASCADE,
+	snippet_id INTEGER NOT NULL REFERENCES snippets ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	PRIMARY KEY (collection_id, snippet_id)
+);
+
+CREATE INDEX collection_snippets_snippet_id_idx ON collection_snippets(snippet_id);
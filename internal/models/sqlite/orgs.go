@@ -0,0 +1,251 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type OrgModel struct {
+	DB *sql.DB
+
+	// The deadline applied to each query. If zero, models.DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Creates an organization with the given user as its only owner, and returns its ID.
+func (m *OrgModel) Insert(ctx context.Context, name string, ownerID int) (int, error) {
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+
+	var id int
+	err = tx.QueryRowContext(ctx, "INSERT INTO orgs (name, created_at) VALUES(?, ?) RETURNING id", name, now).Scan(&id)
+	if err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	stmt := "INSERT INTO org_members (org_id, user_id, role, joined_at) VALUES(?, ?, ?, ?)"
+
+	_, err = tx.ExecContext(ctx, stmt, id, ownerID, models.OrgRoleOwner, now)
+	if err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	return id, nil
+}
+
+func (m *OrgModel) Get(ctx context.Context, id int) (models.Org, error) {
+	var o models.Org
+
+	stmt := "SELECT id, name, created_at FROM orgs WHERE id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&o.ID, &o.Name, &o.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Org{}, models.ErrNoRecord
+		}
+		return models.Org{}, models.TranslateContextError(ctx, err)
+	}
+
+	return o, nil
+}
+
+// Returns the organizations which the user belongs to, in name order.
+func (m *OrgModel) ListForUser(ctx context.Context, userID int) ([]models.Org, error) {
+	stmt := `SELECT o.id, o.name, o.created_at FROM orgs o
+	JOIN org_members om ON om.org_id = o.id
+	WHERE om.user_id = ?
+	ORDER BY o.name, o.id`
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var orgs []models.Org
+
+	for rows.Next() {
+		var o models.Org
+		err = rows.Scan(&o.ID, &o.Name, &o.Created)
+		if err != nil {
+			return nil, models.TranslateContextError(ctx, err)
+		}
+
+		orgs = append(orgs, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	return orgs, nil
+}
+
+// Returns the user's role in the organization, or ErrNoRecord if they aren't a member.
+func (m *OrgModel) MemberRole(ctx context.Context, orgID, userID int) (models.OrgRole, error) {
+	var role models.OrgRole
+
+	stmt := "SELECT role FROM org_members WHERE org_id = ? AND user_id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, orgID, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", models.ErrNoRecord
+		}
+		return "", models.TranslateContextError(ctx, err)
+	}
+
+	return role, nil
+}
+
+// Returns the members of the organization, in the order that they joined.
+func (m *OrgModel) Members(ctx context.Context, orgID int) ([]models.OrgMember, error) {
+	stmt := "SELECT user_id, role, joined_at FROM org_members WHERE org_id = ? ORDER BY joined_at, user_id"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, orgID)
+	if err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var members []models.OrgMember
+
+	for rows.Next() {
+		var om models.OrgMember
+		err = rows.Scan(&om.UserID, &om.Role, &om.Joined)
+		if err != nil {
+			return nil, models.TranslateContextError(ctx, err)
+		}
+
+		members = append(members, om)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	return members, nil
+}
+
+// Creates an invitation to join the organization with the given role, which expires after
+// ttl, and returns its token.
+func (m *OrgModel) Invite(ctx context.Context, orgID int, email string, role models.OrgRole, ttl time.Duration) (string, error) {
+	plaintext, hash, err := models.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	stmt := "INSERT INTO org_invitations (hash, org_id, email, role, expiry) VALUES(?, ?, ?, ?, ?)"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, stmt, hash, orgID, email, role, time.Now().UTC().Add(ttl))
+	if err != nil {
+		return "", models.TranslateContextError(ctx, err)
+	}
+
+	return plaintext, nil
+}
+
+// Returns the unexpired invitation with the given token, without using it up.
+func (m *OrgModel) GetInvitation(ctx context.Context, token string) (models.OrgInvitation, error) {
+	var inv models.OrgInvitation
+
+	stmt := "SELECT org_id, email, role, expiry FROM org_invitations WHERE hash = ? AND expiry > ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, models.HashToken(token), time.Now().UTC()).Scan(&inv.OrgID, &inv.Email, &inv.Role, &inv.Expiry)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.OrgInvitation{}, models.ErrNoRecord
+		}
+		return models.OrgInvitation{}, models.TranslateContextError(ctx, err)
+	}
+
+	return inv, nil
+}
+
+// Uses up an invitation, adding the user to the organization, and returns the organization's
+// ID. ErrDuplicateMember is returned if the user already belongs to the organization, in
+// which case the invitation is left alone.
+func (m *OrgModel) AcceptInvitation(ctx context.Context, token string, userID int) (int, error) {
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+
+	var orgID int
+	var role models.OrgRole
+
+	stmt := "DELETE FROM org_invitations WHERE hash = ? AND expiry > ? RETURNING org_id, role"
+
+	err = tx.QueryRowContext(ctx, stmt, models.HashToken(token), now).Scan(&orgID, &role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrNoRecord
+		}
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	stmt = `INSERT INTO org_members (org_id, user_id, role, joined_at) VALUES(?, ?, ?, ?)
+	ON CONFLICT (org_id, user_id) DO NOTHING`
+
+	result, err := tx.ExecContext(ctx, stmt, orgID, userID, role, now)
+	if err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	if err = checkRowsAffected(result); err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return 0, models.ErrDuplicateMember
+		}
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	return orgID, nil
+}
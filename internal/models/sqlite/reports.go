@@ -0,0 +1,105 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type ReportModel struct {
+	DB *sql.DB
+
+	// The deadline applied to each query. If zero, models.DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Records a report and returns its ID. ErrDuplicateReport is returned if the reporter (told
+// apart by their user ID, or IP address if they're anonymous) already has an open report for
+// the snippet.
+func (m *ReportModel) Insert(ctx context.Context, snippetID, reporterID int, reporterIP, reason string) (int, error) {
+	stmt := `INSERT INTO reports (snippet_id, reporter_id, reporter_ip, reason, created)
+	VALUES(?, NULLIF(?, 0), ?, ?, ?) RETURNING id`
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	var id int
+	err := m.DB.QueryRowContext(ctx, stmt, snippetID, reporterID, reporterIP, reason, time.Now().UTC()).Scan(&id)
+	if err != nil {
+		if isUniqueViolation(err, "reports.snippet_id") {
+			return 0, models.ErrDuplicateReport
+		}
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	return id, nil
+}
+
+// Returns the number of open reports for the snippet.
+func (m *ReportModel) CountOpen(ctx context.Context, snippetID int) (int, error) {
+	var count int
+
+	stmt := "SELECT COUNT(*) FROM reports WHERE snippet_id = ? AND NOT resolved"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, snippetID).Scan(&count)
+	if err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	return count, nil
+}
+
+// Returns every open report, oldest first.
+func (m *ReportModel) ListOpen(ctx context.Context) ([]models.Report, error) {
+	stmt := `SELECT id, snippet_id, COALESCE(reporter_id, 0), reporter_ip, reason, created FROM reports
+	WHERE NOT resolved
+	ORDER BY id`
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var reports []models.Report
+
+	for rows.Next() {
+		var r models.Report
+		err = rows.Scan(&r.ID, &r.SnippetID, &r.ReporterID, &r.ReporterIP, &r.Reason, &r.Created)
+		if err != nil {
+			return nil, models.TranslateContextError(ctx, err)
+		}
+
+		reports = append(reports, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	return reports, nil
+}
+
+// Closes all of the open reports for the snippet.
+func (m *ReportModel) Resolve(ctx context.Context, snippetID int) error {
+	stmt := "UPDATE reports SET resolved = true WHERE snippet_id = ? AND NOT resolved"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, snippetID)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type ShareLinkModel struct {
+	DB *sql.DB
+
+	// The deadline applied to each query. If zero, models.DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Creates a link to the snippet which expires after ttl and can be used maxViews times (or
+// any number of times if maxViews is zero). Returns the link's token.
+func (m *ShareLinkModel) Insert(ctx context.Context, snippetID int, ttl time.Duration, maxViews int) (string, error) {
+	secret, hash, err := models.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	stmt := `INSERT INTO share_links (snippet_id, hash, created_at, expiry, max_views, views)
+	VALUES(?, ?, ?, ?, ?, 0)`
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+
+	result, err := m.DB.ExecContext(ctx, stmt, snippetID, hash, now, now.Add(ttl), maxViews)
+	if err != nil {
+		return "", models.TranslateContextError(ctx, err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return "", err
+	}
+
+	return models.FormatShareLinkToken(int(id), secret), nil
+}
+
+// Returns all of the snippet's links, including spent ones, newest first.
+func (m *ShareLinkModel) ListForSnippet(ctx context.Context, snippetID int) ([]models.ShareLink, error) {
+	stmt := `SELECT id, snippet_id, created_at, expiry, max_views, views FROM share_links
+	WHERE snippet_id = ?
+	ORDER BY id DESC`
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, snippetID)
+	if err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var links []models.ShareLink
+
+	for rows.Next() {
+		var l models.ShareLink
+		err = rows.Scan(&l.ID, &l.SnippetID, &l.Created, &l.Expiry, &l.MaxViews, &l.Views)
+		if err != nil {
+			return nil, models.TranslateContextError(ctx, err)
+		}
+
+		links = append(links, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	return links, nil
+}
+
+// Checks the token without counting a view of the link, returning the ID of the snippet that
+// it's for. ErrNoRecord is returned in the same cases as Use.
+func (m *ShareLinkModel) Check(ctx context.Context, token string) (int, error) {
+	id, secret, ok := models.ParseShareLinkToken(token)
+	if !ok {
+		return 0, models.ErrNoRecord
+	}
+
+	var snippetID int
+	var hash []byte
+
+	stmt := `SELECT snippet_id, hash FROM share_links
+	WHERE id = ? AND expiry > ? AND (max_views = 0 OR views < max_views)`
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, id, time.Now().UTC()).Scan(&snippetID, &hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrNoRecord
+		}
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	if !models.CheckShareLinkSecret(secret, hash) {
+		return 0, models.ErrNoRecord
+	}
+
+	return snippetID, nil
+}
+
+// Checks the token and counts a view of the link, returning the ID of the snippet that it's
+// for. ErrNoRecord is returned if the token is invalid or the link has been revoked, has
+// expired or has no views left. The view is counted by a single conditional update, so
+// concurrent requests can't use the link more times than it allows.
+func (m *ShareLinkModel) Use(ctx context.Context, token string) (int, error) {
+	id, secret, ok := models.ParseShareLinkToken(token)
+	if !ok {
+		return 0, models.ErrNoRecord
+	}
+
+	var hash []byte
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, "SELECT hash FROM share_links WHERE id = ?", id).Scan(&hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrNoRecord
+		}
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	if !models.CheckShareLinkSecret(secret, hash) {
+		return 0, models.ErrNoRecord
+	}
+
+	var snippetID int
+
+	stmt := `UPDATE share_links SET views = views + 1
+	WHERE id = ? AND expiry > ? AND (max_views = 0 OR views < max_views)
+	RETURNING snippet_id`
+
+	err = m.DB.QueryRowContext(ctx, stmt, id, time.Now().UTC()).Scan(&snippetID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrNoRecord
+		}
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	return snippetID, nil
+}
+
+// Revokes one of the snippet's links. Returns ErrNoRecord if the snippet has no such link.
+func (m *ShareLinkModel) Delete(ctx context.Context, snippetID, id int) error {
+	stmt := "DELETE FROM share_links WHERE id = ? AND snippet_id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, id, snippetID)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return checkRowsAffected(result)
+}
@@ -0,0 +1,118 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type ShareModel struct {
+	DB *sql.DB
+
+	// The deadline applied to each query. If zero, models.DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Shares the snippet with the user, or changes their permission if it has already been
+// shared with them.
+func (m *ShareModel) Set(ctx context.Context, snippetID, userID int, permission models.SharePermission) error {
+	stmt := `INSERT INTO snippet_shares (snippet_id, user_id, permission, created_at) VALUES(?, ?, ?, ?)
+		ON CONFLICT (snippet_id, user_id) DO UPDATE SET permission = excluded.permission`
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, snippetID, userID, permission, time.Now().UTC())
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
+
+// Returns the user's permission for the snippet, or ErrNoRecord if it hasn't been shared
+// with them.
+func (m *ShareModel) Get(ctx context.Context, snippetID, userID int) (models.SharePermission, error) {
+	var permission models.SharePermission
+
+	stmt := "SELECT permission FROM snippet_shares WHERE snippet_id = ? AND user_id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, snippetID, userID).Scan(&permission)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", models.ErrNoRecord
+		}
+		return "", models.TranslateContextError(ctx, err)
+	}
+
+	return permission, nil
+}
+
+// Returns everyone the snippet has been shared with, in the order it was shared with them.
+func (m *ShareModel) ListForSnippet(ctx context.Context, snippetID int) ([]models.Share, error) {
+	stmt := `SELECT snippet_id, user_id, permission, created_at FROM snippet_shares
+	WHERE snippet_id = ?
+	ORDER BY created_at, user_id`
+
+	return m.list(ctx, stmt, snippetID)
+}
+
+// Returns the snippets which have been shared with the user, most recently shared first.
+func (m *ShareModel) ListForUser(ctx context.Context, userID int) ([]models.Share, error) {
+	stmt := `SELECT snippet_id, user_id, permission, created_at FROM snippet_shares
+	WHERE user_id = ?
+	ORDER BY created_at DESC, snippet_id DESC`
+
+	return m.list(ctx, stmt, userID)
+}
+
+func (m *ShareModel) list(ctx context.Context, stmt string, args ...any) ([]models.Share, error) {
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var shares []models.Share
+
+	for rows.Next() {
+		var s models.Share
+		err = rows.Scan(&s.SnippetID, &s.UserID, &s.Permission, &s.Created)
+		if err != nil {
+			return nil, models.TranslateContextError(ctx, err)
+		}
+
+		shares = append(shares, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	return shares, nil
+}
+
+// Stops sharing the snippet with the user. Returns ErrNoRecord if it wasn't shared with them.
+func (m *ShareModel) Delete(ctx context.Context, snippetID, userID int) error {
+	stmt := "DELETE FROM snippet_shares WHERE snippet_id = ? AND user_id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, snippetID, userID)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return checkRowsAffected(result)
+}
@@ -0,0 +1,235 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type SnippetModel struct {
+	DB *sql.DB
+
+	// The deadline applied to each query. If zero, models.DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Insert a new snippet into the database.
+func (m *SnippetModel) Insert(ctx context.Context, userID, orgID int, title, content string, visibility models.Visibility) (int, error) {
+	stmt := `INSERT INTO snippets(title, content, created, expires, user_id, org_id, visibility)
+	VALUES(?, ?, ?, ?, ?, NULLIF(?, 0), ?) RETURNING id`
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+
+	var id int
+	err := m.DB.QueryRowContext(ctx, stmt, title, content, now, now.Add(7*24*time.Hour), userID, orgID, visibility).Scan(&id)
+	if err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	return id, nil
+}
+
+// The columns selected by every query which returns whole snippets, in the order that
+// scanSnippet expects them.
+const snippetColumns = "id, title, content, created, expires, user_id, hidden, COALESCE(org_id, 0), visibility"
+
+// Scans a row of snippetColumns from either an *sql.Row or *sql.Rows.
+func scanSnippet(row interface{ Scan(dest ...any) error }) (models.Snippet, error) {
+	var s models.Snippet
+	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.UserID, &s.Hidden, &s.OrgID, &s.Visibility)
+	return s, err
+}
+
+// Returns the snippets matched by the query, which must select snippetColumns.
+func (m *SnippetModel) listSnippets(ctx context.Context, stmt string, args ...any) ([]models.Snippet, error) {
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var snippets []models.Snippet
+
+	for rows.Next() {
+		s, err := scanSnippet(rows)
+		if err != nil {
+			return nil, models.TranslateContextError(ctx, err)
+		}
+
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	return snippets, nil
+}
+
+// Return a specific snippet based on its id
+func (m *SnippetModel) Get(ctx context.Context, id int) (models.Snippet, error) {
+	stmt := "SELECT " + snippetColumns + " FROM snippets WHERE expires > ? AND id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	s, err := scanSnippet(m.DB.QueryRowContext(ctx, stmt, time.Now().UTC(), id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Snippet{}, models.ErrNoRecord
+		}
+		return models.Snippet{}, models.TranslateContextError(ctx, err)
+	}
+
+	return s, nil
+}
+
+// Changes the title, content and visibility of a live snippet. Returns ErrNoRecord if there
+// isn't a live snippet with the given ID.
+func (m *SnippetModel) Update(ctx context.Context, id int, title, content string, visibility models.Visibility) error {
+	stmt := "UPDATE snippets SET title = ?, content = ?, visibility = ? WHERE id = ? AND expires > ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, title, content, visibility, id, time.Now().UTC())
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+// This will return the 10 most recently created public snippets.
+func (m *SnippetModel) Latest(ctx context.Context) ([]models.Snippet, error) {
+	stmt := "SELECT " + snippetColumns + ` FROM snippets
+	WHERE expires > ? AND NOT hidden AND visibility = 'public'
+	ORDER BY id DESC LIMIT 10`
+
+	return m.listSnippets(ctx, stmt, time.Now().UTC())
+}
+
+// Returns the organization's live snippets, newest first, whatever their visibility. Hidden
+// snippets are left out.
+func (m *SnippetModel) ListForOrg(ctx context.Context, orgID int) ([]models.Snippet, error) {
+	stmt := "SELECT " + snippetColumns + ` FROM snippets
+	WHERE org_id = ? AND expires > ? AND NOT hidden
+	ORDER BY id DESC`
+
+	return m.listSnippets(ctx, stmt, orgID, time.Now().UTC())
+}
+
+// Returns the number of live and expired snippets.
+func (m *SnippetModel) Counts(ctx context.Context) (models.SnippetCounts, error) {
+	stmt := "SELECT COUNT(CASE WHEN expires > ? THEN 1 END), COUNT(CASE WHEN expires <= ? THEN 1 END) FROM snippets"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+
+	var c models.SnippetCounts
+
+	err := m.DB.QueryRowContext(ctx, stmt, now, now).Scan(&c.Live, &c.Expired)
+	if err != nil {
+		return models.SnippetCounts{}, models.TranslateContextError(ctx, err)
+	}
+
+	return c, nil
+}
+
+// Returns the users who have created the most snippets, most prolific first, counting
+// expired snippets as well as live ones.
+func (m *SnippetModel) TopCreators(ctx context.Context, limit int) ([]models.SnippetCreator, error) {
+	stmt := `SELECT user_id, COUNT(*) FROM snippets
+	GROUP BY user_id
+	ORDER BY COUNT(*) DESC, user_id LIMIT ?`
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, limit)
+	if err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var creators []models.SnippetCreator
+
+	for rows.Next() {
+		var c models.SnippetCreator
+		err = rows.Scan(&c.UserID, &c.Snippets)
+		if err != nil {
+			return nil, models.TranslateContextError(ctx, err)
+		}
+
+		creators = append(creators, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	return creators, nil
+}
+
+// Makes a live snippet expire straight away. Returns ErrNoRecord if there isn't a live
+// snippet with the given ID.
+func (m *SnippetModel) Expire(ctx context.Context, id int) error {
+	stmt := "UPDATE snippets SET expires = ? WHERE id = ? AND expires > ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+
+	result, err := m.DB.ExecContext(ctx, stmt, now, id, now)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+// Deletes a snippet, whether or not it has expired. Returns ErrNoRecord if there isn't one
+// with the given ID.
+func (m *SnippetModel) Delete(ctx context.Context, id int) error {
+	stmt := "DELETE FROM snippets WHERE id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+// Hides a snippet pending review, or puts it back. Returns ErrNoRecord if there isn't a
+// snippet with the given ID.
+func (m *SnippetModel) SetHidden(ctx context.Context, id int, hidden bool) error {
+	stmt := "UPDATE snippets SET hidden = ? WHERE id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, hidden, id)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return checkRowsAffected(result)
+}
@@ -0,0 +1,129 @@
+// Package sqlite provides implementations of the model interfaces which are backed by an
+// SQLite database, using the pure-Go modernc.org/sqlite driver (so no cgo is needed). This
+// makes it possible to run the application locally without a Postgres server.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+// The SQLite migrations, which mirror the Postgres ones (see models.ReadMigrations).
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Opens the SQLite database at the given DSN (e.g. "file:snippetbox.db") and brings its
+// schema up to date.
+func Open(dsn string) (*sql.DB, error) {
+	// Store times in a fixed, sortable format (the driver defaults to time.Time.String(),
+	// which can't be compared as text), enforce foreign keys, and wait for locks rather
+	// than failing immediately with SQLITE_BUSY.
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	dsn += sep + "_time_format=sqlite&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only supports a single writer at a time, and each connection to an in-memory
+	// database gets its own separate database. Using one connection avoids both problems.
+	db.SetMaxOpenConns(1)
+
+	err = Migrate(context.Background(), db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Brings the database schema up to date, by applying the migrations which haven't been
+// applied yet. The versions which have been applied are recorded in the schema_migrations
+// table, and all of the migrations are applied in a single transaction.
+//
+// Some changes (such as adding a constraint) mean rebuilding a table, which would delete the
+// rows which refer to it if foreign keys were enforced. So they're turned off while the
+// migrations run, and checked before the changes are committed instead.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	migrations, err := models.ReadMigrations(migrationFiles)
+	if err != nil {
+		return err
+	}
+
+	// The foreign_keys pragma can't be changed inside a transaction, and only applies to a
+	// single connection, so we hold on to one connection throughout.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF")
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at DATETIME NOT NULL
+	)`
+
+	_, err = tx.ExecContext(ctx, stmt)
+	if err != nil {
+		return err
+	}
+
+	var current int
+
+	err = tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations[min(current, len(migrations)):] {
+		_, err = tx.ExecContext(ctx, m.SQL)
+		if err != nil {
+			return fmt.Errorf("sqlite: migration %s: %w", m.Name, err)
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, applied_at) VALUES(?, ?)", m.Version, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+	}
+
+	// foreign_key_check returns a row for each violation.
+	rows, err := tx.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	violation := rows.Next()
+	rows.Close()
+
+	if violation {
+		return errors.New("sqlite: migrations left foreign key violations")
+	}
+
+	return tx.Commit()
+}
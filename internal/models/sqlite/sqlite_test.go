@@ -0,0 +1,158 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/assert"
+	"snippetbox.prajjmon.net/internal/models"
+	"snippetbox.prajjmon.net/internal/models/modelstest"
+	"snippetbox.prajjmon.net/internal/passhash"
+)
+
+func TestConformance(t *testing.T) {
+	modelstest.Run(t, func(t *testing.T) *modelstest.Backend {
+		// Each subtest gets a brand new database file, which is removed automatically
+		// when the subtest finishes.
+		db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		users := &UserModel{DB: db}
+
+		return &modelstest.Backend{
+			Snippets:      &SnippetModel{DB: db},
+			Users:         users,
+			Tokens:        &TokenModel{DB: db},
+			MFA:           &MFAModel{DB: db},
+			Reports:       &ReportModel{DB: db},
+			Orgs:          &OrgModel{DB: db},
+			Shares:        &ShareModel{DB: db},
+			Links:         &ShareLinkModel{DB: db},
+			Collections:   &CollectionModel{DB: db},
+			Stars:         &StarModel{DB: db},
+			AuditLog:      &AuditLogModel{DB: db},
+			LoginAttempts: &LoginAttemptModel{DB: db},
+			UserSessions:  &UserSessionModel{DB: db},
+			ExpireSnippet: func(t *testing.T, id int) {
+				_, err := db.Exec("UPDATE snippets SET expires = ? WHERE id = ?", time.Now().UTC().Add(-time.Second), id)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			SetPasswordParams: func(p passhash.Params) {
+				users.PasswordParams = p
+			},
+		}
+	})
+}
+
+func TestAuditLogAppendOnly(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	m := &AuditLogModel{DB: db}
+
+	err = m.Log(context.Background(), models.AuditEntry{ActorID: 1, Action: models.AuditLogin})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec("UPDATE audit_log SET actor_id = 2")
+	assert.Equal(t, err != nil, true)
+
+	_, err = db.Exec("DELETE FROM audit_log")
+	assert.Equal(t, err != nil, true)
+}
+
+func TestMigrateUpgrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	// Build a database with the original schema and some data, the way it would have been
+	// left by a version of the application from before there were migrations.
+	initial, err := migrationFiles.ReadFile("migrations/0001_initial.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stmts := []string{
+		string(initial),
+		`INSERT INTO users (name, email, hashed_password, created_at) VALUES ('Alice', 'alice@example.com', x'00', '2024-01-01 00:00:00')`,
+		`INSERT INTO snippets (title, content, created, expires) VALUES ('An old snippet', 'Content', '2024-01-01 00:00:00', '2024-01-08 00:00:00')`,
+	}
+	for _, stmt := range stmts {
+		_, err = db.Exec(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	migrations, err := models.ReadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Opening the database twice checks that migrations which have been applied aren't
+	// applied again.
+	for range 2 {
+		db, err = Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var version, snippets, users int
+
+		err = db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, version, len(migrations))
+
+		err = db.QueryRow("SELECT COUNT(*) FROM snippets").Scan(&snippets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, snippets, 0)
+
+		err = db.QueryRow("SELECT COUNT(*) FROM users WHERE role = 'user' AND verified AND NOT disabled").Scan(&users)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, users, 1)
+
+		db.Close()
+	}
+}
+
+func TestMigrationsMatchPostgres(t *testing.T) {
+	sqliteMigrations, err := models.ReadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	postgresMigrations, err := models.ReadMigrations(os.DirFS(".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, len(sqliteMigrations), len(postgresMigrations))
+
+	for i := range min(len(sqliteMigrations), len(postgresMigrations)) {
+		assert.Equal(t, sqliteMigrations[i].Name, postgresMigrations[i].Name)
+	}
+}
@@ -0,0 +1,164 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type StarModel struct {
+	DB *sql.DB
+
+	// The deadline applied to each query. If zero, models.DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Stars the snippet for the user. Returns ErrDuplicateStar if they've already starred it.
+func (m *StarModel) Insert(ctx context.Context, userID, snippetID int) error {
+	stmt := `INSERT INTO stars (user_id, snippet_id, created_at) VALUES(?, ?, ?)
+	ON CONFLICT (user_id, snippet_id) DO NOTHING`
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, userID, snippetID, time.Now().UTC())
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return models.ErrDuplicateStar
+	}
+
+	return nil
+}
+
+// Removes the user's star from the snippet. Returns ErrNoRecord if they haven't starred it.
+func (m *StarModel) Delete(ctx context.Context, userID, snippetID int) error {
+	stmt := "DELETE FROM stars WHERE user_id = ? AND snippet_id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, userID, snippetID)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+// Reports whether the user has starred the snippet.
+func (m *StarModel) Exists(ctx context.Context, userID, snippetID int) (bool, error) {
+	var exists bool
+
+	stmt := "SELECT EXISTS(SELECT true FROM stars WHERE user_id = ? AND snippet_id = ?)"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, userID, snippetID).Scan(&exists)
+	if err != nil {
+		return false, models.TranslateContextError(ctx, err)
+	}
+
+	return exists, nil
+}
+
+// Returns the number of users who have starred the snippet.
+func (m *StarModel) Count(ctx context.Context, snippetID int) (int, error) {
+	var count int
+
+	stmt := "SELECT COUNT(*) FROM stars WHERE snippet_id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, snippetID).Scan(&count)
+	if err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	return count, nil
+}
+
+// Returns the user's stars, most recent first. Stars are removed when their snippet is
+// deleted, but stars on expired and hidden snippets are still included.
+func (m *StarModel) ListForUser(ctx context.Context, userID int) ([]models.Star, error) {
+	stmt := `SELECT user_id, snippet_id, created_at FROM stars
+	WHERE user_id = ?
+	ORDER BY created_at DESC, snippet_id DESC`
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var stars []models.Star
+
+	for rows.Next() {
+		var s models.Star
+		err = rows.Scan(&s.UserID, &s.SnippetID, &s.Created)
+		if err != nil {
+			return nil, models.TranslateContextError(ctx, err)
+		}
+
+		stars = append(stars, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	return stars, nil
+}
+
+// Returns the snippets which have been given the most stars since the given time, counting
+// only those stars. Ties are broken by snippet ID. Every snippet is included whoever can see
+// it, so callers need to leave out the ones which shouldn't be shown.
+func (m *StarModel) MostStarred(ctx context.Context, since time.Time, limit int) ([]models.SnippetStars, error) {
+	stmt := `SELECT snippet_id, COUNT(*) FROM stars
+	WHERE created_at >= ?
+	GROUP BY snippet_id
+	ORDER BY COUNT(*) DESC, snippet_id LIMIT ?`
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, since.UTC(), limit)
+	if err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var starred []models.SnippetStars
+
+	for rows.Next() {
+		var s models.SnippetStars
+		err = rows.Scan(&s.SnippetID, &s.Stars)
+		if err != nil {
+			return nil, models.TranslateContextError(ctx, err)
+		}
+
+		starred = append(starred, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	return starred, nil
+}
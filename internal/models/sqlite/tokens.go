@@ -0,0 +1,81 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type TokenModel struct {
+	DB *sql.DB
+
+	// The deadline applied to each query. If zero, models.DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Creates a new token for the given user which expires after ttl, and returns its plaintext.
+func (m *TokenModel) New(ctx context.Context, userID int, ttl time.Duration, scope string) (string, error) {
+	plaintext, hash, err := models.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	stmt := "INSERT INTO tokens (hash, user_id, expiry, scope) VALUES(?, ?, ?, ?)"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, stmt, hash, userID, time.Now().UTC().Add(ttl), scope)
+	if err != nil {
+		return "", models.TranslateContextError(ctx, err)
+	}
+
+	return plaintext, nil
+}
+
+// Returns the ID of the user that a valid (unexpired) token belongs to, without using it up.
+func (m *TokenModel) GetUserID(ctx context.Context, plaintext, scope string) (int, error) {
+	stmt := "SELECT user_id FROM tokens WHERE hash = ? AND scope = ? AND expiry > ?"
+	return m.queryUserID(ctx, stmt, plaintext, scope)
+}
+
+// Like GetUserID, but also deletes the token so that it can't be used again.
+func (m *TokenModel) Consume(ctx context.Context, plaintext, scope string) (int, error) {
+	stmt := "DELETE FROM tokens WHERE hash = ? AND scope = ? AND expiry > ? RETURNING user_id"
+	return m.queryUserID(ctx, stmt, plaintext, scope)
+}
+
+func (m *TokenModel) queryUserID(ctx context.Context, stmt, plaintext, scope string) (int, error) {
+	var userID int
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, models.HashToken(plaintext), scope, time.Now().UTC()).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrNoRecord
+		}
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	return userID, nil
+}
+
+// Deletes all of a user's tokens for the given scope.
+func (m *TokenModel) DeleteAllForUser(ctx context.Context, userID int, scope string) error {
+	stmt := "DELETE FROM tokens WHERE user_id = ? AND scope = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, userID, scope)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,381 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"snippetbox.prajjmon.net/internal/models"
+	"snippetbox.prajjmon.net/internal/passhash"
+)
+
+type UserModel struct {
+	DB *sql.DB
+
+	// The deadline applied to each query. If zero, models.DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+
+	// How new passwords are hashed. Existing hashes are upgraded to these parameters when
+	// their users next log in.
+	PasswordParams passhash.Params
+}
+
+// Inserts a new user and returns their ID.
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) (int, error) {
+	hashedPassword, err := passhash.Hash(password, m.PasswordParams)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := "INSERT INTO users (name, email, hashed_password, created_at) VALUES(?, ?, ?, ?) RETURNING id"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	var id int
+	err = m.DB.QueryRowContext(ctx, stmt, name, email, hashedPassword, time.Now().UTC()).Scan(&id)
+	if err != nil {
+		if isUniqueViolation(err, "users.email") {
+			return 0, models.ErrDuplicateEmail
+		}
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	return id, nil
+}
+
+// Returns the ID of the user with the given email address and password. It returns
+// ErrInvalidCredentials if there's no such user, or ErrAccountDisabled if the password is
+// right but the account has been disabled.
+func (m *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
+	var id int
+	var hashedPassword string
+	var disabled bool
+
+	stmt := "SELECT id, hashed_password, disabled FROM users WHERE email = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, email).Scan(&id, &hashedPassword, &disabled)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrInvalidCredentials
+		}
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	match, err := passhash.Verify(password, hashedPassword)
+	if err != nil {
+		return 0, err
+	} else if !match {
+		return 0, models.ErrInvalidCredentials
+	}
+
+	if disabled {
+		return 0, models.ErrAccountDisabled
+	}
+
+	// A password which is too long for the current algorithm keeps its old hash.
+	if passhash.NeedsRehash(hashedPassword, m.PasswordParams) && len(password) <= m.PasswordParams.MaxPasswordLength() {
+		err = m.rehash(ctx, id, hashedPassword, password)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
+
+// Replaces the user's password hash with one made using the current parameters, unless it
+// has been changed since we read it.
+func (m *UserModel) rehash(ctx context.Context, id int, oldHash, password string) error {
+	newHash, err := passhash.Hash(password, m.PasswordParams)
+	if err != nil {
+		return err
+	}
+
+	stmt := "UPDATE users SET hashed_password = ? WHERE id = ? AND hashed_password = ?"
+
+	_, err = m.DB.ExecContext(ctx, stmt, newHash, id, oldHash)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
+
+func (m *UserModel) Exists(ctx context.Context, id int) (bool, error) {
+	var exists bool
+
+	stmt := "SELECT EXISTS(SELECT true FROM users WHERE id = ?)"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&exists)
+	if err != nil {
+		return false, models.TranslateContextError(ctx, err)
+	}
+
+	return exists, nil
+}
+
+// Returns the user with the given ID, or ErrNoRecord if there isn't one.
+func (m *UserModel) Get(ctx context.Context, id int) (models.User, error) {
+	stmt := "SELECT " + userColumns + " FROM users WHERE id = ?"
+	return m.getUser(ctx, stmt, id)
+}
+
+// Returns the user with the given email address, or ErrNoRecord if there isn't one.
+func (m *UserModel) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	stmt := "SELECT " + userColumns + " FROM users WHERE email = ?"
+	return m.getUser(ctx, stmt, email)
+}
+
+func (m *UserModel) getUser(ctx context.Context, stmt string, arg any) (models.User, error) {
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	u, err := scanUser(m.DB.QueryRowContext(ctx, stmt, arg))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, models.ErrNoRecord
+		}
+		return models.User{}, models.TranslateContextError(ctx, err)
+	}
+
+	return u, nil
+}
+
+// Returns the users matched by the query, which must select userColumns.
+func (m *UserModel) listUsers(ctx context.Context, stmt string, args ...any) ([]models.User, error) {
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var users []models.User
+
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, models.TranslateContextError(ctx, err)
+		}
+
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	return users, nil
+}
+
+// The columns which are scanned into a models.User by scanUser.
+const userColumns = "id, name, email, hashed_password, created_at, verified, role, disabled"
+
+// Scans a row of userColumns from either an *sql.Row or *sql.Rows.
+func scanUser(row interface{ Scan(dest ...any) error }) (models.User, error) {
+	var u models.User
+	err := row.Scan(&u.Id, &u.Name, &u.Email, &u.HashedPassword, &u.Created, &u.Verified, &u.Role, &u.Disabled)
+	return u, err
+}
+
+// Replaces the password for the given user, returning ErrNoRecord if the user doesn't exist.
+func (m *UserModel) UpdatePassword(ctx context.Context, id int, password string) error {
+	hashedPassword, err := passhash.Hash(password, m.PasswordParams)
+	if err != nil {
+		return err
+	}
+
+	stmt := "UPDATE users SET hashed_password = ? WHERE id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, hashedPassword, id)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+// Replaces the user's password, provided that currentPassword matches the one they have now.
+// It returns ErrInvalidCredentials if it doesn't, or ErrNoRecord if the user doesn't exist.
+func (m *UserModel) ChangePassword(ctx context.Context, id int, currentPassword, newPassword string) error {
+	var hashedPassword string
+
+	stmt := "SELECT hashed_password FROM users WHERE id = ?"
+
+	queryCtx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(queryCtx, stmt, id).Scan(&hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrNoRecord
+		}
+		return models.TranslateContextError(queryCtx, err)
+	}
+
+	match, err := passhash.Verify(currentPassword, hashedPassword)
+	if err != nil {
+		return err
+	} else if !match {
+		return models.ErrInvalidCredentials
+	}
+
+	return m.UpdatePassword(ctx, id, newPassword)
+}
+
+// Changes the user's display name.
+func (m *UserModel) UpdateName(ctx context.Context, id int, name string) error {
+	stmt := "UPDATE users SET name = ? WHERE id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, name, id)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+// Changes the user's email address and marks the account as unverified again. Returns
+// ErrDuplicateEmail if another account already uses the address.
+func (m *UserModel) UpdateEmail(ctx context.Context, id int, email string) error {
+	stmt := "UPDATE users SET email = ?, verified = false WHERE id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, email, id)
+	if err != nil {
+		if isUniqueViolation(err, "users.email") {
+			return models.ErrDuplicateEmail
+		}
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+// Marks the user's email address as verified.
+func (m *UserModel) SetVerified(ctx context.Context, id int) error {
+	stmt := "UPDATE users SET verified = true WHERE id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+// Changes the user's role, returning ErrInvalidRole if it isn't one of the known roles.
+func (m *UserModel) SetRole(ctx context.Context, id int, role models.Role) error {
+	if !role.Valid() {
+		return models.ErrInvalidRole
+	}
+
+	stmt := "UPDATE users SET role = ? WHERE id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, string(role), id)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+// Disables or re-enables the user's account.
+func (m *UserModel) SetDisabled(ctx context.Context, id int, disabled bool) error {
+	stmt := "UPDATE users SET disabled = ? WHERE id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, disabled, id)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+// Returns the total number of users.
+func (m *UserModel) Count(ctx context.Context) (int, error) {
+	var count int
+
+	stmt := "SELECT COUNT(*) FROM users"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt).Scan(&count)
+	if err != nil {
+		return 0, models.TranslateContextError(ctx, err)
+	}
+
+	return count, nil
+}
+
+// Returns the users who signed up most recently, newest first.
+func (m *UserModel) Latest(ctx context.Context, limit int) ([]models.User, error) {
+	stmt := "SELECT " + userColumns + " FROM users ORDER BY created_at DESC, id DESC LIMIT ?"
+	return m.listUsers(ctx, stmt, limit)
+}
+
+// Returns the users whose name or email address contains the query (ignoring case, although
+// SQLite only folds the case of ASCII letters), in the order that they signed up.
+func (m *UserModel) Search(ctx context.Context, query string, limit int) ([]models.User, error) {
+	stmt := `SELECT ` + userColumns + ` FROM users
+	WHERE name LIKE ?1 ESCAPE '\' OR email LIKE ?1 ESCAPE '\'
+	ORDER BY id LIMIT ?2`
+	return m.listUsers(ctx, stmt, models.ContainsPattern(query), limit)
+}
+
+// Reports whether err is a UNIQUE constraint violation on the given column (in SQLite's
+// "table.column" form).
+func isUniqueViolation(err error, column string) bool {
+	var sqliteError *sqlite.Error
+	if errors.As(err, &sqliteError) {
+		return sqliteError.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE && strings.Contains(sqliteError.Error(), column)
+	}
+
+	return false
+}
+
+// Returns ErrNoRecord if the statement which produced result didn't change any rows.
+func checkRowsAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/models"
+)
+
+type UserSessionModel struct {
+	DB *sql.DB
+
+	// The deadline applied to each query. If zero, models.DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Records a new session for the user which lasts until expires, and returns its ID.
+func (m *UserSessionModel) Insert(ctx context.Context, userID int, ip, userAgent string, expires time.Time) (string, error) {
+	id, err := models.GenerateSessionID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, "DELETE FROM user_sessions WHERE user_id = ? AND expires_at <= ?", userID, now)
+	if err != nil {
+		return "", models.TranslateContextError(ctx, err)
+	}
+
+	stmt := `INSERT INTO user_sessions (id, user_id, created_at, last_seen_at, expires_at, ip, user_agent)
+	VALUES(?, ?, ?, ?, ?, ?, ?)`
+
+	_, err = m.DB.ExecContext(ctx, stmt, id, userID, now, now, expires.UTC(), ip, userAgent)
+	if err != nil {
+		return "", models.TranslateContextError(ctx, err)
+	}
+
+	return id, nil
+}
+
+// Returns the session with the given ID, or ErrNoRecord if it has been revoked or expired.
+func (m *UserSessionModel) Get(ctx context.Context, id string) (models.UserSession, error) {
+	var s models.UserSession
+
+	stmt := `SELECT id, user_id, created_at, last_seen_at, expires_at, ip, user_agent FROM user_sessions
+	WHERE id = ? AND expires_at > ?`
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, id, time.Now().UTC()).Scan(&s.ID, &s.UserID, &s.Created, &s.LastSeen, &s.Expires, &s.IP, &s.UserAgent)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.UserSession{}, models.ErrNoRecord
+		}
+		return models.UserSession{}, models.TranslateContextError(ctx, err)
+	}
+
+	return s, nil
+}
+
+// Marks the session as having been used just now, from the given IP address and user agent.
+func (m *UserSessionModel) Touch(ctx context.Context, id, ip, userAgent string) error {
+	stmt := "UPDATE user_sessions SET last_seen_at = ?, ip = ?, user_agent = ? WHERE id = ?"
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, time.Now().UTC(), ip, userAgent, id)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+// Returns the user's unexpired sessions, most recently used first.
+func (m *UserSessionModel) ListForUser(ctx context.Context, userID int) ([]models.UserSession, error) {
+	stmt := `SELECT id, user_id, created_at, last_seen_at, expires_at, ip, user_agent FROM user_sessions
+	WHERE user_id = ? AND expires_at > ?
+	ORDER BY last_seen_at DESC, created_at DESC`
+
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID, time.Now().UTC())
+	if err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var sessions []models.UserSession
+
+	for rows.Next() {
+		var s models.UserSession
+		err = rows.Scan(&s.ID, &s.UserID, &s.Created, &s.LastSeen, &s.Expires, &s.IP, &s.UserAgent)
+		if err != nil {
+			return nil, models.TranslateContextError(ctx, err)
+		}
+
+		sessions = append(sessions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, models.TranslateContextError(ctx, err)
+	}
+
+	return sessions, nil
+}
+
+// Revokes one of the user's sessions, returning ErrNoRecord if they don't have one with that ID.
+func (m *UserSessionModel) Delete(ctx context.Context, userID int, id string) error {
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, "DELETE FROM user_sessions WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+// Revokes all of the user's sessions apart from the one with ID exceptID.
+func (m *UserSessionModel) DeleteAllForUser(ctx context.Context, userID int, exceptID string) error {
+	ctx, cancel := models.WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, "DELETE FROM user_sessions WHERE user_id = ? AND id <> ?", userID, exceptID)
+	if err != nil {
+		return models.TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
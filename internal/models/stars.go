@@ -0,0 +1,184 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// A user's bookmark of a snippet. Each user can star a snippet at most once.
+type Star struct {
+	UserID    int
+	SnippetID int
+	Created   time.Time
+}
+
+// The number of stars which a snippet has been given.
+type SnippetStars struct {
+	SnippetID int
+	Stars     int
+}
+
+type StarModelInterface interface {
+	Insert(ctx context.Context, userID, snippetID int) error
+	Delete(ctx context.Context, userID, snippetID int) error
+	Exists(ctx context.Context, userID, snippetID int) (bool, error)
+	Count(ctx context.Context, snippetID int) (int, error)
+	ListForUser(ctx context.Context, userID int) ([]Star, error)
+	MostStarred(ctx context.Context, since time.Time, limit int) ([]SnippetStars, error)
+}
+
+type StarModel struct {
+	DbPool *pgxpool.Pool
+
+	// The deadline applied to each query. If zero, DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Stars the snippet for the user. Returns ErrDuplicateStar if they've already starred it.
+func (m *StarModel) Insert(ctx context.Context, userID, snippetID int) error {
+	stmt := `INSERT INTO stars (user_id, snippet_id, created_at) VALUES($1, $2, NOW())
+	ON CONFLICT (user_id, snippet_id) DO NOTHING`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, userID, snippetID)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrDuplicateStar
+	}
+
+	return nil
+}
+
+// Removes the user's star from the snippet. Returns ErrNoRecord if they haven't starred it.
+func (m *StarModel) Delete(ctx context.Context, userID, snippetID int) error {
+	stmt := "DELETE FROM stars WHERE user_id = $1 AND snippet_id = $2"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, userID, snippetID)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Reports whether the user has starred the snippet.
+func (m *StarModel) Exists(ctx context.Context, userID, snippetID int) (bool, error) {
+	var exists bool
+
+	stmt := "SELECT EXISTS(SELECT true FROM stars WHERE user_id = $1 AND snippet_id = $2)"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, stmt, userID, snippetID).Scan(&exists)
+	if err != nil {
+		return false, TranslateContextError(ctx, err)
+	}
+
+	return exists, nil
+}
+
+// Returns the number of users who have starred the snippet.
+func (m *StarModel) Count(ctx context.Context, snippetID int) (int, error) {
+	var count int
+
+	stmt := "SELECT COUNT(*) FROM stars WHERE snippet_id = $1"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, stmt, snippetID).Scan(&count)
+	if err != nil {
+		return 0, TranslateContextError(ctx, err)
+	}
+
+	return count, nil
+}
+
+// Returns the user's stars, most recent first. Stars are removed when their snippet is
+// deleted, but stars on expired and hidden snippets are still included.
+func (m *StarModel) ListForUser(ctx context.Context, userID int) ([]Star, error) {
+	stmt := `SELECT user_id, snippet_id, created_at FROM stars
+	WHERE user_id = $1
+	ORDER BY created_at DESC, snippet_id DESC`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DbPool.Query(ctx, stmt, userID)
+	if err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var stars []Star
+
+	for rows.Next() {
+		var s Star
+		err = rows.Scan(&s.UserID, &s.SnippetID, &s.Created)
+		if err != nil {
+			return nil, TranslateContextError(ctx, err)
+		}
+
+		stars = append(stars, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	return stars, nil
+}
+
+// Returns the snippets which have been given the most stars since the given time, counting
+// only those stars. Ties are broken by snippet ID. Every snippet is included whoever can see
+// it, so callers need to leave out the ones which shouldn't be shown.
+func (m *StarModel) MostStarred(ctx context.Context, since time.Time, limit int) ([]SnippetStars, error) {
+	stmt := `SELECT snippet_id, COUNT(*) FROM stars
+	WHERE created_at >= $1
+	GROUP BY snippet_id
+	ORDER BY COUNT(*) DESC, snippet_id LIMIT $2`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DbPool.Query(ctx, stmt, since, limit)
+	if err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var starred []SnippetStars
+
+	for rows.Next() {
+		var s SnippetStars
+		err = rows.Scan(&s.SnippetID, &s.Stars)
+		if err != nil {
+			return nil, TranslateContextError(ctx, err)
+		}
+
+		starred = append(starred, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	return starred, nil
+}
@@ -0,0 +1,20 @@
+DROP TABLE IF EXISTS schema_migrations;
+DROP TABLE IF EXISTS user_sessions;
+DROP TABLE IF EXISTS login_failures;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS totp_secrets;
+DROP TABLE IF EXISTS tokens;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS audit_log;
+DROP FUNCTION IF EXISTS audit_log_append_only;
+DROP TABLE IF EXISTS reports;
+DROP TABLE IF EXISTS stars;
+DROP TABLE IF EXISTS collection_snippets;
+DROP TABLE IF EXISTS collections;
+DROP TABLE IF EXISTS share_links;
+DROP TABLE IF EXISTS snippet_shares;
+DROP TABLE IF EXISTS snippets;
+DROP TABLE IF EXISTS org_invitations;
+DROP TABLE IF EXISTS org_members;
+DROP TABLE IF EXISTS orgs;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Token scopes. A token is only valid for the scope that it was created for.
+const (
+	ScopePasswordReset     = "password-reset"
+	ScopeEmailVerification = "email-verification"
+)
+
+// Tokens are single-use secrets which we send to users (e.g. in a password reset email). Only
+// a SHA-256 hash of each token is stored, so a leaked copy of the database can't be used to
+// take over accounts.
+type TokenModelInterface interface {
+	New(ctx context.Context, userID int, ttl time.Duration, scope string) (string, error)
+	GetUserID(ctx context.Context, plaintext, scope string) (int, error)
+	Consume(ctx context.Context, plaintext, scope string) (int, error)
+	DeleteAllForUser(ctx context.Context, userID int, scope string) error
+}
+
+// Generates a new random token, returning both the plaintext (which is safe to use in a URL)
+// and the hash which should be stored.
+func GenerateToken() (string, []byte, error) {
+	b := make([]byte, 32)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", nil, err
+	}
+
+	plaintext := base64.RawURLEncoding.EncodeToString(b)
+
+	return plaintext, HashToken(plaintext), nil
+}
+
+// Returns the hash which is stored for the given plaintext token.
+func HashToken(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+type TokenModel struct {
+	DbPool *pgxpool.Pool
+
+	// The deadline applied to each query. If zero, DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Creates a new token for the given user which expires after ttl, and returns its plaintext.
+func (m *TokenModel) New(ctx context.Context, userID int, ttl time.Duration, scope string) (string, error) {
+	plaintext, hash, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	stmt := "INSERT INTO tokens (hash, user_id, expiry, scope) VALUES($1, $2, $3, $4)"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	_, err = m.DbPool.Exec(ctx, stmt, hash, userID, time.Now().Add(ttl), scope)
+	if err != nil {
+		return "", TranslateContextError(ctx, err)
+	}
+
+	return plaintext, nil
+}
+
+// Returns the ID of the user that a valid (unexpired) token belongs to, without using it up.
+// ErrNoRecord is returned if the token doesn't exist, has expired or is for another scope.
+func (m *TokenModel) GetUserID(ctx context.Context, plaintext, scope string) (int, error) {
+	var userID int
+
+	stmt := "SELECT user_id FROM tokens WHERE hash = $1 AND scope = $2 AND expiry > NOW()"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, stmt, HashToken(plaintext), scope).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, TranslateContextError(ctx, err)
+	}
+
+	return userID, nil
+}
+
+// Like GetUserID, but also deletes the token so that it can't be used again. Deleting and
+// returning the row in a single statement means that two concurrent requests can't both
+// use the same token.
+func (m *TokenModel) Consume(ctx context.Context, plaintext, scope string) (int, error) {
+	var userID int
+
+	stmt := "DELETE FROM tokens WHERE hash = $1 AND scope = $2 AND expiry > NOW() RETURNING user_id"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, stmt, HashToken(plaintext), scope).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, TranslateContextError(ctx, err)
+	}
+
+	return userID, nil
+}
+
+// Deletes all of a user's tokens for the given scope.
+func (m *TokenModel) DeleteAllForUser(ctx context.Context, userID int, scope string) error {
+	stmt := "DELETE FROM tokens WHERE user_id = $1 AND scope = $2"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	_, err := m.DbPool.Exec(ctx, stmt, userID, scope)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
@@ -3,20 +3,62 @@ package models
 import (
 	"context"
 	"errors"
-	"fmt"
 	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"golang.org/x/crypto/bcrypt"
+	"snippetbox.prajjmon.net/internal/passhash"
 )
 
 type UserModelInterface interface {
-	Insert(name, email, password string) error
-	Authenticate(email, password string) (int, error)
-	Exists(id int) (bool, error)
+	Insert(ctx context.Context, name, email, password string) (int, error)
+	Authenticate(ctx context.Context, email, password string) (int, error)
+	Exists(ctx context.Context, id int) (bool, error)
+	Get(ctx context.Context, id int) (User, error)
+	GetByEmail(ctx context.Context, email string) (User, error)
+	UpdatePassword(ctx context.Context, id int, password string) error
+	ChangePassword(ctx context.Context, id int, currentPassword, newPassword string) error
+	UpdateName(ctx context.Context, id int, name string) error
+	UpdateEmail(ctx context.Context, id int, email string) error
+	SetVerified(ctx context.Context, id int) error
+	SetRole(ctx context.Context, id int, role Role) error
+	SetDisabled(ctx context.Context, id int, disabled bool) error
+	Count(ctx context.Context) (int, error)
+	Latest(ctx context.Context, limit int) ([]User, error)
+	Search(ctx context.Context, query string, limit int) ([]User, error)
+}
+
+// What a user is allowed to do. Every user starts off with RoleUser. Moderators can look after
+// content which other users have posted, and admins can also manage the users themselves.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Every role, from the least to the most privileged.
+var Roles = []Role{RoleUser, RoleModerator, RoleAdmin}
+
+// Reports whether r is one of the known roles.
+func (r Role) Valid() bool {
+	switch r {
+	case RoleUser, RoleModerator, RoleAdmin:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r Role) IsModerator() bool {
+	return r == RoleModerator || r == RoleAdmin
+}
+
+func (r Role) IsAdmin() bool {
+	return r == RoleAdmin
 }
 
 type User struct {
@@ -25,55 +67,90 @@ type User struct {
 	Email          string
 	HashedPassword []byte
 	Created        time.Time
+
+	// Whether the user has proved that they own their email address.
+	Verified bool
+
+	Role Role
+
+	// Disabled users can't log in.
+	Disabled bool
 }
 
 type UserModel struct {
 	DbPool *pgxpool.Pool
+
+	// The deadline applied to each query. If zero, DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+
+	// How new passwords are hashed. Existing hashes are upgraded to these parameters when
+	// their users next log in.
+	PasswordParams passhash.Params
 }
 
-func (m *UserModel) Insert(name, email, password string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// Inserts a new user and returns their ID.
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) (int, error) {
+	hashedPassword, err := passhash.Hash(password, m.PasswordParams)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	sqlStatement := "INSERT into users (name, email, hashed_password, created_at) VALUES($1, $2, $3, NOW())"
+	sqlStatement := "INSERT into users (name, email, hashed_password, created_at) VALUES($1, $2, $3, NOW()) RETURNING id"
 
-	_, err = m.DbPool.Exec(context.Background(), sqlStatement, name, email, hashedPassword)
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	var id int
+	err = m.DbPool.QueryRow(ctx, sqlStatement, name, email, hashedPassword).Scan(&id)
 	if err != nil {
-		var postgresError *pgconn.PgError
-		if errors.As(err, &postgresError) {
-			if postgresError.Code == "23505" && strings.Contains(postgresError.Message, "users_uc_email") {
-				return ErrDuplicateEmail
-			}
+		if isDuplicateEmail(err) {
+			return 0, ErrDuplicateEmail
 		}
-		return err
+		return 0, TranslateContextError(ctx, err)
 	}
 
-	return nil
+	return id, nil
 }
 
-func (m *UserModel) Authenticate(email, password string) (int, error) {
+// Returns the ID of the user with the given email address and password. It returns
+// ErrInvalidCredentials if there's no such user, or ErrAccountDisabled if the password is
+// right but the account has been disabled.
+func (m *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
 	var id int
-	var hashedPassword []byte
+	var hashedPassword string
+	var disabled bool
 
-	stmt := "SELECT id, hashed_password FROM users WHERE email = $1"
+	stmt := "SELECT id, hashed_password, disabled FROM users WHERE email = $1"
 
-	err := m.DbPool.QueryRow(context.Background(), stmt, email).Scan(&id, &hashedPassword)
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, stmt, email).Scan(&id, &hashedPassword, &disabled)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return 0, ErrInvalidCredentials
 		} else {
-			return 0, err
+			return 0, TranslateContextError(ctx, err)
 		}
 	}
 
-	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	match, err := passhash.Verify(password, hashedPassword)
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			fmt.Println("Error with login " + err.Error())
-			return 0, ErrInvalidCredentials
-		} else {
+		return 0, err
+	} else if !match {
+		return 0, ErrInvalidCredentials
+	}
+
+	if disabled {
+		return 0, ErrAccountDisabled
+	}
+
+	// Now that we know the password, we can bring the hash up to date if it was made with an
+	// old algorithm or old parameters. A password which is too long for the current algorithm
+	// (such as a long one from before a switch to bcrypt) keeps its old hash.
+	if passhash.NeedsRehash(hashedPassword, m.PasswordParams) && len(password) <= m.PasswordParams.MaxPasswordLength() {
+		err = m.rehash(ctx, id, hashedPassword, password)
+		if err != nil {
 			return 0, err
 		}
 	}
@@ -81,11 +158,300 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 	return id, nil
 }
 
-func (m *UserModel) Exists(id int) (bool, error) {
+// Replaces the user's password hash with a new one made using the current parameters. The
+// update is skipped if the hash has changed since we read it, so that we can't undo a
+// password change which happened in the meantime.
+func (m *UserModel) rehash(ctx context.Context, id int, oldHash, password string) error {
+	newHash, err := passhash.Hash(password, m.PasswordParams)
+	if err != nil {
+		return err
+	}
+
+	stmt := "UPDATE users SET hashed_password = $1 WHERE id = $2 AND hashed_password = $3"
+
+	_, err = m.DbPool.Exec(ctx, stmt, newHash, id, oldHash)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
+
+func (m *UserModel) Exists(ctx context.Context, id int) (bool, error) {
 	var exists bool
 
 	stmt := "SELECT EXISTS(SELECT true FROM users WHERE id = $1)"
 
-	err := m.DbPool.QueryRow(context.Background(), stmt, id).Scan(&exists)
-	return exists, err
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, stmt, id).Scan(&exists)
+	if err != nil {
+		return false, TranslateContextError(ctx, err)
+	}
+
+	return exists, nil
+}
+
+// Returns the user with the given ID, or ErrNoRecord if there isn't one.
+func (m *UserModel) Get(ctx context.Context, id int) (User, error) {
+	stmt := "SELECT " + userColumns + " FROM users WHERE id = $1"
+	return m.getUser(ctx, stmt, id)
+}
+
+// Returns the user with the given email address, or ErrNoRecord if there isn't one.
+func (m *UserModel) GetByEmail(ctx context.Context, email string) (User, error) {
+	stmt := "SELECT " + userColumns + " FROM users WHERE email = $1"
+	return m.getUser(ctx, stmt, email)
+}
+
+func (m *UserModel) getUser(ctx context.Context, stmt string, arg any) (User, error) {
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	u, err := scanUser(m.DbPool.QueryRow(ctx, stmt, arg))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, ErrNoRecord
+		}
+		return User{}, TranslateContextError(ctx, err)
+	}
+
+	return u, nil
+}
+
+// Returns the users matched by the query, which must select userColumns.
+func (m *UserModel) listUsers(ctx context.Context, stmt string, args ...any) ([]User, error) {
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DbPool.Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var users []User
+
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, TranslateContextError(ctx, err)
+		}
+
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	return users, nil
+}
+
+// The columns which are scanned into a User by scanUser.
+const userColumns = "id, name, email, hashed_password, created_at, verified, role, disabled"
+
+// Scans a row of userColumns. Both pgx.Row and pgx.Rows can be passed in.
+func scanUser(row pgx.Row) (User, error) {
+	var u User
+	err := row.Scan(&u.Id, &u.Name, &u.Email, &u.HashedPassword, &u.Created, &u.Verified, &u.Role, &u.Disabled)
+	return u, err
+}
+
+// Replaces the password for the given user, returning ErrNoRecord if the user doesn't exist.
+func (m *UserModel) UpdatePassword(ctx context.Context, id int, password string) error {
+	hashedPassword, err := passhash.Hash(password, m.PasswordParams)
+	if err != nil {
+		return err
+	}
+
+	stmt := "UPDATE users SET hashed_password = $1 WHERE id = $2"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, hashedPassword, id)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Replaces the user's password, provided that currentPassword matches the one they have now.
+// It returns ErrInvalidCredentials if it doesn't, or ErrNoRecord if the user doesn't exist.
+func (m *UserModel) ChangePassword(ctx context.Context, id int, currentPassword, newPassword string) error {
+	var hashedPassword string
+
+	stmt := "SELECT hashed_password FROM users WHERE id = $1"
+
+	queryCtx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(queryCtx, stmt, id).Scan(&hashedPassword)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return TranslateContextError(queryCtx, err)
+	}
+
+	match, err := passhash.Verify(currentPassword, hashedPassword)
+	if err != nil {
+		return err
+	} else if !match {
+		return ErrInvalidCredentials
+	}
+
+	return m.UpdatePassword(ctx, id, newPassword)
+}
+
+// Changes the user's display name.
+func (m *UserModel) UpdateName(ctx context.Context, id int, name string) error {
+	stmt := "UPDATE users SET name = $1 WHERE id = $2"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, name, id)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Changes the user's email address. As they haven't proved that they own the new address
+// yet, the account is marked as unverified again. Returns ErrDuplicateEmail if another
+// account already uses the address.
+func (m *UserModel) UpdateEmail(ctx context.Context, id int, email string) error {
+	stmt := "UPDATE users SET email = $1, verified = false WHERE id = $2"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, email, id)
+	if err != nil {
+		if isDuplicateEmail(err) {
+			return ErrDuplicateEmail
+		}
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Marks the user's email address as verified.
+func (m *UserModel) SetVerified(ctx context.Context, id int) error {
+	stmt := "UPDATE users SET verified = true WHERE id = $1"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, id)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Changes the user's role, returning ErrInvalidRole if it isn't one of the known roles.
+func (m *UserModel) SetRole(ctx context.Context, id int, role Role) error {
+	if !role.Valid() {
+		return ErrInvalidRole
+	}
+
+	stmt := "UPDATE users SET role = $1 WHERE id = $2"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, string(role), id)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Disables or re-enables the user's account.
+func (m *UserModel) SetDisabled(ctx context.Context, id int, disabled bool) error {
+	stmt := "UPDATE users SET disabled = $1 WHERE id = $2"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, disabled, id)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Returns the total number of users.
+func (m *UserModel) Count(ctx context.Context) (int, error) {
+	var count int
+
+	stmt := "SELECT COUNT(*) FROM users"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, stmt).Scan(&count)
+	if err != nil {
+		return 0, TranslateContextError(ctx, err)
+	}
+
+	return count, nil
+}
+
+// Returns the users who signed up most recently, newest first.
+func (m *UserModel) Latest(ctx context.Context, limit int) ([]User, error) {
+	stmt := "SELECT " + userColumns + " FROM users ORDER BY created_at DESC, id DESC LIMIT $1"
+	return m.listUsers(ctx, stmt, limit)
+}
+
+// Returns the users whose name or email address contains the query (ignoring case), in the
+// order that they signed up.
+func (m *UserModel) Search(ctx context.Context, query string, limit int) ([]User, error) {
+	stmt := "SELECT " + userColumns + " FROM users WHERE name ILIKE $1 OR email ILIKE $1 ORDER BY id LIMIT $2"
+	return m.listUsers(ctx, stmt, ContainsPattern(query), limit)
+}
+
+// Reports whether err is a violation of the unique constraint on users.email.
+func isDuplicateEmail(err error) bool {
+	var postgresError *pgconn.PgError
+	if errors.As(err, &postgresError) {
+		return postgresError.Code == "23505" && strings.Contains(postgresError.Message, "users_uc_email")
+	}
+
+	return false
 }
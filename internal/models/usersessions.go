@@ -0,0 +1,195 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Describes one of a user's logged in sessions, so that they can see where they are logged in
+// and revoke the sessions they don't recognise. The ID is our own random identifier, which is
+// stored in the session data; it is deliberately not the session token, so showing it to the
+// user (or putting it in a form) doesn't let anyone take over the session.
+type UserSession struct {
+	ID        string
+	UserID    int
+	Created   time.Time
+	LastSeen  time.Time
+	Expires   time.Time
+	IP        string
+	UserAgent string
+}
+
+// Records metadata about logged in sessions. Deleting a session's record revokes it: the
+// authenticate middleware refuses any session whose record no longer exists.
+type UserSessionModelInterface interface {
+	Insert(ctx context.Context, userID int, ip, userAgent string, expires time.Time) (string, error)
+	Get(ctx context.Context, id string) (UserSession, error)
+	Touch(ctx context.Context, id, ip, userAgent string) error
+	ListForUser(ctx context.Context, userID int) ([]UserSession, error)
+	Delete(ctx context.Context, userID int, id string) error
+	DeleteAllForUser(ctx context.Context, userID int, exceptID string) error
+}
+
+// Generates a new random session ID.
+func GenerateSessionID() (string, error) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type UserSessionModel struct {
+	DbPool *pgxpool.Pool
+
+	// The deadline applied to each query. If zero, DefaultQueryTimeout is used.
+	QueryTimeout time.Duration
+}
+
+// Records a new session for the user which lasts until expires, and returns its ID.
+func (m *UserSessionModel) Insert(ctx context.Context, userID int, ip, userAgent string, expires time.Time) (string, error) {
+	id, err := GenerateSessionID()
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	// Clear out the user's expired sessions while we're here, as nothing else removes them.
+	_, err = m.DbPool.Exec(ctx, "DELETE FROM user_sessions WHERE user_id = $1 AND expires_at <= NOW()", userID)
+	if err != nil {
+		return "", TranslateContextError(ctx, err)
+	}
+
+	stmt := `INSERT INTO user_sessions (id, user_id, created_at, last_seen_at, expires_at, ip, user_agent)
+	VALUES($1, $2, NOW(), NOW(), $3, $4, $5)`
+
+	_, err = m.DbPool.Exec(ctx, stmt, id, userID, expires, ip, userAgent)
+	if err != nil {
+		return "", TranslateContextError(ctx, err)
+	}
+
+	return id, nil
+}
+
+// Returns the session with the given ID. ErrNoRecord is returned if it doesn't exist (because
+// it has been revoked) or has expired.
+func (m *UserSessionModel) Get(ctx context.Context, id string) (UserSession, error) {
+	var s UserSession
+
+	stmt := `SELECT id, user_id, created_at, last_seen_at, expires_at, ip, user_agent FROM user_sessions
+	WHERE id = $1 AND expires_at > NOW()`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	err := m.DbPool.QueryRow(ctx, stmt, id).Scan(&s.ID, &s.UserID, &s.Created, &s.LastSeen, &s.Expires, &s.IP, &s.UserAgent)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return UserSession{}, ErrNoRecord
+		}
+		return UserSession{}, TranslateContextError(ctx, err)
+	}
+
+	return s, nil
+}
+
+// Marks the session as having been used just now, from the given IP address and user agent.
+func (m *UserSessionModel) Touch(ctx context.Context, id, ip, userAgent string) error {
+	stmt := "UPDATE user_sessions SET last_seen_at = NOW(), ip = $1, user_agent = $2 WHERE id = $3"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, ip, userAgent, id)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Returns the user's unexpired sessions, most recently used first.
+func (m *UserSessionModel) ListForUser(ctx context.Context, userID int) ([]UserSession, error) {
+	stmt := `SELECT id, user_id, created_at, last_seen_at, expires_at, ip, user_agent FROM user_sessions
+	WHERE user_id = $1 AND expires_at > NOW()
+	ORDER BY last_seen_at DESC, created_at DESC`
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	rows, err := m.DbPool.Query(ctx, stmt, userID)
+	if err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var sessions []UserSession
+
+	for rows.Next() {
+		var s UserSession
+		err = rows.Scan(&s.ID, &s.UserID, &s.Created, &s.LastSeen, &s.Expires, &s.IP, &s.UserAgent)
+		if err != nil {
+			return nil, TranslateContextError(ctx, err)
+		}
+
+		sessions = append(sessions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, TranslateContextError(ctx, err)
+	}
+
+	return sessions, nil
+}
+
+// Revokes one of the user's sessions. ErrNoRecord is returned if the user doesn't have a
+// session with that ID.
+func (m *UserSessionModel) Delete(ctx context.Context, userID int, id string) error {
+	stmt := "DELETE FROM user_sessions WHERE id = $1 AND user_id = $2"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	tag, err := m.DbPool.Exec(ctx, stmt, id, userID)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Revokes all of the user's sessions apart from the one with ID exceptID (which can be empty
+// to revoke every session).
+func (m *UserSessionModel) DeleteAllForUser(ctx context.Context, userID int, exceptID string) error {
+	stmt := "DELETE FROM user_sessions WHERE user_id = $1 AND id <> $2"
+
+	ctx, cancel := WithQueryTimeout(ctx, m.QueryTimeout)
+	defer cancel()
+
+	_, err := m.DbPool.Exec(ctx, stmt, userID, exceptID)
+	if err != nil {
+		return TranslateContextError(ctx, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,241 @@
+// Package passhash hashes and verifies user passwords. Hashes are self-describing strings
+// which record the algorithm and parameters that produced them, so the parameters can be
+// tuned (or the algorithm changed) without invalidating the hashes which are already stored:
+//
+//	$argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>   (the PHC string format)
+//	$2a$10$<salt and hash>                        (bcrypt's own format)
+//
+// NeedsRehash reports whether a hash was made with anything other than the current
+// parameters, so that it can be upgraded the next time we see the plaintext password.
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The supported hashing algorithms.
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+const (
+	// bcrypt only looks at the first 72 bytes of a password.
+	bcryptMaxPasswordLength = 72
+
+	// argon2id can hash passwords of any length, but there's no point in letting clients
+	// make us hash megabytes of data.
+	maxPasswordLength = 1024
+)
+
+// Returned when a stored hash isn't in a format that we recognise.
+var ErrInvalidHash = errors.New("passhash: invalid hash format")
+
+// The algorithm and cost parameters used to hash new passwords. Any zero fields are taken
+// from DefaultParams.
+type Params struct {
+	Algorithm string
+
+	// The bcrypt cost (the base-2 logarithm of the number of rounds).
+	BcryptCost int
+
+	// The argon2id memory size in KiB, number of passes and degree of parallelism.
+	Argon2Memory  uint32
+	Argon2Time    uint32
+	Argon2Threads uint8
+}
+
+// The default parameters. The argon2id ones are the minimums recommended by the OWASP
+// password storage cheat sheet, and the bcrypt cost (which only applies if bcrypt is
+// selected) is the one we always used before argon2id was supported.
+var DefaultParams = Params{
+	Algorithm:     Argon2id,
+	BcryptCost:    bcrypt.DefaultCost,
+	Argon2Memory:  19 * 1024,
+	Argon2Time:    2,
+	Argon2Threads: 1,
+}
+
+func (p Params) withDefaults() Params {
+	if p.Algorithm == "" {
+		p.Algorithm = DefaultParams.Algorithm
+	}
+	if p.BcryptCost == 0 {
+		p.BcryptCost = DefaultParams.BcryptCost
+	}
+	if p.Argon2Memory == 0 {
+		p.Argon2Memory = DefaultParams.Argon2Memory
+	}
+	if p.Argon2Time == 0 {
+		p.Argon2Time = DefaultParams.Argon2Time
+	}
+	if p.Argon2Threads == 0 {
+		p.Argon2Threads = DefaultParams.Argon2Threads
+	}
+	return p
+}
+
+// Returns the length in bytes of the longest password that Hash accepts with the parameters.
+// Longer passwords should be turned away before they get this far.
+func (p Params) MaxPasswordLength() int {
+	if p.withDefaults().Algorithm == Bcrypt {
+		return bcryptMaxPasswordLength
+	}
+	return maxPasswordLength
+}
+
+// Checks that the parameters can be used to hash passwords.
+func (p Params) Validate() error {
+	p = p.withDefaults()
+
+	switch p.Algorithm {
+	case Argon2id:
+		// argon2 needs at least 8 KiB of memory for each thread.
+		if p.Argon2Memory < 8*uint32(p.Argon2Threads) {
+			return fmt.Errorf("passhash: argon2id memory must be at least %d KiB", 8*uint32(p.Argon2Threads))
+		}
+	case Bcrypt:
+		if p.BcryptCost < bcrypt.MinCost || p.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("passhash: bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return fmt.Errorf("passhash: unknown algorithm %q", p.Algorithm)
+	}
+
+	return nil
+}
+
+// Hashes the password using the algorithm and parameters in p. Note that bcrypt only looks
+// at the first 72 bytes of a password, so it returns an error for anything longer rather
+// than silently ignoring the rest. See MaxPasswordLength.
+func Hash(password string, p Params) (string, error) {
+	p = p.withDefaults()
+
+	err := p.Validate()
+	if err != nil {
+		return "", err
+	}
+
+	if p.Algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), p.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, argon2SaltLength)
+
+	_, err = rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.Argon2Time, p.Argon2Memory, p.Argon2Threads, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Argon2Memory, p.Argon2Time,
+		p.Argon2Threads, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Reports whether the password matches the hash, which can be in any supported format.
+func Verify(password, hash string) (bool, error) {
+	if isBcrypt(hash) {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+
+	p, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, p.Argon2Time, p.Argon2Memory, p.Argon2Threads, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+// Reports whether the hash was made with a different algorithm or different parameters to
+// p, in which case the password should be hashed again. Hashes which can't be parsed always
+// need rehashing.
+func NeedsRehash(hash string, p Params) bool {
+	p = p.withDefaults()
+
+	if isBcrypt(hash) {
+		if p.Algorithm != Bcrypt {
+			return true
+		}
+
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != p.BcryptCost
+	}
+
+	if p.Algorithm != Argon2id {
+		return true
+	}
+
+	hp, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return hp.Argon2Memory != p.Argon2Memory || hp.Argon2Time != p.Argon2Time ||
+		hp.Argon2Threads != p.Argon2Threads || len(salt) != argon2SaltLength || len(key) != argon2KeyLength
+}
+
+// Reports whether the hash is in one of the formats produced by bcrypt ($2a$, $2b$, $2y$).
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2")
+}
+
+// Parses a hash in the PHC string format for argon2id.
+func decodeArgon2id(hash string) (Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != Argon2id {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	p := Params{Algorithm: Argon2id}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Argon2Memory, &p.Argon2Time, &p.Argon2Threads)
+	if err != nil || p.Argon2Time == 0 || p.Argon2Threads == 0 {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	return p, salt, key, nil
+}
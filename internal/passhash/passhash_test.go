@@ -0,0 +1,221 @@
+package passhash
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"snippetbox.prajjmon.net/internal/assert"
+)
+
+// Cheap parameters, so that the tests don't spend most of their time hashing.
+var (
+	testArgon2 = Params{Algorithm: Argon2id, Argon2Memory: 64, Argon2Time: 1, Argon2Threads: 1}
+	testBcrypt = Params{Algorithm: Bcrypt, BcryptCost: 4}
+)
+
+func TestHashAndVerify(t *testing.T) {
+	tests := []struct {
+		name       string
+		params     Params
+		wantPrefix string
+	}{
+		{"argon2id", testArgon2, "$argon2id$v=19$m=64,t=1,p=1$"},
+		{"bcrypt", testBcrypt, "$2a$04$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := Hash("pa$$word", tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, strings.HasPrefix(hash, tt.wantPrefix), true)
+
+			ok, err := Verify("pa$$word", hash)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, ok, true)
+
+			ok, err = Verify("wrong password", hash)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, ok, false)
+
+			// Every hash gets its own salt.
+			other, err := Hash("pa$$word", tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, other == hash, false)
+		})
+	}
+}
+
+func TestHashBcryptTooLong(t *testing.T) {
+	_, err := Hash(strings.Repeat("a", 73), testBcrypt)
+	assert.Equal(t, err != nil, true)
+
+	// argon2id has no such limit.
+	hash, err := Hash(strings.Repeat("a", 73), testArgon2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := Verify(strings.Repeat("a", 72), hash)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ok, false)
+}
+
+func TestMaxPasswordLength(t *testing.T) {
+	for _, p := range []Params{testBcrypt, testArgon2} {
+		t.Run(p.Algorithm, func(t *testing.T) {
+			max := p.MaxPasswordLength()
+
+			// The longest password is accepted, and anything longer than bcrypt's limit is
+			// refused.
+			_, err := Hash(strings.Repeat("a", max), p)
+			assert.Equal(t, err, nil)
+
+			_, err = Hash(strings.Repeat("a", max+1), p)
+			assert.Equal(t, err != nil, p.Algorithm == Bcrypt)
+		})
+	}
+
+	assert.Equal(t, testBcrypt.MaxPasswordLength(), 72)
+	assert.Equal(t, Params{}.MaxPasswordLength(), 1024)
+}
+
+func TestVerifyInvalidHash(t *testing.T) {
+	tests := []string{
+		"",
+		"plaintext",
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$not base64!$a2V5a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$",
+	}
+
+	for _, hash := range tests {
+		t.Run(hash, func(t *testing.T) {
+			ok, err := Verify("pa$$word", hash)
+			assert.Equal(t, errors.Is(err, ErrInvalidHash), true)
+			assert.Equal(t, ok, false)
+			assert.Equal(t, NeedsRehash(hash, testArgon2), true)
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	argon2Hash, err := Hash("pa$$word", testArgon2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bcryptHash, err := Hash("pa$$word", testBcrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moreMemory := testArgon2
+	moreMemory.Argon2Memory = 128
+
+	moreThreads := testArgon2
+	moreThreads.Argon2Threads = 2
+
+	higherCost := testBcrypt
+	higherCost.BcryptCost = 5
+
+	tests := []struct {
+		name   string
+		hash   string
+		params Params
+		want   bool
+	}{
+		{"Same argon2id params", argon2Hash, testArgon2, false},
+		{"Different memory", argon2Hash, moreMemory, true},
+		{"Different threads", argon2Hash, moreThreads, true},
+		{"Same bcrypt cost", bcryptHash, testBcrypt, false},
+		{"Different bcrypt cost", bcryptHash, higherCost, true},
+		{"bcrypt to argon2id", bcryptHash, testArgon2, true},
+		{"argon2id to bcrypt", argon2Hash, testBcrypt, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, NeedsRehash(tt.hash, tt.params), tt.want)
+		})
+	}
+}
+
+func TestParamsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  Params
+		wantErr bool
+	}{
+		{"Defaults", Params{}, false},
+		{"bcrypt", Params{Algorithm: Bcrypt}, false},
+		{"bcrypt cost too high", Params{Algorithm: Bcrypt, BcryptCost: 32}, true},
+		{"argon2id memory too low", Params{Algorithm: Argon2id, Argon2Memory: 8, Argon2Threads: 2}, true},
+		{"Unknown algorithm", Params{Algorithm: "md5"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.params.Validate() != nil, tt.wantErr)
+		})
+	}
+}
+
+// The benchmarks show how long hashing takes with various parameters, to help choose ones
+// which fit within our login latency budget. Verifying costs the same as hashing, so the
+// results are the time that a login will spend on the password. Run them with:
+//
+//	go test -run=^$ -bench=. ./internal/passhash
+var benchmarkParams = []Params{
+	{Algorithm: Bcrypt, BcryptCost: 10},
+	{Algorithm: Bcrypt, BcryptCost: 12},
+	{Algorithm: Bcrypt, BcryptCost: 14},
+	DefaultParams,
+	{Algorithm: Argon2id, Argon2Memory: 46 * 1024, Argon2Time: 1, Argon2Threads: 1},
+	{Algorithm: Argon2id, Argon2Memory: 64 * 1024, Argon2Time: 3, Argon2Threads: 4},
+}
+
+func paramsName(p Params) string {
+	if p.Algorithm == Bcrypt {
+		return fmt.Sprintf("bcrypt/cost=%d", p.BcryptCost)
+	}
+	return fmt.Sprintf("argon2id/m=%d,t=%d,p=%d", p.Argon2Memory, p.Argon2Time, p.Argon2Threads)
+}
+
+func BenchmarkHash(b *testing.B) {
+	for _, p := range benchmarkParams {
+		b.Run(paramsName(p), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := Hash("correct horse battery staple", p)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkVerify(b *testing.B) {
+	for _, p := range benchmarkParams {
+		hash, err := Hash("correct horse battery staple", p)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(paramsName(p), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := Verify("correct horse battery staple", hash)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
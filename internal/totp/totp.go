@@ -0,0 +1,126 @@
+// Package totp implements the time-based one-time password algorithm described in RFC 6238,
+// as used by authenticator apps such as Google Authenticator. Codes are 6 digits long, use
+// HMAC-SHA1 and change every 30 seconds, which are the defaults that every app supports.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// The number of digits in each code.
+	Digits = 6
+
+	// How long each code is valid for.
+	Period = 30 * time.Second
+
+	// The number of periods either side of the current one for which we still accept codes,
+	// to allow for clock drift between the server and the user's device.
+	skew = 1
+)
+
+// Secrets are shared with the user's app as unpadded base32, which is what the otpauth URI
+// format expects.
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Generates a new random 160-bit secret, encoded as base32.
+func GenerateSecret() (string, error) {
+	b := make([]byte, 20)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return encoding.EncodeToString(b), nil
+}
+
+// Returns the time step (the number of whole periods since the Unix epoch) for t.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Returns the code for the given base32 secret at time t.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return hotp(key, uint64(Step(t)), Digits), nil
+}
+
+// Checks a code which the user has entered against the secret, accepting codes from the
+// periods either side of t as well as the current one. If the code is valid, the time step
+// that it belongs to is returned so that the caller can refuse to accept it a second time.
+func Validate(secret, code string, t time.Time) (int64, bool) {
+	key, err := decodeSecret(secret)
+	if err != nil || len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(t)
+
+	for step := current - skew; step <= current+skew; step++ {
+		want := hotp(key, uint64(step), Digits)
+		if subtle.ConstantTimeCompare([]byte(code), []byte(want)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// Returns the otpauth:// URI that authenticator apps use to add an account, either by
+// scanning it as a QR code or from a link.
+func ProvisioningURI(secret, issuer, account string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(int(Period/time.Second)))
+
+	label := url.PathEscape(issuer + ":" + account)
+
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// Decodes a base32 secret. Secrets which the user has typed in may be lowercase or contain
+// spaces, so we're lenient about both.
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	return encoding.DecodeString(strings.TrimRight(secret, "="))
+}
+
+// Implements the HOTP algorithm from RFC 4226, which TOTP builds on by using the time step
+// as the counter.
+func hotp(key []byte, counter uint64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation: the low 4 bits of the last byte pick which 4 bytes of the HMAC to
+	// use.
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
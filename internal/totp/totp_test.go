@@ -0,0 +1,83 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"snippetbox.prajjmon.net/internal/assert"
+)
+
+// The SHA-1 test vectors from appendix B of RFC 6238, which use 8-digit codes.
+func TestHOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			step := Step(time.Unix(tt.unix, 0))
+			assert.Equal(t, hotp(key, uint64(step), 8), tt.want)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+
+	code, err := Code(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(code), Digits)
+
+	tests := []struct {
+		name   string
+		code   string
+		at     time.Time
+		wantOK bool
+	}{
+		{"Current period", code, now, true},
+		{"Previous period", code, now.Add(Period), true},
+		{"Next period", code, now.Add(-Period), true},
+		{"Too old", code, now.Add(2 * Period), false},
+		{"Wrong length", code[:5], now, false},
+		{"Empty", "", now, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(secret, tt.code, tt.at)
+			assert.Equal(t, ok, tt.wantOK)
+
+			if ok {
+				assert.Equal(t, step, Step(now))
+			}
+		})
+	}
+
+	// Secrets typed in by hand may be lowercase and contain spaces.
+	_, ok := Validate(" "+strings.ToLower(secret), code, now)
+	assert.Equal(t, ok, true)
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("JBSWY3DPEHPK3PXP", "Snippetbox", "alice@example.com")
+
+	assert.Equal(t, uri, "otpauth://totp/Snippetbox:alice@example.com?algorithm=SHA1&digits=6&issuer=Snippetbox&period=30&secret=JBSWY3DPEHPK3PXP")
+}
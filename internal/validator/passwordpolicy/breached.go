@@ -0,0 +1,145 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// The number of hex digits of the SHA-1 hash which are used to look up a range of breached
+// hashes.
+const PrefixLength = 5
+
+// A list of breached passwords, stored as SHA-1 hashes.
+type BreachedList interface {
+	// Returns the remaining 35 hex digits (in uppercase) of every breached hash which
+	// starts with the given 5-digit prefix.
+	Range(prefix string) ([]string, error)
+}
+
+// A breached password list which is held in memory, keyed by hash prefix.
+type hashList map[string][]string
+
+func (l hashList) Range(prefix string) ([]string, error) {
+	return l[prefix], nil
+}
+
+// Reads a list of hashes in the Pwned Passwords format: one uppercase hex SHA-1 hash per line,
+// optionally followed by a colon and the number of times it has been seen (which we ignore).
+// Blank lines and lines starting with # are skipped.
+func ReadHashList(r io.Reader) (BreachedList, error) {
+	list := make(hashList)
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		hash, _, _ := strings.Cut(text, ":")
+		hash = strings.ToUpper(hash)
+
+		if !isSHA1Hex(hash) {
+			return nil, fmt.Errorf("passwordpolicy: line %d is not a SHA-1 hash", line)
+		}
+
+		list[hash[:PrefixLength]] = append(list[hash[:PrefixLength]], hash[PrefixLength:])
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// A breached password list stored as a directory of range files, named after each prefix
+// (e.g. "5BAA6.txt"), like the ones the Pwned Passwords downloader can produce. Each file
+// contains the suffixes for its prefix, one per line, in the same format as the Pwned
+// Passwords range API. Files are only read when they're needed, so the list can be far
+// bigger than would fit in memory.
+type rangeDir string
+
+func (d rangeDir) Range(prefix string) ([]string, error) {
+	f, err := os.Open(filepath.Join(string(d), prefix+".txt"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var suffixes []string
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		suffix, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if suffix != "" {
+			suffixes = append(suffixes, strings.ToUpper(suffix))
+		}
+	}
+
+	return suffixes, scanner.Err()
+}
+
+// Opens the breached password list at path, which is either a file of hashes (see
+// ReadHashList) or a directory of range files.
+func Open(path string) (BreachedList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return rangeDir(path), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadHashList(f)
+}
+
+//go:embed breached.txt
+var bundledHashes string
+
+var bundled = sync.OnceValues(func() (BreachedList, error) {
+	return ReadHashList(strings.NewReader(bundledHashes))
+})
+
+// Returns the small list of very common breached passwords which is built into the
+// application, for use when a bigger list hasn't been configured.
+func Bundled() BreachedList {
+	list, err := bundled()
+	if err != nil {
+		// The bundled list is checked by the tests, so this can't happen.
+		panic(err)
+	}
+	return list
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'A' || r > 'F') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,202 @@
+// Package passwordpolicy decides whether a new password is strong enough to use. It rejects
+// passwords which are too short (or too long to hash), too predictable (by a rough estimate of their entropy),
+// based on the user's own name or email address, or known to have appeared in a data breach.
+//
+// Breached passwords are looked up in the same way as the Pwned Passwords k-anonymity API: by
+// the first five hex digits of the password's SHA-1 hash, which returns the suffixes of every
+// breached hash with that prefix. The lists are local, so passwords never leave the server.
+package passwordpolicy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// The default minimum length, in characters.
+	DefaultMinLength = 8
+
+	// The default maximum length, in bytes.
+	DefaultMaxLength = 1024
+
+	// The default minimum estimated entropy, in bits. This is a little less than a random
+	// string of eight lowercase letters.
+	DefaultMinEntropy = 36
+)
+
+// The rules which new passwords have to follow. The zero value uses the default minimums and
+// maximum and doesn't check for breached passwords.
+type Policy struct {
+	MinLength  int
+	MinEntropy float64
+
+	// The longest password, in bytes, which is allowed. This depends on how passwords are
+	// hashed (see passhash.Params.MaxPasswordLength).
+	MaxLength int
+
+	// Where to look up breached passwords. If nil, no check is made.
+	Breached BreachedList
+}
+
+// Checks the password against the policy. The personal values (such as the user's name and
+// email address) are things which the password mustn't contain. It returns an empty string if
+// the password is acceptable, or otherwise a message explaining what is wrong with it. The
+// error is only non-nil if the breached password list couldn't be read.
+func (p *Policy) Check(password string, personal ...string) (string, error) {
+	minLength := p.MinLength
+	if minLength == 0 {
+		minLength = DefaultMinLength
+	}
+
+	maxLength := p.MaxLength
+	if maxLength == 0 {
+		maxLength = DefaultMaxLength
+	}
+
+	minEntropy := p.MinEntropy
+	if minEntropy == 0 {
+		minEntropy = DefaultMinEntropy
+	}
+
+	if utf8.RuneCountInString(password) < minLength {
+		return fmt.Sprintf("Password must be at least %d characters long", minLength), nil
+	}
+
+	if len(password) > maxLength {
+		return fmt.Sprintf("Password can't be longer than %d bytes", maxLength), nil
+	}
+
+	if containsPersonal(password, personal) {
+		return "Password can't contain your name or email address", nil
+	}
+
+	if Entropy(password) < minEntropy {
+		return "Password is too easy to guess. Try making it longer, or mixing in uppercase letters, numbers and symbols", nil
+	}
+
+	if p.Breached != nil {
+		breached, err := IsBreached(p.Breached, password)
+		if err != nil {
+			return "", err
+		} else if breached {
+			return "This password has appeared in a data breach, so attackers are likely to try it. Please choose a different one", nil
+		}
+	}
+
+	return "", nil
+}
+
+// Returns a rough estimate of the password's entropy in bits. Each character is worth
+// log2(N) bits, where N is the size of the alphabet made up of the classes of character
+// (lowercase, uppercase, digits, symbols and everything else) which appear in the password.
+// Characters which repeat the previous one or continue a run (like "abc" or "321") are only
+// worth one bit, as they add very little for an attacker to guess.
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < utf8.RuneSelf && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	var alphabet int
+	if lower {
+		alphabet += 26
+	}
+	if upper {
+		alphabet += 26
+	}
+	if digit {
+		alphabet += 10
+	}
+	if symbol {
+		alphabet += 33
+	}
+	if other {
+		alphabet += 100
+	}
+
+	if alphabet == 0 {
+		return 0
+	}
+
+	perChar := math.Log2(float64(alphabet))
+
+	var bits float64
+	runes := []rune(password)
+
+	for i, r := range runes {
+		repeat := i > 0 && r == runes[i-1]
+		run := i > 1 && r-runes[i-1] == runes[i-1]-runes[i-2] && (r-runes[i-1] == 1 || r-runes[i-1] == -1)
+
+		if repeat || run {
+			bits++
+		} else {
+			bits += perChar
+		}
+	}
+
+	return bits
+}
+
+// Reports whether the password contains any of the personal values (ignoring case). Names
+// are checked word by word, and email addresses by their local part, so "alice.jones" and
+// "Alice Jones" both rule out passwords containing "alice" or "jones". Very short values
+// are ignored, as they would rule out too much.
+func containsPersonal(password string, personal []string) bool {
+	password = strings.ToLower(password)
+
+	for _, value := range personal {
+		value = strings.ToLower(value)
+
+		if local, _, found := strings.Cut(value, "@"); found {
+			value = local
+		}
+
+		words := strings.FieldsFunc(value, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+
+		for _, word := range append(words, value) {
+			if utf8.RuneCountInString(word) >= 3 && strings.Contains(password, word) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Reports whether the password appears in the breached password list.
+func IsBreached(list BreachedList, password string) (bool, error) {
+	hash := sha1.Sum([]byte(password))
+	hexHash := strings.ToUpper(hex.EncodeToString(hash[:]))
+
+	suffixes, err := list.Range(hexHash[:PrefixLength])
+	if err != nil {
+		return false, err
+	}
+
+	for _, suffix := range suffixes {
+		if suffix == hexHash[PrefixLength:] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
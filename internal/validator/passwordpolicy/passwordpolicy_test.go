@@ -0,0 +1,186 @@
+package passwordpolicy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"snippetbox.prajjmon.net/internal/assert"
+)
+
+func TestCheck(t *testing.T) {
+	policy := &Policy{Breached: Bundled()}
+
+	tests := []struct {
+		name     string
+		password string
+		want     string
+	}{
+		{"Valid", "correct horse battery staple", ""},
+		{"Valid with symbols", "pa$$word", ""},
+		{"Too short", "Xk9#q", "at least 8 characters"},
+		{"Contains name", "JonesRocks!99", "can't contain your name"},
+		{"Contains email", "xx-alice.j-xx", "can't contain your name"},
+		{"Repeated characters", "aaaaaaaaaaaa", "too easy to guess"},
+		{"Sequence", "abcdefghijkl", "too easy to guess"},
+		{"Breached", "password1", "data breach"},
+		{"Breached with capitals", "Password123", "data breach"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policy.Check(tt.password, "Alice Jones", "alice.j@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.want == "" {
+				assert.Equal(t, got, "")
+			} else {
+				assert.StringContains(t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckMinimums(t *testing.T) {
+	policy := &Policy{MinLength: 12, MinEntropy: 60}
+
+	got, err := policy.Check("Xk9#qLm2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, got, "Password must be at least 12 characters long")
+
+	got, err = policy.Check("xkqlmzwpvrtb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.StringContains(t, got, "too easy to guess")
+
+	policy = &Policy{MaxLength: 72}
+
+	got, err = policy.Check(strings.Repeat("Xk9#qLm2", 9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, got, "")
+
+	// The maximum is in bytes, so multibyte characters count for more.
+	got, err = policy.Check(strings.Repeat("Xk9#qLm2", 9)[:71] + "é")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, got, "Password can't be longer than 72 bytes")
+
+	got, err = (&Policy{}).Check(strings.Repeat("Xk9#qLm2", 128) + "!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, got, "Password can't be longer than 1024 bytes")
+
+	// Without a breached list, breached passwords are only caught by the other rules.
+	got, err = (&Policy{}).Check("password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, got, "")
+}
+
+func TestEntropy(t *testing.T) {
+	tests := []struct {
+		password string
+		min, max float64
+	}{
+		{"", 0, 0},
+		{"xkqlmzwp", 37, 38},    // 8*log2(26)
+		{"Tr0ub4dor&3", 72, 73}, // 11*log2(95)
+		{"aaaaaaaa", 11, 12},    // log2(26) + 7
+		{"12345678", 12, 13},    // 2*log2(10) + 6
+		{"zyxwvuts", 15, 16},    // 2*log2(26) + 6
+		{"acegikmo", 37, 38},    // steps of two aren't runs
+		{"ééé", 8, 9},           // log2(100) + 2
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			got := Entropy(tt.password)
+			if got < tt.min || got > tt.max {
+				t.Errorf("got %.2f; want between %.2f and %.2f", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestBundled(t *testing.T) {
+	list := Bundled()
+
+	for _, password := range []string{"123456", "password", "qwerty123", "P@ssw0rd"} {
+		breached, err := IsBreached(list, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, breached, true)
+	}
+
+	breached, err := IsBreached(list, "correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, breached, false)
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+
+	// SHA-1("password") is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8.
+	file := filepath.Join(dir, "hashes.txt")
+	err := os.WriteFile(file, []byte("# comment\n\n5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8:9659365\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ranges := filepath.Join(dir, "ranges")
+	err = os.Mkdir(ranges, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(ranges, "5BAA6.txt"), []byte("003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9659365\r\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{file, ranges} {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			list, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			breached, err := IsBreached(list, "password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, breached, true)
+
+			// A prefix without a range file is fine, and just means nothing matches.
+			breached, err = IsBreached(list, "123456")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, breached, false)
+		})
+	}
+
+	t.Run("Invalid file", func(t *testing.T) {
+		_, err := ReadHashList(strings.NewReader("5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8\nnot a hash\n"))
+		assert.StringContains(t, err.Error(), "line 2")
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		_, err := Open(filepath.Join(dir, "missing.txt"))
+		assert.Equal(t, err != nil, true)
+	})
+}